@@ -1,9 +1,11 @@
 package main
 
 import (
-	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/cecobask/imdb-trakt-sync/pkg/cmd"
+	"os"
+	_ "time/tzdata" // embeds the time zone database for TZ on systems without one
 )
 
 func main() {
-	syncer.NewSyncer().Run()
+	os.Exit(cmd.Execute())
 }
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	airtablePathBase  = "https://api.airtable.com/v0"
+	airtablePathTable = "/%s/%s"
+
+	// airtable allows 5 requests per second to a base, and makes clients wait 30 seconds once they send more
+	airtableRequestInterval = 200 * time.Millisecond
+	airtableRetryAfter      = 30 * time.Second
+	airtableMaxRetries      = 5
+	airtableBatchSize       = 10
+	airtablePageSize        = 100
+)
+
+type AirtableClientInterface interface {
+	RecordsGet() ([]entities.AirtableRecord, error)
+	RecordsCreate(target string, records []entities.AirtableRecord) error
+	RecordsUpdate(target string, records []entities.AirtableRecord) error
+	RecordsDelete(target string, records []entities.AirtableRecord) error
+}
+
+// AirtableClient keeps the records of an airtable table, authenticating with a personal access token.
+// Requests are spaced out to stay within the rate limit of the base, which is shared by every client of the base.
+type AirtableClient struct {
+	client      *http.Client
+	config      AirtableConfig
+	logger      *zap.Logger
+	mutex       sync.Mutex
+	lastRequest time.Time
+}
+
+type AirtableConfig struct {
+	BaseUrl           string // defaults to the airtable api
+	Token             string
+	BaseId            string
+	Table             string // the name or id of the table
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type airtableListResponse struct {
+	Records []entities.AirtableRecord `json:"records"`
+	Offset  string                    `json:"offset"`
+}
+
+type airtableErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewAirtableClient(config AirtableConfig, logger *zap.Logger) (AirtableClientInterface, error) {
+	if config.BaseUrl == "" {
+		config.BaseUrl = airtablePathBase
+	}
+	client := &AirtableClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+	query := url.Values{"pageSize": {"1"}}
+	if err := client.decode(http.MethodGet, client.tablePath(query), nil, nil); err != nil {
+		return nil, &AuthError{
+			clientName: clientNameAirtable,
+			err:        fmt.Errorf("failure fetching airtable table %s of base %s, make sure the token has access to the base: %w", config.Table, config.BaseId, err),
+		}
+	}
+	return client, nil
+}
+
+func (ac *AirtableClient) tablePath(query url.Values) string {
+	path := fmt.Sprintf(airtablePathTable, url.PathEscape(ac.config.BaseId), url.PathEscape(ac.config.Table))
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
+
+// wait spaces out the requests so they stay within the rate limit of the base
+func (ac *AirtableClient) wait() {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	if elapsed := time.Since(ac.lastRequest); elapsed < airtableRequestInterval {
+		time.Sleep(airtableRequestInterval - elapsed)
+	}
+	ac.lastRequest = time.Now()
+}
+
+func (ac *AirtableClient) doRequest(method, endpoint string, body interface{}) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failure marshalling airtable request body: %w", err)
+		}
+	}
+	for retries := 0; retries < airtableMaxRetries; retries++ {
+		ac.wait()
+		request, err := http.NewRequest(method, ac.config.BaseUrl+endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+		}
+		request.Header.Set("Authorization", "Bearer "+ac.config.Token)
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		start := time.Now()
+		response, err := ac.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+		}
+		traceRequest(ac.logger, clientNameAirtable, request, response.StatusCode, start)
+		switch {
+		case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices:
+			return response, nil
+		case response.StatusCode == http.StatusTooManyRequests:
+			response.Body.Close()
+			ac.logger.Warn(fmt.Sprintf("airtable rate limit reached, waiting for %s then retrying http request %s %s", airtableRetryAfter, method, endpoint))
+			metrics.RecordRateLimit(clientNameAirtable, true)
+			recordRetryTelemetry(clientNameAirtable, request, airtableRetryAfter)
+			time.Sleep(airtableRetryAfter)
+		default:
+			defer response.Body.Close()
+			details := fmt.Sprintf("unexpected status code %d", response.StatusCode)
+			var airtableError airtableErrorResponse
+			if json.NewDecoder(response.Body).Decode(&airtableError) == nil && airtableError.Error.Message != "" {
+				details = fmt.Sprintf("%s: %s", airtableError.Error.Type, airtableError.Error.Message)
+			}
+			return nil, &ApiError{
+				httpMethod: method,
+				url:        request.URL.String(),
+				StatusCode: response.StatusCode,
+				details:    details,
+			}
+		}
+	}
+	return nil, &ApiError{
+		httpMethod: method,
+		url:        ac.config.BaseUrl + endpoint,
+		StatusCode: http.StatusTooManyRequests,
+		details:    "reached max retry attempts",
+	}
+}
+
+func (ac *AirtableClient) decode(method, endpoint string, body, value interface{}) error {
+	response, err := ac.doRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if value == nil {
+		return nil
+	}
+	if err = json.NewDecoder(response.Body).Decode(value); err != nil {
+		return fmt.Errorf("failure unmarshalling airtable response: %w", err)
+	}
+	return nil
+}
+
+func (ac *AirtableClient) syncMode(target string) string {
+	return targetSyncMode(ac.config.SyncMode, ac.config.SyncModeOverrides, target)
+}
+
+// RecordsGet returns every record of the table, following the offset of every page
+func (ac *AirtableClient) RecordsGet() ([]entities.AirtableRecord, error) {
+	var records []entities.AirtableRecord
+	query := url.Values{"pageSize": {fmt.Sprint(airtablePageSize)}}
+	for {
+		var response airtableListResponse
+		if err := ac.decode(http.MethodGet, ac.tablePath(query), nil, &response); err != nil {
+			return nil, fmt.Errorf("failure fetching airtable records: %w", err)
+		}
+		records = append(records, response.Records...)
+		if response.Offset == "" {
+			return records, nil
+		}
+		query.Set("offset", response.Offset)
+	}
+}
+
+// RecordsCreate adds the records, letting airtable convert the values to the types of the fields
+func (ac *AirtableClient) RecordsCreate(target string, records []entities.AirtableRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if mode := ac.syncMode(target); !syncModeAllowsAdd(mode) {
+		ac.logger.Info(fmt.Sprintf("sync mode %s would have added %d airtable %s record(s)", mode, len(records), target))
+		return nil
+	}
+	return ac.sendBatches(http.MethodPost, records, "adding")
+}
+
+// RecordsUpdate sets the fields of the records, leaving the other fields alone
+func (ac *AirtableClient) RecordsUpdate(target string, records []entities.AirtableRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if mode := ac.syncMode(target); !syncModeAllowsAdd(mode) {
+		ac.logger.Info(fmt.Sprintf("sync mode %s would have updated %d airtable %s record(s)", mode, len(records), target))
+		return nil
+	}
+	return ac.sendBatches(http.MethodPatch, records, "updating")
+}
+
+func (ac *AirtableClient) sendBatches(method string, records []entities.AirtableRecord, action string) error {
+	for start := 0; start < len(records); start += airtableBatchSize {
+		end := start + airtableBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		body := map[string]interface{}{
+			"records":  records[start:end],
+			"typecast": true,
+		}
+		if err := ac.decode(method, ac.tablePath(nil), body, nil); err != nil {
+			return fmt.Errorf("failure %s airtable records: %w", action, err)
+		}
+	}
+	return nil
+}
+
+// RecordsDelete removes the records from the table
+func (ac *AirtableClient) RecordsDelete(target string, records []entities.AirtableRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if mode := ac.syncMode(target); !syncModeAllowsRemove(mode) {
+		ac.logger.Info(fmt.Sprintf("sync mode %s would have removed %d airtable %s record(s)", mode, len(records), target))
+		return nil
+	}
+	for start := 0; start < len(records); start += airtableBatchSize {
+		end := start + airtableBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		query := url.Values{}
+		for _, record := range records[start:end] {
+			query.Add("records[]", record.Id)
+		}
+		if err := ac.decode(http.MethodDelete, ac.tablePath(query), nil, nil); err != nil {
+			return fmt.Errorf("failure removing airtable records: %w", err)
+		}
+	}
+	return nil
+}
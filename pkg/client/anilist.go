@@ -0,0 +1,286 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	aniListPathBase          = "https://graphql.anilist.co"
+	aniListDefaultRetryAfter = 60 * time.Second
+	aniListMaxRetries        = 5
+	aniListChunkSize         = 500
+
+	aniListQueryViewer = `query { Viewer { id } }`
+	aniListQueryList   = `query ($userId: Int, $chunk: Int, $perChunk: Int) {
+  MediaListCollection(userId: $userId, type: ANIME, chunk: $chunk, perChunk: $perChunk) {
+    hasNextChunk
+    lists { entries { id mediaId status score(format: POINT_100) updatedAt } }
+  }
+}`
+	aniListMutationSave = `mutation ($mediaId: Int, $status: MediaListStatus, $scoreRaw: Int) {
+  SaveMediaListEntry(mediaId: $mediaId, status: $status, scoreRaw: $scoreRaw) { id }
+}`
+	aniListMutationDelete = `mutation ($id: Int) { DeleteMediaListEntry(id: $id) { deleted } }`
+)
+
+type AniListClientInterface interface {
+	EntriesGet() ([]entities.AniListEntry, error)
+	EntriesSave(target string, entries []entities.AniListEntry) error
+	EntriesUnscore(entries []entities.AniListEntry) error
+	EntriesDelete(target string, entries []entities.AniListEntry) error
+}
+
+// AniListClient reads and updates the anime list of an anilist user through the anilist graphql api,
+// authenticating with the access token of an anilist application
+type AniListClient struct {
+	client *http.Client
+	config AniListConfig
+	logger *zap.Logger
+	userId int
+}
+
+type AniListConfig struct {
+	BaseUrl           string // defaults to the anilist graphql api
+	AccessToken       string
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type aniListRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type aniListResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type aniListViewerData struct {
+	Viewer struct {
+		Id int `json:"id"`
+	} `json:"Viewer"`
+}
+
+type aniListListData struct {
+	MediaListCollection struct {
+		HasNextChunk bool `json:"hasNextChunk"`
+		Lists        []struct {
+			Entries []struct {
+				Id        int    `json:"id"`
+				MediaId   int    `json:"mediaId"`
+				Status    string `json:"status"`
+				Score     int    `json:"score"`
+				UpdatedAt int64  `json:"updatedAt"`
+			} `json:"entries"`
+		} `json:"lists"`
+	} `json:"MediaListCollection"`
+}
+
+func NewAniListClient(config AniListConfig, logger *zap.Logger) (AniListClientInterface, error) {
+	if config.BaseUrl == "" {
+		config.BaseUrl = aniListPathBase
+	}
+	client := &AniListClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+	var viewer aniListViewerData
+	if err := client.doQuery(aniListQueryViewer, nil, &viewer); err != nil {
+		return nil, &AuthError{
+			clientName: clientNameAniList,
+			err:        fmt.Errorf("failure fetching the anilist user, the access token may have expired: %w", err),
+		}
+	}
+	client.userId = viewer.Viewer.Id
+	return client, nil
+}
+
+// doQuery runs a graphql query or mutation, decoding its data into result when it is not nil.
+// Anilist reports failures as a list of errors, sometimes alongside a successful status code.
+func (ac *AniListClient) doQuery(query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(aniListRequest{
+		Query:     query,
+		Variables: variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failure marshalling anilist request: %w", err)
+	}
+	for retries := 0; retries < aniListMaxRetries; retries++ {
+		request, err := http.NewRequest(http.MethodPost, ac.config.BaseUrl, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("error creating http request %s %s: %w", http.MethodPost, ac.config.BaseUrl, err)
+		}
+		request.Header.Set("Authorization", "Bearer "+ac.config.AccessToken)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Accept", "application/json")
+		start := time.Now()
+		response, err := ac.client.Do(request)
+		if err != nil {
+			return fmt.Errorf("error sending http request %s %s: %w", http.MethodPost, ac.config.BaseUrl, err)
+		}
+		traceRequest(ac.logger, clientNameAniList, request, response.StatusCode, start)
+		if response.StatusCode == http.StatusTooManyRequests {
+			response.Body.Close()
+			duration := aniListDefaultRetryAfter
+			if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+				duration = time.Duration(seconds) * time.Second
+			}
+			ac.logger.Warn(fmt.Sprintf("anilist rate limit reached, waiting for %s then retrying http request %s %s", duration, http.MethodPost, request.URL.Path))
+			metrics.RecordRateLimit(clientNameAniList, true)
+			recordRetryTelemetry(clientNameAniList, request, duration)
+			time.Sleep(duration)
+			continue
+		}
+		var decoded aniListResponse
+		decodeErr := json.NewDecoder(response.Body).Decode(&decoded)
+		response.Body.Close()
+		if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices || len(decoded.Errors) > 0 {
+			details := fmt.Sprintf("unexpected status code %d", response.StatusCode)
+			if len(decoded.Errors) > 0 {
+				messages := make([]string, 0, len(decoded.Errors))
+				for _, graphqlError := range decoded.Errors {
+					messages = append(messages, graphqlError.Message)
+				}
+				details = strings.Join(messages, "; ")
+			}
+			return &ApiError{
+				httpMethod: http.MethodPost,
+				url:        request.URL.String(),
+				StatusCode: response.StatusCode,
+				details:    details,
+			}
+		}
+		if decodeErr != nil {
+			return fmt.Errorf("failure unmarshalling anilist response: %w", decodeErr)
+		}
+		if result == nil {
+			return nil
+		}
+		if err = json.Unmarshal(decoded.Data, result); err != nil {
+			return fmt.Errorf("failure unmarshalling anilist response data: %w", err)
+		}
+		return nil
+	}
+	return &ApiError{
+		httpMethod: http.MethodPost,
+		url:        ac.config.BaseUrl,
+		StatusCode: http.StatusTooManyRequests,
+		details:    "reached max retry attempts",
+	}
+}
+
+// EntriesGet returns the anime of the list of the user, fetched in chunks as anilist limits the size of a response
+func (ac *AniListClient) EntriesGet() ([]entities.AniListEntry, error) {
+	var entries []entities.AniListEntry
+	for chunk := 1; ; chunk++ {
+		var list aniListListData
+		variables := map[string]interface{}{
+			"userId":   ac.userId,
+			"chunk":    chunk,
+			"perChunk": aniListChunkSize,
+		}
+		if err := ac.doQuery(aniListQueryList, variables, &list); err != nil {
+			return nil, fmt.Errorf("failure fetching anilist anime list: %w", err)
+		}
+		for _, statusList := range list.MediaListCollection.Lists {
+			for _, entry := range statusList.Entries {
+				aniListEntry := entities.AniListEntry{
+					Id:      entry.Id,
+					MediaId: entry.MediaId,
+					Status:  entry.Status,
+					// the score is fetched out of 100 whatever the scoring system of the user is
+					Score: (entry.Score + 5) / 10,
+				}
+				if entry.UpdatedAt > 0 {
+					updatedAt := time.Unix(entry.UpdatedAt, 0).UTC()
+					aniListEntry.UpdatedAt = &updatedAt
+				}
+				entries = append(entries, aniListEntry)
+			}
+		}
+		if !list.MediaListCollection.HasNextChunk {
+			return entries, nil
+		}
+	}
+}
+
+// EntriesSave adds the anime to the list of the user or updates them, setting the status and score of the entries that have one
+func (ac *AniListClient) EntriesSave(target string, entries []entities.AniListEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if mode := targetSyncMode(ac.config.SyncMode, ac.config.SyncModeOverrides, target); !syncModeAllowsAdd(mode) {
+		ac.logger.Info(fmt.Sprintf("sync mode %s would have saved %d anilist %s entries", mode, len(entries), target))
+		return nil
+	}
+	for _, entry := range entries {
+		variables := map[string]interface{}{
+			"mediaId": entry.MediaId,
+		}
+		if entry.Status != "" {
+			variables["status"] = entry.Status
+		}
+		if entry.Score > 0 {
+			variables["scoreRaw"] = entry.Score * 10
+		}
+		if err := ac.doQuery(aniListMutationSave, variables, nil); err != nil {
+			return fmt.Errorf("failure saving anilist entry of anime %d: %w", entry.MediaId, err)
+		}
+	}
+	return nil
+}
+
+// EntriesUnscore clears the scores of the anime, leaving them on the list of the user
+func (ac *AniListClient) EntriesUnscore(entries []entities.AniListEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if mode := targetSyncMode(ac.config.SyncMode, ac.config.SyncModeOverrides, entities.SyncTargetRatings); !syncModeAllowsRemove(mode) {
+		ac.logger.Info(fmt.Sprintf("sync mode %s would have removed the scores of %d anilist anime", mode, len(entries)))
+		return nil
+	}
+	for _, entry := range entries {
+		// anilist treats a score of 0 as no score
+		variables := map[string]interface{}{
+			"mediaId":  entry.MediaId,
+			"scoreRaw": 0,
+		}
+		if err := ac.doQuery(aniListMutationSave, variables, nil); err != nil {
+			return fmt.Errorf("failure removing the score of anilist anime %d: %w", entry.MediaId, err)
+		}
+	}
+	return nil
+}
+
+// EntriesDelete removes the anime from the list of the user
+func (ac *AniListClient) EntriesDelete(target string, entries []entities.AniListEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if mode := targetSyncMode(ac.config.SyncMode, ac.config.SyncModeOverrides, target); !syncModeAllowsRemove(mode) {
+		ac.logger.Info(fmt.Sprintf("sync mode %s would have removed %d anilist %s entries", mode, len(entries), target))
+		return nil
+	}
+	for _, entry := range entries {
+		variables := map[string]interface{}{
+			"id": entry.Id,
+		}
+		if err := ac.doQuery(aniListMutationDelete, variables, nil); err != nil {
+			return fmt.Errorf("failure removing anilist entry of anime %d: %w", entry.MediaId, err)
+		}
+	}
+	return nil
+}
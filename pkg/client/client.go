@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"github.com/cecobask/imdb-trakt-sync/pkg/tracing"
+	"go.uber.org/zap"
 	"io"
+	"net/http"
+	"time"
 )
 
 type ImdbClientInterface interface {
@@ -16,6 +21,7 @@ type ImdbClientInterface interface {
 	RatingsGet() ([]entities.ImdbItem, error)
 	UserIdScrape() error
 	WatchlistIdScrape() error
+	InvalidRows() []entities.ItemFailure
 }
 
 type TraktClientInterface interface {
@@ -26,6 +32,8 @@ type TraktClientInterface interface {
 	ActivateAuthorize(authenticityToken string) error
 	GetAccessToken(deviceCode string) (*entities.TraktAuthTokensResponse, error)
 	GetAuthCodes() (*entities.TraktAuthCodesResponse, error)
+	RefreshAccessToken(refreshToken string) (*entities.TraktAuthTokensResponse, error)
+	UserSettingsGet() (*entities.TraktUserSettings, error)
 	WatchlistGet() (*entities.TraktList, error)
 	WatchlistItemsAdd(items entities.TraktItems) error
 	WatchlistItemsRemove(items entities.TraktItems) error
@@ -33,8 +41,9 @@ type TraktClientInterface interface {
 	ListsGet(ids []entities.TraktIds) ([]entities.TraktList, error)
 	ListItemsAdd(listId string, items entities.TraktItems) error
 	ListItemsRemove(listId string, items entities.TraktItems) error
+	ListItemsReorder(listId string, rank []int64) error
 	ListsMetadataGet() ([]entities.TraktList, error)
-	ListAdd(listId, listName string) error
+	ListAdd(listId, listName, description, sortBy, sortHow string) error
 	ListRemove(listId string) error
 	RatingsGet() (entities.TraktItems, error)
 	RatingsAdd(items entities.TraktItems) error
@@ -42,11 +51,34 @@ type TraktClientInterface interface {
 	HistoryGet(itemType, itemId string) (entities.TraktItems, error)
 	HistoryAdd(items entities.TraktItems) error
 	HistoryRemove(items entities.TraktItems) error
+	MetadataGet(imdbId string) (*entities.TraktMetadata, error)
+	SearchTitle(itemType, title string, year int) (*entities.TraktIds, error)
+	SearchTitles(itemType, title string, year int) ([]entities.TraktSearchResult, error)
+	SearchTmdbId(itemType string, tmdbId int) (*entities.TraktIds, error)
+	SearchTvdbId(itemType string, tvdbId int) (*entities.TraktIds, error)
+	ShowEpisodesGet(showId string) ([]entities.TraktShowEpisode, error)
+	CommentAdd(comment entities.TraktComment) (bool, error)
+	CollectionGet() (entities.TraktItems, error)
+	WatchedGet() (entities.TraktItems, error)
+	SyncMode(target string) string
 }
 
 const (
-	clientNameImdb  = "imdb"
-	clientNameTrakt = "trakt"
+	clientNameAirtable     = "airtable"
+	clientNameAniList      = "anilist"
+	clientNameDouban       = "douban"
+	clientNameEmby         = "emby"
+	clientNameGoogleSheets = "sheets"
+	clientNameImdb         = "imdb"
+	clientNameJellyfin     = "jellyfin"
+	clientNameKodi         = "kodi"
+	clientNameMal          = "mal"
+	clientNameNotion       = "notion"
+	clientNamePlex         = "plex"
+	clientNameSimkl        = "simkl"
+	clientNameStremio      = "stremio"
+	clientNameTmdb         = "tmdb"
+	clientNameTrakt        = "trakt"
 )
 
 type requestFields struct {
@@ -94,3 +126,28 @@ func scrapeSelectionAttribute(body io.ReadCloser, clientName, selector, attribut
 	}
 	return &value, nil
 }
+
+// newSemaphore bounds the number of goroutines running at once, treating a non-positive limit as unbounded
+func newSemaphore(limit, size int) chan struct{} {
+	if limit < 1 {
+		limit = size
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return make(chan struct{}, limit)
+}
+
+// traceRequest counts an http request, records its span and telemetry and logs its outcome at debug level, leaving out headers and bodies as they hold credentials
+func traceRequest(logger *zap.Logger, clientName string, request *http.Request, statusCode int, start time.Time) {
+	metrics.RecordRequest(clientName, statusCode)
+	recordRequestTelemetry(clientName, request, time.Since(start))
+	tracing.RecordRequest(clientName, request.Method, request.URL.String(), statusCode, start)
+	logger.Debug(
+		fmt.Sprintf("%s http request", clientName),
+		zap.String("method", request.Method),
+		zap.String("url", request.URL.String()),
+		zap.Int("status", statusCode),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	doubanPathBase        = "https://movie.douban.com"
+	doubanPathSubject     = "/subject/%s/"
+	doubanUserAgent       = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	doubanRequestInterval = 2 * time.Second
+	doubanRetryAfter      = 30 * time.Second
+	doubanMaxRetries      = 3
+)
+
+var doubanImdbIdPattern = regexp.MustCompile(`IMDb:\s*(tt\d+)`)
+
+type DoubanClientInterface interface {
+	SubjectGet(id string) (*entities.DoubanSubject, error)
+}
+
+// DoubanClient reads the pages of douban movies and shows, which need no account. Douban blocks clients that request pages
+// in quick succession, so requests are paced.
+type DoubanClient struct {
+	client      *http.Client
+	config      DoubanConfig
+	logger      *zap.Logger
+	mutex       sync.Mutex
+	lastRequest time.Time
+}
+
+type DoubanConfig struct {
+	BaseUrl  string        // defaults to the douban movie website
+	Interval time.Duration // the minimum time between requests, which defaults to 2 seconds
+}
+
+func NewDoubanClient(config DoubanConfig, logger *zap.Logger) DoubanClientInterface {
+	if config.BaseUrl == "" {
+		config.BaseUrl = doubanPathBase
+	}
+	if config.Interval == 0 {
+		config.Interval = doubanRequestInterval
+	}
+	return &DoubanClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+}
+
+// SubjectGet returns the imdb id listed on the page of a movie or show, which is a show when the page lists its episodes.
+// It returns nil when douban has no such subject.
+func (dc *DoubanClient) SubjectGet(id string) (*entities.DoubanSubject, error) {
+	endpoint := dc.config.BaseUrl + fmt.Sprintf(doubanPathSubject, id)
+	for retries := 0; retries < doubanMaxRetries; retries++ {
+		dc.pace()
+		request, err := http.NewRequest(http.MethodGet, endpoint, http.NoBody)
+		if err != nil {
+			return nil, fmt.Errorf("error creating http request %s %s: %w", http.MethodGet, endpoint, err)
+		}
+		request.Header.Set("User-Agent", doubanUserAgent)
+		start := time.Now()
+		response, err := dc.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error sending http request %s %s: %w", http.MethodGet, endpoint, err)
+		}
+		traceRequest(dc.logger, clientNameDouban, request, response.StatusCode, start)
+		switch {
+		case response.StatusCode == http.StatusOK:
+			defer response.Body.Close()
+			document, err := goquery.NewDocumentFromReader(response.Body)
+			if err != nil {
+				return nil, fmt.Errorf("failure creating goquery document from %s response: %w", clientNameDouban, err)
+			}
+			info := document.Find("#info").Text()
+			subject := &entities.DoubanSubject{
+				Id:     id,
+				IsShow: strings.Contains(info, "集数:"),
+			}
+			if match := doubanImdbIdPattern.FindStringSubmatch(info); match != nil {
+				subject.ImdbId = match[1]
+			}
+			return subject, nil
+		case response.StatusCode == http.StatusNotFound:
+			response.Body.Close()
+			return nil, nil
+		case response.StatusCode == http.StatusTooManyRequests:
+			response.Body.Close()
+			dc.logger.Warn(fmt.Sprintf("douban rate limit reached, waiting for %s then retrying http request %s %s", doubanRetryAfter, http.MethodGet, request.URL.Path))
+			metrics.RecordRateLimit(clientNameDouban, true)
+			recordRetryTelemetry(clientNameDouban, request, doubanRetryAfter)
+			time.Sleep(doubanRetryAfter)
+		default:
+			response.Body.Close()
+			return nil, &ApiError{
+				httpMethod: http.MethodGet,
+				url:        request.URL.String(),
+				StatusCode: response.StatusCode,
+				details:    fmt.Sprintf("unexpected status code %d", response.StatusCode),
+			}
+		}
+	}
+	return nil, &ApiError{
+		httpMethod: http.MethodGet,
+		url:        endpoint,
+		StatusCode: http.StatusTooManyRequests,
+		details:    "reached max retry attempts",
+	}
+}
+
+// pace waits until the interval since the last request has passed
+func (dc *DoubanClient) pace() {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+	if wait := dc.config.Interval - time.Since(dc.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	dc.lastRequest = time.Now()
+}
@@ -1,9 +1,32 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 )
 
+// ErrSyncModeSkipped is returned instead of making a change the sync mode of its target forbids, such as any change in dry-run
+var ErrSyncModeSkipped = errors.New("skipped by the sync mode")
+
+// SyncModeSkippedError is returned instead of making a change the sync mode of its target forbids, along with that sync mode.
+// It matches ErrSyncModeSkipped.
+type SyncModeSkippedError struct {
+	Mode string
+}
+
+func (e *SyncModeSkippedError) Error() string {
+	return fmt.Sprintf("%s %s", ErrSyncModeSkipped, e.Mode)
+}
+
+func (e *SyncModeSkippedError) Is(target error) bool {
+	return target == ErrSyncModeSkipped
+}
+
 type ApiError struct {
 	httpMethod string
 	url        string
@@ -14,3 +37,58 @@ type ApiError struct {
 func (e *ApiError) Error() string {
 	return fmt.Sprintf("http request %s %s returned status code %d: %s", e.httpMethod, e.url, e.StatusCode, e.details)
 }
+
+type AuthError struct {
+	clientName string
+	err        error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("%s authentication failure: %s", e.clientName, e.err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.err
+}
+
+// ClientName returns the name of the client that failed to authenticate
+func (e *AuthError) ClientName() string {
+	return e.clientName
+}
+
+type ItemsNotFoundError struct {
+	target   string
+	NotFound entities.TraktListBody
+}
+
+func (e *ItemsNotFoundError) Error() string {
+	return fmt.Sprintf("trakt could not find %d item(s) while syncing %s", e.NotFound.Count(), e.target)
+}
+
+// ListsFetchError is returned alongside the lists that were fetched successfully when some of the lists failed
+type ListsFetchError struct {
+	Failed map[string]error
+}
+
+func (e *ListsFetchError) Error() string {
+	listIds := make([]string, 0, len(e.Failed))
+	for listId := range e.Failed {
+		listIds = append(listIds, listId)
+	}
+	sort.Strings(listIds)
+	messages := make([]string, 0, len(listIds))
+	for _, listId := range listIds {
+		messages = append(messages, fmt.Sprintf("%s: %s", listId, e.Failed[listId]))
+	}
+	return fmt.Sprintf("failure fetching %d imdb list(s): %s", len(e.Failed), strings.Join(messages, "; "))
+}
+
+// IsTransientError reports whether an error is likely to go away when the request is retried later
+func IsTransientError(err error) bool {
+	var apiError *ApiError
+	if errors.As(err, &apiError) {
+		return apiError.StatusCode == http.StatusTooManyRequests || apiError.StatusCode >= http.StatusInternalServerError
+	}
+	var urlError *url.Error
+	return errors.As(err, &urlError)
+}
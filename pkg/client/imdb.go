@@ -11,7 +11,6 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,9 +32,11 @@ const (
 )
 
 type ImdbClient struct {
-	client *http.Client
-	config ImdbConfig
-	logger *zap.Logger
+	client      *http.Client
+	config      ImdbConfig
+	logger      *zap.Logger
+	mutex       sync.Mutex
+	invalidRows []entities.ItemFailure
 }
 
 type ImdbConfig struct {
@@ -43,6 +44,7 @@ type ImdbConfig struct {
 	CookieUbidMain string
 	UserId         string
 	WatchlistId    string
+	Concurrency    int
 }
 
 func NewImdbClient(config ImdbConfig, logger *zap.Logger) (ImdbClientInterface, error) {
@@ -58,7 +60,10 @@ func NewImdbClient(config ImdbConfig, logger *zap.Logger) (ImdbClientInterface,
 		logger: logger,
 	}
 	if err = client.hydrate(); err != nil {
-		return nil, fmt.Errorf("failure hydrating imdb client: %w", err)
+		return nil, &AuthError{
+			clientName: clientNameImdb,
+			err:        fmt.Errorf("failure hydrating imdb client: %w", err),
+		}
 	}
 	return client, nil
 }
@@ -100,10 +105,12 @@ func (c *ImdbClient) doRequest(requestFields requestFields) (*http.Response, err
 	if err != nil {
 		return nil, fmt.Errorf("failure creating http request %s %s: %w", requestFields.Method, requestFields.BasePath+requestFields.Endpoint, err)
 	}
+	start := time.Now()
 	response, err := c.client.Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("failure sending http request %s %s: %w", request.Method, request.URL, err)
 	}
+	traceRequest(c.logger, clientNameImdb, request, response.StatusCode, start)
 	switch response.StatusCode {
 	case http.StatusOK:
 		return response, nil
@@ -146,7 +153,9 @@ func (c *ImdbClient) ListGet(listId string) (*entities.ImdbList, error) {
 			details:    fmt.Sprintf("list with id %s could not be found", listId),
 		}
 	}
-	return readImdbListResponse(response, listId)
+	list, invalidRows, err := readImdbListResponse(response, listId)
+	c.recordInvalidRows(invalidRows)
+	return list, err
 }
 
 func (c *ImdbClient) WatchlistGet() (*entities.ImdbList, error) {
@@ -187,44 +196,43 @@ func (c *ImdbClient) ListsGetAll() ([]entities.ImdbList, error) {
 
 func (c *ImdbClient) ListsGet(listIds []string) ([]entities.ImdbList, error) {
 	var (
-		outChan  = make(chan entities.ImdbList, len(listIds))
-		errChan  = make(chan error, 1)
-		doneChan = make(chan struct{})
-		lists    = make([]entities.ImdbList, 0, len(listIds))
+		mutex     = new(sync.Mutex)
+		waitGroup = new(sync.WaitGroup)
+		lists     = make([]entities.ImdbList, 0, len(listIds))
+		failed    = make(map[string]error)
+		semaphore = newSemaphore(c.config.Concurrency, len(listIds))
 	)
-	go func() {
-		waitGroup := new(sync.WaitGroup)
-		for _, listId := range listIds {
-			waitGroup.Add(1)
-			go func(id string) {
-				defer waitGroup.Done()
-				imdbList, err := c.ListGet(id)
-				if err != nil {
-					var apiError *ApiError
-					if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
-						c.logger.Debug("silencing not found error while fetching imdb lists", zap.Error(apiError))
-						return
-					}
-					errChan <- fmt.Errorf("unexpected error while fetching imdb lists: %w", err)
+	for _, listId := range listIds {
+		waitGroup.Add(1)
+		semaphore <- struct{}{}
+		go func(id string) {
+			defer func() {
+				<-semaphore
+				waitGroup.Done()
+			}()
+			imdbList, err := c.ListGet(id)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				var apiError *ApiError
+				if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
+					c.logger.Debug("silencing not found error while fetching imdb lists", zap.Error(apiError))
 					return
 				}
-				imdbList.TraktListSlug = buildTraktListName(imdbList.ListName)
-				outChan <- *imdbList
-			}(listId)
-		}
-		waitGroup.Wait()
-		close(doneChan)
-	}()
-	for {
-		select {
-		case list := <-outChan:
-			lists = append(lists, list)
-		case err := <-errChan:
-			return nil, err
-		case <-doneChan:
-			return lists, nil
+				failed[id] = err
+				return
+			}
+			imdbList.TraktListSlug = entities.BuildTraktListSlug(imdbList.ListName)
+			lists = append(lists, *imdbList)
+		}(listId)
+	}
+	waitGroup.Wait()
+	if len(failed) > 0 {
+		return lists, &ListsFetchError{
+			Failed: failed,
 		}
 	}
+	return lists, nil
 }
 
 func (c *ImdbClient) UserIdScrape() error {
@@ -273,77 +281,138 @@ func (c *ImdbClient) RatingsGet() ([]entities.ImdbItem, error) {
 	if err != nil {
 		return nil, err
 	}
-	return readImdbRatingsResponse(response)
+	ratings, invalidRows, err := readImdbRatingsResponse(response)
+	c.recordInvalidRows(invalidRows)
+	return ratings, err
+}
+
+// InvalidRows returns the rows of the imdb exports that could not be parsed since the client was created
+func (c *ImdbClient) InvalidRows() []entities.ItemFailure {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]entities.ItemFailure(nil), c.invalidRows...)
 }
 
-func readImdbListResponse(response *http.Response, listId string) (*entities.ImdbList, error) {
+func (c *ImdbClient) recordInvalidRows(invalidRows []entities.ItemFailure) {
+	if len(invalidRows) == 0 {
+		return
+	}
+	for _, row := range invalidRows {
+		c.logger.Warn("failure parsing imdb export row", zap.String("target", row.Target), zap.String("list", row.List), zap.String("error", row.Error))
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.invalidRows = append(c.invalidRows, invalidRows...)
+}
+
+// readImdbListResponse parses the csv export of a list. A row that cannot be parsed fails the list, along with the
+// invalid rows for the failure report, as syncing the list without them would remove their titles from trakt.
+func readImdbListResponse(response *http.Response, listId string) (*entities.ImdbList, []entities.ItemFailure, error) {
 	defer response.Body.Close()
 	csvReader := csv.NewReader(response.Body)
 	csvReader.LazyQuotes = true
 	csvReader.FieldsPerRecord = -1
 	csvData, err := csvReader.ReadAll()
 	if err != nil {
-		return nil, fmt.Errorf("failure reading from imdb response: %w", err)
+		return nil, nil, fmt.Errorf("failure reading from imdb response: %w", err)
 	}
-	var listItems []entities.ImdbItem
+	var (
+		listItems   []entities.ImdbItem
+		invalidRows []entities.ItemFailure
+	)
 	for i, record := range csvData {
-		if i > 0 { // omit header line
-			listItems = append(listItems, entities.ImdbItem{
-				Id:        record[1],
-				TitleType: record[7],
-			})
+		if i == 0 { // omit header line
+			continue
+		}
+		if len(record) < 8 || !isImdbTitleId(record[1]) {
+			invalidRows = append(invalidRows, invalidRow(entities.SyncTargetList, listId, i, record, 1, "expected at least 8 columns with a title id in the second one"))
+			continue
 		}
+		listItems = append(listItems, entities.ImdbItem{
+			Id:        record[1],
+			TitleType: record[7],
+		})
+	}
+	if len(invalidRows) > 0 {
+		return nil, invalidRows, fmt.Errorf("failure parsing %d row(s) of imdb list %s", len(invalidRows), listId)
 	}
 	contentDispositionHeader := response.Header.Get(imdbHeaderKeyContentDisposition)
 	if contentDispositionHeader == "" {
-		return nil, fmt.Errorf("failure reading header %s from imdb response", imdbHeaderKeyContentDisposition)
+		return nil, invalidRows, fmt.Errorf("failure reading header %s from imdb response", imdbHeaderKeyContentDisposition)
 	}
 	_, params, err := mime.ParseMediaType(contentDispositionHeader)
 	if err != nil || len(params) == 0 {
-		return nil, fmt.Errorf("failure parsing media type from imdb header %s: %w", imdbHeaderKeyContentDisposition, err)
+		return nil, invalidRows, fmt.Errorf("failure parsing media type from imdb header %s: %w", imdbHeaderKeyContentDisposition, err)
 	}
 	listName := strings.Split(params["filename"], ".")[0]
 	return &entities.ImdbList{
 		ListName:      listName,
 		ListId:        listId,
 		ListItems:     listItems,
-		TraktListSlug: buildTraktListName(listName),
-	}, nil
+		TraktListSlug: entities.BuildTraktListSlug(listName),
+	}, invalidRows, nil
 }
 
-func readImdbRatingsResponse(response *http.Response) ([]entities.ImdbItem, error) {
+// readImdbRatingsResponse parses the csv export of the ratings. A row that cannot be parsed fails the ratings, along with
+// the invalid rows for the failure report, as syncing the ratings without them would remove their titles from trakt.
+func readImdbRatingsResponse(response *http.Response) ([]entities.ImdbItem, []entities.ItemFailure, error) {
 	defer response.Body.Close()
 	csvReader := csv.NewReader(response.Body)
 	csvReader.LazyQuotes = true
 	csvReader.FieldsPerRecord = -1
 	csvData, err := csvReader.ReadAll()
 	if err != nil {
-		return nil, fmt.Errorf("failure reading from imdb response: %w", err)
+		return nil, nil, fmt.Errorf("failure reading from imdb response: %w", err)
 	}
-	var ratings []entities.ImdbItem
+	var (
+		ratings     []entities.ImdbItem
+		invalidRows []entities.ItemFailure
+	)
 	for i, record := range csvData {
-		if i > 0 {
-			rating, err := strconv.Atoi(record[1])
-			if err != nil {
-				return nil, fmt.Errorf("failure parsing imdb rating value to integer: %w", err)
-			}
-			ratingDate, err := time.Parse("2006-01-02", record[2])
-			if err != nil {
-				return nil, fmt.Errorf("failure parsing imdb rating date: %w", err)
-			}
-			ratings = append(ratings, entities.ImdbItem{
-				Id:         record[0],
-				TitleType:  record[5],
-				Rating:     &rating,
-				RatingDate: &ratingDate,
-			})
+		if i == 0 {
+			continue
+		}
+		if len(record) < 6 || !isImdbTitleId(record[0]) {
+			invalidRows = append(invalidRows, invalidRow(entities.SyncTargetRatings, "", i, record, 0, "expected at least 6 columns with a title id in the first one"))
+			continue
 		}
+		rating, err := strconv.Atoi(record[1])
+		if err != nil {
+			invalidRows = append(invalidRows, invalidRow(entities.SyncTargetRatings, "", i, record, 0, fmt.Sprintf("failure parsing imdb rating value to integer: %s", err)))
+			continue
+		}
+		ratingDate, err := time.ParseInLocation("2006-01-02", record[2], time.Local)
+		if err != nil {
+			invalidRows = append(invalidRows, invalidRow(entities.SyncTargetRatings, "", i, record, 0, fmt.Sprintf("failure parsing imdb rating date: %s", err)))
+			continue
+		}
+		ratings = append(ratings, entities.ImdbItem{
+			Id:         record[0],
+			TitleType:  record[5],
+			Rating:     &rating,
+			RatingDate: &ratingDate,
+		})
 	}
-	return ratings, nil
+	if len(invalidRows) > 0 {
+		return nil, invalidRows, fmt.Errorf("failure parsing %d row(s) of imdb ratings", len(invalidRows))
+	}
+	return ratings, nil, nil
 }
 
-func buildTraktListName(imdbListName string) string {
-	formatted := strings.ToLower(strings.Join(strings.Fields(imdbListName), "-"))
-	re := regexp.MustCompile(`[^-a-z0-9]+`)
-	return re.ReplaceAllString(formatted, "")
+func isImdbTitleId(id string) bool {
+	return strings.HasPrefix(id, "tt") && len(id) > 2
+}
+
+// invalidRow describes a row of an imdb export that could not be parsed, along with its title id when the row has one
+func invalidRow(target, listId string, row int, record []string, idColumn int, reason string) entities.ItemFailure {
+	failure := entities.ItemFailure{
+		Target: target,
+		List:   listId,
+		Reason: entities.ItemFailureReasonInvalidRow,
+		Error:  fmt.Sprintf("row %d: %s", row+1, reason),
+	}
+	if idColumn < len(record) && isImdbTitleId(record[idColumn]) {
+		failure.ImdbId = record[idColumn]
+	}
+	return failure
 }
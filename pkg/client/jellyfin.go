@@ -0,0 +1,293 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	jellyfinPathFavoriteItem = "/Users/%s/FavoriteItems/%s"
+	jellyfinPathItems        = "/Users/%s/Items"
+	jellyfinPathPlayedItem   = "/Users/%s/PlayedItems/%s"
+	jellyfinPathUsers        = "/Users"
+
+	jellyfinHeaderKeyAuthorization = "Authorization"
+	embyHeaderKeyToken             = "X-Emby-Token"
+
+	jellyfinPageSize = 500
+
+	jellyfinItemTypeEpisode = "Episode"
+	jellyfinItemTypeMovie   = "Movie"
+	jellyfinItemTypeSeries  = "Series"
+
+	jellyfinProviderImdb = "imdb"
+)
+
+// JellyfinClient reads and writes the played status and favorites of a user of a jellyfin server, authenticating with an api key.
+// Jellyfin has no ratings of its own, so favorites stand in for them: an item is a favorite when it is rated at least the favorite rating.
+// Emby servers are read the same way, as jellyfin was forked from emby and kept its api, only authenticating differently.
+type JellyfinClient struct {
+	name      string
+	client    *http.Client
+	config    JellyfinConfig
+	logger    *zap.Logger
+	userId    string
+	favorites map[string]bool // keyed by item id, as of the last time the library was fetched
+}
+
+type JellyfinConfig struct {
+	Url               string
+	ApiKey            string
+	User              string
+	FavoriteRating    int // 0 leaves the favorites alone
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type jellyfinUser struct {
+	Id   string `json:"Id"`
+	Name string `json:"Name"`
+}
+
+type jellyfinItemsResponse struct {
+	Items            []jellyfinItem `json:"Items"`
+	TotalRecordCount int            `json:"TotalRecordCount"`
+}
+
+type jellyfinItem struct {
+	Id          string            `json:"Id"`
+	Name        string            `json:"Name"`
+	Type        string            `json:"Type"`
+	ProviderIds map[string]string `json:"ProviderIds"`
+	UserData    struct {
+		Played         bool   `json:"Played"`
+		LastPlayedDate string `json:"LastPlayedDate"`
+		IsFavorite     bool   `json:"IsFavorite"`
+	} `json:"UserData"`
+}
+
+func NewJellyfinClient(config JellyfinConfig, logger *zap.Logger) (MediaServerClientInterface, error) {
+	return newJellyfinClient(clientNameJellyfin, config, logger)
+}
+
+// NewEmbyClient returns a client of an emby server, whose url may need to end with /emby depending on how it is exposed
+func NewEmbyClient(config JellyfinConfig, logger *zap.Logger) (MediaServerClientInterface, error) {
+	return newJellyfinClient(clientNameEmby, config, logger)
+}
+
+func newJellyfinClient(name string, config JellyfinConfig, logger *zap.Logger) (MediaServerClientInterface, error) {
+	client := &JellyfinClient{
+		name:      name,
+		client:    &http.Client{},
+		config:    config,
+		logger:    logger,
+		favorites: make(map[string]bool),
+	}
+	userId, err := client.userIdGet()
+	if err != nil {
+		return nil, &AuthError{
+			clientName: name,
+			err:        err,
+		}
+	}
+	client.userId = userId
+	return client, nil
+}
+
+func (jc *JellyfinClient) doRequest(method, endpoint string, query url.Values) (*http.Response, error) {
+	requestUrl := strings.TrimSuffix(jc.config.Url, "/") + endpoint
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+	request, err := http.NewRequest(method, requestUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+	}
+	request.Header.Set("Accept", "application/json")
+	if jc.name == clientNameEmby {
+		request.Header.Set(embyHeaderKeyToken, jc.config.ApiKey)
+	} else {
+		request.Header.Set(jellyfinHeaderKeyAuthorization, fmt.Sprintf(`MediaBrowser Client="imdb-trakt-sync", Token="%s"`, jc.config.ApiKey))
+	}
+	start := time.Now()
+	response, err := jc.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+	}
+	traceRequest(jc.logger, jc.name, request, response.StatusCode, start)
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		response.Body.Close()
+		return nil, &ApiError{
+			httpMethod: method,
+			url:        request.URL.Redacted(),
+			StatusCode: response.StatusCode,
+			details:    fmt.Sprintf("unexpected status code %d", response.StatusCode),
+		}
+	}
+	return response, nil
+}
+
+func (jc *JellyfinClient) decode(method, endpoint string, query url.Values, value interface{}) error {
+	response, err := jc.doRequest(method, endpoint, query)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err = json.NewDecoder(response.Body).Decode(value); err != nil {
+		return fmt.Errorf("failure unmarshalling %s response: %w", jc.name, err)
+	}
+	return nil
+}
+
+// userIdGet returns the id of the configured user, or of the only user of the server when none is configured
+func (jc *JellyfinClient) userIdGet() (string, error) {
+	var users []jellyfinUser
+	if err := jc.decode(http.MethodGet, jellyfinPathUsers, nil, &users); err != nil {
+		return "", fmt.Errorf("failure fetching %s users: %w", jc.name, err)
+	}
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		if strings.EqualFold(user.Name, jc.config.User) || (jc.config.User == "" && len(users) == 1) {
+			return user.Id, nil
+		}
+		names = append(names, user.Name)
+	}
+	if jc.config.User == "" {
+		return "", fmt.Errorf("the %s server has %d users, pick one of %s", jc.name, len(users), strings.Join(names, ", "))
+	}
+	return "", fmt.Errorf("%s user %s not found, expected one of %s", jc.name, jc.config.User, strings.Join(names, ", "))
+}
+
+// LibraryGet returns the movies, shows and episodes of the libraries of the user,
+// leaving out those the server has no imdb id for
+func (jc *JellyfinClient) LibraryGet() ([]entities.MediaServerItem, error) {
+	var items []entities.MediaServerItem
+	query := url.Values{
+		"Recursive":        {"true"},
+		"IncludeItemTypes": {strings.Join([]string{jellyfinItemTypeMovie, jellyfinItemTypeSeries, jellyfinItemTypeEpisode}, ",")},
+		"Fields":           {"ProviderIds"},
+		"EnableUserData":   {"true"},
+		"Limit":            {strconv.Itoa(jellyfinPageSize)},
+	}
+	for start := 0; ; start += jellyfinPageSize {
+		query.Set("StartIndex", strconv.Itoa(start))
+		var response jellyfinItemsResponse
+		if err := jc.decode(http.MethodGet, fmt.Sprintf(jellyfinPathItems, url.PathEscape(jc.userId)), query, &response); err != nil {
+			return nil, fmt.Errorf("failure fetching %s items: %w", jc.name, err)
+		}
+		for _, jellyfinItem := range response.Items {
+			jc.favorites[jellyfinItem.Id] = jellyfinItem.UserData.IsFavorite
+			if item, ok := jc.toMediaServerItem(jellyfinItem); ok {
+				items = append(items, item)
+			}
+		}
+		if len(response.Items) < jellyfinPageSize || start+jellyfinPageSize >= response.TotalRecordCount {
+			return items, nil
+		}
+	}
+}
+
+func (jc *JellyfinClient) toMediaServerItem(jellyfinItem jellyfinItem) (entities.MediaServerItem, bool) {
+	item := entities.MediaServerItem{
+		Key:   jellyfinItem.Id,
+		Title: jellyfinItem.Name,
+	}
+	switch jellyfinItem.Type {
+	case jellyfinItemTypeMovie:
+		item.Type = entities.MediaServerItemTypeMovie
+	case jellyfinItemTypeSeries:
+		item.Type = entities.MediaServerItemTypeShow
+	case jellyfinItemTypeEpisode:
+		item.Type = entities.MediaServerItemTypeEpisode
+	default:
+		return item, false
+	}
+	for provider, id := range jellyfinItem.ProviderIds {
+		if strings.EqualFold(provider, jellyfinProviderImdb) && strings.HasPrefix(id, "tt") {
+			item.ImdbId = id
+		}
+	}
+	// a show counts as played once all of its episodes are, which the episodes themselves already tell
+	if item.Type != entities.MediaServerItemTypeShow && jellyfinItem.UserData.Played {
+		item.Watched = true
+		if playedAt, err := time.Parse(time.RFC3339, jellyfinItem.UserData.LastPlayedDate); err == nil {
+			item.ViewedAt = &playedAt
+		}
+	}
+	if jc.config.FavoriteRating > 0 && jellyfinItem.UserData.IsFavorite {
+		rating := float64(jc.config.FavoriteRating)
+		item.Rating = &rating
+	}
+	return item, item.ImdbId != ""
+}
+
+// ItemsMarkWatched marks the items as played by the user
+func (jc *JellyfinClient) ItemsMarkWatched(items []entities.MediaServerItem) error {
+	if mode := targetSyncMode(jc.config.SyncMode, jc.config.SyncModeOverrides, entities.SyncTargetHistory); !syncModeAllowsAdd(mode) {
+		jc.logger.Info(fmt.Sprintf("sync mode %s would have marked %d %s item(s) as played", mode, len(items), jc.name))
+		return nil
+	}
+	for _, item := range items {
+		response, err := jc.doRequest(http.MethodPost, fmt.Sprintf(jellyfinPathPlayedItem, url.PathEscape(jc.userId), url.PathEscape(item.Key)), nil)
+		if err != nil {
+			return fmt.Errorf("failure marking %s %s %s as played: %w", jc.name, item.Type, item.Title, err)
+		}
+		response.Body.Close()
+	}
+	jc.logger.Info(fmt.Sprintf("marked %d %s item(s) as played", len(items), jc.name))
+	return nil
+}
+
+// ItemsRate adds the items rated at least the favorite rating to the favorites of the user, removing the rest of them.
+// Adding favorites follows the add side of the sync mode and removing them its remove side.
+func (jc *JellyfinClient) ItemsRate(items []entities.MediaServerItem) error {
+	if jc.config.FavoriteRating == 0 {
+		return nil
+	}
+	var favorite, unfavorite []entities.MediaServerItem
+	for _, item := range items {
+		if item.Rating == nil {
+			continue
+		}
+		isFavorite := *item.Rating >= float64(jc.config.FavoriteRating)
+		switch {
+		case isFavorite && !jc.favorites[item.Key]:
+			favorite = append(favorite, item)
+		case !isFavorite && jc.favorites[item.Key]:
+			unfavorite = append(unfavorite, item)
+		}
+	}
+	mode := targetSyncMode(jc.config.SyncMode, jc.config.SyncModeOverrides, entities.SyncTargetRatings)
+	if err := jc.favoritesChange(http.MethodPost, favorite, syncModeAllowsAdd(mode), mode, "added"); err != nil {
+		return err
+	}
+	return jc.favoritesChange(http.MethodDelete, unfavorite, syncModeAllowsRemove(mode), mode, "removed")
+}
+
+// favoritesChange adds the items to the favorites with a post request, or removes them from the favorites with a delete request
+func (jc *JellyfinClient) favoritesChange(method string, items []entities.MediaServerItem, allowed bool, mode, verb string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if !allowed {
+		jc.logger.Info(fmt.Sprintf("sync mode %s would have %s %d %s favorite(s)", mode, verb, len(items), jc.name))
+		return nil
+	}
+	for _, item := range items {
+		response, err := jc.doRequest(method, fmt.Sprintf(jellyfinPathFavoriteItem, url.PathEscape(jc.userId), url.PathEscape(item.Key)), nil)
+		if err != nil {
+			return fmt.Errorf("failure changing %s favorite %s %s: %w", jc.name, item.Type, item.Title, err)
+		}
+		response.Body.Close()
+		jc.favorites[item.Key] = method == http.MethodPost
+	}
+	jc.logger.Info(fmt.Sprintf("%s %d %s favorite(s)", verb, len(items), jc.name))
+	return nil
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	kodiPathJsonRpc = "/jsonrpc"
+
+	kodiMethodGetEpisodes = "VideoLibrary.GetEpisodes"
+	kodiMethodGetMovies   = "VideoLibrary.GetMovies"
+	kodiMethodGetTvShows  = "VideoLibrary.GetTVShows"
+	kodiMethodPing        = "JSONRPC.Ping"
+
+	kodiPageSize = 500
+
+	// kodi records when an item was last played in the local time of the machine it runs on
+	kodiDateLayout = "2006-01-02 15:04:05"
+
+	kodiUniqueIdImdb = "imdb"
+)
+
+// KodiClient reads the watched status and ratings of the video library of kodi, either through the json-rpc api
+// of its web server or from the single file the library was exported to. Kodi is only read, as the export cannot be written back.
+type KodiClient struct {
+	client *http.Client
+	config KodiConfig
+	logger *zap.Logger
+}
+
+type KodiConfig struct {
+	Url         string // of the web server, which serves the json-rpc api
+	Username    string
+	Password    string
+	LibraryPath string // of a videodb.xml export, read instead of the json-rpc api
+}
+
+type kodiRequest struct {
+	JsonRpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	Id      int         `json:"id"`
+}
+
+type kodiResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type kodiLimits struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	Total int `json:"total,omitempty"`
+}
+
+type kodiLibraryParams struct {
+	Properties []string   `json:"properties"`
+	Limits     kodiLimits `json:"limits"`
+}
+
+type kodiLibraryResult struct {
+	Limits   kodiLimits  `json:"limits"`
+	Movies   []kodiEntry `json:"movies"`
+	TvShows  []kodiEntry `json:"tvshows"`
+	Episodes []kodiEntry `json:"episodes"`
+}
+
+type kodiEntry struct {
+	MovieId    int               `json:"movieid"`
+	TvShowId   int               `json:"tvshowid"`
+	EpisodeId  int               `json:"episodeid"`
+	Title      string            `json:"title"`
+	ShowTitle  string            `json:"showtitle"`
+	ImdbNumber string            `json:"imdbnumber"`
+	UniqueId   map[string]string `json:"uniqueid"`
+	PlayCount  int               `json:"playcount"`
+	LastPlayed string            `json:"lastplayed"`
+	UserRating int               `json:"userrating"`
+}
+
+type kodiVideoDb struct {
+	Movies  []kodiXmlEntry `xml:"movie"`
+	TvShows []kodiXmlShow  `xml:"tvshow"`
+}
+
+type kodiXmlShow struct {
+	kodiXmlEntry
+	Episodes []kodiXmlEntry `xml:"episodedetails"`
+}
+
+type kodiXmlEntry struct {
+	Title      string `xml:"title"`
+	UserRating int    `xml:"userrating"`
+	PlayCount  int    `xml:"playcount"`
+	LastPlayed string `xml:"lastplayed"`
+	Id         string `xml:"id"`
+	UniqueIds  []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"uniqueid"`
+}
+
+func (e *kodiXmlEntry) entry() kodiEntry {
+	entry := kodiEntry{
+		Title:      e.Title,
+		ImdbNumber: e.Id,
+		UniqueId:   make(map[string]string, len(e.UniqueIds)),
+		PlayCount:  e.PlayCount,
+		LastPlayed: e.LastPlayed,
+		UserRating: e.UserRating,
+	}
+	for _, uniqueId := range e.UniqueIds {
+		entry.UniqueId[strings.ToLower(uniqueId.Type)] = strings.TrimSpace(uniqueId.Value)
+	}
+	return entry
+}
+
+func NewKodiClient(config KodiConfig, logger *zap.Logger) (MediaServerClientInterface, error) {
+	client := &KodiClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+	if config.LibraryPath != "" {
+		if _, err := os.Stat(config.LibraryPath); err != nil {
+			return nil, fmt.Errorf("failure reading kodi library export %s: %w", config.LibraryPath, err)
+		}
+		return client, nil
+	}
+	var pong string
+	if err := client.call(kodiMethodPing, nil, &pong); err != nil {
+		return nil, &AuthError{
+			clientName: clientNameKodi,
+			err:        fmt.Errorf("failure reaching the kodi json-rpc api: %w", err),
+		}
+	}
+	return client, nil
+}
+
+func (kc *KodiClient) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(kodiRequest{
+		JsonRpc: "2.0",
+		Method:  method,
+		Params:  params,
+		Id:      1,
+	})
+	if err != nil {
+		return fmt.Errorf("failure marshaling kodi request %s: %w", method, err)
+	}
+	requestUrl := strings.TrimSuffix(kc.config.Url, "/") + kodiPathJsonRpc
+	request, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating http request %s %s: %w", http.MethodPost, kodiPathJsonRpc, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if kc.config.Username != "" || kc.config.Password != "" {
+		request.SetBasicAuth(kc.config.Username, kc.config.Password)
+	}
+	start := time.Now()
+	response, err := kc.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error sending http request %s %s: %w", http.MethodPost, kodiPathJsonRpc, err)
+	}
+	defer response.Body.Close()
+	traceRequest(kc.logger, clientNameKodi, request, response.StatusCode, start)
+	if response.StatusCode != http.StatusOK {
+		return &ApiError{
+			httpMethod: http.MethodPost,
+			url:        request.URL.Redacted(),
+			StatusCode: response.StatusCode,
+			details:    fmt.Sprintf("unexpected status code %d calling %s", response.StatusCode, method),
+		}
+	}
+	var rpcResponse kodiResponse
+	if err = json.NewDecoder(response.Body).Decode(&rpcResponse); err != nil {
+		return fmt.Errorf("failure unmarshalling kodi response: %w", err)
+	}
+	if rpcResponse.Error != nil {
+		return fmt.Errorf("kodi method %s failed with code %d: %s", method, rpcResponse.Error.Code, rpcResponse.Error.Message)
+	}
+	if err = json.Unmarshal(rpcResponse.Result, result); err != nil {
+		return fmt.Errorf("failure unmarshalling kodi %s result: %w", method, err)
+	}
+	return nil
+}
+
+// LibraryGet returns the movies, shows and episodes of the video library, leaving out those kodi has no imdb id for,
+// which are usually the episodes, as the default scrapers identify them by their tvdb or tmdb ids
+func (kc *KodiClient) LibraryGet() ([]entities.MediaServerItem, error) {
+	if kc.config.LibraryPath != "" {
+		return kc.libraryExportGet()
+	}
+	var items []entities.MediaServerItem
+	for _, library := range []struct {
+		method     string
+		itemType   string
+		properties []string
+	}{
+		{kodiMethodGetMovies, entities.MediaServerItemTypeMovie, []string{"title", "imdbnumber", "uniqueid", "playcount", "lastplayed", "userrating"}},
+		{kodiMethodGetTvShows, entities.MediaServerItemTypeShow, []string{"title", "imdbnumber", "uniqueid", "userrating"}},
+		{kodiMethodGetEpisodes, entities.MediaServerItemTypeEpisode, []string{"title", "showtitle", "uniqueid", "playcount", "lastplayed", "userrating"}},
+	} {
+		for start := 0; ; start += kodiPageSize {
+			params := kodiLibraryParams{
+				Properties: library.properties,
+				Limits: kodiLimits{
+					Start: start,
+					End:   start + kodiPageSize,
+				},
+			}
+			var result kodiLibraryResult
+			if err := kc.call(library.method, params, &result); err != nil {
+				return nil, fmt.Errorf("failure fetching kodi %s items: %w", library.itemType, err)
+			}
+			entries := append(append(result.Movies, result.TvShows...), result.Episodes...)
+			for _, entry := range entries {
+				if item, ok := toKodiItem(entry, library.itemType); ok {
+					items = append(items, item)
+				}
+			}
+			if len(entries) < kodiPageSize || start+kodiPageSize >= result.Limits.Total {
+				break
+			}
+		}
+	}
+	return items, nil
+}
+
+// libraryExportGet reads the items of a library exported to a single file, which nests the episodes in their shows
+func (kc *KodiClient) libraryExportGet() ([]entities.MediaServerItem, error) {
+	data, err := os.ReadFile(kc.config.LibraryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading kodi library export %s: %w", kc.config.LibraryPath, err)
+	}
+	var videoDb kodiVideoDb
+	if err = xml.Unmarshal(data, &videoDb); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling kodi library export %s: %w", kc.config.LibraryPath, err)
+	}
+	var items []entities.MediaServerItem
+	add := func(entry kodiXmlEntry, itemType string) {
+		if item, ok := toKodiItem(entry.entry(), itemType); ok {
+			items = append(items, item)
+		}
+	}
+	for _, movie := range videoDb.Movies {
+		add(movie, entities.MediaServerItemTypeMovie)
+	}
+	for _, show := range videoDb.TvShows {
+		add(show.kodiXmlEntry, entities.MediaServerItemTypeShow)
+		for _, episode := range show.Episodes {
+			add(episode, entities.MediaServerItemTypeEpisode)
+		}
+	}
+	kc.logger.Info(fmt.Sprintf("read %d kodi item(s) with an imdb id from %s", len(items), kc.config.LibraryPath))
+	return items, nil
+}
+
+func toKodiItem(entry kodiEntry, itemType string) (entities.MediaServerItem, bool) {
+	item := entities.MediaServerItem{
+		Type:  itemType,
+		Title: entry.Title,
+	}
+	switch itemType {
+	case entities.MediaServerItemTypeMovie:
+		item.Key = fmt.Sprintf("movie/%d", entry.MovieId)
+	case entities.MediaServerItemTypeShow:
+		item.Key = fmt.Sprintf("tvshow/%d", entry.TvShowId)
+	default:
+		item.Key = fmt.Sprintf("episode/%d", entry.EpisodeId)
+		if entry.ShowTitle != "" {
+			item.Title = fmt.Sprintf("%s - %s", entry.ShowTitle, entry.Title)
+		}
+	}
+	// the imdbnumber of kodi is the default unique id of the item, which is not always the imdb one
+	for _, id := range []string{entry.UniqueId[kodiUniqueIdImdb], entry.ImdbNumber} {
+		if strings.HasPrefix(id, "tt") {
+			item.ImdbId = id
+			break
+		}
+	}
+	if item.ImdbId == "" {
+		return item, false
+	}
+	if item.Key == "" || strings.HasSuffix(item.Key, "/0") {
+		item.Key = item.ImdbId
+	}
+	// a show counts as watched once all of its episodes are, which the episodes themselves already tell
+	if itemType != entities.MediaServerItemTypeShow && entry.PlayCount > 0 {
+		item.Watched = true
+		if lastPlayed, err := time.ParseInLocation(kodiDateLayout, entry.LastPlayed, time.Local); err == nil {
+			item.ViewedAt = &lastPlayed
+		}
+	}
+	if entry.UserRating >= 1 && entry.UserRating <= 10 {
+		rating := float64(entry.UserRating)
+		item.Rating = &rating
+	}
+	return item, true
+}
+
+// ItemsMarkWatched is not supported, as kodi is only read
+func (kc *KodiClient) ItemsMarkWatched(items []entities.MediaServerItem) error {
+	return fmt.Errorf("kodi is only read, failure marking %d item(s) as watched", len(items))
+}
+
+// ItemsRate is not supported, as kodi is only read
+func (kc *KodiClient) ItemsRate(items []entities.MediaServerItem) error {
+	return fmt.Errorf("kodi is only read, failure rating %d item(s)", len(items))
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	malPathBase          = "https://api.myanimelist.net/v2"
+	malPathUser          = "/users/@me"
+	malPathAnimeList     = "/users/@me/animelist?fields=list_status&limit=1000&nsfw=true"
+	malPathListStatus    = "/anime/%d/my_list_status"
+	malDefaultRetryAfter = 10 * time.Second
+	malMaxRetries        = 5
+)
+
+type MalClientInterface interface {
+	ScoresGet() (map[int]entities.MalScore, error)
+	ScoresSet(scores []entities.MalScore) error
+	ScoresRemove(scores []entities.MalScore) error
+}
+
+// MalClient rates the anime of a myanimelist account, authenticating with the access token of a myanimelist application
+type MalClient struct {
+	client *http.Client
+	config MalConfig
+	logger *zap.Logger
+}
+
+type MalConfig struct {
+	BaseUrl           string // defaults to the myanimelist api
+	AccessToken       string
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type malAnimeListResponse struct {
+	Data []struct {
+		Node struct {
+			Id int `json:"id"`
+		} `json:"node"`
+		ListStatus struct {
+			Status string `json:"status"`
+			Score  int    `json:"score"`
+		} `json:"list_status"`
+	} `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+type malErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func NewMalClient(config MalConfig, logger *zap.Logger) (MalClientInterface, error) {
+	if config.BaseUrl == "" {
+		config.BaseUrl = malPathBase
+	}
+	client := &MalClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+	response, err := client.doRequest(http.MethodGet, config.BaseUrl+malPathUser, nil)
+	if err != nil {
+		return nil, &AuthError{
+			clientName: clientNameMal,
+			err:        fmt.Errorf("failure fetching the myanimelist user, the access token may have expired: %w", err),
+		}
+	}
+	response.Body.Close()
+	return client, nil
+}
+
+func (mc *MalClient) doRequest(method, endpoint string, form url.Values) (*http.Response, error) {
+	for retries := 0; retries < malMaxRetries; retries++ {
+		var body io.Reader = http.NoBody
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		request, err := http.NewRequest(method, endpoint, body)
+		if err != nil {
+			return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+		}
+		request.Header.Set("Authorization", "Bearer "+mc.config.AccessToken)
+		if form != nil {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		start := time.Now()
+		response, err := mc.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+		}
+		traceRequest(mc.logger, clientNameMal, request, response.StatusCode, start)
+		switch {
+		case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices:
+			return response, nil
+		case response.StatusCode == http.StatusTooManyRequests:
+			response.Body.Close()
+			duration := malDefaultRetryAfter
+			if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+				duration = time.Duration(seconds) * time.Second
+			}
+			mc.logger.Warn(fmt.Sprintf("myanimelist rate limit reached, waiting for %s then retrying http request %s %s", duration, method, request.URL.Path))
+			metrics.RecordRateLimit(clientNameMal, true)
+			recordRetryTelemetry(clientNameMal, request, duration)
+			time.Sleep(duration)
+		default:
+			defer response.Body.Close()
+			details := fmt.Sprintf("unexpected status code %d", response.StatusCode)
+			var malError malErrorResponse
+			if json.NewDecoder(response.Body).Decode(&malError) == nil && malError.Error != "" {
+				details = strings.TrimSpace(fmt.Sprintf("%s %s", malError.Error, malError.Message))
+			}
+			return nil, &ApiError{
+				httpMethod: method,
+				url:        request.URL.String(),
+				StatusCode: response.StatusCode,
+				details:    details,
+			}
+		}
+	}
+	return nil, &ApiError{
+		httpMethod: method,
+		url:        endpoint,
+		StatusCode: http.StatusTooManyRequests,
+		details:    "reached max retry attempts",
+	}
+}
+
+func (mc *MalClient) syncMode() string {
+	return targetSyncMode(mc.config.SyncMode, mc.config.SyncModeOverrides, entities.SyncTargetRatings)
+}
+
+// ScoresGet returns the anime of the list of the user, keyed by their myanimelist id
+func (mc *MalClient) ScoresGet() (map[int]entities.MalScore, error) {
+	scores := make(map[int]entities.MalScore)
+	endpoint := mc.config.BaseUrl + malPathAnimeList
+	for endpoint != "" {
+		response, err := mc.doRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failure fetching myanimelist anime list: %w", err)
+		}
+		var animeList malAnimeListResponse
+		err = json.NewDecoder(response.Body).Decode(&animeList)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failure unmarshalling myanimelist anime list: %w", err)
+		}
+		for _, entry := range animeList.Data {
+			scores[entry.Node.Id] = entities.MalScore{
+				Id:     entry.Node.Id,
+				Score:  entry.ListStatus.Score,
+				Status: entry.ListStatus.Status,
+			}
+		}
+		// the next page is linked with an absolute url
+		endpoint = animeList.Paging.Next
+	}
+	return scores, nil
+}
+
+// ScoresSet scores the anime, adding those not listed yet as completed, as they have been rated
+func (mc *MalClient) ScoresSet(scores []entities.MalScore) error {
+	if len(scores) == 0 {
+		return nil
+	}
+	if mode := mc.syncMode(); !syncModeAllowsAdd(mode) {
+		mc.logger.Info(fmt.Sprintf("sync mode %s would have scored %d myanimelist anime", mode, len(scores)))
+		return nil
+	}
+	for _, score := range scores {
+		form := url.Values{"score": {strconv.Itoa(score.Score)}}
+		if score.Status == "" {
+			form.Set("status", entities.MalStatusCompleted)
+		}
+		if err := mc.listStatusUpdate(score.Id, form); err != nil {
+			return fmt.Errorf("failure scoring myanimelist anime %d: %w", score.Id, err)
+		}
+	}
+	return nil
+}
+
+// ScoresRemove clears the scores of the anime, leaving them on the list of the user
+func (mc *MalClient) ScoresRemove(scores []entities.MalScore) error {
+	if len(scores) == 0 {
+		return nil
+	}
+	if mode := mc.syncMode(); !syncModeAllowsRemove(mode) {
+		mc.logger.Info(fmt.Sprintf("sync mode %s would have removed the scores of %d myanimelist anime", mode, len(scores)))
+		return nil
+	}
+	for _, score := range scores {
+		// myanimelist treats a score of 0 as no score
+		form := url.Values{"score": {"0"}}
+		if err := mc.listStatusUpdate(score.Id, form); err != nil {
+			return fmt.Errorf("failure removing the score of myanimelist anime %d: %w", score.Id, err)
+		}
+	}
+	return nil
+}
+
+func (mc *MalClient) listStatusUpdate(id int, form url.Values) error {
+	response, err := mc.doRequest(http.MethodPatch, mc.config.BaseUrl+fmt.Sprintf(malPathListStatus, id), form)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
@@ -0,0 +1,13 @@
+package client
+
+import (
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+)
+
+// MediaServerClientInterface is implemented by the clients of media servers such as plex and jellyfin,
+// whose libraries feed the trakt history and ratings, and which can be updated with the state of trakt
+type MediaServerClientInterface interface {
+	LibraryGet() ([]entities.MediaServerItem, error)
+	ItemsMarkWatched(items []entities.MediaServerItem) error
+	ItemsRate(items []entities.MediaServerItem) error
+}
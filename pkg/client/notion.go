@@ -0,0 +1,398 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	notionPathBase          = "https://api.notion.com/v1"
+	notionPathDatabase      = "/databases/%s"
+	notionPathDatabaseQuery = "/databases/%s/query"
+	notionPathPage          = "/pages/%s"
+	notionPathPages         = "/pages"
+
+	notionHeaderKeyVersion = "Notion-Version"
+	notionVersion          = "2022-06-28"
+
+	notionPageSize = 100
+
+	// the columns the syncer fills in, besides the title column, whatever its name
+	NotionPropertyImdbId  = "IMDb ID"
+	NotionPropertyPoster  = "Poster"
+	NotionPropertyRatedAt = "Rated"
+	NotionPropertyRating  = "Rating"
+	NotionPropertyStatus  = "Status"
+	NotionPropertyType    = "Type"
+
+	notionTypeDate     = "date"
+	notionTypeFiles    = "files"
+	notionTypeNumber   = "number"
+	notionTypeRichText = "rich_text"
+	notionTypeSelect   = "select"
+	notionTypeStatus   = "status"
+	notionTypeTitle    = "title"
+	notionTypeUrl      = "url"
+)
+
+type NotionClientInterface interface {
+	PagesGet() ([]entities.NotionPage, error)
+	PageCreate(target string, page entities.NotionPage) error
+	PageUpdate(target string, page entities.NotionPage) error
+	PageArchive(target string, page entities.NotionPage) error
+}
+
+// NotionClient keeps the pages of a notion database in line with the watchlist and ratings, authenticating with the token
+// of an internal integration the database is shared with. Only the columns the database has are filled in.
+type NotionClient struct {
+	client     *http.Client
+	config     NotionConfig
+	logger     *zap.Logger
+	properties map[string]string // the types of the columns of the database, keyed by their name
+	title      string            // the name of the title column
+}
+
+type NotionConfig struct {
+	BaseUrl           string // defaults to the notion api
+	Token             string
+	DatabaseId        string
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type notionDatabaseResponse struct {
+	Properties map[string]struct {
+		Type string `json:"type"`
+	} `json:"properties"`
+}
+
+type notionQueryResponse struct {
+	Results    []notionPageResponse `json:"results"`
+	HasMore    bool                 `json:"has_more"`
+	NextCursor string               `json:"next_cursor"`
+}
+
+type notionPageResponse struct {
+	Id         string                            `json:"id"`
+	Properties map[string]notionPropertyResponse `json:"properties"`
+}
+
+type notionPropertyResponse struct {
+	Type     string             `json:"type"`
+	Title    []notionRichText   `json:"title"`
+	RichText []notionRichText   `json:"rich_text"`
+	Number   *float64           `json:"number"`
+	Select   *notionSelectValue `json:"select"`
+	Status   *notionSelectValue `json:"status"`
+	Date     *struct {
+		Start string `json:"start"`
+	} `json:"date"`
+}
+
+type notionRichText struct {
+	PlainText string `json:"plain_text,omitempty"`
+	Text      *struct {
+		Content string `json:"content"`
+	} `json:"text,omitempty"`
+}
+
+type notionSelectValue struct {
+	Name string `json:"name"`
+}
+
+type notionErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewNotionClient(config NotionConfig, logger *zap.Logger) (NotionClientInterface, error) {
+	if config.BaseUrl == "" {
+		config.BaseUrl = notionPathBase
+	}
+	client := &NotionClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+	if err := client.databaseGet(); err != nil {
+		return nil, &AuthError{
+			clientName: clientNameNotion,
+			err:        fmt.Errorf("failure fetching notion database %s, make sure it is shared with the integration: %w", config.DatabaseId, err),
+		}
+	}
+	return client, nil
+}
+
+func (nc *NotionClient) doRequest(method, endpoint string, body interface{}) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failure marshalling notion request body: %w", err)
+		}
+	}
+	for {
+		var reader io.Reader = http.NoBody
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+		request, err := http.NewRequest(method, nc.config.BaseUrl+endpoint, reader)
+		if err != nil {
+			return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+		}
+		request.Header.Set("Authorization", "Bearer "+nc.config.Token)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(notionHeaderKeyVersion, notionVersion)
+		start := time.Now()
+		response, err := nc.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+		}
+		traceRequest(nc.logger, clientNameNotion, request, response.StatusCode, start)
+		switch {
+		case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices:
+			return response, nil
+		case response.StatusCode == http.StatusTooManyRequests:
+			response.Body.Close()
+			retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After"))
+			if err != nil || retryAfter <= 0 {
+				retryAfter = 1
+			}
+			duration := time.Duration(retryAfter) * time.Second
+			nc.logger.Warn(fmt.Sprintf("notion rate limit reached, retrying in %s", duration))
+			recordRetryTelemetry(clientNameNotion, request, duration)
+			time.Sleep(duration)
+		default:
+			details := fmt.Sprintf("unexpected status code %d", response.StatusCode)
+			var notionError notionErrorResponse
+			if json.NewDecoder(response.Body).Decode(&notionError) == nil && notionError.Message != "" {
+				details = fmt.Sprintf("%s: %s", notionError.Code, notionError.Message)
+			}
+			response.Body.Close()
+			return nil, &ApiError{
+				httpMethod: method,
+				url:        request.URL.String(),
+				StatusCode: response.StatusCode,
+				details:    details,
+			}
+		}
+	}
+}
+
+func (nc *NotionClient) decode(method, endpoint string, body, value interface{}) error {
+	response, err := nc.doRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if value == nil {
+		return nil
+	}
+	if err = json.NewDecoder(response.Body).Decode(value); err != nil {
+		return fmt.Errorf("failure unmarshalling notion response: %w", err)
+	}
+	return nil
+}
+
+// databaseGet reads the columns of the database, warning about the ones the syncer fills in that are missing or of another type
+func (nc *NotionClient) databaseGet() error {
+	var database notionDatabaseResponse
+	if err := nc.decode(http.MethodGet, fmt.Sprintf(notionPathDatabase, nc.config.DatabaseId), nil, &database); err != nil {
+		return err
+	}
+	nc.properties = make(map[string]string, len(database.Properties))
+	for name, property := range database.Properties {
+		nc.properties[name] = property.Type
+		if property.Type == notionTypeTitle {
+			nc.title = name
+		}
+	}
+	if nc.properties[NotionPropertyImdbId] != notionTypeRichText {
+		return fmt.Errorf("the database needs a %s column of the text type, which tells the synced pages apart", NotionPropertyImdbId)
+	}
+	for name, types := range map[string][]string{
+		NotionPropertyPoster:  {notionTypeFiles, notionTypeUrl},
+		NotionPropertyRatedAt: {notionTypeDate},
+		NotionPropertyRating:  {notionTypeNumber},
+		NotionPropertyStatus:  {notionTypeSelect, notionTypeStatus},
+		NotionPropertyType:    {notionTypeSelect},
+	} {
+		if propertyType, found := nc.properties[name]; found && !stringSliceContains(types, propertyType) {
+			nc.logger.Warn(fmt.Sprintf("leaving the notion %s column alone, as it is of the %s type instead of %s", name, propertyType, strings.Join(types, " or ")))
+			delete(nc.properties, name)
+		}
+	}
+	return nil
+}
+
+func (nc *NotionClient) syncMode(target string) string {
+	return targetSyncMode(nc.config.SyncMode, nc.config.SyncModeOverrides, target)
+}
+
+// PagesGet returns the pages of the database that have an imdb id, leaving alone those added by hand
+func (nc *NotionClient) PagesGet() ([]entities.NotionPage, error) {
+	var pages []entities.NotionPage
+	body := map[string]interface{}{
+		"page_size": notionPageSize,
+	}
+	for {
+		var response notionQueryResponse
+		if err := nc.decode(http.MethodPost, fmt.Sprintf(notionPathDatabaseQuery, nc.config.DatabaseId), body, &response); err != nil {
+			return nil, fmt.Errorf("failure fetching notion pages: %w", err)
+		}
+		for _, result := range response.Results {
+			if page := result.toNotionPage(nc.title); page.ImdbId != "" {
+				pages = append(pages, page)
+			}
+		}
+		if !response.HasMore || response.NextCursor == "" {
+			return pages, nil
+		}
+		body["start_cursor"] = response.NextCursor
+	}
+}
+
+func (r *notionPageResponse) toNotionPage(title string) entities.NotionPage {
+	page := entities.NotionPage{
+		Id:     r.Id,
+		ImdbId: strings.TrimSpace(plainText(r.Properties[NotionPropertyImdbId].RichText)),
+		Title:  plainText(r.Properties[title].Title),
+	}
+	if status := r.Properties[NotionPropertyStatus]; status.Select != nil {
+		page.Status = status.Select.Name
+	} else if status.Status != nil {
+		page.Status = status.Status.Name
+	}
+	if rating := r.Properties[NotionPropertyRating].Number; rating != nil {
+		value := int(*rating)
+		page.Rating = &value
+	}
+	return page
+}
+
+func plainText(texts []notionRichText) string {
+	var builder strings.Builder
+	for _, text := range texts {
+		builder.WriteString(text.PlainText)
+	}
+	return builder.String()
+}
+
+func richText(content string) []notionRichText {
+	text := notionRichText{
+		Text: &struct {
+			Content string `json:"content"`
+		}{Content: content},
+	}
+	return []notionRichText{text}
+}
+
+// pageProperties returns the values of the columns the database has, leaving out the title, type and poster of existing pages,
+// which may have been edited by hand
+func (nc *NotionClient) pageProperties(page entities.NotionPage, create bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	set := func(name string, value func(propertyType string) interface{}) {
+		if propertyType, found := nc.properties[name]; found {
+			properties[name] = map[string]interface{}{propertyType: value(propertyType)}
+		}
+	}
+	if create {
+		if nc.title != "" {
+			properties[nc.title] = map[string]interface{}{notionTypeTitle: richText(page.Title)}
+		}
+		set(NotionPropertyImdbId, func(string) interface{} {
+			return richText(page.ImdbId)
+		})
+		if page.Type != "" {
+			set(NotionPropertyType, func(string) interface{} {
+				// the trakt types are lowercase words, such as movie
+				return notionSelectValue{Name: strings.ToUpper(page.Type[:1]) + page.Type[1:]}
+			})
+		}
+		if page.Poster != "" {
+			set(NotionPropertyPoster, func(propertyType string) interface{} {
+				if propertyType == notionTypeUrl {
+					return page.Poster
+				}
+				return []map[string]interface{}{{
+					"name":     "poster",
+					"type":     "external",
+					"external": map[string]string{"url": page.Poster},
+				}}
+			})
+		}
+	}
+	set(NotionPropertyStatus, func(string) interface{} {
+		return notionSelectValue{Name: page.Status}
+	})
+	set(NotionPropertyRating, func(string) interface{} {
+		return page.Rating
+	})
+	set(NotionPropertyRatedAt, func(string) interface{} {
+		if page.RatedAt == nil {
+			return nil
+		}
+		return map[string]string{"start": page.RatedAt.Format("2006-01-02")}
+	})
+	return properties
+}
+
+// PageCreate adds a page for the item, with its poster as the cover of the page
+func (nc *NotionClient) PageCreate(target string, page entities.NotionPage) error {
+	if mode := nc.syncMode(target); !syncModeAllowsAdd(mode) {
+		nc.logger.Info(fmt.Sprintf("sync mode %s would have added notion page %s", mode, page.Title))
+		return nil
+	}
+	body := map[string]interface{}{
+		"parent":     map[string]string{"database_id": nc.config.DatabaseId},
+		"properties": nc.pageProperties(page, true),
+	}
+	if page.Poster != "" {
+		body["cover"] = map[string]interface{}{
+			"type":     "external",
+			"external": map[string]string{"url": page.Poster},
+		}
+	}
+	if err := nc.decode(http.MethodPost, notionPathPages, body, nil); err != nil {
+		return fmt.Errorf("failure adding notion page %s: %w", page.Title, err)
+	}
+	return nil
+}
+
+// PageUpdate sets the status and rating of the page
+func (nc *NotionClient) PageUpdate(target string, page entities.NotionPage) error {
+	if mode := nc.syncMode(target); !syncModeAllowsAdd(mode) {
+		nc.logger.Info(fmt.Sprintf("sync mode %s would have updated notion page %s", mode, page.Title))
+		return nil
+	}
+	body := map[string]interface{}{
+		"properties": nc.pageProperties(page, false),
+	}
+	if err := nc.decode(http.MethodPatch, fmt.Sprintf(notionPathPage, page.Id), body, nil); err != nil {
+		return fmt.Errorf("failure updating notion page %s: %w", page.Title, err)
+	}
+	return nil
+}
+
+// PageArchive moves the page to the trash of notion, where it can be restored from
+func (nc *NotionClient) PageArchive(target string, page entities.NotionPage) error {
+	if mode := nc.syncMode(target); !syncModeAllowsRemove(mode) {
+		nc.logger.Info(fmt.Sprintf("sync mode %s would have archived notion page %s", mode, page.Title))
+		return nil
+	}
+	body := map[string]interface{}{
+		"archived": true,
+	}
+	if err := nc.decode(http.MethodPatch, fmt.Sprintf(notionPathPage, page.Id), body, nil); err != nil {
+		return fmt.Errorf("failure archiving notion page %s: %w", page.Title, err)
+	}
+	return nil
+}
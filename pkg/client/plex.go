@@ -0,0 +1,280 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	plexPathRate         = "/:/rate"
+	plexPathScrobble     = "/:/scrobble"
+	plexPathSections     = "/library/sections"
+	plexPathSectionItems = "/library/sections/%s/all"
+
+	plexIdentifierLibrary = "com.plexapp.plugins.library"
+
+	plexHeaderKeyContainerSize  = "X-Plex-Container-Size"
+	plexHeaderKeyContainerStart = "X-Plex-Container-Start"
+	plexHeaderKeyToken          = "X-Plex-Token"
+
+	plexPageSize = 500
+
+	plexSectionTypeMovie = "movie"
+	plexSectionTypeShow  = "show"
+
+	// the metadata types plex filters the items of a library section by
+	plexTypeMovie   = "1"
+	plexTypeShow    = "2"
+	plexTypeEpisode = "4"
+
+	plexGuidPrefixImdb = "imdb://"
+)
+
+// PlexClient reads the libraries of a plex media server, authenticating with the token of its owner
+type PlexClient struct {
+	client *http.Client
+	config PlexConfig
+	logger *zap.Logger
+}
+
+type PlexConfig struct {
+	Url               string
+	Token             string
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type plexResponse struct {
+	MediaContainer plexMediaContainer `json:"MediaContainer"`
+}
+
+type plexMediaContainer struct {
+	TotalSize int            `json:"totalSize"`
+	Directory []plexSection  `json:"Directory"`
+	Metadata  []plexMetadata `json:"Metadata"`
+}
+
+type plexSection struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+type plexMetadata struct {
+	RatingKey    string   `json:"ratingKey"`
+	Type         string   `json:"type"`
+	Title        string   `json:"title"`
+	ViewCount    int      `json:"viewCount"`
+	LastViewedAt int64    `json:"lastViewedAt"`
+	UserRating   *float64 `json:"userRating"`
+	LastRatedAt  int64    `json:"lastRatedAt"`
+	Guid         []struct {
+		Id string `json:"id"`
+	} `json:"Guid"`
+}
+
+func NewPlexClient(config PlexConfig, logger *zap.Logger) (MediaServerClientInterface, error) {
+	client := &PlexClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+	if _, err := client.sectionsGet(); err != nil {
+		return nil, &AuthError{
+			clientName: clientNamePlex,
+			err:        fmt.Errorf("failure fetching plex library sections: %w", err),
+		}
+	}
+	return client, nil
+}
+
+func (pc *PlexClient) doRequest(method, endpoint string, query url.Values, headers map[string]string) (*http.Response, error) {
+	requestUrl := strings.TrimSuffix(pc.config.Url, "/") + endpoint
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+	request, err := http.NewRequest(method, requestUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set(plexHeaderKeyToken, pc.config.Token)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	start := time.Now()
+	response, err := pc.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+	}
+	traceRequest(pc.logger, clientNamePlex, request, response.StatusCode, start)
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, &ApiError{
+			httpMethod: method,
+			url:        request.URL.Redacted(),
+			StatusCode: response.StatusCode,
+			details:    fmt.Sprintf("unexpected status code %d", response.StatusCode),
+		}
+	}
+	return response, nil
+}
+
+func (pc *PlexClient) getMediaContainer(endpoint string, query url.Values, headers map[string]string) (*plexMediaContainer, error) {
+	response, err := pc.doRequest(http.MethodGet, endpoint, query, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var plexResp plexResponse
+	if err = json.NewDecoder(response.Body).Decode(&plexResp); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling plex response: %w", err)
+	}
+	return &plexResp.MediaContainer, nil
+}
+
+func (pc *PlexClient) sectionsGet() ([]plexSection, error) {
+	container, err := pc.getMediaContainer(plexPathSections, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return container.Directory, nil
+}
+
+// LibraryGet returns the movies, shows and episodes of the movie and show libraries,
+// leaving out those plex has no imdb id for, such as items matched by a local agent
+func (pc *PlexClient) LibraryGet() ([]entities.MediaServerItem, error) {
+	sections, err := pc.sectionsGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching plex library sections: %w", err)
+	}
+	var items []entities.MediaServerItem
+	for _, section := range sections {
+		var types []string
+		switch section.Type {
+		case plexSectionTypeMovie:
+			types = []string{plexTypeMovie}
+		case plexSectionTypeShow:
+			types = []string{plexTypeShow, plexTypeEpisode}
+		default:
+			continue
+		}
+		for _, metadataType := range types {
+			sectionItems, err := pc.sectionItemsGet(section, metadataType)
+			if err != nil {
+				return nil, fmt.Errorf("failure fetching items of plex library %s: %w", section.Title, err)
+			}
+			items = append(items, sectionItems...)
+		}
+	}
+	return items, nil
+}
+
+func (pc *PlexClient) sectionItemsGet(section plexSection, metadataType string) ([]entities.MediaServerItem, error) {
+	var items []entities.MediaServerItem
+	query := url.Values{
+		"type":         {metadataType},
+		"includeGuids": {"1"},
+	}
+	for start := 0; ; start += plexPageSize {
+		headers := map[string]string{
+			plexHeaderKeyContainerStart: strconv.Itoa(start),
+			plexHeaderKeyContainerSize:  strconv.Itoa(plexPageSize),
+		}
+		container, err := pc.getMediaContainer(fmt.Sprintf(plexPathSectionItems, url.PathEscape(section.Key)), query, headers)
+		if err != nil {
+			return nil, err
+		}
+		for _, metadata := range container.Metadata {
+			if item, ok := metadata.toMediaServerItem(); ok {
+				items = append(items, item)
+			}
+		}
+		if len(container.Metadata) < plexPageSize || start+plexPageSize >= container.TotalSize {
+			return items, nil
+		}
+	}
+}
+
+func (m plexMetadata) toMediaServerItem() (entities.MediaServerItem, bool) {
+	item := entities.MediaServerItem{
+		Key:   m.RatingKey,
+		Type:  m.Type,
+		Title: m.Title,
+	}
+	for _, guid := range m.Guid {
+		if strings.HasPrefix(guid.Id, plexGuidPrefixImdb) {
+			item.ImdbId = strings.TrimPrefix(guid.Id, plexGuidPrefixImdb)
+			break
+		}
+	}
+	// a show counts as watched once all of its episodes are, which the episodes themselves already tell
+	if m.Type != entities.MediaServerItemTypeShow && m.ViewCount > 0 {
+		item.Watched = true
+		if m.LastViewedAt > 0 {
+			viewedAt := time.Unix(m.LastViewedAt, 0)
+			item.ViewedAt = &viewedAt
+		}
+	}
+	if m.UserRating != nil && *m.UserRating > 0 {
+		item.Rating = m.UserRating
+		if m.LastRatedAt > 0 {
+			ratedAt := time.Unix(m.LastRatedAt, 0)
+			item.RatedAt = &ratedAt
+		}
+	}
+	return item, item.ImdbId != ""
+}
+
+// ItemsMarkWatched marks the items as watched, as if they were played to the end
+func (pc *PlexClient) ItemsMarkWatched(items []entities.MediaServerItem) error {
+	if mode := targetSyncMode(pc.config.SyncMode, pc.config.SyncModeOverrides, entities.SyncTargetHistory); !syncModeAllowsAdd(mode) {
+		pc.logger.Info(fmt.Sprintf("sync mode %s would have marked %d plex item(s) as watched", mode, len(items)))
+		return nil
+	}
+	for _, item := range items {
+		query := url.Values{
+			"key":        {item.Key},
+			"identifier": {plexIdentifierLibrary},
+		}
+		response, err := pc.doRequest(http.MethodGet, plexPathScrobble, query, nil)
+		if err != nil {
+			return fmt.Errorf("failure marking plex %s %s as watched: %w", item.Type, item.Title, err)
+		}
+		response.Body.Close()
+	}
+	pc.logger.Info(fmt.Sprintf("marked %d plex item(s) as watched", len(items)))
+	return nil
+}
+
+// ItemsRate sets the user rating of the items to their rating
+func (pc *PlexClient) ItemsRate(items []entities.MediaServerItem) error {
+	if mode := targetSyncMode(pc.config.SyncMode, pc.config.SyncModeOverrides, entities.SyncTargetRatings); !syncModeAllowsAdd(mode) {
+		pc.logger.Info(fmt.Sprintf("sync mode %s would have rated %d plex item(s)", mode, len(items)))
+		return nil
+	}
+	for _, item := range items {
+		if item.Rating == nil {
+			continue
+		}
+		query := url.Values{
+			"key":        {item.Key},
+			"identifier": {plexIdentifierLibrary},
+			"rating":     {strconv.FormatFloat(*item.Rating, 'f', -1, 64)},
+		}
+		response, err := pc.doRequest(http.MethodPut, plexPathRate, query, nil)
+		if err != nil {
+			return fmt.Errorf("failure rating plex %s %s: %w", item.Type, item.Title, err)
+		}
+		response.Body.Close()
+	}
+	pc.logger.Info(fmt.Sprintf("rated %d plex item(s)", len(items)))
+	return nil
+}
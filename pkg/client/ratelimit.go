@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+)
+
+const (
+	traktHeaderKeyRateLimit = "X-Ratelimit"
+
+	DefaultRateLimitWarnPercent = 10
+
+	rateLimitMinWarnPeriod = 60
+)
+
+// traktRateLimit is the json value of the X-Ratelimit header, describing the limit the request counted towards
+type traktRateLimit struct {
+	Name      string `json:"name"`
+	Period    int    `json:"period"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Until     string `json:"until"`
+}
+
+// rateLimitWatcher logs the remaining quota of every trakt response, warning once per window when it runs low
+type rateLimitWatcher struct {
+	mutex       sync.Mutex
+	warnPercent int
+	warned      map[string]bool
+}
+
+func newRateLimitWatcher(warnPercent int) *rateLimitWatcher {
+	return &rateLimitWatcher{
+		warnPercent: warnPercent,
+		warned:      make(map[string]bool),
+	}
+}
+
+func (w *rateLimitWatcher) observe(logger *zap.Logger, response *http.Response) {
+	value := response.Header.Get(traktHeaderKeyRateLimit)
+	if value == "" {
+		return
+	}
+	var rateLimit traktRateLimit
+	if err := json.Unmarshal([]byte(value), &rateLimit); err != nil {
+		logger.Debug(fmt.Sprintf("failure parsing trakt header %s", traktHeaderKeyRateLimit), zap.String("value", value), zap.Error(err))
+		return
+	}
+	fields := []zap.Field{
+		zap.String("name", rateLimit.Name),
+		zap.Int("limit", rateLimit.Limit),
+		zap.Int("remaining", rateLimit.Remaining),
+		zap.Int("period_seconds", rateLimit.Period),
+		zap.String("until", rateLimit.Until),
+	}
+	logger.Debug("trakt rate limit", fields...)
+	// windows shorter than a minute, such as the limit of one write per second, run out on every request and reset before anyone could act
+	if rateLimit.Period < rateLimitMinWarnPeriod || rateLimit.Limit <= 0 || rateLimit.Remaining*100 >= rateLimit.Limit*w.warnPercent {
+		return
+	}
+	// the window is identified by its limit and reset time, so a long run warns again once the quota resets and runs low anew
+	window := rateLimit.Name + "/" + rateLimit.Until
+	w.mutex.Lock()
+	alreadyWarned := w.warned[window]
+	w.warned[window] = true
+	w.mutex.Unlock()
+	if !alreadyWarned {
+		logger.Warn(fmt.Sprintf("trakt rate limit %s is running low, %d of %d request(s) remaining until %s", rateLimit.Name, rateLimit.Remaining, rateLimit.Limit, rateLimit.Until), fields...)
+	}
+}
@@ -0,0 +1,318 @@
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sheetsPathBase              = "https://sheets.googleapis.com/v4"
+	sheetsPathSpreadsheet       = "/spreadsheets/%s?fields=sheets.properties.title"
+	sheetsPathBatchUpdate       = "/spreadsheets/%s:batchUpdate"
+	sheetsPathValuesBatchUpdate = "/spreadsheets/%s/values:batchUpdate"
+	sheetsPathValuesBatchClear  = "/spreadsheets/%s/values:batchClear"
+
+	sheetsDefaultTokenUri   = "https://oauth2.googleapis.com/token"
+	sheetsScope             = "https://www.googleapis.com/auth/spreadsheets"
+	sheetsGrantTypeJwt      = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	sheetsDefaultRetryAfter = 10 * time.Second
+	sheetsMaxRetries        = 5
+)
+
+type GoogleSheetsClientInterface interface {
+	SheetWrite(title string, rows [][]interface{}) error
+}
+
+// GoogleSheetsClient writes worksheets of a spreadsheet shared with a google service account,
+// signing in with the json key of the account
+type GoogleSheetsClient struct {
+	client  *http.Client
+	config  GoogleSheetsConfig
+	logger  *zap.Logger
+	account sheetsServiceAccount
+	key     *rsa.PrivateKey
+	token   string
+	expiry  time.Time
+	sheets  map[string]bool // the titles of the worksheets of the spreadsheet
+}
+
+type GoogleSheetsConfig struct {
+	BaseUrl       string // defaults to the google sheets api
+	Credentials   string // the json key of a service account
+	SpreadsheetId string
+}
+
+type sheetsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+}
+
+type sheetsTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type sheetsSpreadsheetResponse struct {
+	Sheets []struct {
+		Properties struct {
+			Title string `json:"title"`
+		} `json:"properties"`
+	} `json:"sheets"`
+}
+
+type sheetsErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewGoogleSheetsClient(config GoogleSheetsConfig, logger *zap.Logger) (GoogleSheetsClientInterface, error) {
+	if config.BaseUrl == "" {
+		config.BaseUrl = sheetsPathBase
+	}
+	client := &GoogleSheetsClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+		sheets: make(map[string]bool),
+	}
+	if err := client.parseCredentials(); err != nil {
+		return nil, &AuthError{
+			clientName: clientNameGoogleSheets,
+			err:        err,
+		}
+	}
+	var spreadsheet sheetsSpreadsheetResponse
+	if err := client.decode(http.MethodGet, fmt.Sprintf(sheetsPathSpreadsheet, config.SpreadsheetId), nil, &spreadsheet); err != nil {
+		return nil, &AuthError{
+			clientName: clientNameGoogleSheets,
+			err:        fmt.Errorf("failure fetching spreadsheet %s, make sure it is shared with %s: %w", config.SpreadsheetId, client.account.ClientEmail, err),
+		}
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		client.sheets[sheet.Properties.Title] = true
+	}
+	return client, nil
+}
+
+func (gc *GoogleSheetsClient) parseCredentials() error {
+	if err := json.Unmarshal([]byte(gc.config.Credentials), &gc.account); err != nil {
+		return fmt.Errorf("failure unmarshalling the service account key: %w", err)
+	}
+	if gc.account.ClientEmail == "" || gc.account.PrivateKey == "" {
+		return fmt.Errorf("the service account key has no client_email or private_key")
+	}
+	if gc.account.TokenUri == "" {
+		gc.account.TokenUri = sheetsDefaultTokenUri
+	}
+	block, _ := pem.Decode([]byte(gc.account.PrivateKey))
+	if block == nil {
+		return fmt.Errorf("the private key of the service account is not pem encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if gc.key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return fmt.Errorf("failure parsing the private key of the service account: %w", err)
+		}
+		return nil
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("the private key of the service account is not an rsa key")
+	}
+	gc.key = rsaKey
+	return nil
+}
+
+// accessToken exchanges a jwt signed with the key of the service account for an access token, which lasts an hour
+func (gc *GoogleSheetsClient) accessToken() (string, error) {
+	if gc.token != "" && time.Now().Before(gc.expiry) {
+		return gc.token, nil
+	}
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   gc.account.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   gc.account.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, gc.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failure signing the service account jwt: %w", err)
+	}
+	form := url.Values{
+		"grant_type": {sheetsGrantTypeJwt},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	start := time.Now()
+	response, err := gc.client.PostForm(gc.account.TokenUri, form)
+	if err != nil {
+		return "", fmt.Errorf("error sending http request %s %s: %w", http.MethodPost, gc.account.TokenUri, err)
+	}
+	defer response.Body.Close()
+	traceRequest(gc.logger, clientNameGoogleSheets, response.Request, response.StatusCode, start)
+	if response.StatusCode != http.StatusOK {
+		return "", &AuthError{
+			clientName: clientNameGoogleSheets,
+			err:        fmt.Errorf("unexpected status code %d exchanging the service account jwt", response.StatusCode),
+		}
+	}
+	var token sheetsTokenResponse
+	if err = json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failure unmarshalling google access token: %w", err)
+	}
+	gc.token = token.AccessToken
+	// the token is renewed a minute early, so it does not expire in the middle of a request
+	gc.expiry = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return gc.token, nil
+}
+
+func (gc *GoogleSheetsClient) doRequest(method, endpoint string, body interface{}) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failure marshalling google sheets request body: %w", err)
+		}
+	}
+	for retries := 0; retries < sheetsMaxRetries; retries++ {
+		token, err := gc.accessToken()
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequest(method, gc.config.BaseUrl+endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+		request.Header.Set("Content-Type", "application/json")
+		start := time.Now()
+		response, err := gc.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+		}
+		traceRequest(gc.logger, clientNameGoogleSheets, request, response.StatusCode, start)
+		switch {
+		case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices:
+			return response, nil
+		case response.StatusCode == http.StatusTooManyRequests:
+			// the write quota is counted per minute, and google rarely says when it resets
+			response.Body.Close()
+			duration := sheetsDefaultRetryAfter
+			if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+				duration = time.Duration(seconds) * time.Second
+			}
+			gc.logger.Warn(fmt.Sprintf("google sheets rate limit reached, waiting for %s then retrying http request %s %s", duration, method, endpoint))
+			metrics.RecordRateLimit(clientNameGoogleSheets, true)
+			recordRetryTelemetry(clientNameGoogleSheets, request, duration)
+			time.Sleep(duration)
+		default:
+			defer response.Body.Close()
+			details := fmt.Sprintf("unexpected status code %d", response.StatusCode)
+			var sheetsError sheetsErrorResponse
+			if json.NewDecoder(response.Body).Decode(&sheetsError) == nil && sheetsError.Error.Message != "" {
+				details = sheetsError.Error.Message
+			}
+			return nil, &ApiError{
+				httpMethod: method,
+				url:        request.URL.String(),
+				StatusCode: response.StatusCode,
+				details:    details,
+			}
+		}
+	}
+	return nil, &ApiError{
+		httpMethod: method,
+		url:        gc.config.BaseUrl + endpoint,
+		StatusCode: http.StatusTooManyRequests,
+		details:    "reached max retry attempts",
+	}
+}
+
+func (gc *GoogleSheetsClient) decode(method, endpoint string, body, value interface{}) error {
+	response, err := gc.doRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if value == nil {
+		return nil
+	}
+	if err = json.NewDecoder(response.Body).Decode(value); err != nil {
+		return fmt.Errorf("failure unmarshalling google sheets response: %w", err)
+	}
+	return nil
+}
+
+// SheetWrite replaces the values of the worksheet with the rows, adding the worksheet when the spreadsheet does not have it yet.
+// The rows are written over the previous ones and the rows left below them are cleared, so the worksheet is never empty
+// while it is written, and the columns to the right of the rows are left alone.
+func (gc *GoogleSheetsClient) SheetWrite(title string, rows [][]interface{}) error {
+	if !gc.sheets[title] {
+		body := map[string]interface{}{
+			"requests": []map[string]interface{}{{
+				"addSheet": map[string]interface{}{
+					"properties": map[string]string{"title": title},
+				},
+			}},
+		}
+		if err := gc.decode(http.MethodPost, fmt.Sprintf(sheetsPathBatchUpdate, gc.config.SpreadsheetId), body, nil); err != nil {
+			return fmt.Errorf("failure adding worksheet %s: %w", title, err)
+		}
+		gc.sheets[title] = true
+	}
+	columns := 1
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	// titles are quoted in a1 notation, doubling the quotes they contain
+	sheet := "'" + strings.ReplaceAll(title, "'", "''") + "'"
+	body := map[string]interface{}{
+		"valueInputOption": "RAW",
+		"data": []map[string]interface{}{{
+			"range":  sheet + "!A1",
+			"values": rows,
+		}},
+	}
+	if err := gc.decode(http.MethodPost, fmt.Sprintf(sheetsPathValuesBatchUpdate, gc.config.SpreadsheetId), body, nil); err != nil {
+		return fmt.Errorf("failure writing worksheet %s: %w", title, err)
+	}
+	body = map[string]interface{}{
+		"ranges": []string{fmt.Sprintf("%s!A%d:%s", sheet, len(rows)+1, sheetsColumn(columns))},
+	}
+	if err := gc.decode(http.MethodPost, fmt.Sprintf(sheetsPathValuesBatchClear, gc.config.SpreadsheetId), body, nil); err != nil {
+		return fmt.Errorf("failure clearing worksheet %s: %w", title, err)
+	}
+	return nil
+}
+
+// sheetsColumn returns the a1 name of the column with the number, such as A for 1 and AA for 27
+func sheetsColumn(number int) string {
+	var name string
+	for ; number > 0; number = (number - 1) / 26 {
+		name = string(rune('A'+(number-1)%26)) + name
+	}
+	return name
+}
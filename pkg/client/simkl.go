@@ -0,0 +1,325 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	simklPathBase          = "https://api.simkl.com"
+	simklPathAddToList     = "/sync/add-to-list"
+	simklPathAllItems      = "/sync/all-items/"
+	simklPathHistory       = "/sync/history"
+	simklPathPin           = "/oauth/pin"
+	simklPathPinCode       = "/oauth/pin/%s"
+	simklPathRatings       = "/sync/ratings"
+	simklPathRatingsRemove = "/sync/ratings/remove"
+	simklPathUserSettings  = "/users/settings"
+
+	simklHeaderKeyApiKey = "simkl-api-key"
+
+	simklResultOk = "OK"
+)
+
+type SimklClientInterface interface {
+	ItemsGet() ([]entities.SimklItem, error)
+	WatchlistAdd(items []entities.SimklItem) error
+	RatingsAdd(items []entities.SimklItem) error
+	RatingsRemove(items []entities.SimklItem) error
+	HistoryAdd(items []entities.SimklItem) error
+}
+
+// SimklClient pushes the watchlist, ratings and history to simkl, authenticating with the access token of the pin flow
+type SimklClient struct {
+	client *http.Client
+	config SimklConfig
+	logger *zap.Logger
+}
+
+type SimklConfig struct {
+	BaseUrl           string // defaults to the simkl api
+	ClientId          string
+	AccessToken       string
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type simklIds struct {
+	Imdb string `json:"imdb,omitempty"`
+}
+
+type simklMedia struct {
+	Ids simklIds `json:"ids"`
+}
+
+type simklAllItem struct {
+	Status        string      `json:"status"`
+	UserRating    *int        `json:"user_rating"`
+	UserRatedAt   *time.Time  `json:"user_rated_at"`
+	LastWatchedAt *time.Time  `json:"last_watched_at"`
+	Movie         *simklMedia `json:"movie"`
+	Show          *simklMedia `json:"show"`
+}
+
+type simklAllItemsResponse struct {
+	Movies []simklAllItem `json:"movies"`
+	Shows  []simklAllItem `json:"shows"`
+	Anime  []simklAllItem `json:"anime"`
+}
+
+type simklSyncItem struct {
+	Ids       simklIds `json:"ids"`
+	To        string   `json:"to,omitempty"`
+	Rating    *int     `json:"rating,omitempty"`
+	RatedAt   string   `json:"rated_at,omitempty"`
+	WatchedAt string   `json:"watched_at,omitempty"`
+}
+
+type simklSyncBody struct {
+	Movies []simklSyncItem `json:"movies,omitempty"`
+	Shows  []simklSyncItem `json:"shows,omitempty"`
+}
+
+type simklPinResponse struct {
+	Result      string `json:"result"`
+	AccessToken string `json:"access_token"`
+}
+
+func NewSimklClient(config SimklConfig, logger *zap.Logger) (SimklClientInterface, error) {
+	client := newSimklClient(config, logger)
+	response, err := client.doRequest(http.MethodPost, simklPathUserSettings, nil, nil)
+	if err != nil {
+		return nil, &AuthError{
+			clientName: clientNameSimkl,
+			err:        fmt.Errorf("failure fetching simkl user settings: %w", err),
+		}
+	}
+	response.Body.Close()
+	return client, nil
+}
+
+func newSimklClient(config SimklConfig, logger *zap.Logger) *SimklClient {
+	if config.BaseUrl == "" {
+		config.BaseUrl = simklPathBase
+	}
+	return &SimklClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+}
+
+// AuthorizeSimkl runs the simkl pin flow, prompting for the code to enter, and returns the access token once it is approved.
+// Simkl access tokens never expire, so the flow only runs once.
+func AuthorizeSimkl(config SimklConfig, logger *zap.Logger, prompt func(codes *entities.SimklAuthCodesResponse)) (string, error) {
+	sc := newSimklClient(config, logger)
+	query := url.Values{"client_id": {config.ClientId}}
+	response, err := sc.doRequest(http.MethodGet, simklPathPin, query, nil)
+	if err != nil {
+		return "", fmt.Errorf("failure generating simkl pin: %w", err)
+	}
+	codes := &entities.SimklAuthCodesResponse{}
+	err = json.NewDecoder(response.Body).Decode(codes)
+	response.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failure unmarshalling simkl pin: %w", err)
+	}
+	prompt(codes)
+	interval := time.Duration(codes.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(codes.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		response, err = sc.doRequest(http.MethodGet, fmt.Sprintf(simklPathPinCode, url.PathEscape(codes.UserCode)), query, nil)
+		if err != nil {
+			return "", fmt.Errorf("failure exchanging simkl pin for access token: %w", err)
+		}
+		pin := simklPinResponse{}
+		err = json.NewDecoder(response.Body).Decode(&pin)
+		response.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failure unmarshalling simkl access token: %w", err)
+		}
+		if pin.Result == simklResultOk && pin.AccessToken != "" {
+			return pin.AccessToken, nil
+		}
+	}
+	return "", fmt.Errorf("failure exchanging simkl pin for access token: the pin expired before it was approved")
+}
+
+func (sc *SimklClient) doRequest(method, endpoint string, query url.Values, body interface{}) (*http.Response, error) {
+	requestUrl := sc.config.BaseUrl + endpoint
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failure marshalling simkl request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	for {
+		request, err := http.NewRequest(method, requestUrl, reader)
+		if err != nil {
+			return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+		}
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(simklHeaderKeyApiKey, sc.config.ClientId)
+		if sc.config.AccessToken != "" {
+			request.Header.Set("Authorization", "Bearer "+sc.config.AccessToken)
+		}
+		start := time.Now()
+		response, err := sc.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+		}
+		traceRequest(sc.logger, clientNameSimkl, request, response.StatusCode, start)
+		switch {
+		case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices:
+			return response, nil
+		case response.StatusCode == http.StatusTooManyRequests:
+			response.Body.Close()
+			retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After"))
+			if err != nil || retryAfter <= 0 {
+				retryAfter = 1
+			}
+			duration := time.Duration(retryAfter) * time.Second
+			sc.logger.Warn(fmt.Sprintf("simkl rate limit reached, retrying in %s", duration))
+			recordRetryTelemetry(clientNameSimkl, request, duration)
+			time.Sleep(duration)
+			if seeker, ok := reader.(io.Seeker); ok {
+				if _, err = seeker.Seek(0, io.SeekStart); err != nil {
+					return nil, fmt.Errorf("failure rewinding simkl request body: %w", err)
+				}
+			}
+		default:
+			response.Body.Close()
+			return nil, &ApiError{
+				httpMethod: method,
+				url:        request.URL.String(),
+				StatusCode: response.StatusCode,
+				details:    fmt.Sprintf("unexpected status code %d", response.StatusCode),
+			}
+		}
+	}
+}
+
+func (sc *SimklClient) syncMode(target string) string {
+	return targetSyncMode(sc.config.SyncMode, sc.config.SyncModeOverrides, target)
+}
+
+// ItemsGet returns every movie and show tracked on simkl, with anime counted as shows
+func (sc *SimklClient) ItemsGet() ([]entities.SimklItem, error) {
+	response, err := sc.doRequest(http.MethodGet, simklPathAllItems, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching simkl items: %w", err)
+	}
+	defer response.Body.Close()
+	// simkl responds with null when nothing is tracked yet
+	var allItems *simklAllItemsResponse
+	if err = json.NewDecoder(response.Body).Decode(&allItems); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling simkl items: %w", err)
+	}
+	if allItems == nil {
+		return nil, nil
+	}
+	var items []entities.SimklItem
+	for _, item := range allItems.Movies {
+		if item.Movie != nil && item.Movie.Ids.Imdb != "" {
+			items = append(items, item.toSimklItem(entities.SimklItemTypeMovie, item.Movie.Ids.Imdb))
+		}
+	}
+	for _, item := range append(allItems.Shows, allItems.Anime...) {
+		if item.Show != nil && item.Show.Ids.Imdb != "" {
+			items = append(items, item.toSimklItem(entities.SimklItemTypeShow, item.Show.Ids.Imdb))
+		}
+	}
+	return items, nil
+}
+
+func (i simklAllItem) toSimklItem(itemType, imdbId string) entities.SimklItem {
+	return entities.SimklItem{
+		ImdbId:    imdbId,
+		Type:      itemType,
+		Status:    i.Status,
+		Rating:    i.UserRating,
+		RatedAt:   i.UserRatedAt,
+		WatchedAt: i.LastWatchedAt,
+	}
+}
+
+func simklBody(items []entities.SimklItem, toSyncItem func(item entities.SimklItem) simklSyncItem) simklSyncBody {
+	body := simklSyncBody{}
+	for _, item := range items {
+		syncItem := toSyncItem(item)
+		syncItem.Ids = simklIds{Imdb: item.ImdbId}
+		if item.Type == entities.SimklItemTypeShow {
+			body.Shows = append(body.Shows, syncItem)
+		} else {
+			body.Movies = append(body.Movies, syncItem)
+		}
+	}
+	return body
+}
+
+func simklTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// sync posts the items to the endpoint when the sync mode of the target allows it, or logs what it would have done
+func (sc *SimklClient) sync(target, endpoint, action string, allowed func(string) bool, items []entities.SimklItem, toSyncItem func(item entities.SimklItem) simklSyncItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if mode := sc.syncMode(target); !allowed(mode) {
+		sc.logger.Info(fmt.Sprintf("sync mode %s would have %s %d simkl item(s)", mode, action, len(items)))
+		return nil
+	}
+	response, err := sc.doRequest(http.MethodPost, endpoint, nil, simklBody(items, toSyncItem))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	sc.logger.Info(fmt.Sprintf("%s %d simkl item(s)", action, len(items)))
+	return nil
+}
+
+// WatchlistAdd adds the items to the plan to watch list
+func (sc *SimklClient) WatchlistAdd(items []entities.SimklItem) error {
+	return sc.sync(entities.SyncTargetWatchlist, simklPathAddToList, "added to the plan to watch list", syncModeAllowsAdd, items, func(item entities.SimklItem) simklSyncItem {
+		return simklSyncItem{To: entities.SimklStatusPlanToWatch}
+	})
+}
+
+// RatingsAdd rates the items, replacing their current rating
+func (sc *SimklClient) RatingsAdd(items []entities.SimklItem) error {
+	return sc.sync(entities.SyncTargetRatings, simklPathRatings, "rated", syncModeAllowsAdd, items, func(item entities.SimklItem) simklSyncItem {
+		return simklSyncItem{Rating: item.Rating, RatedAt: simklTime(item.RatedAt)}
+	})
+}
+
+func (sc *SimklClient) RatingsRemove(items []entities.SimklItem) error {
+	return sc.sync(entities.SyncTargetRatings, simklPathRatingsRemove, "unrated", syncModeAllowsRemove, items, func(item entities.SimklItem) simklSyncItem {
+		return simklSyncItem{}
+	})
+}
+
+// HistoryAdd marks the items as watched, which moves them to the completed list
+func (sc *SimklClient) HistoryAdd(items []entities.SimklItem) error {
+	return sc.sync(entities.SyncTargetHistory, simklPathHistory, "marked as watched", syncModeAllowsAdd, items, func(item entities.SimklItem) simklSyncItem {
+		return simklSyncItem{WatchedAt: simklTime(item.WatchedAt)}
+	})
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	stremioPathBase          = "https://api.strem.io"
+	stremioPathLogin         = "/api/login"
+	stremioPathDatastoreGet  = "/api/datastoreGet"
+	stremioCollectionLibrary = "libraryItem"
+
+	stremioTypeMovie  = "movie"
+	stremioTypeSeries = "series"
+)
+
+// StremioClient reads the library of a stremio account through the api stremio syncs its apps with, which is
+// the addon collection api of the account. Stremio is only read, as its library keeps its own watch progress.
+type StremioClient struct {
+	client  *http.Client
+	config  StremioConfig
+	logger  *zap.Logger
+	authKey string
+}
+
+type StremioConfig struct {
+	BaseUrl  string // defaults to the stremio api
+	AuthKey  string // of a signed in session, used instead of the email and password
+	Email    string
+	Password string
+}
+
+type stremioResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type stremioLoginResult struct {
+	AuthKey string `json:"authKey"`
+}
+
+type stremioLibraryItem struct {
+	Id      string `json:"_id"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Removed bool   `json:"removed"`
+	Temp    bool   `json:"temp"`
+	State   struct {
+		LastWatched    string `json:"lastWatched"`
+		TimeWatched    int64  `json:"timeWatched"`
+		TimesWatched   int    `json:"timesWatched"`
+		FlaggedWatched int    `json:"flaggedWatched"`
+	} `json:"state"`
+}
+
+func NewStremioClient(config StremioConfig, logger *zap.Logger) (MediaServerClientInterface, error) {
+	if config.BaseUrl == "" {
+		config.BaseUrl = stremioPathBase
+	}
+	client := &StremioClient{
+		client:  &http.Client{},
+		config:  config,
+		logger:  logger,
+		authKey: config.AuthKey,
+	}
+	if client.authKey != "" {
+		return client, nil
+	}
+	var login stremioLoginResult
+	err := client.call(stremioPathLogin, map[string]interface{}{
+		"type":     "Login",
+		"email":    config.Email,
+		"password": config.Password,
+		"facebook": false,
+	}, &login)
+	if err == nil && login.AuthKey == "" {
+		err = fmt.Errorf("stremio returned no auth key")
+	}
+	if err != nil {
+		return nil, &AuthError{
+			clientName: clientNameStremio,
+			err:        fmt.Errorf("failure signing in to stremio: %w", err),
+		}
+	}
+	client.authKey = login.AuthKey
+	return client, nil
+}
+
+// call posts a request to the stremio api, decoding its result into result. Stremio reports failures as an error
+// alongside a successful status code.
+func (sc *StremioClient) call(path string, body interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failure marshalling stremio request: %w", err)
+	}
+	url := sc.config.BaseUrl + path
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating http request %s %s: %w", http.MethodPost, url, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	start := time.Now()
+	response, err := sc.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error sending http request %s %s: %w", http.MethodPost, url, err)
+	}
+	defer response.Body.Close()
+	traceRequest(sc.logger, clientNameStremio, request, response.StatusCode, start)
+	var decoded stremioResponse
+	decodeErr := json.NewDecoder(response.Body).Decode(&decoded)
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices || decoded.Error != nil {
+		details := fmt.Sprintf("unexpected status code %d", response.StatusCode)
+		if decoded.Error != nil {
+			details = decoded.Error.Message
+		}
+		return &ApiError{
+			httpMethod: http.MethodPost,
+			url:        url,
+			StatusCode: response.StatusCode,
+			details:    details,
+		}
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failure unmarshalling stremio response: %w", decodeErr)
+	}
+	if err = json.Unmarshal(decoded.Result, result); err != nil {
+		return fmt.Errorf("failure unmarshalling stremio response result: %w", err)
+	}
+	return nil
+}
+
+// LibraryGet returns the movies and series of the stremio library. Items watched to the end or marked as watched are watched,
+// while the items added to the library that were never started are planned. Stremio keeps the watched episodes of a series
+// in a form tied to its own catalog, so a series is only watched once it is marked as watched as a whole. Items of
+// addons that do not identify them by their imdb id are left out.
+func (sc *StremioClient) LibraryGet() ([]entities.MediaServerItem, error) {
+	var libraryItems []stremioLibraryItem
+	err := sc.call(stremioPathDatastoreGet, map[string]interface{}{
+		"authKey":    sc.authKey,
+		"collection": stremioCollectionLibrary,
+		"ids":        []string{},
+		"all":        true,
+	}, &libraryItems)
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching stremio library: %w", err)
+	}
+	items := make([]entities.MediaServerItem, 0, len(libraryItems))
+	for _, libraryItem := range libraryItems {
+		if !strings.HasPrefix(libraryItem.Id, "tt") {
+			sc.logger.Debug(fmt.Sprintf("skipping stremio item %s %s, as it has no imdb id", libraryItem.Id, libraryItem.Name))
+			continue
+		}
+		item := entities.MediaServerItem{
+			Key:    libraryItem.Id,
+			ImdbId: libraryItem.Id,
+			Title:  libraryItem.Name,
+		}
+		switch libraryItem.Type {
+		case stremioTypeMovie:
+			item.Type = entities.MediaServerItemTypeMovie
+			item.Watched = libraryItem.State.TimesWatched > 0 || libraryItem.State.FlaggedWatched > 0
+		case stremioTypeSeries:
+			item.Type = entities.MediaServerItemTypeShow
+			item.Watched = libraryItem.State.FlaggedWatched > 0
+		default:
+			continue
+		}
+		if lastWatched, err := time.Parse(time.RFC3339, libraryItem.State.LastWatched); err == nil && item.Watched {
+			item.ViewedAt = &lastWatched
+		}
+		started := item.Watched || libraryItem.State.TimeWatched > 0 || libraryItem.State.TimesWatched > 0
+		item.Planned = !started && !libraryItem.Removed && !libraryItem.Temp
+		if !item.Watched && !item.Planned {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// ItemsMarkWatched is not supported, as stremio is only read
+func (sc *StremioClient) ItemsMarkWatched(items []entities.MediaServerItem) error {
+	return fmt.Errorf("stremio is only read, failure marking %d item(s) as watched", len(items))
+}
+
+// ItemsRate is not supported, as stremio has no ratings
+func (sc *StremioClient) ItemsRate(items []entities.MediaServerItem) error {
+	return fmt.Errorf("stremio has no ratings, failure rating %d item(s)", len(items))
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// endpointStats accumulates the requests sent to an endpoint during a run
+type endpointStats struct {
+	requests  int
+	retries   int
+	latencies []time.Duration
+}
+
+var (
+	telemetryMutex sync.Mutex
+	endpoints      = make(map[[3]string]*endpointStats)
+	rateLimitWait  time.Duration
+)
+
+// ResetTelemetry forgets the requests of the previous run, so the telemetry of every run starts from scratch
+func ResetTelemetry() {
+	telemetryMutex.Lock()
+	defer telemetryMutex.Unlock()
+	endpoints = make(map[[3]string]*endpointStats)
+	rateLimitWait = 0
+}
+
+// Telemetry summarizes the requests sent since the telemetry was last reset, sorted by the number of requests
+func Telemetry() *entities.HttpTelemetry {
+	telemetryMutex.Lock()
+	defer telemetryMutex.Unlock()
+	telemetry := &entities.HttpTelemetry{
+		RateLimitWaitSeconds: rateLimitWait.Seconds(),
+		Endpoints:            make([]entities.EndpointTelemetry, 0, len(endpoints)),
+	}
+	var latencies []time.Duration
+	for key, stats := range endpoints {
+		telemetry.Requests += stats.requests
+		telemetry.Retries += stats.retries
+		latencies = append(latencies, stats.latencies...)
+		telemetry.Endpoints = append(telemetry.Endpoints, entities.EndpointTelemetry{
+			Service:      key[0],
+			Method:       key[1],
+			Route:        key[2],
+			Requests:     stats.requests,
+			Retries:      stats.retries,
+			P95LatencyMs: percentile(stats.latencies, 0.95).Milliseconds(),
+		})
+	}
+	telemetry.P95LatencyMs = percentile(latencies, 0.95).Milliseconds()
+	sort.Slice(telemetry.Endpoints, func(i, j int) bool {
+		a, b := telemetry.Endpoints[i], telemetry.Endpoints[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Service+a.Route+a.Method < b.Service+b.Route+b.Method
+	})
+	return telemetry
+}
+
+func recordRequestTelemetry(clientName string, request *http.Request, latency time.Duration) {
+	telemetryMutex.Lock()
+	defer telemetryMutex.Unlock()
+	stats := endpointStatsOf(clientName, request)
+	stats.requests++
+	stats.latencies = append(stats.latencies, latency)
+}
+
+// recordRetryTelemetry counts a request sent again after waiting for the rate limit to reset
+func recordRetryTelemetry(clientName string, request *http.Request, wait time.Duration) {
+	telemetryMutex.Lock()
+	defer telemetryMutex.Unlock()
+	endpointStatsOf(clientName, request).retries++
+	rateLimitWait += wait
+}
+
+func endpointStatsOf(clientName string, request *http.Request) *endpointStats {
+	key := [3]string{clientName, request.Method, endpointRoute(request.URL.Path)}
+	stats, found := endpoints[key]
+	if !found {
+		stats = &endpointStats{}
+		endpoints[key] = stats
+	}
+	return stats
+}
+
+// endpointRoute replaces the user names, list ids and item ids of a path with placeholders,
+// so the requests sent to every list count towards the same endpoint, e.g. /users/{id}/lists/{id}/items
+func endpointRoute(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		switch strings.ToLower(segments[i-1]) {
+		case "anime", "databases", "favoriteitems", "find", "list", "lists", "movie", "pages", "playeditems", "shows", "spreadsheets", "subject", "tv":
+			segments[i] = "{id}"
+		case "account", "user", "users":
+			if i < len(segments)-1 {
+				segments[i] = "{id}"
+			}
+		default:
+			if (i == 3 && segments[0] == "sync" && segments[1] == "history") || (i == 2 && segments[0] == "search") {
+				segments[i] = "{id}"
+			}
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// percentile returns the latency below which the given share of the latencies fall, using the nearest rank
+func percentile(latencies []time.Duration, share float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	rank := int(share*float64(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,456 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tmdbPathBaseAPI      = "https://api.themoviedb.org/3"
+	tmdbPathAccount      = "/account"
+	tmdbPathAccountItems = "/account/%d/%s/%s"
+	tmdbPathAccountLists = "/account/%d/lists"
+	tmdbPathAccountSet   = "/account/%d/%s"
+	tmdbPathExternalIds  = "/%s/%d/external_ids"
+	tmdbPathFind         = "/find/%s"
+	tmdbPathList         = "/list/%s"
+	tmdbPathListAdd      = "/list"
+	tmdbPathListAddItem  = "/list/%s/add_item"
+	tmdbPathListRemove   = "/list/%s/remove_item"
+
+	tmdbHeaderKeyRetryAfter = "Retry-After"
+	tmdbDefaultRetryAfter   = time.Second
+	tmdbMaxPages            = 500
+)
+
+type TmdbClientInterface interface {
+	FindByImdbId(imdbId string) (*entities.TmdbItem, error)
+	ListsGet() ([]entities.TmdbList, error)
+	ListGet(listId string) (*entities.TmdbList, error)
+	ListAdd(name, description string) (*entities.TmdbList, error)
+	ListItemsAdd(listId string, items []entities.TmdbItem) error
+	ListItemsRemove(listId string, items []entities.TmdbItem) error
+	AccountListGet(accountList string) ([]entities.TmdbItem, error)
+	ImdbIdGet(item entities.TmdbItem) (string, error)
+	AccountListItemsAdd(accountList string, items []entities.TmdbItem) error
+	AccountListItemsRemove(accountList string, items []entities.TmdbItem) error
+}
+
+// TmdbClient talks to version 3 of the tmdb api, signing requests with an api key and the session of a user
+type TmdbClient struct {
+	client    *http.Client
+	config    TmdbConfig
+	logger    *zap.Logger
+	accountId int
+}
+
+type TmdbConfig struct {
+	ApiKey            string
+	SessionId         string
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+}
+
+type tmdbAccountResponse struct {
+	Id int `json:"id"`
+}
+
+type tmdbPageResponse struct {
+	Page       int               `json:"page"`
+	TotalPages int               `json:"total_pages"`
+	Results    []json.RawMessage `json:"results"`
+}
+
+type tmdbListResponse struct {
+	Id    json.RawMessage     `json:"id"`
+	Name  string              `json:"name"`
+	Items []entities.TmdbItem `json:"items"`
+}
+
+type tmdbListCreateResponse struct {
+	ListId json.RawMessage `json:"list_id"`
+}
+
+type tmdbFindResponse struct {
+	MovieResults []entities.TmdbItem `json:"movie_results"`
+	TvResults    []entities.TmdbItem `json:"tv_results"`
+}
+
+// tmdbAccountItem is an item of the favorites, ratings or watchlist of an account, where ratings also hold the rating
+// of the user, along with when it was given in the recent versions of the api
+type tmdbAccountItem struct {
+	Id            int     `json:"id"`
+	Rating        float64 `json:"rating"`
+	AccountRating *struct {
+		Value     float64 `json:"value"`
+		CreatedAt string  `json:"created_at"`
+	} `json:"account_rating"`
+}
+
+func (i tmdbAccountItem) toTmdbItem(mediaType string) entities.TmdbItem {
+	item := entities.TmdbItem{
+		Id:        i.Id,
+		MediaType: mediaType,
+		Rating:    i.Rating,
+	}
+	if i.AccountRating != nil {
+		if i.AccountRating.Value > 0 {
+			item.Rating = i.AccountRating.Value
+		}
+		if ratedAt, err := time.Parse(time.RFC3339, i.AccountRating.CreatedAt); err == nil {
+			item.RatedAt = &ratedAt
+		}
+	}
+	return item
+}
+
+type tmdbExternalIdsResponse struct {
+	ImdbId string `json:"imdb_id"`
+}
+
+type tmdbStatusResponse struct {
+	StatusCode    int    `json:"status_code"`
+	StatusMessage string `json:"status_message"`
+}
+
+func NewTmdbClient(config TmdbConfig, logger *zap.Logger) (TmdbClientInterface, error) {
+	client := &TmdbClient{
+		client: &http.Client{},
+		config: config,
+		logger: logger,
+	}
+	response, err := client.doRequest(http.MethodGet, tmdbPathAccount, nil, nil)
+	if err == nil {
+		var account tmdbAccountResponse
+		if err = decodeTmdbResponse(response, &account); err == nil {
+			client.accountId = account.Id
+		}
+	}
+	if err != nil {
+		return nil, &AuthError{
+			clientName: clientNameTmdb,
+			err:        fmt.Errorf("failure fetching tmdb account: %w", err),
+		}
+	}
+	return client, nil
+}
+
+func (tc *TmdbClient) doRequest(method, endpoint string, query url.Values, body interface{}) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("api_key", tc.config.ApiKey)
+	query.Set("session_id", tc.config.SessionId)
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failure marshalling tmdb request body: %w", err)
+		}
+	}
+	for retries := 0; retries < 5; retries++ {
+		request, err := http.NewRequest(method, tmdbPathBaseAPI+endpoint+"?"+query.Encode(), bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("error creating http request %s %s: %w", method, endpoint, err)
+		}
+		request.Header.Set("Accept", "application/json")
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json;charset=utf-8")
+		}
+		start := time.Now()
+		response, err := tc.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error sending http request %s %s: %w", method, endpoint, err)
+		}
+		// the query holds the api key and session, which must not end up in logs and traces
+		traced := request.Clone(request.Context())
+		traced.URL.RawQuery = ""
+		traceRequest(tc.logger, clientNameTmdb, traced, response.StatusCode, start)
+		switch {
+		case response.StatusCode == http.StatusTooManyRequests:
+			response.Body.Close()
+			duration := tmdbDefaultRetryAfter
+			if seconds, err := strconv.Atoi(response.Header.Get(tmdbHeaderKeyRetryAfter)); err == nil {
+				duration = time.Duration(seconds) * time.Second
+			}
+			tc.logger.Warn(fmt.Sprintf("tmdb rate limit reached, waiting for %s then retrying http request %s %s", duration, method, endpoint))
+			metrics.RecordRateLimit(clientNameTmdb, true)
+			recordRetryTelemetry(clientNameTmdb, traced, duration)
+			time.Sleep(duration)
+			continue
+		case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices, response.StatusCode == http.StatusNotFound:
+			return response, nil
+		default:
+			defer response.Body.Close()
+			details := fmt.Sprintf("unexpected status code %d", response.StatusCode)
+			var status tmdbStatusResponse
+			if json.NewDecoder(response.Body).Decode(&status) == nil && status.StatusMessage != "" {
+				details = status.StatusMessage
+			}
+			return nil, &ApiError{
+				httpMethod: method,
+				url:        tmdbPathBaseAPI + endpoint,
+				StatusCode: response.StatusCode,
+				details:    details,
+			}
+		}
+	}
+	return nil, &ApiError{
+		httpMethod: method,
+		url:        tmdbPathBaseAPI + endpoint,
+		StatusCode: http.StatusTooManyRequests,
+		details:    "reached max retry attempts",
+	}
+}
+
+// decodeTmdbResponse unmarshals the body of a response, treating not found as an error
+func decodeTmdbResponse(response *http.Response, value interface{}) error {
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return &ApiError{
+			httpMethod: response.Request.Method,
+			url:        tmdbPathBaseAPI + response.Request.URL.Path,
+			StatusCode: response.StatusCode,
+			details:    "resource not found",
+		}
+	}
+	if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+		return fmt.Errorf("failure unmarshalling tmdb response: %w", err)
+	}
+	return nil
+}
+
+// getPages fetches every page of a paginated endpoint, passing each of its results to handle
+func (tc *TmdbClient) getPages(endpoint string, handle func(result json.RawMessage) error) error {
+	for page := 1; page <= tmdbMaxPages; page++ {
+		response, err := tc.doRequest(http.MethodGet, endpoint, url.Values{"page": {strconv.Itoa(page)}}, nil)
+		if err != nil {
+			return err
+		}
+		var pageResponse tmdbPageResponse
+		if err = decodeTmdbResponse(response, &pageResponse); err != nil {
+			return err
+		}
+		for _, result := range pageResponse.Results {
+			if err = handle(result); err != nil {
+				return err
+			}
+		}
+		if page >= pageResponse.TotalPages {
+			return nil
+		}
+	}
+	return nil
+}
+
+// FindByImdbId returns the movie or show of tmdb with the imdb id, or nil when tmdb does not know it
+func (tc *TmdbClient) FindByImdbId(imdbId string) (*entities.TmdbItem, error) {
+	response, err := tc.doRequest(http.MethodGet, fmt.Sprintf(tmdbPathFind, url.PathEscape(imdbId)), url.Values{"external_source": {"imdb_id"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var found tmdbFindResponse
+	if err = decodeTmdbResponse(response, &found); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(found.MovieResults) > 0:
+		return &entities.TmdbItem{Id: found.MovieResults[0].Id, MediaType: entities.TmdbMediaTypeMovie}, nil
+	case len(found.TvResults) > 0:
+		return &entities.TmdbItem{Id: found.TvResults[0].Id, MediaType: entities.TmdbMediaTypeTv}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// ListsGet returns the lists of the account, without their items
+func (tc *TmdbClient) ListsGet() ([]entities.TmdbList, error) {
+	var lists []entities.TmdbList
+	err := tc.getPages(fmt.Sprintf(tmdbPathAccountLists, tc.accountId), func(result json.RawMessage) error {
+		var list tmdbListResponse
+		if err := json.Unmarshal(result, &list); err != nil {
+			return fmt.Errorf("failure unmarshalling tmdb list: %w", err)
+		}
+		lists = append(lists, entities.TmdbList{Id: tmdbId(list.Id), Name: list.Name})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching tmdb lists: %w", err)
+	}
+	return lists, nil
+}
+
+func (tc *TmdbClient) ListGet(listId string) (*entities.TmdbList, error) {
+	response, err := tc.doRequest(http.MethodGet, fmt.Sprintf(tmdbPathList, url.PathEscape(listId)), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var list tmdbListResponse
+	if err = decodeTmdbResponse(response, &list); err != nil {
+		return nil, fmt.Errorf("failure fetching tmdb list %s: %w", listId, err)
+	}
+	return &entities.TmdbList{
+		Id:    tmdbId(list.Id),
+		Name:  list.Name,
+		Items: list.Items,
+	}, nil
+}
+
+func (tc *TmdbClient) ListAdd(name, description string) (*entities.TmdbList, error) {
+	if mode := tc.syncMode(entities.SyncTargetList); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have created tmdb list %s", mode, name))
+		return nil, nil
+	}
+	body := map[string]string{
+		"name":        name,
+		"description": description,
+		"language":    "en",
+	}
+	response, err := tc.doRequest(http.MethodPost, tmdbPathListAdd, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var created tmdbListCreateResponse
+	if err = decodeTmdbResponse(response, &created); err != nil {
+		return nil, fmt.Errorf("failure creating tmdb list %s: %w", name, err)
+	}
+	tc.logger.Info(fmt.Sprintf("created tmdb list %s", name))
+	return &entities.TmdbList{
+		Id:   tmdbId(created.ListId),
+		Name: name,
+	}, nil
+}
+
+// ListItemsAdd adds movies to a list one at a time, as version 3 of the api neither accepts several items nor shows
+func (tc *TmdbClient) ListItemsAdd(listId string, items []entities.TmdbItem) error {
+	if mode := tc.syncMode(entities.SyncTargetList); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have added %d tmdb list item(s)", mode, len(items)), zap.String("list", listId))
+		return nil
+	}
+	for _, item := range items {
+		if err := tc.postItem(fmt.Sprintf(tmdbPathListAddItem, url.PathEscape(listId)), map[string]int{"media_id": item.Id}); err != nil {
+			return fmt.Errorf("failure adding %s %d to tmdb list %s: %w", item.MediaType, item.Id, listId, err)
+		}
+	}
+	tc.logger.Info(fmt.Sprintf("added %d item(s) to tmdb list %s", len(items), listId))
+	return nil
+}
+
+func (tc *TmdbClient) ListItemsRemove(listId string, items []entities.TmdbItem) error {
+	if mode := tc.syncMode(entities.SyncTargetList); !syncModeAllowsRemove(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have removed %d tmdb list item(s)", mode, len(items)), zap.String("list", listId))
+		return nil
+	}
+	for _, item := range items {
+		if err := tc.postItem(fmt.Sprintf(tmdbPathListRemove, url.PathEscape(listId)), map[string]int{"media_id": item.Id}); err != nil {
+			return fmt.Errorf("failure removing %s %d from tmdb list %s: %w", item.MediaType, item.Id, listId, err)
+		}
+	}
+	tc.logger.Info(fmt.Sprintf("removed %d item(s) from tmdb list %s", len(items), listId))
+	return nil
+}
+
+// AccountListGet returns the movies and shows of the favorites, ratings or watchlist of the account
+func (tc *TmdbClient) AccountListGet(accountList string) ([]entities.TmdbItem, error) {
+	var items []entities.TmdbItem
+	mediaTypes := []struct {
+		mediaType string
+		path      string
+	}{
+		{mediaType: entities.TmdbMediaTypeMovie, path: "movies"},
+		{mediaType: entities.TmdbMediaTypeTv, path: "tv"},
+	}
+	for _, mediaType := range mediaTypes {
+		mediaType := mediaType
+		err := tc.getPages(fmt.Sprintf(tmdbPathAccountItems, tc.accountId, accountList, mediaType.path), func(result json.RawMessage) error {
+			var item tmdbAccountItem
+			if err := json.Unmarshal(result, &item); err != nil {
+				return fmt.Errorf("failure unmarshalling tmdb item: %w", err)
+			}
+			items = append(items, item.toTmdbItem(mediaType.mediaType))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failure fetching tmdb %s: %w", accountList, err)
+		}
+	}
+	return items, nil
+}
+
+// ImdbIdGet returns the imdb id of a movie or show, which is empty when tmdb does not know it
+func (tc *TmdbClient) ImdbIdGet(item entities.TmdbItem) (string, error) {
+	response, err := tc.doRequest(http.MethodGet, fmt.Sprintf(tmdbPathExternalIds, item.MediaType, item.Id), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var externalIds tmdbExternalIdsResponse
+	if err = decodeTmdbResponse(response, &externalIds); err != nil {
+		return "", fmt.Errorf("failure fetching imdb id of tmdb %s %d: %w", item.MediaType, item.Id, err)
+	}
+	return externalIds.ImdbId, nil
+}
+
+func (tc *TmdbClient) AccountListItemsAdd(accountList string, items []entities.TmdbItem) error {
+	return tc.setAccountListItems(accountList, items, true)
+}
+
+func (tc *TmdbClient) AccountListItemsRemove(accountList string, items []entities.TmdbItem) error {
+	return tc.setAccountListItems(accountList, items, false)
+}
+
+func (tc *TmdbClient) setAccountListItems(accountList string, items []entities.TmdbItem, member bool) error {
+	target, allowed, verb := entities.SyncTargetList, syncModeAllowsAdd, "added"
+	if accountList == entities.TmdbAccountListWatchlist {
+		target = entities.SyncTargetWatchlist
+	}
+	if !member {
+		allowed, verb = syncModeAllowsRemove, "removed"
+	}
+	if mode := tc.syncMode(target); !allowed(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have %s %d tmdb %s item(s)", mode, verb, len(items), accountList))
+		return nil
+	}
+	for _, item := range items {
+		body := map[string]interface{}{
+			"media_type": item.MediaType,
+			"media_id":   item.Id,
+			accountList:  member,
+		}
+		if err := tc.postItem(fmt.Sprintf(tmdbPathAccountSet, tc.accountId, accountList), body); err != nil {
+			return fmt.Errorf("failure updating %s %d of tmdb %s: %w", item.MediaType, item.Id, accountList, err)
+		}
+	}
+	tc.logger.Info(fmt.Sprintf("%s %d item(s) of tmdb %s", verb, len(items), accountList))
+	return nil
+}
+
+func (tc *TmdbClient) postItem(endpoint string, body interface{}) error {
+	response, err := tc.doRequest(http.MethodPost, endpoint, nil, body)
+	if err != nil {
+		return err
+	}
+	var status tmdbStatusResponse
+	return decodeTmdbResponse(response, &status)
+}
+
+func (tc *TmdbClient) syncMode(target string) string {
+	return targetSyncMode(tc.config.SyncMode, tc.config.SyncModeOverrides, target)
+}
+
+// tmdbId returns a list id, which tmdb returns as a number or a string depending on the age of the list
+func tmdbId(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	return strings.TrimSpace(string(raw))
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
@@ -32,45 +34,73 @@ const (
 	traktHeaderKeyContentType   = "Content-Type"
 	traktHeaderKeyRetryAfter    = "Retry-After"
 
-	traktPathActivate            = "/activate"
-	traktPathActivateAuthorize   = "/activate/authorize"
-	traktPathAuthCodes           = "/oauth/device/code"
-	traktPathAuthSignIn          = "/auth/signin"
-	traktPathAuthTokens          = "/oauth/device/token"
-	traktPathBaseAPI             = "https://api.trakt.tv"
-	traktPathBaseBrowser         = "https://trakt.tv"
-	traktPathHistory             = "/sync/history"
-	traktPathHistoryGet          = "/sync/history/%s/%s?limit=%s"
-	traktPathHistoryRemove       = "/sync/history/remove"
-	traktPathRatings             = "/sync/ratings"
-	traktPathRatingsRemove       = "/sync/ratings/remove"
-	traktPathUserList            = "/users/%s/lists/%s"
-	traktPathUserListItems       = "/users/%s/lists/%s/items"
-	traktPathUserListItemsRemove = "/users/%s/lists/%s/items/remove"
-	traktPathWatchlist           = "/sync/watchlist"
-	traktPathWatchlistRemove     = "/sync/watchlist/remove"
-
-	traktStatusCodeEnhanceYourCalm = 420 // https://github.com/trakt/api-help/discussions/350
-
-	traktSyncModeAddOnly = "add-only"
-	traktSyncModeDryRun  = "dry-run"
-	traktSyncModeFull    = "full"
+	traktPathActivate             = "/activate"
+	traktPathActivateAuthorize    = "/activate/authorize"
+	traktPathAuthCodes            = "/oauth/device/code"
+	traktPathAuthSignIn           = "/auth/signin"
+	traktPathAuthRefresh          = "/oauth/token"
+	traktPathAuthTokens           = "/oauth/device/token"
+	traktPathBaseAPI              = "https://api.trakt.tv"
+	traktPathBaseBrowser          = "https://trakt.tv"
+	traktPathCollection           = "/sync/collection/%s"
+	traktPathComments             = "/comments"
+	traktPathHistory              = "/sync/history"
+	traktPathHistoryGet           = "/sync/history/%s/%s?limit=%s"
+	traktPathHistoryRemove        = "/sync/history/remove"
+	traktPathRatings              = "/sync/ratings"
+	traktPathRatingsRemove        = "/sync/ratings/remove"
+	traktPathSearchImdb           = "/search/imdb/%s?extended=images"
+	traktPathSearchText           = "/search/%s?query=%s&fields=title"
+	traktPathSearchTmdb           = "/search/tmdb/%d?type=%s"
+	traktPathSearchTvdb           = "/search/tvdb/%d?type=%s"
+	traktPathShowSeasons          = "/shows/%s/seasons?extended=episodes"
+	traktPathUserSettings         = "/users/settings"
+	traktPathUserList             = "/users/%s/lists/%s"
+	traktPathUserListItems        = "/users/%s/lists/%s/items"
+	traktPathUserListItemsRemove  = "/users/%s/lists/%s/items/remove"
+	traktPathUserListItemsReorder = "/users/%s/lists/%s/items/reorder"
+	traktPathWatched              = "/sync/watched/%s"
+	traktPathWatchlist            = "/sync/watchlist"
+	traktPathWatchlistRemove      = "/sync/watchlist/remove"
+
+	traktGrantTypeRefreshToken = "refresh_token"
+	traktRedirectUriOob        = "urn:ietf:wg:oauth:2.0:oob"
+	traktTokenRefreshWindow    = 24 * time.Hour
+
+	traktListSortByRank = "rank"
+	traktListSortHowAsc = "asc"
+
+	TraktStatusCodeEnhanceYourCalm = 420 // https://github.com/trakt/api-help/discussions/350
+
+	traktSyncModeAddOnly    = "add-only"
+	traktSyncModeDryRun     = "dry-run"
+	traktSyncModeFull       = "full"
+	traktSyncModeRemoveOnly = "remove-only"
 )
 
 type TraktClient struct {
-	client *http.Client
-	config TraktConfig
-	logger *zap.Logger
+	client     *http.Client
+	config     TraktConfig
+	logger     *zap.Logger
+	rateLimits *rateLimitWatcher
 }
 
 type TraktConfig struct {
-	accessToken  string
-	ClientId     string
-	ClientSecret string
-	Email        string
-	Password     string
-	username     string
-	SyncMode     string
+	accessToken       string
+	ClientId          string
+	ClientSecret      string
+	Email             string
+	Password          string
+	username          string
+	SyncMode          string
+	SyncModeOverrides map[string]string // keyed by sync target
+	Concurrency       int
+	// RateLimitWarnPercent is the percentage of a rate limit left when a warning is logged, which is never logged when zero
+	RateLimitWarnPercent int
+	// Tokens minted ahead of time by the device flow, which replace signing in with the email and password when set
+	Tokens *entities.TraktAuthTokensResponse
+	// OnTokensRefresh persists the tokens after the access token was refreshed
+	OnTokensRefresh func(tokens *entities.TraktAuthTokensResponse) error
 }
 
 func NewTraktClient(config TraktConfig, logger *zap.Logger) (TraktClientInterface, error) {
@@ -78,8 +108,13 @@ func NewTraktClient(config TraktConfig, logger *zap.Logger) (TraktClientInterfac
 	if err != nil {
 		return nil, fmt.Errorf("failure creating cookie jar: %w", err)
 	}
-	if !stringSliceContains(validSyncModes(), config.SyncMode) {
-		return nil, fmt.Errorf("failure using trakt sync mode %s: valid modes are %s", config.SyncMode, strings.Join(validSyncModes(), ", "))
+	if !stringSliceContains(ValidSyncModes(), config.SyncMode) {
+		return nil, fmt.Errorf("failure using trakt sync mode %s: valid modes are %s", config.SyncMode, strings.Join(ValidSyncModes(), ", "))
+	}
+	for target, mode := range config.SyncModeOverrides {
+		if mode != "" && !stringSliceContains(ValidSyncModes(), mode) {
+			return nil, fmt.Errorf("failure using trakt sync mode %s for %s: valid modes are %s", mode, target, strings.Join(ValidSyncModes(), ", "))
+		}
 	}
 	client := &TraktClient{
 		client: &http.Client{
@@ -88,8 +123,16 @@ func NewTraktClient(config TraktConfig, logger *zap.Logger) (TraktClientInterfac
 		config: config,
 		logger: logger,
 	}
-	if err = client.hydrate(); err != nil {
-		return nil, fmt.Errorf("failure hydrating trakt client: %w", err)
+	client.rateLimits = newRateLimitWatcher(config.RateLimitWarnPercent)
+	hydrate := client.hydrate
+	if config.Tokens != nil {
+		hydrate = client.hydrateFromTokens
+	}
+	if err = hydrate(); err != nil {
+		return nil, &AuthError{
+			clientName: clientNameTrakt,
+			err:        fmt.Errorf("failure hydrating trakt client: %w", err),
+		}
 	}
 	return client, nil
 }
@@ -125,6 +168,105 @@ func (tc *TraktClient) hydrate() error {
 	return nil
 }
 
+// hydrateFromTokens uses the stored tokens, refreshing the access token shortly before it expires
+func (tc *TraktClient) hydrateFromTokens() error {
+	tokens := tc.config.Tokens
+	if time.Until(tokens.ExpiresAt()) < traktTokenRefreshWindow {
+		refreshed, err := tc.RefreshAccessToken(tokens.RefreshToken)
+		if err != nil {
+			return fmt.Errorf("failure refreshing trakt access token, run the auth command again: %w", err)
+		}
+		if tc.config.OnTokensRefresh != nil {
+			if err = tc.config.OnTokensRefresh(refreshed); err != nil {
+				return fmt.Errorf("failure storing refreshed trakt tokens: %w", err)
+			}
+		}
+		tokens = refreshed
+	}
+	tc.config.accessToken = tokens.AccessToken
+	settings, err := tc.UserSettingsGet()
+	if err != nil {
+		return fmt.Errorf("failure fetching trakt user settings: %w", err)
+	}
+	tc.config.username = settings.User.Ids.Slug
+	return nil
+}
+
+// AuthorizeDevice runs the trakt device flow: it shows the user code through prompt and waits until the user approves the application
+func AuthorizeDevice(config TraktConfig, logger *zap.Logger, prompt func(codes *entities.TraktAuthCodesResponse)) (*entities.TraktAuthTokensResponse, error) {
+	tc := &TraktClient{
+		client:     &http.Client{},
+		config:     config,
+		logger:     logger,
+		rateLimits: newRateLimitWatcher(config.RateLimitWarnPercent),
+	}
+	codes, err := tc.GetAuthCodes()
+	if err != nil {
+		return nil, fmt.Errorf("failure generating auth codes: %w", err)
+	}
+	prompt(codes)
+	interval := time.Duration(codes.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(codes.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		tokens, err := tc.GetAccessToken(codes.DeviceCode)
+		var apiError *ApiError
+		if errors.As(err, &apiError) && apiError.StatusCode == http.StatusBadRequest {
+			continue // the user has not approved the application yet
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure exchanging trakt device code for access token: %w", err)
+		}
+		return tokens, nil
+	}
+	return nil, fmt.Errorf("failure exchanging trakt device code for access token: the code expired before it was approved")
+}
+
+func (tc *TraktClient) RefreshAccessToken(refreshToken string) (*entities.TraktAuthTokensResponse, error) {
+	body, err := json.Marshal(entities.TraktAuthRefreshBody{
+		RefreshToken: refreshToken,
+		ClientID:     tc.config.ClientId,
+		ClientSecret: tc.config.ClientSecret,
+		RedirectUri:  traktRedirectUriOob,
+		GrantType:    traktGrantTypeRefreshToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodPost,
+		BasePath: traktPathBaseAPI,
+		Endpoint: traktPathAuthRefresh,
+		Body:     bytes.NewReader(body),
+		Headers: map[string]string{
+			traktHeaderKeyContentType: "application/json",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readAuthTokensResponse(response.Body)
+}
+
+func (tc *TraktClient) UserSettingsGet() (*entities.TraktUserSettings, error) {
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodGet,
+		BasePath: traktPathBaseAPI,
+		Endpoint: traktPathUserSettings,
+		Body:     http.NoBody,
+		Headers:  tc.defaultApiHeaders(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	settings := entities.TraktUserSettings{}
+	if err = json.NewDecoder(response.Body).Decode(&settings); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling trakt user settings: %w", err)
+	}
+	return &settings, nil
+}
+
 func (tc *TraktClient) BrowseSignIn() (*string, error) {
 	response, err := tc.doRequest(requestFields{
 		Method:   http.MethodGet,
@@ -287,10 +429,13 @@ func (tc *TraktClient) doRequest(requestFields requestFields) (*http.Response, e
 		request.Header.Set(key, value)
 	}
 	for retries := 0; retries < 5; retries++ {
+		start := time.Now()
 		response, err := tc.client.Do(request)
 		if err != nil {
 			return nil, fmt.Errorf("error sending http request %s, %s: %w", request.Method, request.URL, err)
 		}
+		traceRequest(tc.logger, clientNameTrakt, request, response.StatusCode, start)
+		tc.rateLimits.observe(tc.logger, response)
 		switch response.StatusCode {
 		case http.StatusOK:
 			return response, nil
@@ -300,8 +445,9 @@ func (tc *TraktClient) doRequest(requestFields requestFields) (*http.Response, e
 			return response, nil
 		case http.StatusNotFound:
 			return response, nil
-		case traktStatusCodeEnhanceYourCalm:
+		case TraktStatusCodeEnhanceYourCalm:
 			response.Body.Close()
+			metrics.RecordRateLimit(clientNameTrakt, false)
 			return nil, &ApiError{
 				httpMethod: response.Request.Method,
 				url:        response.Request.URL.String(),
@@ -317,6 +463,8 @@ func (tc *TraktClient) doRequest(requestFields requestFields) (*http.Response, e
 			duration := time.Duration(retryAfter) * time.Second
 			message := fmt.Sprintf("trakt rate limit reached, waiting for %s then retrying http request %s %s", duration, response.Request.Method, response.Request.URL)
 			tc.logger.Warn(message)
+			metrics.RecordRateLimit(clientNameTrakt, true)
+			recordRetryTelemetry(clientNameTrakt, request, duration)
 			time.Sleep(duration)
 			continue
 		default:
@@ -329,7 +477,12 @@ func (tc *TraktClient) doRequest(requestFields requestFields) (*http.Response, e
 			}
 		}
 	}
-	return nil, fmt.Errorf("reached max retry attempts for %s %s", request.Method, request.URL)
+	return nil, &ApiError{
+		httpMethod: request.Method,
+		url:        request.URL.String(),
+		StatusCode: http.StatusTooManyRequests,
+		details:    "reached max retry attempts",
+	}
 }
 
 func (tc *TraktClient) WatchlistGet() (*entities.TraktList, error) {
@@ -353,9 +506,9 @@ func (tc *TraktClient) WatchlistGet() (*entities.TraktList, error) {
 }
 
 func (tc *TraktClient) WatchlistItemsAdd(items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun {
-		tc.logger.Info(fmt.Sprintf("sync mode dry run would have added %d trakt list item(s)", len(items)), zap.Array("watchlist", items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetWatchlist); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have added %d trakt list item(s)", mode, len(items)), zap.Array("watchlist", items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -376,13 +529,13 @@ func (tc *TraktClient) WatchlistItemsAdd(items entities.TraktItems) error {
 		return err
 	}
 	tc.logger.Info("synced trakt watchlist", zap.Object("watchlist", traktResponse))
-	return nil
+	return traktResponseError(entities.SyncTargetWatchlist, traktResponse)
 }
 
 func (tc *TraktClient) WatchlistItemsRemove(items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun || tc.config.SyncMode == traktSyncModeAddOnly {
-		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt list item(s)", tc.config.SyncMode, len(items)), zap.Array("watchlist", items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetWatchlist); !syncModeAllowsRemove(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt list item(s)", mode, len(items)), zap.Array("watchlist", items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -403,7 +556,7 @@ func (tc *TraktClient) WatchlistItemsRemove(items entities.TraktItems) error {
 		return err
 	}
 	tc.logger.Info("synced trakt watchlist", zap.Object("watchlist", traktResponse))
-	return nil
+	return traktResponseError(entities.SyncTargetWatchlist, traktResponse)
 }
 
 func (tc *TraktClient) ListGet(listId string) (*entities.TraktList, error) {
@@ -434,9 +587,9 @@ func (tc *TraktClient) ListGet(listId string) (*entities.TraktList, error) {
 }
 
 func (tc *TraktClient) ListItemsAdd(listId string, items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun {
-		tc.logger.Info(fmt.Sprintf("sync mode dry run would have added %d trakt list item(s)", len(items)), zap.Array(listId, items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetList); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have added %d trakt list item(s)", mode, len(items)), zap.Array(listId, items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -457,13 +610,13 @@ func (tc *TraktClient) ListItemsAdd(listId string, items entities.TraktItems) er
 		return err
 	}
 	tc.logger.Info("synced trakt list", zap.Object(listId, traktResponse))
-	return nil
+	return traktResponseError(listId, traktResponse)
 }
 
 func (tc *TraktClient) ListItemsRemove(listId string, items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun || tc.config.SyncMode == traktSyncModeAddOnly {
-		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt list item(s)", tc.config.SyncMode, len(items)), zap.Array(listId, items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetList); !syncModeAllowsRemove(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt list item(s)", mode, len(items)), zap.Array(listId, items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -484,6 +637,32 @@ func (tc *TraktClient) ListItemsRemove(listId string, items entities.TraktItems)
 		return err
 	}
 	tc.logger.Info("synced trakt list", zap.Object(listId, traktResponse))
+	return traktResponseError(listId, traktResponse)
+}
+
+func (tc *TraktClient) ListItemsReorder(listId string, rank []int64) error {
+	if mode := tc.SyncMode(entities.SyncTargetList); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have reordered %d item(s) of trakt list %s", mode, len(rank), listId))
+		return &SyncModeSkippedError{Mode: mode}
+	}
+	body, err := json.Marshal(entities.TraktListReorderBody{
+		Rank: rank,
+	})
+	if err != nil {
+		return err
+	}
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodPost,
+		BasePath: traktPathBaseAPI,
+		Endpoint: fmt.Sprintf(traktPathUserListItemsReorder, tc.config.username, listId),
+		Body:     bytes.NewReader(body),
+		Headers:  tc.defaultApiHeaders(),
+	})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	tc.logger.Info(fmt.Sprintf("reordered %d item(s) of trakt list %s", len(rank), listId))
 	return nil
 }
 
@@ -510,10 +689,15 @@ func (tc *TraktClient) ListsGet(ids []entities.TraktIds) ([]entities.TraktList,
 	)
 	go func() {
 		waitGroup := new(sync.WaitGroup)
+		semaphore := newSemaphore(tc.config.Concurrency, len(ids))
 		for _, id := range ids {
 			waitGroup.Add(1)
+			semaphore <- struct{}{}
 			go func(id entities.TraktIds) {
-				defer waitGroup.Done()
+				defer func() {
+					<-semaphore
+					waitGroup.Done()
+				}()
 				list, err := tc.ListGet(id.Slug)
 				if err != nil {
 					var apiError *ApiError
@@ -543,19 +727,25 @@ func (tc *TraktClient) ListsGet(ids []entities.TraktIds) ([]entities.TraktList,
 	}
 }
 
-func (tc *TraktClient) ListAdd(listId, listName string) error {
-	if tc.config.SyncMode == traktSyncModeDryRun {
-		tc.logger.Info(fmt.Sprintf("sync mode dry run would have created trakt list %s", listId))
-		return nil
+func (tc *TraktClient) ListAdd(listId, listName, description, sortBy, sortHow string) error {
+	if mode := tc.SyncMode(entities.SyncTargetList); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have created trakt list %s", mode, listId))
+		return &SyncModeSkippedError{Mode: mode}
+	}
+	if sortBy == "" || sortHow == "" {
+		sortBy, sortHow = traktListSortByRank, traktListSortHowAsc
+	}
+	if description == "" {
+		description = fmt.Sprintf("%s on %v", entities.TraktListDescriptionAutoImported, time.Now().Format(time.RFC1123))
 	}
 	body, err := json.Marshal(entities.TraktListAddBody{
 		Name:           listName,
-		Description:    fmt.Sprintf("list auto imported from imdb by https://github.com/cecobask/imdb-trakt-sync on %v", time.Now().Format(time.RFC1123)),
+		Description:    description,
 		Privacy:        "public",
 		DisplayNumbers: false,
 		AllowComments:  true,
-		SortBy:         "rank",
-		SortHow:        "asc",
+		SortBy:         sortBy,
+		SortHow:        sortHow,
 	})
 	if err != nil {
 		return err
@@ -576,9 +766,9 @@ func (tc *TraktClient) ListAdd(listId, listName string) error {
 }
 
 func (tc *TraktClient) ListRemove(listId string) error {
-	if tc.config.SyncMode == traktSyncModeDryRun || tc.config.SyncMode == traktSyncModeAddOnly {
-		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted trakt list %s", tc.config.SyncMode, listId))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetList); !syncModeAllowsRemove(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted trakt list %s", mode, listId))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	response, err := tc.doRequest(requestFields{
 		Method:   http.MethodDelete,
@@ -610,9 +800,9 @@ func (tc *TraktClient) RatingsGet() (entities.TraktItems, error) {
 }
 
 func (tc *TraktClient) RatingsAdd(items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun {
-		tc.logger.Info(fmt.Sprintf("sync mode dry run would have added %d trakt rating item(s)", len(items)), zap.Array("ratings", items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetRatings); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have added %d trakt rating item(s)", mode, len(items)), zap.Array("ratings", items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -633,13 +823,13 @@ func (tc *TraktClient) RatingsAdd(items entities.TraktItems) error {
 		return err
 	}
 	tc.logger.Info("synced trakt ratings", zap.Object("ratings", traktResponse))
-	return nil
+	return traktResponseError(entities.SyncTargetRatings, traktResponse)
 }
 
 func (tc *TraktClient) RatingsRemove(items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun || tc.config.SyncMode == traktSyncModeAddOnly {
-		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt rating item(s)", tc.config.SyncMode, len(items)), zap.Array("ratings", items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetRatings); !syncModeAllowsRemove(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt rating item(s)", mode, len(items)), zap.Array("ratings", items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -660,7 +850,7 @@ func (tc *TraktClient) RatingsRemove(items entities.TraktItems) error {
 		return err
 	}
 	tc.logger.Info("synced trakt ratings", zap.Object("ratings", traktResponse))
-	return nil
+	return traktResponseError(entities.SyncTargetRatings, traktResponse)
 }
 
 func (tc *TraktClient) HistoryGet(itemType, itemId string) (entities.TraktItems, error) {
@@ -678,9 +868,9 @@ func (tc *TraktClient) HistoryGet(itemType, itemId string) (entities.TraktItems,
 }
 
 func (tc *TraktClient) HistoryAdd(items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun {
-		tc.logger.Info(fmt.Sprintf("sync mode dry run would have added %d trakt history item(s)", len(items)), zap.Array("history", items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetHistory); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have added %d trakt history item(s)", mode, len(items)), zap.Array("history", items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -701,13 +891,13 @@ func (tc *TraktClient) HistoryAdd(items entities.TraktItems) error {
 		return err
 	}
 	tc.logger.Info("synced trakt history", zap.Object("history", traktResponse))
-	return nil
+	return traktResponseError(entities.SyncTargetHistory, traktResponse)
 }
 
 func (tc *TraktClient) HistoryRemove(items entities.TraktItems) error {
-	if tc.config.SyncMode == traktSyncModeDryRun || tc.config.SyncMode == traktSyncModeAddOnly {
-		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt history item(s)", tc.config.SyncMode, len(items)), zap.Array("history", items))
-		return nil
+	if mode := tc.SyncMode(entities.SyncTargetHistory); !syncModeAllowsRemove(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have deleted %d trakt history item(s)", mode, len(items)), zap.Array("history", items))
+		return &SyncModeSkippedError{Mode: mode}
 	}
 	body, err := json.Marshal(mapTraktItemsToTraktBody(items))
 	if err != nil {
@@ -728,7 +918,254 @@ func (tc *TraktClient) HistoryRemove(items entities.TraktItems) error {
 		return err
 	}
 	tc.logger.Info("synced trakt history", zap.Object("history", traktResponse))
-	return nil
+	return traktResponseError(entities.SyncTargetHistory, traktResponse)
+}
+
+// MetadataGet returns the title, year and poster of the movie, show or episode with the imdb id, or nil when trakt does not know it
+func (tc *TraktClient) MetadataGet(imdbId string) (*entities.TraktMetadata, error) {
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodGet,
+		BasePath: traktPathBaseAPI,
+		Endpoint: fmt.Sprintf(traktPathSearchImdb, url.PathEscape(imdbId)),
+		Body:     http.NoBody,
+		Headers:  tc.defaultApiHeaders(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	type media struct {
+		Title  string `json:"title"`
+		Year   int    `json:"year"`
+		Images struct {
+			Poster []string `json:"poster"`
+		} `json:"images"`
+	}
+	var results []struct {
+		Type    string `json:"type"`
+		Movie   *media `json:"movie"`
+		Show    *media `json:"show"`
+		Episode *media `json:"episode"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling trakt search results: %w", err)
+	}
+	for _, result := range results {
+		item := result.Movie
+		if result.Type == entities.TraktItemTypeShow || result.Type == entities.TraktItemTypeEpisode {
+			item = result.Show
+		}
+		if item == nil {
+			continue
+		}
+		metadata := &entities.TraktMetadata{
+			Type:  result.Type,
+			Title: item.Title,
+			Year:  item.Year,
+		}
+		if result.Type == entities.TraktItemTypeEpisode && result.Episode != nil {
+			metadata.Title = fmt.Sprintf("%s - %s", item.Title, result.Episode.Title)
+		}
+		// trakt serves the images without their scheme
+		if len(item.Images.Poster) > 0 {
+			metadata.Poster = "https://" + strings.TrimPrefix(item.Images.Poster[0], "https://")
+		}
+		return metadata, nil
+	}
+	return nil, nil
+}
+
+// SearchTitle returns the ids of the movie or show whose title is the given one, released in the year unless it is 0,
+// or nil when trakt knows no item of that exact title, as the first search result is not always the right one
+func (tc *TraktClient) SearchTitle(itemType, title string, year int) (*entities.TraktIds, error) {
+	results, err := tc.SearchTitles(itemType, title, year)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if strings.EqualFold(strings.TrimSpace(results[i].Title), strings.TrimSpace(title)) {
+			return &results[i].Ids, nil
+		}
+	}
+	return nil, nil
+}
+
+// SearchTitles returns the movies or shows trakt finds for the title, released in the year unless it is 0, most relevant first
+func (tc *TraktClient) SearchTitles(itemType, title string, year int) ([]entities.TraktSearchResult, error) {
+	endpoint := fmt.Sprintf(traktPathSearchText, itemType, url.QueryEscape(title))
+	if year > 0 {
+		endpoint += fmt.Sprintf("&years=%d", year)
+	}
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodGet,
+		BasePath: traktPathBaseAPI,
+		Endpoint: endpoint,
+		Body:     http.NoBody,
+		Headers:  tc.defaultApiHeaders(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var results []map[string]json.RawMessage
+	if err = json.NewDecoder(response.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling trakt search results: %w", err)
+	}
+	items := make([]entities.TraktSearchResult, 0, len(results))
+	for _, result := range results {
+		var item entities.TraktSearchResult
+		if err = json.Unmarshal(result[itemType], &item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// SearchTmdbId returns the ids of the movie or show with the tmdb id, or nil when trakt does not know it
+func (tc *TraktClient) SearchTmdbId(itemType string, tmdbId int) (*entities.TraktIds, error) {
+	return tc.searchId(fmt.Sprintf(traktPathSearchTmdb, tmdbId, itemType), itemType)
+}
+
+// SearchTvdbId returns the ids of the movie or show with the tvdb id, or nil when trakt does not know it
+func (tc *TraktClient) SearchTvdbId(itemType string, tvdbId int) (*entities.TraktIds, error) {
+	return tc.searchId(fmt.Sprintf(traktPathSearchTvdb, tvdbId, itemType), itemType)
+}
+
+// ShowEpisodesGet returns the episodes of every season of the show, identified by its trakt or imdb id, along with their titles
+func (tc *TraktClient) ShowEpisodesGet(showId string) ([]entities.TraktShowEpisode, error) {
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodGet,
+		BasePath: traktPathBaseAPI,
+		Endpoint: fmt.Sprintf(traktPathShowSeasons, url.PathEscape(showId)),
+		Body:     http.NoBody,
+		Headers:  tc.defaultApiHeaders(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var seasons []struct {
+		Episodes []entities.TraktShowEpisode `json:"episodes"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&seasons); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling trakt seasons: %w", err)
+	}
+	var episodes []entities.TraktShowEpisode
+	for _, season := range seasons {
+		episodes = append(episodes, season.Episodes...)
+	}
+	return episodes, nil
+}
+
+func (tc *TraktClient) searchId(endpoint, itemType string) (*entities.TraktIds, error) {
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodGet,
+		BasePath: traktPathBaseAPI,
+		Endpoint: endpoint,
+		Body:     http.NoBody,
+		Headers:  tc.defaultApiHeaders(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	results, err := readTraktItems(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		switch {
+		case results[i].Type != itemType:
+			continue
+		case itemType == entities.TraktItemTypeShow:
+			return &results[i].Show.Ids, nil
+		case itemType == entities.TraktItemTypeMovie:
+			return &results[i].Movie.Ids, nil
+		}
+	}
+	return nil, nil
+}
+
+// CommentAdd posts a comment, reporting whether it did. Comments accompany the ratings they review, so they follow
+// the sync mode of the ratings. A comment trakt rejects, such as one on a title it does not know, is an error.
+func (tc *TraktClient) CommentAdd(comment entities.TraktComment) (bool, error) {
+	if mode := tc.SyncMode(entities.SyncTargetRatings); !syncModeAllowsAdd(mode) {
+		tc.logger.Info(fmt.Sprintf("sync mode %s would have posted a trakt comment", mode))
+		return false, nil
+	}
+	body, err := json.Marshal(comment)
+	if err != nil {
+		return false, err
+	}
+	response, err := tc.doRequest(requestFields{
+		Method:   http.MethodPost,
+		BasePath: traktPathBaseAPI,
+		Endpoint: traktPathComments,
+		Body:     bytes.NewReader(body),
+		Headers:  tc.defaultApiHeaders(),
+	})
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return false, &ApiError{
+			httpMethod: response.Request.Method,
+			url:        response.Request.URL.String(),
+			StatusCode: response.StatusCode,
+			details:    fmt.Sprintf("unexpected status code %d", response.StatusCode),
+		}
+	}
+	return true, nil
+}
+
+func (tc *TraktClient) CollectionGet() (entities.TraktItems, error) {
+	return tc.itemsGetByType(traktPathCollection)
+}
+
+func (tc *TraktClient) WatchedGet() (entities.TraktItems, error) {
+	return tc.itemsGetByType(traktPathWatched)
+}
+
+// itemsGetByType fetches movies and shows from endpoints whose responses do not specify the item type
+func (tc *TraktClient) itemsGetByType(endpointFormat string) (entities.TraktItems, error) {
+	var items entities.TraktItems
+	for _, itemType := range []string{entities.TraktItemTypeMovie, entities.TraktItemTypeShow} {
+		response, err := tc.doRequest(requestFields{
+			Method:   http.MethodGet,
+			BasePath: traktPathBaseAPI,
+			Endpoint: fmt.Sprintf(endpointFormat, itemType+"s"),
+			Body:     http.NoBody,
+			Headers:  tc.defaultApiHeaders(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		typeItems, err := readTraktItems(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		for i := range typeItems {
+			typeItems[i].Type = itemType
+		}
+		items = append(items, typeItems...)
+	}
+	return items, nil
+}
+
+// SyncMode returns the sync mode the client applies to the changes of a target
+func (tc *TraktClient) SyncMode(target string) string {
+	return targetSyncMode(tc.config.SyncMode, tc.config.SyncModeOverrides, target)
+}
+
+func traktResponseError(target string, response *entities.TraktResponse) error {
+	if response.NotFound == nil || response.NotFound.Count() == 0 {
+		return nil
+	}
+	return &ItemsNotFoundError{
+		target:   target,
+		NotFound: *response.NotFound,
+	}
 }
 
 func mapTraktItemsToTraktBody(items entities.TraktItems) entities.TraktListBody {
@@ -763,6 +1200,7 @@ func readAuthTokensResponse(body io.ReadCloser) (*entities.TraktAuthTokensRespon
 	if err := json.NewDecoder(body).Decode(&response); err != nil {
 		return nil, fmt.Errorf("failure unmarshalling trakt auth tokens response: %w", err)
 	}
+	logger.AddSecrets(response.AccessToken, response.RefreshToken)
 	return &response, nil
 }
 
@@ -810,10 +1248,27 @@ func stringSliceContains(slice []string, element string) bool {
 	return false
 }
 
-func validSyncModes() []string {
+func ValidSyncModes() []string {
 	return []string{
 		traktSyncModeFull,
 		traktSyncModeAddOnly,
+		traktSyncModeRemoveOnly,
 		traktSyncModeDryRun,
 	}
 }
+
+func syncModeAllowsAdd(mode string) bool {
+	return mode == traktSyncModeFull || mode == traktSyncModeAddOnly
+}
+
+func syncModeAllowsRemove(mode string) bool {
+	return mode == traktSyncModeFull || mode == traktSyncModeRemoveOnly
+}
+
+// targetSyncMode returns the sync mode of a target, falling back to the sync mode of every target
+func targetSyncMode(syncMode string, overrides map[string]string, target string) string {
+	if mode := overrides[target]; mode != "" {
+		return mode
+	}
+	return syncMode
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/console"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	flagOpenBrowser = "open-browser"
+	flagSimkl       = "simkl"
+)
+
+func newAuthCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "auth",
+		Short: "Authorize the application on Trakt once and store the tokens for later syncs",
+		Long: "Run the Trakt device flow interactively and store the tokens, so scheduled syncs use them instead of signing in with " +
+			"the Trakt email and password. The tokens are refreshed automatically before they expire. " +
+			"Pass --simkl to authorize the application on Simkl instead, whose access token never expires.",
+		Args: withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			openBrowser, _ := cmd.Flags().GetBool(flagOpenBrowser)
+			if simkl, _ := cmd.Flags().GetBool(flagSimkl); simkl {
+				if err := authorizeSimkl(cmd, openBrowser); err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err)
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "Successfully authorized the application on simkl, stored the access token for later syncs")
+				return nil
+			}
+			if err := authorizeTrakt(cmd, openBrowser); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Successfully authorized the application on trakt, stored the tokens for later syncs")
+			return nil
+		},
+	}
+	command.Flags().Bool(flagOpenBrowser, false, "open the verification page in the default browser")
+	command.Flags().Bool(flagSimkl, false, "authorize the application on simkl instead of trakt")
+	return command
+}
+
+// authorizeTrakt runs the trakt device flow, printing the code to enter along with a countdown until it expires
+func authorizeTrakt(cmd *cobra.Command, openBrowser bool) error {
+	prompt, finish := authPrompt(cmd, openBrowser)
+	err := syncer.AuthorizeTrakt(func(codes *entities.TraktAuthCodesResponse) {
+		prompt(codes.VerificationUrl, codes.UserCode, codes.ExpiresIn)
+	})
+	finish()
+	return err
+}
+
+// authorizeSimkl runs the simkl pin flow, prompting the same way as the trakt device flow
+func authorizeSimkl(cmd *cobra.Command, openBrowser bool) error {
+	prompt, finish := authPrompt(cmd, openBrowser)
+	err := syncer.AuthorizeSimkl(func(codes *entities.SimklAuthCodesResponse) {
+		prompt(codes.VerificationUrl, codes.UserCode, codes.ExpiresIn)
+	})
+	finish()
+	return err
+}
+
+// authPrompt returns a prompt that prints the code to enter along with a countdown until it expires,
+// and a function that stops the countdown once the flow is over
+func authPrompt(cmd *cobra.Command, openBrowser bool) (func(verificationUrl, userCode string, expiresIn int), func()) {
+	out := cmd.OutOrStdout()
+	var (
+		done    = make(chan struct{})
+		waiting sync.WaitGroup
+	)
+	prompt := func(verificationUrl, userCode string, expiresIn int) {
+		printAuthCodes(out, verificationUrl, userCode)
+		if openBrowser {
+			if err := openUrl(verificationUrl); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "failure opening the browser, visit the page manually: %s\n", err)
+			}
+		}
+		waiting.Add(1)
+		go func() {
+			defer waiting.Done()
+			countdown(out, time.Now().Add(time.Duration(expiresIn)*time.Second), done)
+		}()
+	}
+	finish := func() {
+		close(done)
+		waiting.Wait()
+	}
+	return prompt, finish
+}
+
+// printAuthCodes prints the verification url and the user code in a block that stands out from the logs
+func printAuthCodes(out io.Writer, verificationUrl, userCode string) {
+	border := strings.Repeat("=", 60)
+	fmt.Fprintf(out, "\n%s\n", border)
+	fmt.Fprintf(out, "  1. Open    %s\n", console.Colorize(out, console.Bold, verificationUrl))
+	fmt.Fprintf(out, "  2. Enter   %s\n", console.Colorize(out, console.Bold+console.Yellow, userCode))
+	fmt.Fprintf(out, "%s\n\n", border)
+}
+
+// countdown keeps a line with the time left to approve the code up to date, until done is closed or the code expires.
+// Output that is not a terminal gets a single line instead, so logs are not flooded.
+func countdown(out io.Writer, expiresAt time.Time, done <-chan struct{}) {
+	if !console.IsTerminal(out) {
+		fmt.Fprintf(out, "Waiting for approval, the code expires at %s\n", expiresAt.Local().Format(time.Kitchen))
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		left := time.Until(expiresAt).Round(time.Second)
+		if left < 0 {
+			left = 0
+		}
+		fmt.Fprintf(out, "\rWaiting for approval, the code expires in %d:%02d ", int(left.Minutes()), int(left.Seconds())%60)
+		if left == 0 {
+			fmt.Fprintln(out)
+			return
+		}
+		select {
+		case <-done:
+			fmt.Fprintln(out)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func openUrl(url string) error {
+	var command *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		command = exec.Command("open", url)
+	case "windows":
+		command = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		command = exec.Command("xdg-open", url)
+	}
+	return command.Start()
+}
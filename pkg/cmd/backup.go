@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+)
+
+const defaultBackupPath = "trakt-backup.json"
+
+func newBackupCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup [path]",
+		Short: "Save the Trakt watchlist, lists and ratings to a backup file",
+		Long:  "Save the Trakt watchlist, lists and ratings to a backup file, which defaults to trakt-backup.json in the state directory.",
+		Args:  withUsage(cobra.MaximumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := newSyncer(cmd)
+			if err != nil {
+				return err
+			}
+			path := pathArg(args, syncer.StatePath(defaultBackupPath))
+			if err = s.Backup(path); err != nil {
+				return err
+			}
+			if jsonOutput(cmd) {
+				return printJson(cmd.OutOrStdout(), fileOutput{Path: path})
+			}
+			return nil
+		},
+	}
+}
+
+func newRestoreCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <path>",
+		Short: "Add the items of a backup file back to Trakt, recreating missing lists",
+		Args:  withUsage(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := newSyncer(cmd)
+			if err != nil {
+				return err
+			}
+			return s.Restore(args[0])
+		},
+	}
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/config"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// annotationManagesConfig marks commands that export the settings of the config file themselves
+	annotationManagesConfig = "manages-config"
+	// annotationServesMetrics marks long-running commands that prometheus scrapes, whose metrics are never pushed
+	annotationServesMetrics = "serves-metrics"
+
+	configPollInterval = 5 * time.Second
+	metricsPath        = "/metrics"
+)
+
+var errDaemonStopped = errors.New("daemon stopped")
+
+func newDaemonCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "daemon",
+		Short: "Keep running and sync on a schedule, reloading the config file when it changes",
+		Long: fmt.Sprintf("Keep running and sync every %s (defaults to 6h), delayed by up to %s. Changes to the config file are applied to the next sync without a restart, "+
+			"except for credentials, which are only reloaded on SIGHUP.", syncer.EnvVarKeySyncInterval, syncer.EnvVarKeySyncJitter),
+		Args:        withUsage(cobra.NoArgs),
+		Annotations: map[string]string{annotationManagesConfig: "true", annotationServesMetrics: "true"},
+		RunE:        runDaemon,
+	}
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	log := logger.NewLogger()
+	watcher := &configWatcher{
+		profile: activeProfile(cmd),
+	}
+	if err := watcher.load(true); err != nil {
+		return &usageError{err: err}
+	}
+	if watcher.profile != "" {
+		if err := os.Setenv(syncer.EnvVarKeyProfile, watcher.profile); err != nil {
+			return &usageError{err: err}
+		}
+	}
+	if addr := os.Getenv(metrics.EnvVarKeyMetricsAddr); addr != "" {
+		if err := serveMetrics(cmd, log, addr); err != nil {
+			return &usageError{err: err}
+		}
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	poll := time.NewTicker(configPollInterval)
+	defer poll.Stop()
+	for {
+		lastRun := time.Now()
+		if err := runScheduledSync(cmd); err != nil {
+			var interrupted *syncer.InterruptedError
+			if errors.As(err, &interrupted) {
+				return err
+			}
+			// the syncer already logged the failure, which is retried on the next scheduled sync
+		}
+		if err := waitForNextSync(cmd, log, watcher, hangup, poll, lastRun); err != nil {
+			if errors.Is(err, errDaemonStopped) {
+				log.Info("stopped the daemon")
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// waitForNextSync blocks until the next scheduled sync, reloading the config file meanwhile.
+// It returns errDaemonStopped once the command context is done.
+func waitForNextSync(cmd *cobra.Command, log *zap.Logger, watcher *configWatcher, hangup <-chan os.Signal, poll *time.Ticker, lastRun time.Time) error {
+	interval, jitter := syncer.SyncInterval(), syncer.Jitter()
+	log.Info(fmt.Sprintf("next sync scheduled at %s", lastRun.Add(interval+jitter).Format(time.RFC3339)))
+	timer := time.NewTimer(time.Until(lastRun.Add(interval + jitter)))
+	defer timer.Stop()
+	for {
+		select {
+		case <-cmd.Context().Done():
+			return errDaemonStopped
+		case <-timer.C:
+			return nil
+		case <-hangup:
+			watcher.reload(log, true)
+		case <-poll.C:
+			if !watcher.changed() {
+				continue
+			}
+			watcher.reload(log, false)
+		}
+		// the reloaded config file may have changed the schedule
+		if next := syncer.SyncInterval(); next != interval {
+			interval = next
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(time.Until(lastRun.Add(interval + jitter)))
+			log.Info(fmt.Sprintf("next sync rescheduled at %s", lastRun.Add(interval+jitter).Format(time.RFC3339)))
+		}
+	}
+}
+
+// serveMetrics exposes the metrics of the daemon at /metrics for prometheus to scrape, until the command context is done
+func serveMetrics(cmd *cobra.Command, log *zap.Logger, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failure listening on %s from %s: %w", addr, metrics.EnvVarKeyMetricsAddr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, metrics.Handler())
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failure serving metrics", zap.Error(err))
+		}
+	}()
+	go func() {
+		<-cmd.Context().Done()
+		_ = server.Close()
+	}()
+	log.Info(fmt.Sprintf("serving metrics at http://%s%s", listener.Addr(), metricsPath))
+	return nil
+}
+
+func runScheduledSync(cmd *cobra.Command) error {
+	startedAt := time.Now()
+	s, err := newSyncer(cmd)
+	if err != nil {
+		// runs failing before they start, such as after breaking the config file, still show in the metrics
+		metrics.RecordRun(entities.SyncSummary{StartedAt: startedAt, FinishedAt: time.Now()}, err)
+		return err
+	}
+	return s.Run()
+}
+
+// configWatcher exports the settings of the config file and replaces them whenever the file changes.
+// Credentials are kept from the last explicit reload, so an edit in progress never signs in with half-updated credentials.
+type configWatcher struct {
+	profile     string
+	modTime     time.Time
+	size        int64
+	credentials map[string]string
+	restore     func()
+}
+
+func (w *configWatcher) load(reloadCredentials bool) error {
+	w.modTime, w.size = configFileStat()
+	file, err := config.LoadDefault()
+	if err != nil {
+		return err
+	}
+	settings := make(map[string]string, len(file.Settings))
+	for key, value := range file.Settings {
+		settings[key] = value
+	}
+	if w.profile != "" {
+		if settings, err = file.Profile(w.profile); err != nil {
+			return err
+		}
+	}
+	if reloadCredentials || w.credentials == nil {
+		w.credentials = make(map[string]string)
+		for _, key := range syncer.CredentialEnvVarKeys() {
+			if value, ok := settings[key]; ok {
+				w.credentials[key] = value
+			}
+		}
+	}
+	for _, key := range syncer.CredentialEnvVarKeys() {
+		delete(settings, key)
+		if value, ok := w.credentials[key]; ok {
+			settings[key] = value
+		}
+	}
+	if w.restore != nil {
+		w.restore()
+	}
+	w.restore, err = config.Export(settings)
+	return err
+}
+
+// reload loads the config file again, keeping the previous settings when it is invalid
+func (w *configWatcher) reload(log *zap.Logger, reloadCredentials bool) {
+	if err := w.load(reloadCredentials); err != nil {
+		log.Error("failure reloading the config file, keeping the previous settings", zap.Error(err))
+		return
+	}
+	if reloadCredentials {
+		log.Info("reloaded the config file including credentials")
+		return
+	}
+	log.Info("reloaded the config file, send SIGHUP to also reload credentials")
+}
+
+func (w *configWatcher) changed() bool {
+	modTime, size := configFileStat()
+	return !modTime.Equal(w.modTime) || size != w.size
+}
+
+func configFileStat() (time.Time, int64) {
+	path, _ := config.Path()
+	if path == "" {
+		return time.Time{}, 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
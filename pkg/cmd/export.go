@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultExportPath           = "imdb-export.json"
+	defaultLetterboxdExportPath = "letterboxd.csv"
+
+	flagFormat = "format"
+)
+
+func newExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [path]",
+		Short: "Save the IMDb watchlist, lists and ratings to a file without syncing",
+		Long: "Save the IMDb watchlist, lists and ratings to a json or csv file without signing in to Trakt. " +
+			"The format is detected from the extension of the file, unless set with the --format flag. " +
+			"The letterboxd-csv format exports the rated films and every list to csv files for the Letterboxd importers, " +
+			"to be imported by hand, as nothing is pushed to a Letterboxd account.",
+		Args: withUsage(cobra.MaximumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString(flagFormat)
+			path := pathArg(args, defaultExportPath)
+			if format == syncer.FileFormatLetterboxdCsv {
+				path = pathArg(args, defaultLetterboxdExportPath)
+			}
+			if _, err := syncer.ExportFormat(path, format); err != nil {
+				return &usageError{err: err}
+			}
+			s, err := newSyncer(cmd, syncer.WithImdbOnly())
+			if err != nil {
+				return err
+			}
+			if err = s.Export(path, format); err != nil {
+				return err
+			}
+			if jsonOutput(cmd) {
+				return printJson(cmd.OutOrStdout(), fileOutput{Path: path})
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String(flagFormat, "", fmt.Sprintf("format of the export file, %s, %s or %s (defaults to the file extension)", syncer.FileFormatJson, syncer.FileFormatCsv, syncer.FileFormatLetterboxdCsv))
+	return cmd
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/history"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the recorded runs, most recent first",
+		Long: "List the recorded runs, most recent first, along with the number of items they added and removed. " +
+			"Run history show <run-id> to print every change a run applied.",
+		Args: withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := syncer.NewRunHistory().List()
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				return err
+			}
+			if jsonOutput(cmd) {
+				return printJson(cmd.OutOrStdout(), runs)
+			}
+			return history.PrintRuns(cmd.OutOrStdout(), runs)
+		},
+	}
+	cmd.AddCommand(newHistoryShowCommand())
+	return cmd
+}
+
+func newHistoryShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <run-id>",
+		Short: "Print what a recorded run changed",
+		Long:  fmt.Sprintf("Print the outcome of a recorded run and every item it added or removed. Pass %s to print the most recent run.", history.Latest),
+		Args:  withUsage(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			run, err := syncer.NewRunHistory().Get(args[0])
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				return err
+			}
+			if jsonOutput(cmd) {
+				return printJson(cmd.OutOrStdout(), run)
+			}
+			return history.PrintRun(cmd.OutOrStdout(), *run)
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+const (
+	flagColumns  = "columns"
+	flagLinks    = "links"
+	flagListName = "list-name"
+	flagNetflix  = "netflix-profile"
+	flagTarget   = "target"
+)
+
+func newImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <path>",
+		Short: "Add the IMDb ids of a csv or json file to the Trakt watchlist, a list, ratings or history",
+		Long: "Add the IMDb ids of a csv or json file to the Trakt watchlist, a list, ratings or history without signing in to IMDb. " +
+			"Every record has an imdb_id and optionally a title_type, rating and watched_at date. " +
+			"The csv exports of IMDb can be imported as they are, and --columns maps the headers of any other csv file to these fields, " +
+			"along with a title and year to look up items without an imdb id, and a list to import every record to a list of its own. " +
+			"Pass --format serializd to import the history, ratings and reviews of a Serializd export, " +
+			"--format douban to import the history, ratings and wishes of a Douban csv export, " +
+			"--format icheckmovies to import the checks, favorites and watchlist of an iCheckMovies csv export, " +
+			"--format movielens to import the ratings of a MovieLens export, " +
+			"--format netflix to import the viewing history of Netflix to the Trakt history, " +
+			"or --format primevideo to import the watch history of Prime Video to the Trakt history, which need no target.",
+		Args: withUsage(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString(flagFormat)
+			target, _ := cmd.Flags().GetString(flagTarget)
+			listName, _ := cmd.Flags().GetString(flagListName)
+			format, err := syncer.ImportFormat(args[0], format)
+			if err != nil {
+				return &usageError{err: err}
+			}
+			switch format {
+			case syncer.FileFormatDouban:
+				s, err := newSyncer(cmd, syncer.WithTraktOnly())
+				if err != nil {
+					return err
+				}
+				return s.ImportDouban(args[0])
+			case syncer.FileFormatICheckMovies:
+				s, err := newSyncer(cmd, syncer.WithTraktOnly())
+				if err != nil {
+					return err
+				}
+				return s.ImportICheckMovies(args[0], listName)
+			case syncer.FileFormatMovieLens:
+				linksPath, _ := cmd.Flags().GetString(flagLinks)
+				s, err := newSyncer(cmd, syncer.WithTraktOnly())
+				if err != nil {
+					return err
+				}
+				return s.ImportMovieLens(args[0], linksPath)
+			case syncer.FileFormatNetflix:
+				profile, _ := cmd.Flags().GetString(flagNetflix)
+				s, err := newSyncer(cmd, syncer.WithTraktOnly())
+				if err != nil {
+					return err
+				}
+				return s.ImportNetflix(args[0], profile)
+			case syncer.FileFormatPrimeVideo:
+				s, err := newSyncer(cmd, syncer.WithTraktOnly())
+				if err != nil {
+					return err
+				}
+				return s.ImportPrimeVideo(args[0])
+			case syncer.FileFormatSerializd:
+				s, err := newSyncer(cmd, syncer.WithTraktOnly())
+				if err != nil {
+					return err
+				}
+				return s.ImportSerializd(args[0])
+			}
+			if err = syncer.ValidateImportTarget(target, listName); err != nil {
+				return &usageError{err: err}
+			}
+			s, err := newSyncer(cmd, syncer.WithTraktOnly())
+			if err != nil {
+				return err
+			}
+			return s.Import(args[0], format, target, listName)
+		},
+	}
+	cmd.Flags().String(flagFormat, "", fmt.Sprintf("format of the import file, %s, %s or one of %s (defaults to the file extension)", syncer.FileFormatJson, syncer.FileFormatCsv, strings.Join(syncer.ImportServiceFormats(), ", ")))
+	cmd.Flags().String(flagTarget, "", fmt.Sprintf("where to add the items: %s, %s, %s or %s", entities.SyncTargetWatchlist, entities.SyncTargetList, entities.SyncTargetRatings, entities.SyncTargetHistory))
+	cmd.Flags().String(flagColumns, "", fmt.Sprintf("comma separated field=header pairs mapping the csv headers to the fields of a record, overrides %s", syncer.EnvVarKeyImportColumns))
+	cmd.Flags().String(flagLinks, "", "path of the links.csv mapping the movies of a movielens dataset to their imdb and tmdb ids (defaults to the links.csv beside the ratings)")
+	cmd.Flags().String(flagListName, "", "name of the trakt list to add the items to, which is created when missing")
+	cmd.Flags().String(flagNetflix, "", "name of the netflix profile to import the viewing activity of, when it holds several profiles")
+	return cmd
+}
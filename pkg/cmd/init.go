@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/config"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+// setupQuestion asks for the value of a single setting during the setup wizard
+type setupQuestion struct {
+	key          string
+	prompt       string
+	defaultValue string
+}
+
+var setupQuestions = []setupQuestion{
+	{
+		key:    syncer.EnvVarKeyTraktClientId,
+		prompt: "Trakt API application client id (create one at https://trakt.tv/oauth/applications with redirect uri urn:ietf:wg:oauth:2.0:oob)",
+	},
+	{
+		key:    syncer.EnvVarKeyTraktClientSecret,
+		prompt: "Trakt API application client secret",
+	},
+	{
+		key:    syncer.EnvVarKeyTraktEmail,
+		prompt: "Trakt account email address",
+	},
+	{
+		key:    syncer.EnvVarKeyTraktPassword,
+		prompt: "Trakt account password",
+	},
+	{
+		key:    syncer.EnvVarKeyCookieAtMain,
+		prompt: "IMDb at-main cookie (inspect the cookies of imdb.com in your browser while signed in)",
+	},
+	{
+		key:    syncer.EnvVarKeyCookieUbidMain,
+		prompt: "IMDb ubid-main cookie",
+	},
+	{
+		key:          syncer.EnvVarKeyListIds,
+		prompt:       "Comma separated IMDb list ids to sync, or all",
+		defaultValue: "all",
+	},
+	{
+		key:          syncer.EnvVarKeySyncMode,
+		prompt:       "Sync mode (full, add-only, remove-only, dry-run)",
+		defaultValue: "dry-run",
+	},
+}
+
+// traktAppKeys are not asked for when the build embeds a trakt application, which signs in with the device flow instead
+var traktAppKeys = map[string]bool{
+	syncer.EnvVarKeyTraktClientId:     true,
+	syncer.EnvVarKeyTraktClientSecret: true,
+	syncer.EnvVarKeyTraktEmail:        true,
+	syncer.EnvVarKeyTraktPassword:     true,
+}
+
+const flagKeyring = "keyring"
+
+func newInitCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "init",
+		Short: "Set up the credentials interactively, test them and write a config file",
+		Args:  withUsage(cobra.NoArgs),
+		// the config file is about to be written, so it is not loaded beforehand
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, _ := config.Path()
+			if path == "" {
+				return &usageError{err: fmt.Errorf("failure locating the user config directory, set %s to choose the config file", config.EnvVarKeyConfigPath)}
+			}
+			if config.IsRemote(path) {
+				return &usageError{err: fmt.Errorf("config file %s is remote, set %s to a local path to write it", path, config.EnvVarKeyConfigPath)}
+			}
+			reader := bufio.NewReader(cmd.InOrStdin())
+			out := cmd.OutOrStdout()
+			if _, err := os.Stat(path); err == nil {
+				overwrite, err := ask(reader, out, fmt.Sprintf("Config file %s already exists, overwrite it? [y/N]", path), "n")
+				if err != nil {
+					return err
+				}
+				if answer := strings.ToLower(overwrite); answer != "y" && answer != "yes" {
+					return nil
+				}
+			}
+			settings := make(map[string]string, len(setupQuestions))
+			defaultTraktApp := syncer.HasDefaultTraktApp() && os.Getenv(syncer.EnvVarKeyTraktClientId) == "" && os.Getenv(syncer.EnvVarKeyTraktClientSecret) == ""
+			for _, question := range setupQuestions {
+				if defaultTraktApp && traktAppKeys[question.key] {
+					continue
+				}
+				answer, err := ask(reader, out, question.prompt, question.defaultValue)
+				if err != nil {
+					return err
+				}
+				settings[question.key] = answer
+				if err = os.Setenv(question.key, answer); err != nil {
+					return fmt.Errorf("failure setting %s: %w", question.key, err)
+				}
+			}
+			if defaultTraktApp {
+				fmt.Fprintln(out, "Authorize the built-in Trakt application by entering the code below, or run init with TRAKT_CLIENT_ID and TRAKT_CLIENT_SECRET set to use your own")
+				if err := authorizeTrakt(cmd, false); err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err)
+					return err
+				}
+			}
+			fmt.Fprintln(out, "Signing in to IMDb and Trakt to test the credentials...")
+			if _, err := newSyncer(cmd); err != nil {
+				fmt.Fprintf(out, "The credentials could not be verified, run init again to correct them: %s\n", err)
+				return err
+			}
+			if useKeyring, _ := cmd.Flags().GetBool(flagKeyring); useKeyring {
+				if err := syncer.StoreSecrets(settings); err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err)
+					return err
+				}
+				fmt.Fprintln(out, "Stored the credentials in the keyring")
+			}
+			if err := config.Save(path, settings); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				return err
+			}
+			fmt.Fprintf(out, "Saved config file %s, run the sync command to start syncing\n", path)
+			return nil
+		},
+	}
+	command.Flags().Bool(flagKeyring, false, "store the credentials in the platform keyring instead of the config file")
+	return command
+}
+
+// ask prompts for a single line of input, returning the default value when the answer is empty
+func ask(reader *bufio.Reader, out io.Writer, prompt, defaultValue string) (string, error) {
+	for {
+		if defaultValue != "" {
+			fmt.Fprintf(out, "%s [%s]: ", prompt, defaultValue)
+		} else {
+			fmt.Fprintf(out, "%s: ", prompt)
+		}
+		answer, err := reader.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+			return "", fmt.Errorf("failure reading answer: %w", err)
+		}
+		if answer = strings.TrimSpace(answer); answer != "" {
+			return answer, nil
+		}
+		if defaultValue != "" {
+			return defaultValue, nil
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+const (
+	outputJson = "json"
+	outputText = "text"
+)
+
+// checkOutput is the json output of a single check of the validate and healthcheck commands
+type checkOutput struct {
+	Name  string `json:"name"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	Hint  string `json:"hint,omitempty"`
+}
+
+// fileOutput is the json output of the commands that only write a file, such as backup and export
+type fileOutput struct {
+	Path string `json:"path"`
+}
+
+func validateOutput(cmd *cobra.Command) error {
+	output, _ := cmd.Flags().GetString(flagOutput)
+	if output != outputText && output != outputJson {
+		return fmt.Errorf("output %s is invalid, expected %s or %s", output, outputText, outputJson)
+	}
+	return nil
+}
+
+// jsonOutput reports whether the command prints json instead of text to stdout, while logs keep going to stderr
+func jsonOutput(cmd *cobra.Command) bool {
+	output, _ := cmd.Flags().GetString(flagOutput)
+	return output == outputJson
+}
+
+func printJson(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("failure printing json output: %w", err)
+	}
+	return nil
+}
+
+// printPlanFile prints the plan saved by the plan command
+func printPlanFile(out io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	var plan entities.SyncPlan
+	if err = json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("failure unmarshalling %s: %w", path, err)
+	}
+	return printJson(out, plan)
+}
+
+// reportChecks prints the outcome of every check as text or json, returning the error of the first failed one
+func reportChecks(cmd *cobra.Command, checks []syncer.Check) error {
+	var firstErr error
+	for _, check := range checks {
+		if check.Err != nil {
+			firstErr = check.Err
+			break
+		}
+	}
+	out := cmd.OutOrStdout()
+	if !jsonOutput(cmd) {
+		printChecks(out, checks)
+		return firstErr
+	}
+	outputs := make([]checkOutput, 0, len(checks))
+	for _, check := range checks {
+		output := checkOutput{
+			Name: check.Name,
+			Ok:   check.Err == nil,
+		}
+		if check.Err != nil {
+			output.Error = check.Err.Error()
+			output.Hint = check.Hint
+		}
+		outputs = append(outputs, output)
+	}
+	if err := printJson(out, outputs); err != nil {
+		return err
+	}
+	return firstErr
+}
@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/config"
+	"github.com/cecobask/imdb-trakt-sync/pkg/console"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/events"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"github.com/cecobask/imdb-trakt-sync/pkg/notify"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
+)
+
+const (
+	flagAllProfiles = "all-profiles"
+	flagConcurrency = "concurrency"
+	flagEnvFile     = "env-file"
+	flagForce       = "force"
+	flagInteractive = "interactive"
+	flagLists       = "lists"
+	flagLogLevel    = "log-level"
+	flagOutput      = "output"
+	flagProfile     = "profile"
+	flagQuiet       = "quiet"
+	flagSyncMode    = "sync-mode"
+
+	defaultEnvFile = ".env"
+)
+
+// settingFlags maps the flags that override a setting to its environment variable, taking precedence over the environment and config file
+var settingFlags = map[string]string{
+	flagColumns:     syncer.EnvVarKeyImportColumns,
+	flagConcurrency: syncer.EnvVarKeyConcurrency,
+	flagLists:       syncer.EnvVarKeyListIds,
+	flagLogLevel:    logger.EnvVarKeyLogLevel,
+	flagSyncMode:    syncer.EnvVarKeySyncMode,
+}
+
+// usageError is returned for invalid command usage or configuration, which are reported without running the syncer
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// Execute runs the command line interface and returns the exit code of the process
+func Execute() int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// restore the default behaviour after the first signal, so a second one terminates the process immediately
+		<-ctx.Done()
+		stop()
+	}()
+	root := NewRootCommand()
+	defer func() {
+		if value := recover(); value != nil {
+			command, _, _ := root.Find(os.Args[1:])
+			reportPanic(command, value, debug.Stack())
+			panic(value)
+		}
+	}()
+	cmd, err := root.ExecuteContextC(ctx)
+	var usage *usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintln(os.Stderr, err)
+		return syncer.ExitCodeConfigError
+	}
+	exitCode := syncer.ExitCode(err)
+	if err != nil {
+		reportError(cmd, err, exitCode)
+	}
+	return exitCode
+}
+
+func NewRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:               "syncer",
+		Short:             "Sync IMDb data to Trakt",
+		Long:              "Sync your IMDb watchlist, lists, ratings and history to Trakt. Running without a command is equivalent to running the sync command.",
+		Args:              withUsage(cobra.NoArgs),
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		PersistentPreRunE: loadConfig,
+		RunE:              runSync,
+	}
+	root.Flags().Bool(flagAllProfiles, false, "sync every profile of the config file, one after another")
+	root.PersistentFlags().Int(flagConcurrency, 0, fmt.Sprintf("maximum number of concurrent requests to imdb and trakt, when fetching lists and applying changes, overrides %s", syncer.EnvVarKeyConcurrency))
+	root.PersistentFlags().String(flagEnvFile, "", fmt.Sprintf("path of a file with environment variables to load, defaults to %s in the working directory when it exists", defaultEnvFile))
+	root.PersistentFlags().Bool(flagForce, false, "apply the planned changes even when they are unusually large compared to previous runs")
+	root.PersistentFlags().Bool(flagInteractive, false, "print the planned changes and confirm removals before applying them")
+	root.PersistentFlags().String(flagLists, "", fmt.Sprintf("comma separated imdb list ids to sync or all, overrides %s", syncer.EnvVarKeyListIds))
+	root.PersistentFlags().String(flagLogLevel, "", fmt.Sprintf("log level (debug, info, warn, error), overrides %s", logger.EnvVarKeyLogLevel))
+	root.PersistentFlags().String(flagOutput, outputText, fmt.Sprintf("output format of the command, %s or %s", outputText, outputJson))
+	root.PersistentFlags().String(flagProfile, "", fmt.Sprintf("name of the config file profile to use, defaults to %s", syncer.EnvVarKeyProfile))
+	root.PersistentFlags().Bool(flagQuiet, false, "only log errors and print a single summary line once done, for cron jobs")
+	root.PersistentFlags().String(flagSyncMode, "", fmt.Sprintf("sync mode (full, add-only, remove-only, dry-run), overrides %s", syncer.EnvVarKeySyncMode))
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
+	root.AddCommand(
+		newApplyCommand(),
+		newAuthCommand(),
+		newBackupCommand(),
+		newDaemonCommand(),
+		newExportCommand(),
+		newHealthcheckCommand(),
+		newHistoryCommand(),
+		newImportCommand(),
+		newInitCommand(),
+		newInstallServiceCommand(),
+		newPlanCommand(),
+		newRestoreCommand(),
+		newStatsCommand(),
+		newStatusCommand(),
+		newSyncCommand(),
+		newValidateCommand(),
+		newVersionCommand(),
+	)
+	return root
+}
+
+// loadConfig loads the .env file and exports the settings of the config file, layering the selected profile over them.
+// The settings are left untouched when syncing every profile, since each one is exported right before it runs.
+func loadConfig(cmd *cobra.Command, args []string) error {
+	if err := validateOutput(cmd); err != nil {
+		return &usageError{err: err}
+	}
+	if err := exportSettingFlags(cmd); err != nil {
+		return &usageError{err: err}
+	}
+	if quiet, _ := cmd.Flags().GetBool(flagQuiet); quiet {
+		if err := os.Setenv(logger.EnvVarKeyLogLevel, zapcore.ErrorLevel.String()); err != nil {
+			return &usageError{err: err}
+		}
+	}
+	if err := loadEnvFile(cmd); err != nil {
+		return &usageError{err: err}
+	}
+	if cmd.Annotations[annotationManagesConfig] != "" {
+		return applyTimezone()
+	}
+	file, err := config.LoadDefault()
+	if err != nil {
+		return &usageError{err: err}
+	}
+	profile := activeProfile(cmd)
+	if allProfiles, _ := cmd.Flags().GetBool(flagAllProfiles); allProfiles {
+		if profile != "" {
+			return &usageError{err: fmt.Errorf("--%s cannot be combined with profile %s", flagAllProfiles, profile)}
+		}
+		return nil
+	}
+	settings := file.Settings
+	if profile != "" {
+		if settings, err = file.Profile(profile); err != nil {
+			return &usageError{err: err}
+		}
+		if err = os.Setenv(syncer.EnvVarKeyProfile, profile); err != nil {
+			return &usageError{err: err}
+		}
+	}
+	if _, err = config.Export(settings); err != nil {
+		return &usageError{err: err}
+	}
+	return applyTimezone()
+}
+
+func applyTimezone() error {
+	if err := syncer.ApplyTimezone(); err != nil {
+		return &usageError{err: err}
+	}
+	return nil
+}
+
+// exportSettingFlags sets the environment variable of every setting flag that was passed,
+// which the .env and config files never override
+func exportSettingFlags(cmd *cobra.Command) error {
+	for name, key := range settingFlags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		if err := os.Setenv(key, flag.Value.String()); err != nil {
+			return fmt.Errorf("failure setting %s from flag --%s: %w", key, name, err)
+		}
+	}
+	return nil
+}
+
+// loadEnvFile sets the variables of the .env file that are missing from the environment, ignoring a missing .env file unless it was set explicitly
+func loadEnvFile(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString(flagEnvFile)
+	if path == "" {
+		if _, err := os.Stat(defaultEnvFile); err != nil {
+			return nil
+		}
+		path = defaultEnvFile
+	}
+	if err := godotenv.Load(path); err != nil {
+		return fmt.Errorf("failure loading env file %s: %w", path, err)
+	}
+	return nil
+}
+
+// activeProfile returns the profile selected by flag, falling back to the SYNC_PROFILE environment variable
+func activeProfile(cmd *cobra.Command) string {
+	if profile, _ := cmd.Flags().GetString(flagProfile); profile != "" {
+		return profile
+	}
+	return os.Getenv(syncer.EnvVarKeyProfile)
+}
+
+// newSyncer creates a syncer that stops once the command context is done, configured by the persistent flags
+func newSyncer(cmd *cobra.Command, extraOptions ...syncer.Option) (*syncer.Syncer, error) {
+	options := append([]syncer.Option{
+		syncer.WithContext(cmd.Context()),
+		syncer.WithHooks(syncer.Hooks{
+			OnRunComplete: metrics.RecordRun,
+		}),
+	}, extraOptions...)
+	if force, _ := cmd.Flags().GetBool(flagForce); force {
+		options = append(options, syncer.WithForce())
+	}
+	if interactive, _ := cmd.Flags().GetBool(flagInteractive); interactive {
+		options = append(options, syncer.WithInteractive())
+	}
+	out := cmd.OutOrStdout()
+	if jsonOutput(cmd) {
+		options = append(options, syncer.WithHooks(syncer.Hooks{
+			OnRunComplete: func(summary entities.SyncSummary, err error) {
+				_ = printJson(out, entities.NewSyncResult(summary, err))
+			},
+		}))
+	} else if quiet, _ := cmd.Flags().GetBool(flagQuiet); quiet {
+		options = append(options, syncer.WithHooks(syncer.Hooks{
+			OnRunComplete: func(summary entities.SyncSummary, err error) {
+				fmt.Fprintln(out, summaryLine(out, summary, err))
+			},
+		}))
+	}
+	if path := os.Getenv(envVarKeyGithubStepSummary); path != "" {
+		errOut := cmd.ErrOrStderr()
+		options = append(options, syncer.WithHooks(syncer.Hooks{
+			OnRunComplete: func(summary entities.SyncSummary, err error) {
+				if err := writeStepSummary(path, summary, err); err != nil {
+					fmt.Fprintln(errOut, err)
+				}
+			},
+		}))
+	}
+	if metrics.PushEnabled() && cmd.Annotations[annotationServesMetrics] == "" {
+		errOut := cmd.ErrOrStderr()
+		options = append(options, syncer.WithHooks(syncer.Hooks{
+			OnRunComplete: func(summary entities.SyncSummary, err error) {
+				if err := metrics.Push(); err != nil {
+					fmt.Fprintln(errOut, err)
+				}
+			},
+		}))
+	}
+	if notify.PingEnabled() {
+		errOut := cmd.ErrOrStderr()
+		options = append(options, syncer.WithHooks(syncer.Hooks{
+			OnRunStart: func() {
+				if err := notify.PingStart(); err != nil {
+					fmt.Fprintln(errOut, err)
+				}
+			},
+			OnRunComplete: func(summary entities.SyncSummary, err error) {
+				if err := notify.PingFinish(err); err != nil {
+					fmt.Fprintln(errOut, err)
+				}
+			},
+		}))
+	}
+	if events.Enabled() {
+		errOut := cmd.ErrOrStderr()
+		publisher := events.NewPublisher(activeProfile(cmd))
+		printErrors := func(errs []error) {
+			for _, err := range errs {
+				fmt.Fprintln(errOut, err)
+			}
+		}
+		options = append(options, syncer.WithHooks(syncer.Hooks{
+			OnRunStart: func() {
+				printErrors(publisher.RunStarted())
+			},
+			OnListSynced: func(target, listSlug string, err error) {
+				printErrors(publisher.ListSynced(target, listSlug, err))
+			},
+			OnRunComplete: func(summary entities.SyncSummary, err error) {
+				printErrors(publisher.RunCompleted(summary, err))
+			},
+		}))
+	}
+	if notify.Enabled() {
+		errOut := cmd.ErrOrStderr()
+		profile := activeProfile(cmd)
+		options = append(options, syncer.WithHooks(syncer.Hooks{
+			OnRunComplete: func(summary entities.SyncSummary, err error) {
+				for _, notifyErr := range notify.Send(notify.NewReport(summary, err, profile)) {
+					fmt.Fprintln(errOut, notifyErr)
+				}
+			},
+		}))
+	}
+	// the config file of a profile may set a different time zone, while an invalid one is reported by the syncer
+	_ = syncer.ApplyTimezone()
+	return syncer.NewSyncer(options...)
+}
+
+// summaryLine describes the outcome of a run in a single line, colored when printed to a terminal
+func summaryLine(out io.Writer, summary entities.SyncSummary, err error) string {
+	outcome := console.Colorize(out, console.Green, "succeeded")
+	if err != nil {
+		outcome = console.Colorize(out, console.Red, "failed")
+	}
+	added := console.Colorize(out, console.Green, fmt.Sprintf("%d item(s) added", summary.ItemsAdded()))
+	removed := console.Colorize(out, console.Red, fmt.Sprintf("%d item(s) removed", summary.ItemsRemoved()))
+	line := fmt.Sprintf("sync %s in %s: %s, %s", outcome, summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second), added, removed)
+	if summary.ItemsNotFound > 0 {
+		line += fmt.Sprintf(", %d item(s) not found", summary.ItemsNotFound)
+	}
+	if summary.OperationsDeferred > 0 {
+		line += fmt.Sprintf(", %d operation(s) deferred to the next run", summary.OperationsDeferred)
+	}
+	return line
+}
+
+func withUsage(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, positional []string) error {
+		if err := args(cmd, positional); err != nil {
+			return &usageError{err: fmt.Errorf("%w, see %s --help", err, cmd.CommandPath())}
+		}
+		return nil
+	}
+}
+
+// pathArg returns the first positional argument, falling back to a default path
+func pathArg(args []string, defaultPath string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return defaultPath
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/sentry"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// errorCategories names the failure category of every exit code, which groups the errors reported to sentry
+var errorCategories = map[int]string{
+	syncer.ExitCodeFailure:        "failure",
+	syncer.ExitCodeConfigError:    "config_error",
+	syncer.ExitCodeAuthFailure:    "auth_failure",
+	syncer.ExitCodeRateLimited:    "rate_limited",
+	syncer.ExitCodePartialFailure: "partial_failure",
+	syncer.ExitCodeListFailure:    "list_failure",
+}
+
+// reportError sends a failed command to sentry, leaving out interruptions and invalid usage, which are no failures of the syncer
+func reportError(cmd *cobra.Command, err error, exitCode int) {
+	category, ok := errorCategories[exitCode]
+	if !ok || !sentry.Enabled() {
+		return
+	}
+	captureEvent(sentry.Event{
+		Level:    sentry.LevelError,
+		Category: category,
+		Message:  err.Error(),
+		Tags:     eventTags(cmd, exitCode),
+	})
+}
+
+// reportPanic sends a panic to sentry along with the stack of the panicking goroutine
+func reportPanic(cmd *cobra.Command, value interface{}, stack []byte) {
+	if !sentry.Enabled() {
+		return
+	}
+	captureEvent(sentry.Event{
+		Level:    sentry.LevelFatal,
+		Category: "panic",
+		Message:  fmt.Sprint(value),
+		Stack:    string(stack),
+		Tags:     eventTags(cmd, syncer.ExitCodeFailure),
+	})
+}
+
+func captureEvent(event sentry.Event) {
+	if err := sentry.Capture(event, syncer.SecretValues()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func eventTags(cmd *cobra.Command, exitCode int) map[string]string {
+	tags := map[string]string{
+		"exit_code": fmt.Sprint(exitCode),
+	}
+	if cmd != nil {
+		tags["command"] = cmd.Name()
+	}
+	if profile := os.Getenv(syncer.EnvVarKeyProfile); profile != "" {
+		tags["profile"] = profile
+	}
+	return tags
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/config"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	flagEnable         = "enable"
+	flagOnCalendar     = "on-calendar"
+	flagPrint          = "print"
+	flagSystem         = "system"
+	defaultOnCalendar  = "*-*-* 00/3:00:00"
+	serviceName        = "imdb-trakt-sync"
+	systemUnitsDir     = "/etc/systemd/system"
+	userUnitsDirSuffix = "systemd/user"
+)
+
+func newInstallServiceCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "install-service",
+		Short: "Write a systemd service and timer that sync on a schedule with the current configuration",
+		Long: "Write a systemd service running the sync command with the current profile, config file and working directory, " +
+			"and a timer starting it on a schedule. The units are installed for the current user unless --system is passed, " +
+			"which requires root. Pass --print to print the units instead of writing them.",
+		Args: withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			units, err := newServiceUnits(cmd)
+			if err != nil {
+				return &usageError{err: err}
+			}
+			out := cmd.OutOrStdout()
+			if printUnits, _ := cmd.Flags().GetBool(flagPrint); printUnits {
+				for _, unit := range units {
+					fmt.Fprintf(out, "# %s\n%s\n", unit.name, unit.content)
+				}
+				return nil
+			}
+			if runtime.GOOS != "linux" {
+				return &usageError{err: fmt.Errorf("systemd is only available on linux, pass --%s to print the units instead", flagPrint)}
+			}
+			system, _ := cmd.Flags().GetBool(flagSystem)
+			dir, err := unitsDir(system)
+			if err != nil {
+				return &usageError{err: err}
+			}
+			if err = os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failure creating directory %s: %w", dir, err)
+			}
+			for _, unit := range units {
+				path := filepath.Join(dir, unit.name)
+				if err = os.WriteFile(path, []byte(unit.content), 0644); err != nil {
+					return fmt.Errorf("failure writing %s: %w", path, err)
+				}
+				fmt.Fprintf(out, "Wrote %s\n", path)
+			}
+			timer := units[1].name
+			commands := [][]string{
+				systemctl(system, "daemon-reload"),
+				systemctl(system, "enable", "--now", timer),
+			}
+			if enable, _ := cmd.Flags().GetBool(flagEnable); enable {
+				for _, args := range commands {
+					if err = runSystemctl(out, cmd.ErrOrStderr(), args); err != nil {
+						return err
+					}
+				}
+				fmt.Fprintf(out, "Enabled %s, check the next run with: %s\n", timer, strings.Join(systemctl(system, "list-timers", timer), " "))
+				return nil
+			}
+			fmt.Fprintln(out, "Enable the timer with:")
+			for _, args := range commands {
+				fmt.Fprintf(out, "  %s\n", strings.Join(args, " "))
+			}
+			return nil
+		},
+	}
+	command.Flags().Bool(flagEnable, false, "reload systemd and enable the timer once the units are written")
+	command.Flags().String(flagOnCalendar, defaultOnCalendar, "systemd calendar expression of when to sync, see man systemd.time")
+	command.Flags().Bool(flagPrint, false, "print the units instead of writing them")
+	command.Flags().Bool(flagSystem, false, "install the units for the whole system instead of the current user, which requires root")
+	return command
+}
+
+// serviceUnit is a systemd unit file written by the install-service command
+type serviceUnit struct {
+	name    string
+	content string
+}
+
+// newServiceUnits returns the service and the timer running the sync with the current profile, config file and working directory
+func newServiceUnits(cmd *cobra.Command) ([]serviceUnit, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failure locating the executable: %w", err)
+	}
+	if strings.Contains(executable, string(filepath.Separator)+"go-build") {
+		return nil, fmt.Errorf("the executable %s is temporary, build it with go build instead of go run", executable)
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failure locating the working directory: %w", err)
+	}
+	name := serviceName
+	execStart := []string{quoteUnitValue(executable), "sync"}
+	profile := activeProfile(cmd)
+	if profile != "" {
+		name += "-" + profile
+		execStart = append(execStart, "--profile", quoteUnitValue(profile))
+	}
+	if envFile, _ := cmd.Flags().GetString(flagEnvFile); envFile != "" {
+		if envFile, err = filepath.Abs(envFile); err != nil {
+			return nil, fmt.Errorf("failure locating env file: %w", err)
+		}
+		execStart = append(execStart, "--"+flagEnvFile, quoteUnitValue(envFile))
+	}
+	var environment string
+	// the default config file is pinned, since the user config directory of the service may differ
+	if path, explicit := config.Path(); explicit || fileExists(path) {
+		environment = fmt.Sprintf("Environment=%s\n", quoteUnitValue(config.EnvVarKeyConfigPath+"="+path))
+	}
+	onCalendar, _ := cmd.Flags().GetString(flagOnCalendar)
+	if onCalendar == "" {
+		return nil, fmt.Errorf("--%s must not be empty", flagOnCalendar)
+	}
+	description := "Sync IMDb data to Trakt"
+	if profile != "" {
+		description += fmt.Sprintf(" for profile %s", profile)
+	}
+	service := fmt.Sprintf(`[Unit]
+Description=%s
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+WorkingDirectory=%s
+%sExecStart=%s
+`, description, quoteUnitValue(workingDir), environment, strings.Join(execStart, " "))
+	timer := fmt.Sprintf(`[Unit]
+Description=%s on a schedule
+
+[Timer]
+OnCalendar=%s
+Persistent=true
+RandomizedDelaySec=5m
+
+[Install]
+WantedBy=timers.target
+`, description, onCalendar)
+	return []serviceUnit{
+		{name: name + ".service", content: service},
+		{name: name + ".timer", content: timer},
+	}, nil
+}
+
+func unitsDir(system bool) (string, error) {
+	if system {
+		return systemUnitsDir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failure locating the user config directory: %w", err)
+	}
+	return filepath.Join(configDir, userUnitsDirSuffix), nil
+}
+
+func systemctl(system bool, args ...string) []string {
+	if system {
+		return append([]string{"systemctl"}, args...)
+	}
+	return append([]string{"systemctl", "--user"}, args...)
+}
+
+func runSystemctl(stdout, stderr io.Writer, args []string) error {
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("failure running %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// quoteUnitValue quotes values with spaces, which systemd would otherwise split into several arguments
+func quoteUnitValue(value string) string {
+	if !strings.ContainsAny(value, " \t\"") {
+		return value
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/stats"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+)
+
+func newStatsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "Print weekly trends of the recorded runs",
+		Args:  withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := stats.NewStore(syncer.RunStatsPath()).Load()
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				return err
+			}
+			if jsonOutput(cmd) {
+				return printJson(cmd.OutOrStdout(), stats.WeeklyTrends(runs))
+			}
+			return stats.PrintTrends(cmd.OutOrStdout(), runs)
+		},
+	}
+}
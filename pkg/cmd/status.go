@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/stats"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const flagDiff = "diff"
+
+func newStatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print the last run, pending retries and credential expiry read from the state directory",
+		Long: "Print when the last run and the last successful sync happened, what failed, the operations waiting in the retry queue " +
+			"and when the stored Trakt tokens expire. Pass --diff to also count the changes a sync would make, which signs in to IMDb and Trakt.",
+		Args: withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := syncer.ReadStatus()
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				return err
+			}
+			if diff, _ := cmd.Flags().GetBool(flagDiff); diff {
+				s, err := newSyncer(cmd)
+				if err != nil {
+					return err
+				}
+				if status.PendingChanges, err = s.PlanTotals(); err != nil {
+					return err
+				}
+			}
+			if jsonOutput(cmd) {
+				return printJson(cmd.OutOrStdout(), status)
+			}
+			return printStatus(cmd.OutOrStdout(), status)
+		},
+	}
+	cmd.Flags().Bool(flagDiff, false, "count the changes a sync would make, without applying them")
+	return cmd
+}
+
+func printStatus(out io.Writer, status *syncer.Status) error {
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "last run:\t%s\n", describeRun(status.LastRun))
+	fmt.Fprintf(table, "last successful run:\t%s\n", describeRun(status.LastSuccessfulRun))
+	if status.LastRun != nil && len(status.LastRun.FailedLists) > 0 {
+		fmt.Fprintf(table, "failed lists:\t%s\n", strings.Join(status.LastRun.FailedLists, ", "))
+	}
+	fmt.Fprintf(table, "retry queue:\t%d pending operation(s)\n", status.PendingOperations)
+	switch {
+	case status.TraktTokensExpireAt == nil:
+		fmt.Fprintf(table, "trakt tokens:\tnot stored, signing in with the email and password\n")
+	case status.TraktTokensExpireAt.Before(time.Now()):
+		fmt.Fprintf(table, "trakt tokens:\texpired on %s, refreshed on the next sync\n", status.TraktTokensExpireAt.Local().Format(time.RFC1123))
+	default:
+		fmt.Fprintf(table, "trakt tokens:\texpire on %s, refreshed automatically a day before\n", status.TraktTokensExpireAt.Local().Format(time.RFC1123))
+	}
+	if status.LastSuccessfulRun != nil {
+		fmt.Fprintf(table, "imdb cookies:\tlast worked on %s, replace them when a sync fails to sign in\n", status.LastSuccessfulRun.StartedAt.Local().Format(time.RFC1123))
+	} else {
+		fmt.Fprintf(table, "imdb cookies:\tnot confirmed by a successful sync yet\n")
+	}
+	if changes := status.PendingChanges; changes != nil {
+		fmt.Fprintf(table, "pending changes:\t%d operation(s), %d item(s) to add, %d item(s) to remove\n", changes.Operations, changes.ItemsAdded, changes.ItemsRemoved)
+	}
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("failure printing status: %w", err)
+	}
+	return nil
+}
+
+// describeRun summarises a recorded run in a single line
+func describeRun(run *stats.Run) string {
+	if run == nil {
+		return "none recorded"
+	}
+	line := fmt.Sprintf("%s, %d item(s) added, %d item(s) removed", run.StartedAt.Local().Format(time.RFC1123), run.ItemsAdded, run.ItemsRemoved)
+	if run.Error != "" {
+		line += fmt.Sprintf(", failed: %s", run.Error)
+	}
+	return line
+}
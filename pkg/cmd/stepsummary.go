@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	envVarKeyGithubStepSummary = "GITHUB_STEP_SUMMARY"
+	stepSummaryMaxItems        = 100
+)
+
+// writeStepSummary appends the markdown report of a run to the job summary of github actions,
+// so the added and removed items show on the page of the workflow run
+func writeStepSummary(path string, summary entities.SyncSummary, err error) error {
+	file, fileErr := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if fileErr != nil {
+		return fmt.Errorf("failure opening github step summary %s: %w", path, fileErr)
+	}
+	defer file.Close()
+	if _, fileErr = file.WriteString(stepSummaryMarkdown(summary, err)); fileErr != nil {
+		return fmt.Errorf("failure writing github step summary %s: %w", path, fileErr)
+	}
+	return nil
+}
+
+func stepSummaryMarkdown(summary entities.SyncSummary, err error) string {
+	var builder strings.Builder
+	outcome := "succeeded"
+	if err != nil {
+		outcome = "failed"
+	}
+	fmt.Fprintf(&builder, "## IMDb to Trakt sync %s\n\n", outcome)
+	if err != nil {
+		fmt.Fprintf(&builder, "> %s\n\n", strings.ReplaceAll(err.Error(), "\n", "\n> "))
+	}
+	fmt.Fprintf(&builder, "| Duration | Items added | Items removed | Items not found | Operations deferred |\n")
+	fmt.Fprintf(&builder, "|---|---|---|---|---|\n")
+	fmt.Fprintf(&builder, "| %s | %d | %d | %d | %d |\n\n", summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second),
+		summary.ItemsAdded(), summary.ItemsRemoved(), summary.ItemsNotFound, summary.OperationsDeferred)
+	if len(summary.FailedLists) > 0 {
+		fmt.Fprintf(&builder, "Failed lists: %s\n\n", strings.Join(summary.FailedLists, ", "))
+	}
+	for _, operation := range summary.Operations {
+		fmt.Fprintf(&builder, "<details><summary>%s</summary>\n\n", operation.Describe())
+		for i := range operation.Items {
+			if i == stepSummaryMaxItems {
+				fmt.Fprintf(&builder, "- and %d more\n", len(operation.Items)-i)
+				break
+			}
+			id, idErr := operation.Items[i].GetItemId()
+			if idErr != nil || id == nil || *id == "" {
+				fmt.Fprintf(&builder, "- %s without an imdb id\n", operation.Items[i].Type)
+				continue
+			}
+			fmt.Fprintf(&builder, "- [%s](https://www.imdb.com/title/%s/) %s\n", *id, *id, operation.Items[i].Type)
+		}
+		fmt.Fprintf(&builder, "\n</details>\n\n")
+	}
+	if len(summary.Operations) == 0 {
+		fmt.Fprintf(&builder, "Trakt was already in sync with IMDb.\n\n")
+	}
+	if len(summary.Timings) > 0 {
+		builder.WriteString(timingsMarkdown(summary.Timings))
+	}
+	if summary.Http != nil && summary.Http.Requests > 0 {
+		builder.WriteString(httpTelemetryMarkdown(summary.Http))
+	}
+	return builder.String()
+}
+
+// timingsMarkdown lists the time spent on every phase and on the steps within it, such as applying the changes of a list
+func timingsMarkdown(timings []entities.Timing) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "<details><summary>Time spent per phase</summary>\n\n")
+	fmt.Fprintf(&builder, "| Phase | Step | Duration |\n")
+	fmt.Fprintf(&builder, "|---|---|---|\n")
+	for _, timing := range timings {
+		step := timing.Step
+		if step == "" {
+			step = "total"
+		}
+		fmt.Fprintf(&builder, "| %s | %s | %s |\n", timing.Phase, step, timing.Duration().Round(time.Millisecond))
+	}
+	fmt.Fprintf(&builder, "\n</details>\n\n")
+	return builder.String()
+}
+
+// httpTelemetryMarkdown lists the requests sent to every endpoint, along with the time spent waiting for rate limits
+func httpTelemetryMarkdown(telemetry *entities.HttpTelemetry) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "<details><summary>%d http request(s), %d retried, %s waiting for rate limits, p95 latency %dms</summary>\n\n",
+		telemetry.Requests, telemetry.Retries, time.Duration(telemetry.RateLimitWaitSeconds*float64(time.Second)).Round(time.Second), telemetry.P95LatencyMs)
+	fmt.Fprintf(&builder, "| Service | Endpoint | Requests | Retries | p95 latency |\n")
+	fmt.Fprintf(&builder, "|---|---|---|---|---|\n")
+	for _, endpoint := range telemetry.Endpoints {
+		fmt.Fprintf(&builder, "| %s | `%s %s` | %d | %d | %dms |\n", endpoint.Service, endpoint.Method, endpoint.Route, endpoint.Requests, endpoint.Retries, endpoint.P95LatencyMs)
+	}
+	fmt.Fprintf(&builder, "\n</details>\n\n")
+	return builder.String()
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/config"
+	"github.com/cecobask/imdb-trakt-sync/pkg/console"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+const defaultPlanPath = "plan.json"
+
+func newSyncCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync IMDb data to Trakt",
+		Args:  withUsage(cobra.NoArgs),
+		RunE:  runSync,
+	}
+	command.Flags().Bool(flagAllProfiles, false, "sync every profile of the config file, one after another")
+	return command
+}
+
+func newPlanCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "plan [path]",
+		Short: "Compute the changes a sync would make and save them to a plan file",
+		Args:  withUsage(cobra.MaximumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := newSyncer(cmd)
+			if err != nil {
+				return err
+			}
+			path := pathArg(args, defaultPlanPath)
+			if err = s.Plan(path); err != nil {
+				return err
+			}
+			if jsonOutput(cmd) {
+				return printPlanFile(cmd.OutOrStdout(), path)
+			}
+			return nil
+		},
+	}
+}
+
+func newApplyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "apply <path>",
+		Short: "Apply the changes recorded in a plan file",
+		Args:  withUsage(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := newSyncer(cmd)
+			if err != nil {
+				return err
+			}
+			return s.Apply(args[0])
+		},
+	}
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	if err := waitForJitter(cmd); err != nil {
+		return err
+	}
+	if allProfiles, _ := cmd.Flags().GetBool(flagAllProfiles); allProfiles {
+		return runAllProfiles(cmd)
+	}
+	s, err := newSyncer(cmd)
+	if err != nil {
+		return err
+	}
+	return s.Run()
+}
+
+// runAllProfiles syncs every profile of the config file in alphabetical order.
+// A failing profile does not stop the remaining ones, but its error is returned once they are done.
+func runAllProfiles(cmd *cobra.Command) error {
+	file, err := config.LoadDefault()
+	if err != nil {
+		return &usageError{err: err}
+	}
+	profiles := file.ProfileNames()
+	if len(profiles) == 0 {
+		return &usageError{err: fmt.Errorf("--%s requires profiles to be defined in the config file", flagAllProfiles)}
+	}
+	var result error
+	for _, profile := range profiles {
+		if cmd.Context().Err() != nil {
+			return &syncer.InterruptedError{}
+		}
+		if quiet, _ := cmd.Flags().GetBool(flagQuiet); !quiet {
+			fmt.Fprintf(cmd.ErrOrStderr(), "syncing profile %s\n", profile)
+		}
+		if err = runProfile(cmd, file, profile); err != nil && result == nil {
+			result = fmt.Errorf("failure syncing profile %s: %w", profile, err)
+		}
+	}
+	return result
+}
+
+func runProfile(cmd *cobra.Command, file *config.File, profile string) error {
+	settings, err := file.Profile(profile)
+	if err != nil {
+		return &usageError{err: err}
+	}
+	restore, err := config.Export(settings)
+	if err != nil {
+		return &usageError{err: err}
+	}
+	defer restore()
+	if err = os.Setenv(syncer.EnvVarKeyProfile, profile); err != nil {
+		return err
+	}
+	defer os.Unsetenv(syncer.EnvVarKeyProfile)
+	s, err := newSyncer(cmd)
+	if err != nil {
+		return err
+	}
+	return s.Run()
+}
+
+// waitForJitter delays a sync started by a scheduler, such as cron, by up to SYNC_JITTER.
+// Syncs started from a terminal are never delayed.
+func waitForJitter(cmd *cobra.Command) error {
+	delay := syncer.Jitter()
+	if delay == 0 || console.IsTerminal(cmd.OutOrStdout()) {
+		return nil
+	}
+	logger.NewLogger().Info(fmt.Sprintf("delaying the sync by %s to spread scheduled syncs", delay.Round(time.Second)))
+	select {
+	case <-cmd.Context().Done():
+		return &syncer.InterruptedError{}
+	case <-time.After(delay):
+		return nil
+	}
+}
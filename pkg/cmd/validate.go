@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/console"
+	"github.com/cecobask/imdb-trakt-sync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+const (
+	flagOffline  = "offline"
+	flagSkipAuth = "skip-auth"
+)
+
+func newValidateCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "validate",
+		Short: "Verify the configuration, credentials and list access without syncing",
+		Long: "Verify the configuration, sign in to IMDb and Trakt and check that every configured list can be read, without changing anything. " +
+			"Use it as a preflight check before scheduled syncs.",
+		Args: withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checks := []syncer.Check{configurationCheck()}
+			offline, _ := cmd.Flags().GetBool(flagOffline)
+			if checks[0].Err != nil || offline {
+				return reportChecks(cmd, checks)
+			}
+			s, err := newSyncer(cmd)
+			checks = append(checks, signInCheck(err))
+			if err != nil {
+				return reportChecks(cmd, checks)
+			}
+			return reportChecks(cmd, append(checks, s.Validate()...))
+		},
+	}
+	command.Flags().Bool(flagOffline, false, "only validate the configuration, without contacting imdb or trakt")
+	return command
+}
+
+func newHealthcheckCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "healthcheck",
+		Short: "Check that the configuration, state files and credentials are usable, for container health probes",
+		Long: "Check that the configuration is valid, the retry queue and run statistics can be written and the credentials still sign in. " +
+			"Exits with 0 when healthy and with the sync exit codes otherwise, suitable for a Docker HEALTHCHECK or a Kubernetes probe.",
+		Args: withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checks := []syncer.Check{configurationCheck()}
+			if checks[0].Err != nil {
+				return reportChecks(cmd, checks)
+			}
+			checks = append(checks, syncer.CheckStateFiles()...)
+			if skipAuth, _ := cmd.Flags().GetBool(flagSkipAuth); !skipAuth {
+				_, err := newSyncer(cmd)
+				checks = append(checks, signInCheck(err))
+			}
+			return reportChecks(cmd, checks)
+		},
+	}
+	command.Flags().Bool(flagSkipAuth, false, "skip signing in to imdb and trakt, for probes running more often than the credentials need checking")
+	return command
+}
+
+func configurationCheck() syncer.Check {
+	return syncer.Check{
+		Name: "configuration",
+		Err:  syncer.ValidateConfig(),
+	}
+}
+
+func signInCheck(err error) syncer.Check {
+	check := syncer.Check{
+		Name: "imdb and trakt sign in",
+		Err:  err,
+	}
+	if err != nil {
+		check.Hint = syncer.AuthHint(err)
+	}
+	return check
+}
+
+// printChecks prints the outcome of every check
+func printChecks(out io.Writer, checks []syncer.Check) {
+	ok, failed := console.Colorize(out, console.Green, "ok    "), console.Colorize(out, console.Red, "failed")
+	for _, check := range checks {
+		switch {
+		case check.Err == nil:
+			fmt.Fprintf(out, "%s  %s\n", ok, check.Name)
+		case check.Hint == "":
+			fmt.Fprintf(out, "%s  %s: %s\n", failed, check.Name, check.Err)
+		default:
+			fmt.Fprintf(out, "%s  %s: %s\n        hint: %s\n", failed, check.Name, check.Err, check.Hint)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version, commit and build date of the application",
+		Args:  withUsage(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if jsonOutput(cmd) {
+				return printJson(cmd.OutOrStdout(), version.Get())
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "imdb-trakt-sync %s\n", version.String())
+			return nil
+		},
+	}
+}
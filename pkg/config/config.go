@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	EnvVarKeyConfigPath = "CONFIG_PATH"
+
+	defaultConfigDir  = "imdb-trakt-sync"
+	defaultConfigFile = "config.yaml"
+
+	profilesKey = "profiles"
+)
+
+// File holds the settings of a config file, along with the named profiles layered over them
+type File struct {
+	Settings map[string]string
+	Profiles map[string]map[string]string
+}
+
+// Path returns the config file set through CONFIG_PATH, which can also be an https url or an s3 url, falling back to config.yaml in the user config directory
+func Path() (path string, explicit bool) {
+	if path = os.Getenv(EnvVarKeyConfigPath); path != "" {
+		return path, true
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(configDir, defaultConfigDir, defaultConfigFile), false
+}
+
+// Load reads the settings of a yaml or toml config file, keyed by the name of their environment variable.
+// Keys are case-insensitive, so `sync_mode: full` is equivalent to `SYNC_MODE: full`, while sequences are joined with commas.
+// The settings of every named profile under the `profiles` key are read the same way.
+// Both the whole file and single values can be encrypted with age, which are decrypted with the configured age key.
+func Load(path string) (*File, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading config file %s: %w", path, err)
+	}
+	if isEncrypted(data) {
+		if data, err = decrypt(data); err != nil {
+			return nil, fmt.Errorf("failure decrypting config file %s: %w", path, err)
+		}
+	}
+	var document map[string]interface{}
+	if isToml(path) {
+		err = toml.Unmarshal(data, &document)
+	} else {
+		err = yaml.Unmarshal(data, &document)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing config file %s: %w", path, err)
+	}
+	file := &File{
+		Profiles: make(map[string]map[string]string),
+	}
+	profiles, ok := document[profilesKey]
+	if ok {
+		delete(document, profilesKey)
+		profileDocuments, ok := profiles.(map[string]interface{})
+		if !ok && profiles != nil {
+			return nil, fmt.Errorf("failure parsing profiles of config file %s: unsupported value of type %T", path, profiles)
+		}
+		for name, profile := range profileDocuments {
+			profileDocument, ok := profile.(map[string]interface{})
+			if !ok && profile != nil {
+				return nil, fmt.Errorf("failure parsing profile %s of config file %s: unsupported value of type %T", name, path, profile)
+			}
+			if file.Profiles[name], err = formatSettings(profileDocument); err != nil {
+				return nil, fmt.Errorf("failure parsing profile %s of config file %s: %w", name, path, err)
+			}
+		}
+	}
+	if file.Settings, err = formatSettings(document); err != nil {
+		return nil, fmt.Errorf("failure parsing config file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Profile returns the settings of a named profile, falling back to the top-level settings for the ones it does not set
+func (f *File) Profile(name string) (map[string]string, error) {
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s is not defined in the config file", name)
+	}
+	settings := make(map[string]string, len(f.Settings)+len(profile))
+	for key, value := range f.Settings {
+		settings[key] = value
+	}
+	for key, value := range profile {
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+// ProfileNames returns the names of the profiles in alphabetical order
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export sets every setting missing from or empty in the environment as an environment variable,
+// so environment variables always take precedence over the config file.
+// The returned function unsets the exported variables again, so settings of one profile never leak into the next.
+func Export(settings map[string]string) (func(), error) {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	exported := make([]string, 0, len(keys))
+	restore := func() {
+		for _, key := range exported {
+			_ = os.Unsetenv(key)
+		}
+	}
+	for _, key := range keys {
+		// empty variables, such as the ones of a .env file copied from .env.example, do not hide the config file
+		if os.Getenv(key) != "" {
+			continue
+		}
+		if err := os.Setenv(key, settings[key]); err != nil {
+			restore()
+			return nil, fmt.Errorf("failure exporting setting %s: %w", key, err)
+		}
+		exported = append(exported, key)
+	}
+	return restore, nil
+}
+
+// LoadDefault loads the config file, returning an empty one when it is missing unless it was set explicitly
+func LoadDefault() (*File, error) {
+	empty := &File{
+		Profiles: make(map[string]map[string]string),
+	}
+	path, explicit := Path()
+	if path == "" {
+		return empty, nil
+	}
+	file, err := Load(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return empty, nil
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func formatSettings(document map[string]interface{}) (map[string]string, error) {
+	settings := make(map[string]string, len(document))
+	for key, value := range document {
+		setting, err := formatValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing setting %s: %w", key, err)
+		}
+		settings[strings.ToUpper(key)] = setting
+	}
+	return settings, nil
+}
+
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		if isEncrypted([]byte(v)) {
+			decrypted, err := decrypt([]byte(v))
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(decrypted), "\r\n"), nil
+		}
+		return v, nil
+	case bool, int, int64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		elements := make([]string, 0, len(v))
+		for _, element := range v {
+			formatted, err := formatValue(element)
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, formatted)
+		}
+		return strings.Join(elements, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+// Save writes settings to a yaml or toml config file readable only by the current user, keyed by the lowercase name of their environment variable
+func Save(path string, settings map[string]string) error {
+	document := make(map[string]string, len(settings))
+	for key, value := range settings {
+		document[strings.ToLower(key)] = value
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if isToml(path) {
+		buffer := new(bytes.Buffer)
+		err = toml.NewEncoder(buffer).Encode(document)
+		data = buffer.Bytes()
+	} else {
+		data, err = yaml.Marshal(document)
+	}
+	if err != nil {
+		return fmt.Errorf("failure marshalling config file: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failure creating directory of config file %s: %w", path, err)
+	}
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// isToml reports whether a config file is written in toml, which is told by its .toml extension, also when it is
+// encrypted as a .toml.age file or fetched from a url with a query. Every other config file is read as yaml.
+func isToml(path string) bool {
+	path = strings.SplitN(path, "?", 2)[0]
+	path = strings.TrimSuffix(strings.ToLower(path), ".age")
+	return strings.HasSuffix(path, ".toml")
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
+	"github.com/zalando/go-keyring"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	EnvVarKeyAgeKey     = "CONFIG_AGE_KEY"
+	EnvVarKeyAgeKeyFile = "CONFIG_AGE_KEY_FILE"
+
+	ageBinaryHeader = "age-encryption.org/"
+	keyringService  = "imdb-trakt-sync"
+)
+
+// isEncrypted reports whether data was encrypted with age, either armored or binary
+func isEncrypted(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return bytes.HasPrefix(trimmed, []byte(armor.Header)) || bytes.HasPrefix(trimmed, []byte(ageBinaryHeader))
+}
+
+// decrypt decrypts an age encrypted config file or setting
+func decrypt(data []byte) ([]byte, error) {
+	identities, err := ageIdentities()
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader = bytes.NewReader(data)
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte(armor.Header)) {
+		reader = armor.NewReader(bytes.NewReader(trimmed))
+	}
+	decrypted, err := age.Decrypt(reader, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failure decrypting with age: %w", err)
+	}
+	plaintext, err := io.ReadAll(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failure decrypting with age: %w", err)
+	}
+	return plaintext, nil
+}
+
+// ageIdentities returns the age key set through CONFIG_AGE_KEY or CONFIG_AGE_KEY_FILE, falling back to the one stored in the keyring
+func ageIdentities() ([]age.Identity, error) {
+	key := os.Getenv(EnvVarKeyAgeKey)
+	if path := os.Getenv(EnvVarKeyAgeKeyFile); path != "" && key == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading age key file %s: %w", path, err)
+		}
+		key = string(data)
+	}
+	if key == "" {
+		stored, err := keyring.Get(keyringService, EnvVarKeyAgeKey)
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return nil, fmt.Errorf("failure reading age key from the keyring: %w", err)
+		}
+		key = stored
+	}
+	if strings.TrimSpace(key) == "" {
+		return nil, fmt.Errorf("config file is encrypted: set %s or %s, or store the age key in the keyring", EnvVarKeyAgeKey, EnvVarKeyAgeKeyFile)
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing age key: %w", err)
+	}
+	return identities, nil
+}
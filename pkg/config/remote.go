@@ -0,0 +1,190 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	EnvVarKeyAuthHeader = "CONFIG_AUTH_HEADER"
+
+	envVarKeyAwsAccessKeyId     = "AWS_ACCESS_KEY_ID"
+	envVarKeyAwsDefaultRegion   = "AWS_DEFAULT_REGION"
+	envVarKeyAwsEndpointUrl     = "AWS_ENDPOINT_URL"
+	envVarKeyAwsRegion          = "AWS_REGION"
+	envVarKeyAwsSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+	envVarKeyAwsSessionToken    = "AWS_SESSION_TOKEN"
+
+	defaultAwsRegion   = "us-east-1"
+	remoteTimeout      = 30 * time.Second
+	schemeHttp         = "http://"
+	schemeHttps        = "https://"
+	schemeS3           = "s3://"
+	s3PayloadUnsigned  = "UNSIGNED-PAYLOAD"
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// SecretEnvVarKeys returns the environment variables holding credentials of the config file
+func SecretEnvVarKeys() []string {
+	return []string{EnvVarKeyAgeKey, EnvVarKeyAuthHeader, envVarKeyAwsSecretAccessKey, envVarKeyAwsSessionToken}
+}
+
+// IsRemote reports whether the config file is fetched from an https url or an s3 bucket instead of read from disk
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, schemeHttps) || strings.HasPrefix(path, schemeHttp) || strings.HasPrefix(path, schemeS3)
+}
+
+// readFile reads a config file from disk, an https url or an s3 bucket.
+// Remote config files are fetched again every time, so changes made centrally apply to the next run of every device.
+func readFile(path string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(path, schemeHttps):
+		return fetchHttps(path)
+	case strings.HasPrefix(path, schemeHttp):
+		return nil, fmt.Errorf("config file url must use https to keep the credentials it holds private")
+	case strings.HasPrefix(path, schemeS3):
+		return fetchS3(path)
+	default:
+		return os.ReadFile(path)
+	}
+}
+
+// fetchHttps downloads a config file, sending the header set through CONFIG_AUTH_HEADER, such as `Authorization: Bearer <token>`
+func fetchHttps(rawUrl string) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header := os.Getenv(EnvVarKeyAuthHeader); header != "" {
+		name, value := "Authorization", header
+		if i := strings.Index(header, ":"); i > 0 {
+			name, value = header[:i], header[i+1:]
+		}
+		request.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return doRemoteRequest(request)
+}
+
+// fetchS3 downloads a config file from an s3 bucket, signing the request with the standard aws credential variables.
+// AWS_ENDPOINT_URL selects s3 compatible storage, such as minio or cloudflare r2, which is addressed with path-style urls.
+func fetchS3(rawUrl string) ([]byte, error) {
+	location := strings.TrimPrefix(rawUrl, schemeS3)
+	i := strings.Index(location, "/")
+	if i <= 0 || i == len(location)-1 {
+		return nil, fmt.Errorf("s3 url %s is invalid, expected s3://bucket/key", rawUrl)
+	}
+	bucket, key := location[:i], location[i+1:]
+	region := os.Getenv(envVarKeyAwsRegion)
+	if region == "" {
+		region = os.Getenv(envVarKeyAwsDefaultRegion)
+	}
+	if region == "" {
+		region = defaultAwsRegion
+	}
+	var (
+		host = fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region)
+		path = "/" + encodeS3Path(key)
+	)
+	scheme := strings.TrimSuffix(schemeHttps, "://")
+	if endpoint := os.Getenv(envVarKeyAwsEndpointUrl); endpoint != "" {
+		endpointUrl, err := url.Parse(endpoint)
+		if err != nil || endpointUrl.Host == "" {
+			return nil, fmt.Errorf("%s %s is invalid, expected a url such as https://s3.example.com", envVarKeyAwsEndpointUrl, endpoint)
+		}
+		scheme, host = endpointUrl.Scheme, endpointUrl.Host
+		path = strings.TrimSuffix(endpointUrl.Path, "/") + "/" + encodeS3Path(bucket) + path
+	}
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s%s", scheme, host, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.URL.RawPath = path
+	accessKeyId, secretAccessKey := os.Getenv(envVarKeyAwsAccessKeyId), os.Getenv(envVarKeyAwsSecretAccessKey)
+	if accessKeyId == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("%s and %s are required to read the config file from s3", envVarKeyAwsAccessKeyId, envVarKeyAwsSecretAccessKey)
+	}
+	signS3Request(request, host, path, region, accessKeyId, secretAccessKey, os.Getenv(envVarKeyAwsSessionToken), time.Now().UTC())
+	return doRemoteRequest(request)
+}
+
+// signS3Request adds the aws signature version 4 headers of a get request without query parameters
+func signS3Request(request *http.Request, host, path, region, accessKeyId, secretAccessKey, sessionToken string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	headers := [][2]string{
+		{"host", host},
+		{"x-amz-content-sha256", s3PayloadUnsigned},
+		{"x-amz-date", amzDate},
+	}
+	if sessionToken != "" {
+		headers = append(headers, [2]string{"x-amz-security-token", sessionToken})
+	}
+	var canonicalHeaders, signedHeaders []string
+	for _, header := range headers {
+		canonicalHeaders = append(canonicalHeaders, header[0]+":"+header[1]+"\n")
+		signedHeaders = append(signedHeaders, header[0])
+		if header[0] != "host" {
+			request.Header.Set(header[0], header[1])
+		}
+	}
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		path,
+		"",
+		strings.Join(canonicalHeaders, ""),
+		strings.Join(signedHeaders, ";"),
+		s3PayloadUnsigned,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3SigningAlgorithm, amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, accessKeyId, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// encodeS3Path escapes every character of an object key except the unreserved ones and slashes, as expected by the signature
+func encodeS3Path(key string) string {
+	var builder strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '-', b == '_', b == '.', b == '~', b == '/':
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+func doRemoteRequest(request *http.Request) ([]byte, error) {
+	client := &http.Client{Timeout: remoteTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("unexpected status code %d: %s", response.StatusCode, strings.Join(strings.Fields(string(body)), " "))
+	}
+	return io.ReadAll(response.Body)
+}
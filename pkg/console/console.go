@@ -0,0 +1,43 @@
+package console
+
+import (
+	"io"
+	"os"
+)
+
+const (
+	envVarKeyNoColor = "NO_COLOR"
+	envVarKeyTerm    = "TERM"
+
+	Bold   = "\033[1m"
+	Green  = "\033[32m"
+	Red    = "\033[31m"
+	Yellow = "\033[33m"
+	reset  = "\033[0m"
+)
+
+// IsTerminal reports whether the writer is attached to a terminal rather than piped to a file or another program
+func IsTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled reports whether output to the writer is colored, which it is for terminals unless NO_COLOR is set
+func ColorEnabled(w io.Writer) bool {
+	if os.Getenv(envVarKeyNoColor) != "" || os.Getenv(envVarKeyTerm) == "dumb" {
+		return false
+	}
+	return IsTerminal(w)
+}
+
+// Colorize wraps the text in the color when output to the writer is colored, returning it unchanged otherwise
+func Colorize(w io.Writer, color, text string) string {
+	if !ColorEnabled(w) {
+		return text
+	}
+	return color + text + reset
+}
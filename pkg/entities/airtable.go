@@ -0,0 +1,7 @@
+package entities
+
+// AirtableRecord is a row of an airtable table, with its values keyed by the name of their field
+type AirtableRecord struct {
+	Id     string                 `json:"id,omitempty"`
+	Fields map[string]interface{} `json:"fields"`
+}
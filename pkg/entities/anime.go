@@ -0,0 +1,62 @@
+package entities
+
+import (
+	"time"
+)
+
+const (
+	AnimeTypeMovie = "MOVIE"
+
+	AniListStatusCompleted = "COMPLETED"
+	AniListStatusPlanning  = "PLANNING"
+
+	MalStatusCompleted = "completed"
+)
+
+// AnimeIds are the ids of an anime on the services that track it, as listed by an anime mapping database
+type AnimeIds struct {
+	Imdb    string
+	Mal     int
+	AniDb   int
+	AniList int
+	Tmdb    int
+	Tvdb    int
+	Type    string // the format of the anime, such as TV, MOVIE or OVA
+}
+
+// MalScore is the score of an anime on a myanimelist list, which is 0 when the anime is listed without a score
+type MalScore struct {
+	Id     int
+	Score  int
+	Status string // empty when the anime is not listed
+}
+
+// AniListEntry is an anime of the list of an anilist user
+type AniListEntry struct {
+	Id        int // the id of the entry, which is 0 for an anime not listed yet
+	MediaId   int
+	Status    string
+	Score     int // from 1 to 10, or 0 when the anime is not scored
+	UpdatedAt *time.Time
+}
+
+// ImdbItem converts the entry to the imdb item of the anime with the ids, rated when the entry is scored
+func (e *AniListEntry) ImdbItem(ids AnimeIds) ImdbItem {
+	item := ImdbItem{
+		Id:        ids.Imdb,
+		TitleType: imdbItemTypeTvSeries,
+	}
+	if ids.Type == AnimeTypeMovie {
+		item.TitleType = imdbItemTypeMovie
+	}
+	if e.Score > 0 {
+		score := e.Score
+		ratedAt := time.Now()
+		if e.UpdatedAt != nil {
+			ratedAt = *e.UpdatedAt
+		}
+		item.Rating = &score
+		item.RatingDate = &ratedAt
+	}
+	return item
+}
@@ -1,5 +1,9 @@
 package entities
 
+import (
+	"sort"
+)
+
 func ListDifference(imdbList ImdbList, traktList TraktList) map[string]TraktItems {
 	imdbItems := make(map[string]ImdbItem)
 	for _, item := range imdbList.ListItems {
@@ -36,3 +40,22 @@ func ItemsDifference(imdbItems map[string]ImdbItem, traktItems map[string]TraktI
 	}
 	return diff
 }
+
+// ListOrderDiffers reports whether the items shared by both lists are ordered differently in trakt than in imdb
+func ListOrderDiffers(imdbList ImdbList, traktList TraktList) bool {
+	traktRanks := make(map[string]int)
+	for _, item := range traktList.ListItems {
+		id, err := item.GetItemId()
+		if err != nil || id == nil {
+			continue
+		}
+		traktRanks[*id] = item.Rank
+	}
+	var ranks []int
+	for _, item := range imdbList.ListItems {
+		if rank, found := traktRanks[item.Id]; found {
+			ranks = append(ranks, rank)
+		}
+	}
+	return !sort.IntsAreSorted(ranks)
+}
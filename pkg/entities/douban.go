@@ -0,0 +1,8 @@
+package entities
+
+// DoubanSubject is a movie or show of douban, with the imdb id its page lists, which is empty when it lists none
+type DoubanSubject struct {
+	Id     string `json:"id"`
+	ImdbId string `json:"imdb_id"`
+	IsShow bool   `json:"is_show"`
+}
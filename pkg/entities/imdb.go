@@ -51,10 +51,43 @@ func (i *ImdbItem) toTraktItem() TraktItem {
 	return ti
 }
 
+// TraktItemType returns the type of the trakt item the imdb item is synced as
+func (i *ImdbItem) TraktItemType() string {
+	return i.toTraktItem().Type
+}
+
+func (i *ImdbItem) IsShow() bool {
+	switch i.TitleType {
+	case imdbItemTypeTvEpisode, imdbItemTypeTvMiniSeries, imdbItemTypeTvSeries:
+		return true
+	default:
+		return false
+	}
+}
+
 type ImdbList struct {
 	ListId        string
 	ListName      string
 	ListItems     []ImdbItem
 	IsWatchlist   bool
 	TraktListSlug string // lazily populated
+	TraktSortBy   string
+	TraktSortHow  string
+	Ranked        bool // the order of the items is synced, not just their membership
+}
+
+// TraktItems converts the items of the list to trakt items, preserving their order
+func (l *ImdbList) TraktItems() TraktItems {
+	items := make(TraktItems, 0, len(l.ListItems))
+	for i := range l.ListItems {
+		items = append(items, l.ListItems[i].toTraktItem())
+	}
+	return items
+}
+
+// ImdbExport is a snapshot of the imdb data read by the syncer
+type ImdbExport struct {
+	CreatedAt time.Time  `json:"created_at"`
+	Lists     []ImdbList `json:"lists"`
+	Ratings   []ImdbItem `json:"ratings"`
 }
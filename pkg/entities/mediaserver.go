@@ -0,0 +1,79 @@
+package entities
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	MediaServerItemTypeEpisode = "episode"
+	MediaServerItemTypeMovie   = "movie"
+	MediaServerItemTypeShow    = "show"
+)
+
+// MediaServerItem is a movie, show or episode of the library of a media server such as plex or jellyfin,
+// which the server identifies by its key
+type MediaServerItem struct {
+	Key      string
+	ImdbId   string
+	Type     string
+	Title    string
+	Watched  bool
+	Planned  bool       // in the library without having been started, such as the planned items of stremio
+	ViewedAt *time.Time // when it was last watched, if the server knows
+	Rating   *float64   // out of 10, in steps of half a point
+	RatedAt  *time.Time
+}
+
+func (i *MediaServerItem) titleType() string {
+	switch i.Type {
+	case MediaServerItemTypeEpisode:
+		return imdbItemTypeTvEpisode
+	case MediaServerItemTypeShow:
+		return imdbItemTypeTvSeries
+	default:
+		return imdbItemTypeMovie
+	}
+}
+
+// ImdbItem converts a rated item to an imdb item, rounding its rating to the whole points of trakt.
+// It is dated when it was rated, falling back to when it was last watched.
+func (i *MediaServerItem) ImdbItem() ImdbItem {
+	item := ImdbItem{
+		Id:        i.ImdbId,
+		TitleType: i.titleType(),
+	}
+	if i.Rating != nil {
+		rating := int(math.Max(1, math.Round(*i.Rating)))
+		ratedAt := time.Now()
+		if i.RatedAt != nil {
+			ratedAt = *i.RatedAt
+		} else if i.ViewedAt != nil {
+			ratedAt = *i.ViewedAt
+		}
+		item.Rating = &rating
+		item.RatingDate = &ratedAt
+	}
+	return item
+}
+
+// HistoryItem converts a watched item to a trakt history entry, dated when it was last watched when the server knows
+func (i *MediaServerItem) HistoryItem() TraktItem {
+	imdbItem := ImdbItem{
+		Id:        i.ImdbId,
+		TitleType: i.titleType(),
+	}
+	item := imdbItem.toTraktItem()
+	if i.ViewedAt != nil {
+		watchedAt := i.ViewedAt.UTC().Format(time.RFC3339)
+		switch item.Type {
+		case TraktItemTypeShow:
+			item.Show.WatchedAt = &watchedAt
+		case TraktItemTypeEpisode:
+			item.Episode.WatchedAt = &watchedAt
+		default:
+			item.Movie.WatchedAt = &watchedAt
+		}
+	}
+	return item
+}
@@ -0,0 +1,30 @@
+package entities
+
+import (
+	"time"
+)
+
+const (
+	NotionStatusRated     = "Rated"
+	NotionStatusWatchlist = "Watchlist"
+)
+
+// NotionPage is a movie, show or episode of a notion database, which the syncer tells apart from the pages added by hand by its imdb id
+type NotionPage struct {
+	Id      string
+	ImdbId  string
+	Title   string
+	Type    string // the trakt type of the item, shown capitalized
+	Status  string
+	Rating  *int
+	RatedAt *time.Time
+	Poster  string
+}
+
+// Differs reports whether the status or rating of the page differs from the other one
+func (p *NotionPage) Differs(other NotionPage) bool {
+	if p.Status != other.Status || (p.Rating == nil) != (other.Rating == nil) {
+		return true
+	}
+	return p.Rating != nil && *p.Rating != *other.Rating
+}
@@ -0,0 +1,66 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	SyncActionAdd     = "add"
+	SyncActionCreate  = "create"
+	SyncActionDelete  = "delete"
+	SyncActionRemove  = "remove"
+	SyncActionReorder = "reorder"
+
+	SyncTargetHistory   = "history"
+	SyncTargetList      = "list"
+	SyncTargetRatings   = "ratings"
+	SyncTargetWatchlist = "watchlist"
+)
+
+type SyncOperation struct {
+	Action      string     `json:"action"`
+	Target      string     `json:"target"`
+	ListName    string     `json:"list_name,omitempty"`
+	ListSlug    string     `json:"list_slug,omitempty"`
+	Description string     `json:"description,omitempty"`
+	SortBy      string     `json:"sort_by,omitempty"`
+	SortHow     string     `json:"sort_how,omitempty"`
+	Items       TraktItems `json:"items,omitempty"`
+}
+
+type SyncPlan struct {
+	CreatedAt  time.Time       `json:"created_at"`
+	Operations []SyncOperation `json:"operations"`
+}
+
+// Describe summarizes the operation in a few words, such as "add 3 item(s) of watchlist"
+func (o SyncOperation) Describe() string {
+	switch o.Action {
+	case SyncActionCreate, SyncActionDelete:
+		return fmt.Sprintf("%s list %s", o.Action, o.ListSlug)
+	}
+	if o.Target == SyncTargetList {
+		return fmt.Sprintf("%s %d item(s) of list %s", o.Action, len(o.Items), o.ListSlug)
+	}
+	return fmt.Sprintf("%s %d item(s) of %s", o.Action, len(o.Items), o.Target)
+}
+
+// Chunks splits an operation into operations containing at most size items each.
+// Reorder operations are never split, since they carry the complete order of a list.
+func (o SyncOperation) Chunks(size int) []SyncOperation {
+	if size <= 0 || len(o.Items) <= size || o.Action == SyncActionReorder {
+		return []SyncOperation{o}
+	}
+	chunks := make([]SyncOperation, 0, len(o.Items)/size+1)
+	for start := 0; start < len(o.Items); start += size {
+		end := start + size
+		if end > len(o.Items) {
+			end = len(o.Items)
+		}
+		chunk := o
+		chunk.Items = o.Items[start:end]
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
@@ -0,0 +1,49 @@
+package entities
+
+import (
+	"time"
+)
+
+const (
+	SimklItemTypeMovie = "movie"
+	SimklItemTypeShow  = "show"
+
+	SimklStatusCompleted   = "completed"
+	SimklStatusPlanToWatch = "plantowatch"
+)
+
+type SimklAuthCodesResponse struct {
+	UserCode        string `json:"user_code"`
+	VerificationUrl string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// SimklItem is a movie or show tracked on simkl, which is identified by its imdb id along with its type
+type SimklItem struct {
+	ImdbId    string
+	Type      string
+	Status    string // the list of the item, such as plantowatch or completed, empty when the item is not tracked
+	Rating    *int
+	RatedAt   *time.Time
+	WatchedAt *time.Time
+}
+
+// NewSimklItem converts an imdb item to a simkl item, dated when it was rated.
+// It reports false for episodes, which simkl only knows by their show, season and number.
+func NewSimklItem(i ImdbItem) (SimklItem, bool) {
+	item := SimklItem{
+		ImdbId:    i.Id,
+		Type:      SimklItemTypeMovie,
+		Rating:    i.Rating,
+		RatedAt:   i.RatingDate,
+		WatchedAt: i.RatingDate,
+	}
+	switch i.TitleType {
+	case imdbItemTypeTvEpisode:
+		return item, false
+	case imdbItemTypeTvSeries, imdbItemTypeTvMiniSeries:
+		item.Type = SimklItemTypeShow
+	}
+	return item, true
+}
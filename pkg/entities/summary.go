@@ -0,0 +1,103 @@
+package entities
+
+import (
+	"time"
+)
+
+type SyncSummary struct {
+	Version            string          `json:"version"`
+	StartedAt          time.Time       `json:"started_at"`
+	FinishedAt         time.Time       `json:"finished_at"`
+	Operations         []SyncOperation `json:"operations"`
+	ItemsNotFound      int             `json:"items_not_found"`
+	OperationsDeferred int             `json:"operations_deferred"`
+	FailedLists        []string        `json:"failed_lists,omitempty"`
+	Http               *HttpTelemetry  `json:"http,omitempty"`
+	Failures           []ItemFailure   `json:"failures,omitempty"`
+	Timings            []Timing        `json:"timings,omitempty"`
+}
+
+const (
+	ItemFailureReasonInvalidRow = "invalid_row"
+	ItemFailureReasonNotFound   = "not_found"
+	ItemFailureReasonRejected   = "rejected"
+)
+
+// ItemFailure is an item that could not be synced, such as an id trakt does not know or a row of an imdb export that could not be parsed
+type ItemFailure struct {
+	ImdbId string `json:"imdb_id,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Action string `json:"action,omitempty"`
+	Target string `json:"target"`
+	List   string `json:"list,omitempty"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Timing is the time spent on a phase of a run, or on a step of it when the step is set, such as applying the changes of a list
+type Timing struct {
+	Phase   string  `json:"phase"`
+	Step    string  `json:"step,omitempty"`
+	Seconds float64 `json:"seconds"`
+}
+
+func (t Timing) Duration() time.Duration {
+	return time.Duration(t.Seconds * float64(time.Second))
+}
+
+// HttpTelemetry summarizes the http requests sent during a run, showing whether rate limits of trakt slowed it down
+type HttpTelemetry struct {
+	Requests             int                 `json:"requests"`
+	Retries              int                 `json:"retries"`
+	RateLimitWaitSeconds float64             `json:"rate_limit_wait_seconds"`
+	P95LatencyMs         int64               `json:"p95_latency_ms"`
+	Endpoints            []EndpointTelemetry `json:"endpoints"`
+}
+
+// EndpointTelemetry summarizes the requests sent to an endpoint, identified by its path with ids left out
+type EndpointTelemetry struct {
+	Service      string `json:"service"`
+	Method       string `json:"method"`
+	Route        string `json:"route"`
+	Requests     int    `json:"requests"`
+	Retries      int    `json:"retries"`
+	P95LatencyMs int64  `json:"p95_latency_ms"`
+}
+
+// SyncResult is the json representation of a finished run, printed by the commands that change trakt with --output json
+type SyncResult struct {
+	SyncSummary
+	ItemsAdded   int    `json:"items_added"`
+	ItemsRemoved int    `json:"items_removed"`
+	Error        string `json:"error,omitempty"`
+}
+
+func NewSyncResult(summary SyncSummary, err error) SyncResult {
+	result := SyncResult{
+		SyncSummary:  summary,
+		ItemsAdded:   summary.ItemsAdded(),
+		ItemsRemoved: summary.ItemsRemoved(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (s *SyncSummary) ItemsAdded() int {
+	return s.countItems(SyncActionAdd)
+}
+
+func (s *SyncSummary) ItemsRemoved() int {
+	return s.countItems(SyncActionRemove)
+}
+
+func (s *SyncSummary) countItems(action string) int {
+	count := 0
+	for _, operation := range s.Operations {
+		if operation.Action == action {
+			count += len(operation.Items)
+		}
+	}
+	return count
+}
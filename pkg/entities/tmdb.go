@@ -0,0 +1,51 @@
+package entities
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	TmdbMediaTypeMovie = "movie"
+	TmdbMediaTypeTv    = "tv"
+
+	TmdbAccountListFavorite  = "favorite"
+	TmdbAccountListRated     = "rated"
+	TmdbAccountListWatchlist = "watchlist"
+)
+
+// TmdbItem is a movie or show of tmdb, which is identified by its id along with its media type
+type TmdbItem struct {
+	Id        int        `json:"id"`
+	MediaType string     `json:"media_type"`
+	Rating    float64    `json:"rating,omitempty"`
+	RatedAt   *time.Time `json:"rated_at,omitempty"`
+}
+
+type TmdbList struct {
+	Id    string
+	Name  string
+	Items []TmdbItem
+}
+
+// ImdbItem converts the item to the imdb item with the id, so it feeds the same targets as the items of imdb.
+// The ratings of tmdb go in steps of half a point, which are rounded to the whole points of trakt.
+func (i *TmdbItem) ImdbItem(imdbId string) ImdbItem {
+	item := ImdbItem{
+		Id:        imdbId,
+		TitleType: imdbItemTypeMovie,
+	}
+	if i.MediaType == TmdbMediaTypeTv {
+		item.TitleType = imdbItemTypeTvSeries
+	}
+	if i.Rating > 0 {
+		rating := int(math.Max(1, math.Round(i.Rating)))
+		ratedAt := time.Now()
+		if i.RatedAt != nil {
+			ratedAt = *i.RatedAt
+		}
+		item.Rating = &rating
+		item.RatingDate = &ratedAt
+	}
+	return item
+}
@@ -3,6 +3,9 @@ package entities
 import (
 	"fmt"
 	"go.uber.org/zap/zapcore"
+	"regexp"
+	"strings"
+	"time"
 )
 
 const (
@@ -10,6 +13,11 @@ const (
 	TraktItemTypeMovie   = "movie"
 	TraktItemTypeSeason  = "season"
 	TraktItemTypeShow    = "show"
+
+	TraktListDescriptionAutoImported = "list auto imported from imdb by https://github.com/cecobask/imdb-trakt-sync"
+
+	TraktListSortByMyRating = "my_rating"
+	TraktListSortHowDesc    = "desc"
 )
 
 type TraktAuthCodesBody struct {
@@ -17,8 +25,11 @@ type TraktAuthCodesBody struct {
 }
 
 type TraktAuthCodesResponse struct {
-	DeviceCode string `json:"device_code"`
-	UserCode   string `json:"user_code"`
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationUrl string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
 }
 
 type TraktAuthTokensBody struct {
@@ -28,12 +39,35 @@ type TraktAuthTokensBody struct {
 }
 
 type TraktAuthTokensResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	CreatedAt    int64  `json:"created_at,omitempty"`
+}
+
+// ExpiresAt returns the time the access token expires
+func (r *TraktAuthTokensResponse) ExpiresAt() time.Time {
+	return time.Unix(r.CreatedAt+r.ExpiresIn, 0)
+}
+
+type TraktAuthRefreshBody struct {
+	RefreshToken string `json:"refresh_token"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectUri  string `json:"redirect_uri"`
+	GrantType    string `json:"grant_type"`
+}
+
+type TraktUserSettings struct {
+	User struct {
+		Ids TraktIds `json:"ids"`
+	} `json:"user"`
 }
 
 type TraktIds struct {
 	Imdb string `json:"imdb,omitempty" zap:"imdb,omitempty"`
 	Slug string `json:"slug,omitempty"`
+	Tmdb int    `json:"tmdb,omitempty"`
 }
 
 func (ti TraktIds) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
@@ -42,10 +76,59 @@ func (ti TraktIds) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
 }
 
 type TraktItemSpec struct {
-	Ids       TraktIds `json:"ids" zap:"ids"`
-	RatedAt   *string  `json:"rated_at,omitempty"`
-	Rating    *int     `json:"rating,omitempty"`
-	WatchedAt *string  `json:"watched_at,omitempty"`
+	Ids       TraktIds      `json:"ids" zap:"ids"`
+	Notes     *string       `json:"notes,omitempty"`
+	RatedAt   *string       `json:"rated_at,omitempty"`
+	Rating    *int          `json:"rating,omitempty"`
+	WatchedAt *string       `json:"watched_at,omitempty"`
+	Seasons   []TraktSeason `json:"seasons,omitempty"` // only populated for shows, to sync some of their seasons or episodes
+}
+
+// TraktMetadata describes a movie, show or episode to the targets that display it, such as notion
+type TraktMetadata struct {
+	Type   string
+	Title  string
+	Year   int
+	Poster string // the url of the poster, which is that of the show for an episode
+}
+
+// TraktSeason is a season of a show, identified by its number, which syncs the whole season unless episodes are given
+type TraktSeason struct {
+	Number    int            `json:"number"`
+	RatedAt   *string        `json:"rated_at,omitempty"`
+	Rating    *int           `json:"rating,omitempty"`
+	WatchedAt *string        `json:"watched_at,omitempty"`
+	Episodes  []TraktEpisode `json:"episodes,omitempty"`
+}
+
+// TraktEpisode is an episode of a season, identified by its number
+type TraktEpisode struct {
+	Number    int     `json:"number"`
+	RatedAt   *string `json:"rated_at,omitempty"`
+	Rating    *int    `json:"rating,omitempty"`
+	WatchedAt *string `json:"watched_at,omitempty"`
+}
+
+// TraktShowEpisode is an episode of a show as listed by its seasons, with its title
+type TraktShowEpisode struct {
+	Season int    `json:"season"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+}
+
+// TraktSearchResult is a movie or show found by a trakt text search
+type TraktSearchResult struct {
+	Title string   `json:"title"`
+	Year  int      `json:"year"`
+	Ids   TraktIds `json:"ids"`
+}
+
+// TraktComment is a comment on a show or one of its seasons, which trakt requires to be at least five words long
+type TraktComment struct {
+	Show    *TraktItemSpec `json:"show,omitempty"`
+	Season  *TraktItemSpec `json:"season,omitempty"`
+	Comment string         `json:"comment"`
+	Spoiler bool           `json:"spoiler"`
 }
 
 func (spec *TraktItemSpec) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
@@ -63,12 +146,15 @@ func (specs TraktItemSpecs) MarshalLogArray(encoder zapcore.ArrayEncoder) error
 }
 
 type TraktItem struct {
-	Type    string        `json:"type"`
-	RatedAt string        `json:"rated_at,omitempty"`
-	Rating  int           `json:"rating,omitempty"`
-	Movie   TraktItemSpec `json:"movie,omitempty"`
-	Show    TraktItemSpec `json:"show,omitempty"`
-	Episode TraktItemSpec `json:"episode,omitempty"`
+	Id       int64         `json:"id,omitempty"`   // only populated for list items
+	Rank     int           `json:"rank,omitempty"` // only populated for list items
+	Type     string        `json:"type"`
+	ListedAt string        `json:"listed_at,omitempty"` // only populated for list and watchlist items
+	RatedAt  string        `json:"rated_at,omitempty"`
+	Rating   int           `json:"rating,omitempty"`
+	Movie    TraktItemSpec `json:"movie,omitempty"`
+	Show     TraktItemSpec `json:"show,omitempty"`
+	Episode  TraktItemSpec `json:"episode,omitempty"`
 }
 
 type TraktItems []TraktItem
@@ -84,6 +170,18 @@ func (items TraktItems) MarshalLogArray(encoder zapcore.ArrayEncoder) error {
 	return nil
 }
 
+// SetNotes attaches notes to the item, which trakt only stores for list items of vip accounts
+func (item *TraktItem) SetNotes(notes string) {
+	switch item.Type {
+	case TraktItemTypeMovie:
+		item.Movie.Notes = &notes
+	case TraktItemTypeShow:
+		item.Show.Notes = &notes
+	case TraktItemTypeEpisode:
+		item.Episode.Notes = &notes
+	}
+}
+
 func (item *TraktItem) GetItemId() (*string, error) {
 	switch item.Type {
 	case TraktItemTypeMovie:
@@ -105,6 +203,10 @@ type TraktListBody struct {
 	Episodes TraktItemSpecs `json:"episodes,omitempty" zap:"episodes,omitempty"`
 }
 
+func (tlb *TraktListBody) Count() int {
+	return len(tlb.Movies) + len(tlb.Shows) + len(tlb.Episodes)
+}
+
 func (tlb *TraktListBody) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
 	if len(tlb.Movies) != 0 {
 		_ = encoder.AddArray("movies", tlb.Movies)
@@ -128,6 +230,10 @@ type TraktListAddBody struct {
 	SortHow        string `json:"sort_how"`
 }
 
+type TraktListReorderBody struct {
+	Rank []int64 `json:"rank"`
+}
+
 type TraktCrudItem struct {
 	Movies   int `json:"movies,omitempty" zap:"movies,omitempty"`
 	Shows    int `json:"shows,omitempty" zap:"shows,omitempty"`
@@ -180,7 +286,41 @@ func (tr *TraktResponse) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
 
 type TraktList struct {
 	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	SortBy      string  `json:"sort_by,omitempty"`
+	SortHow     string  `json:"sort_how,omitempty"`
 	Ids         TraktIds
 	ListItems   TraktItems
 	IsWatchlist bool
 }
+
+func (tl *TraktList) IsAutoImported() bool {
+	return tl.Description != nil && strings.HasPrefix(*tl.Description, TraktListDescriptionAutoImported)
+}
+
+func BuildTraktListSlug(listName string) string {
+	formatted := strings.ToLower(strings.Join(strings.Fields(listName), "-"))
+	re := regexp.MustCompile(`[^-a-z0-9]+`)
+	return re.ReplaceAllString(formatted, "")
+}
+
+// ImdbIds returns the imdb ids of every item in the body
+func (tlb *TraktListBody) ImdbIds() []string {
+	ids := make([]string, 0, tlb.Count())
+	for _, specs := range []TraktItemSpecs{tlb.Movies, tlb.Shows, tlb.Episodes} {
+		for _, spec := range specs {
+			if spec.Ids.Imdb != "" {
+				ids = append(ids, spec.Ids.Imdb)
+			}
+		}
+	}
+	return ids
+}
+
+// TraktBackup is a snapshot of the trakt data managed by the syncer
+type TraktBackup struct {
+	CreatedAt time.Time   `json:"created_at"`
+	Watchlist TraktItems  `json:"watchlist"`
+	Lists     []TraktList `json:"lists"`
+	Ratings   TraktItems  `json:"ratings"`
+}
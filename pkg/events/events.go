@@ -0,0 +1,208 @@
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EnvVarKeyHttpUrl     = "CLOUDEVENTS_HTTP_URL"
+	EnvVarKeyNatsSubject = "CLOUDEVENTS_NATS_SUBJECT"
+	EnvVarKeyNatsUrl     = "CLOUDEVENTS_NATS_URL"
+
+	TypeRunStarted   = "run.started"
+	TypeListSynced   = "list.synced"
+	TypeRunCompleted = "run.completed"
+	TypeRunFailed    = "run.failed"
+
+	specVersion        = "1.0"
+	typePrefix         = "io.github.cecobask.imdb-trakt-sync."
+	source             = "/imdb-trakt-sync"
+	contentType        = "application/cloudevents+json"
+	defaultNatsSubject = "imdb-trakt-sync"
+	publishTimeout     = 10 * time.Second
+)
+
+// Event is a cloudevent in the structured json format, correlated with the other events of its run through the runid extension
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	Id              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	RunId           string      `json:"runid,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+type runData struct {
+	Profile string `json:"profile,omitempty"`
+}
+
+type listData struct {
+	Target string `json:"target"`
+	List   string `json:"list,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type resultData struct {
+	entities.SyncResult
+	Profile string `json:"profile,omitempty"`
+}
+
+// Enabled reports whether the lifecycle events of runs are published to an http sink or a nats subject
+func Enabled() bool {
+	return os.Getenv(EnvVarKeyHttpUrl) != "" || os.Getenv(EnvVarKeyNatsUrl) != ""
+}
+
+func Validate() []error {
+	var errs []error
+	if value := os.Getenv(EnvVarKeyHttpUrl); value != "" {
+		if parsed, err := url.Parse(value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("failure parsing environment variable %s: must be an http or https url", EnvVarKeyHttpUrl))
+		}
+	}
+	if value := os.Getenv(EnvVarKeyNatsUrl); value != "" {
+		if _, err := parseNatsUrl(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if subject := os.Getenv(EnvVarKeyNatsSubject); strings.ContainsAny(subject, " \t*>") {
+		errs = append(errs, fmt.Errorf("failure parsing environment variable %s: must be a subject without whitespace or wildcards", EnvVarKeyNatsSubject))
+	}
+	return errs
+}
+
+// SecretEnvVarKeys returns the environment variables that may hold credentials within the url of a sink
+func SecretEnvVarKeys() []string {
+	return []string{EnvVarKeyHttpUrl, EnvVarKeyNatsUrl}
+}
+
+// Publisher sends the lifecycle events of the runs of a profile to every configured sink
+type Publisher struct {
+	profile string
+	mutex   sync.Mutex
+	runId   string
+}
+
+func NewPublisher(profile string) *Publisher {
+	return &Publisher{
+		profile: profile,
+	}
+}
+
+// RunStarted publishes the start of a run, which every following event of the run refers to through its runid
+func (p *Publisher) RunStarted() []error {
+	p.mutex.Lock()
+	p.runId = randomId()
+	p.mutex.Unlock()
+	return p.publish(TypeRunStarted, p.profile, runData{Profile: p.profile})
+}
+
+func (p *Publisher) ListSynced(target, listSlug string, err error) []error {
+	data := listData{
+		Target: target,
+		List:   listSlug,
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	subject := target
+	if listSlug != "" {
+		subject = listSlug
+	}
+	return p.publish(TypeListSynced, subject, data)
+}
+
+// RunCompleted publishes the summary of a finished run, as run.failed when the run failed
+func (p *Publisher) RunCompleted(summary entities.SyncSummary, err error) []error {
+	eventType := TypeRunCompleted
+	if err != nil {
+		eventType = TypeRunFailed
+	}
+	return p.publish(eventType, p.profile, resultData{
+		SyncResult: entities.NewSyncResult(summary, err),
+		Profile:    p.profile,
+	})
+}
+
+func (p *Publisher) publish(eventType, subject string, data interface{}) []error {
+	p.mutex.Lock()
+	runId := p.runId
+	p.mutex.Unlock()
+	event := Event{
+		SpecVersion:     specVersion,
+		Id:              randomId(),
+		Source:          source,
+		Type:            typePrefix + eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		RunId:           runId,
+		Data:            data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return []error{fmt.Errorf("failure marshalling %s event: %w", eventType, err)}
+	}
+	var errs []error
+	if endpoint := os.Getenv(EnvVarKeyHttpUrl); endpoint != "" {
+		if err = publishHttp(endpoint, payload); err != nil {
+			errs = append(errs, fmt.Errorf("failure publishing %s event to the http sink: %w", eventType, err))
+		}
+	}
+	if natsUrl := os.Getenv(EnvVarKeyNatsUrl); natsUrl != "" {
+		if err = publishNats(natsUrl, natsSubject(eventType), payload); err != nil {
+			errs = append(errs, fmt.Errorf("failure publishing %s event to nats: %w", eventType, err))
+		}
+	}
+	return errs
+}
+
+// publishHttp posts the event in the structured content mode of the cloudevents http binding
+func publishHttp(endpoint string, payload []byte) error {
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failure creating request: %w", err)
+	}
+	request.Header.Set("Content-Type", contentType)
+	client := &http.Client{Timeout: publishTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failure sending request: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// natsSubject appends the event type to the configured subject, such as imdb-trakt-sync.run.started,
+// so subscribers can pick the events they need with wildcards
+func natsSubject(eventType string) string {
+	subject := os.Getenv(EnvVarKeyNatsSubject)
+	if subject == "" {
+		subject = defaultNatsSubject
+	}
+	return subject + "." + eventType
+}
+
+func randomId() string {
+	bytes := make([]byte, 16)
+	_, _ = rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,237 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// Latest selects the most recent run instead of its id
+	Latest = "latest"
+
+	idLayout      = "20060102T150405Z"
+	fileExtension = ".json"
+)
+
+// Run is the summary of a past run, including every change it applied, identified by the time it started
+type Run struct {
+	Id string `json:"id"`
+	entities.SyncResult
+}
+
+func NewRun(summary entities.SyncSummary, err error) Run {
+	return Run{
+		Id:         summary.StartedAt.UTC().Format(idLayout),
+		SyncResult: entities.NewSyncResult(summary, err),
+	}
+}
+
+// Store keeps the summary of every run as a json file of a local directory, dropping the oldest runs past the limit
+type Store struct {
+	dir   string
+	limit int
+}
+
+func NewStore(dir string, limit int) *Store {
+	return &Store{
+		dir:   dir,
+		limit: limit,
+	}
+}
+
+func (s *Store) Save(run Run) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failure creating run history directory %s: %w", s.dir, err)
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failure marshalling run history: %w", err)
+	}
+	path := filepath.Join(s.dir, run.Id+fileExtension)
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing run history to %s: %w", path, err)
+	}
+	return s.prune()
+}
+
+// prune removes the oldest runs, keeping the number of runs within the limit
+func (s *Store) prune() error {
+	ids, err := s.ids()
+	if err != nil || s.limit <= 0 || len(ids) <= s.limit {
+		return err
+	}
+	for _, id := range ids[s.limit:] {
+		path := filepath.Join(s.dir, id+fileExtension)
+		if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failure removing run history %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// ids returns the ids of the recorded runs, most recent first
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failure reading run history directory %s: %w", s.dir, err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), fileExtension) {
+			ids = append(ids, strings.TrimSuffix(entry.Name(), fileExtension))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// List returns the recorded runs, most recent first
+func (s *Store) List() ([]Run, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]Run, 0, len(ids))
+	for _, id := range ids {
+		run, err := s.load(id)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, nil
+}
+
+// Get returns the run with the given id, or the most recent run when the id is latest
+func (s *Store) Get(id string) (*Run, error) {
+	if id == Latest {
+		ids, err := s.ids()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no runs recorded yet in %s", s.dir)
+		}
+		id = ids[0]
+	}
+	if strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("run id %s is invalid", id)
+	}
+	run, err := s.load(id)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("run %s is not recorded in %s, list the recorded runs with the history command", id, s.dir)
+	}
+	return run, err
+}
+
+func (s *Store) load(id string) (*Run, error) {
+	path := filepath.Join(s.dir, id+fileExtension)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading run history %s: %w", path, err)
+	}
+	var run Run
+	if err = json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling run history %s: %w", path, err)
+	}
+	return &run, nil
+}
+
+func PrintRuns(writer io.Writer, runs []Run) error {
+	if len(runs) == 0 {
+		_, err := fmt.Fprintln(writer, "no runs recorded yet")
+		return err
+	}
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tSTARTED\tDURATION\tADDED\tREMOVED\tNOT FOUND\tOUTCOME")
+	for _, run := range runs {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", run.Id, run.StartedAt.Local().Format("2006-01-02 15:04"), run.duration(),
+			run.ItemsAdded, run.ItemsRemoved, run.ItemsNotFound, run.outcome())
+	}
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("failure printing run history: %w", err)
+	}
+	return nil
+}
+
+// PrintRun prints the outcome of a run and every change it applied, listing the imdb ids of the items
+func PrintRun(writer io.Writer, run Run) error {
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "run:\t%s\n", run.Id)
+	fmt.Fprintf(table, "started:\t%s\n", run.StartedAt.Local().Format(time.RFC1123))
+	fmt.Fprintf(table, "duration:\t%s\n", run.duration())
+	fmt.Fprintf(table, "outcome:\t%s\n", run.outcome())
+	if run.Error != "" {
+		fmt.Fprintf(table, "error:\t%s\n", run.Error)
+	}
+	fmt.Fprintf(table, "items:\t%d added, %d removed, %d not found, %d operation(s) deferred\n", run.ItemsAdded, run.ItemsRemoved, run.ItemsNotFound, run.OperationsDeferred)
+	if len(run.FailedLists) > 0 {
+		fmt.Fprintf(table, "failed lists:\t%s\n", strings.Join(run.FailedLists, ", "))
+	}
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("failure printing run history: %w", err)
+	}
+	if err := printTimings(writer, run.Timings); err != nil {
+		return err
+	}
+	if len(run.Operations) == 0 {
+		_, err := fmt.Fprintln(writer, "\nno changes applied")
+		return err
+	}
+	for _, operation := range run.Operations {
+		fmt.Fprintf(writer, "\n%s\n", operation.Describe())
+		for i := range operation.Items {
+			id, err := operation.Items[i].GetItemId()
+			if err != nil || id == nil || *id == "" {
+				fmt.Fprintf(writer, "  %s without an imdb id\n", operation.Items[i].Type)
+				continue
+			}
+			fmt.Fprintf(writer, "  %s %s\n", *id, operation.Items[i].Type)
+		}
+	}
+	return nil
+}
+
+// printTimings prints the time spent on every phase of the run and on the steps within it, such as applying the changes of a list
+func printTimings(writer io.Writer, timings []entities.Timing) error {
+	if len(timings) == 0 {
+		return nil
+	}
+	fmt.Fprintln(writer)
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PHASE\tSTEP\tDURATION")
+	for _, timing := range timings {
+		step := timing.Step
+		if step == "" {
+			step = "total"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", timing.Phase, step, timing.Duration().Round(time.Millisecond))
+	}
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("failure printing run timings: %w", err)
+	}
+	return nil
+}
+
+func (r Run) duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt).Round(time.Second)
+}
+
+func (r Run) outcome() string {
+	if r.Error != "" {
+		return "failed"
+	}
+	return "succeeded"
+}
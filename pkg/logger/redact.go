@@ -0,0 +1,168 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const redacted = "[redacted]"
+
+var (
+	secretsMutex sync.RWMutex
+	secrets      = make(map[string]bool)
+)
+
+// credentialPatterns match credentials that may show up in errors without being configured, such as tokens of authorization headers
+// or the api keys of request urls
+var credentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[^\s"']+`),
+	regexp.MustCompile(`(?i)((?:access_token|refresh_token|client_secret|password|token)["']?\s*[:=]\s*["']?)[^\s"'&,}]+`),
+	regexp.MustCompile(`(?i)([?&](?:api_key|apikey)=)[^\s"'&#]+`),
+}
+
+// AddSecrets registers credentials that must never show up in the logs, such as tokens obtained at runtime
+// or secrets read from files, which are replaced along with anything resembling a credential
+func AddSecrets(values ...string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, value := range values {
+		if value != "" {
+			secrets[value] = true
+		}
+	}
+}
+
+// Redact replaces the registered secrets and anything resembling a credential in the text with a placeholder
+func Redact(text string) string {
+	secretsMutex.RLock()
+	values := make([]string, 0, len(secrets))
+	for value := range secrets {
+		values = append(values, value)
+	}
+	secretsMutex.RUnlock()
+	return Scrub(text, values)
+}
+
+// Scrub replaces the secret values and anything resembling a credential with a placeholder
+func Scrub(text string, secrets []string) string {
+	for _, secret := range secrets {
+		// short values such as a rating or a boolean would redact unrelated text
+		if len(secret) >= 6 {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	for _, pattern := range credentialPatterns {
+		text = pattern.ReplaceAllString(text, "${1}"+redacted)
+	}
+	return text
+}
+
+// redactingCore scrubs the message and fields of every entry before it reaches the wrapped core,
+// so debug logs are safe to share in issues
+type redactingCore struct {
+	zapcore.Core
+}
+
+func newRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{
+		Core: core,
+	}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return newRedactingCore(c.Core.With(redactFields(fields)))
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = Redact(entry.Message)
+	entry.Stack = Redact(entry.Stack)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = redactField(field)
+	}
+	return redacted
+}
+
+func redactField(field zapcore.Field) zapcore.Field {
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = Redact(field.String)
+	case zapcore.ByteStringType:
+		if data, ok := field.Interface.([]byte); ok {
+			return zap.ByteString(field.Key, []byte(Redact(string(data))))
+		}
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok {
+			if message := Redact(err.Error()); message != err.Error() {
+				return zap.NamedError(field.Key, errors.New(message))
+			}
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(fmt.Stringer); ok {
+			return zap.String(field.Key, Redact(stringer.String()))
+		}
+	case zapcore.ReflectType:
+		data, err := json.Marshal(field.Interface)
+		if err != nil {
+			return field
+		}
+		if redacted := Redact(string(data)); redacted != string(data) {
+			return zap.Reflect(field.Key, json.RawMessage(redacted))
+		}
+	case zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		// complex values are only rebuilt when they hold a secret, as most of them are lists of items
+		encoder := zapcore.NewMapObjectEncoder()
+		field.AddTo(encoder)
+		value, changed := redactValue(encoder.Fields[field.Key])
+		if changed {
+			return zap.Any(field.Key, value)
+		}
+	}
+	return field
+}
+
+// redactValue redacts the strings nested in a value encoded by a map encoder, reporting whether any of them changed
+func redactValue(value interface{}) (interface{}, bool) {
+	switch typed := value.(type) {
+	case string:
+		redacted := Redact(typed)
+		return redacted, redacted != typed
+	case map[string]interface{}:
+		changed := false
+		for key, nested := range typed {
+			var nestedChanged bool
+			if typed[key], nestedChanged = redactValue(nested); nestedChanged {
+				changed = true
+			}
+		}
+		return typed, changed
+	case []interface{}:
+		changed := false
+		for i, nested := range typed {
+			var nestedChanged bool
+			if typed[i], nestedChanged = redactValue(nested); nestedChanged {
+				changed = true
+			}
+		}
+		return typed, changed
+	default:
+		return value, false
+	}
+}
@@ -1,16 +1,100 @@
 package logger
 
 import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/console"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 	"os"
+	"strconv"
 	"time"
 )
 
+const (
+	EnvVarKeyLogFile           = "LOG_FILE"
+	EnvVarKeyLogFileMaxAge     = "LOG_FILE_MAX_AGE"
+	EnvVarKeyLogFileMaxBackups = "LOG_FILE_MAX_BACKUPS"
+	EnvVarKeyLogFileMaxSize    = "LOG_FILE_MAX_SIZE"
+	EnvVarKeyLogFormat         = "LOG_FORMAT"
+	EnvVarKeyLogLevel          = "LOG_LEVEL"
+
+	defaultLogFileMaxAge     = 28
+	defaultLogFileMaxBackups = 5
+	defaultLogFileMaxSize    = 10
+
+	FormatConsole = "console"
+	FormatJson    = "json"
+)
+
+// ParseLevel parses a log level such as debug, info, warn or error, defaulting to info when it is empty
+func ParseLevel(value string) (zapcore.Level, error) {
+	if value == "" {
+		return zapcore.InfoLevel, nil
+	}
+	level, err := zapcore.ParseLevel(value)
+	if err != nil {
+		return zapcore.InfoLevel, fmt.Errorf("failure parsing log level %s: valid levels are debug, info, warn, error", value)
+	}
+	return level, nil
+}
+
+// ParseFormat parses a log format, defaulting to json when it is empty
+func ParseFormat(value string) (string, error) {
+	switch value {
+	case "", FormatJson:
+		return FormatJson, nil
+	case FormatConsole:
+		return FormatConsole, nil
+	default:
+		return FormatJson, fmt.Errorf("failure parsing log format %s: valid formats are %s, %s", value, FormatConsole, FormatJson)
+	}
+}
+
+// NewFileWriter returns a writer rotating the log file set through LOG_FILE, or nil when logging to a file is disabled
+func NewFileWriter() (*lumberjack.Logger, error) {
+	path := os.Getenv(EnvVarKeyLogFile)
+	if path == "" {
+		return nil, nil
+	}
+	writer := &lumberjack.Logger{
+		Filename: path,
+	}
+	settings := []struct {
+		key          string
+		value        *int
+		defaultValue int
+	}{
+		{key: EnvVarKeyLogFileMaxAge, value: &writer.MaxAge, defaultValue: defaultLogFileMaxAge},
+		{key: EnvVarKeyLogFileMaxBackups, value: &writer.MaxBackups, defaultValue: defaultLogFileMaxBackups},
+		{key: EnvVarKeyLogFileMaxSize, value: &writer.MaxSize, defaultValue: defaultLogFileMaxSize},
+	}
+	for _, setting := range settings {
+		*setting.value = setting.defaultValue
+		value := os.Getenv(setting.key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("failure parsing environment variable %s: must be a non-negative integer", setting.key)
+		}
+		*setting.value = parsed
+	}
+	return writer, nil
+}
+
 func NewLogger() *zap.Logger {
+	// invalid settings are reported while validating the environment variables, so they fall back to the defaults here
+	level, _ := ParseLevel(os.Getenv(EnvVarKeyLogLevel))
+	format, _ := ParseFormat(os.Getenv(EnvVarKeyLogFormat))
+	// people watching a terminal get readable lines, while logs piped to a file or collector stay structured
+	if os.Getenv(EnvVarKeyLogFormat) == "" && console.IsTerminal(os.Stderr) {
+		format = FormatConsole
+	}
 	config := zap.Config{
-		Level:    zap.NewAtomicLevelAt(zapcore.DebugLevel),
-		Encoding: "json",
+		Level:    zap.NewAtomicLevelAt(level),
+		Encoding: format,
 		EncoderConfig: zapcore.EncoderConfig{
 			TimeKey:        "time",
 			LevelKey:       "level",
@@ -28,7 +112,24 @@ func NewLogger() *zap.Logger {
 		OutputPaths:      []string{"stderr"},
 		ErrorOutputPaths: []string{"stderr"},
 	}
-	logger, err := config.Build()
+	fileEncoderConfig := config.EncoderConfig
+	if format == FormatConsole && console.ColorEnabled(os.Stderr) {
+		config.EncoderConfig.EncodeLevel = zapcore.LowercaseColorLevelEncoder
+	}
+	var options []zap.Option
+	if fileWriter, _ := NewFileWriter(); fileWriter != nil {
+		encoder := zapcore.NewJSONEncoder(fileEncoderConfig)
+		if format == FormatConsole {
+			encoder = zapcore.NewConsoleEncoder(fileEncoderConfig)
+		}
+		fileCore := zapcore.NewCore(encoder, zapcore.AddSync(fileWriter), config.Level)
+		options = append(options, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, fileCore)
+		}))
+	}
+	// wrapped last, so the entries written to the log file are redacted as well
+	options = append(options, zap.WrapCore(newRedactingCore))
+	logger, err := config.Build(options...)
 	if err != nil {
 		os.Exit(1)
 	}
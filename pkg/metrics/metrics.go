@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EnvVarKeyMetricsAddr = "METRICS_ADDR"
+
+	namespace = "imdb_trakt_sync"
+
+	OutcomeFailure = "failure"
+	OutcomeSuccess = "success"
+)
+
+// runDurationBuckets are the upper bounds in seconds of the run duration histogram, from quick incremental syncs to first syncs of large libraries
+var runDurationBuckets = []float64{10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// metric is a counter or gauge, keyed by its formatted labels
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	values map[string]float64
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+var (
+	mutex sync.Mutex
+
+	requests           = newMetric("api_requests_total", "Http requests sent to imdb and trakt by service and status code.", "counter")
+	rateLimits         = newMetric("api_rate_limit_hits_total", "Responses telling to slow down by service.", "counter")
+	retries            = newMetric("api_retries_total", "Http requests sent again after being rate limited by service.", "counter")
+	runs               = newMetric("runs_total", "Runs by outcome.", "counter")
+	itemsAdded         = newMetric("items_added_total", "Items added to trakt by target.", "counter")
+	itemsRemoved       = newMetric("items_removed_total", "Items removed from trakt by target.", "counter")
+	itemsNotFound      = newMetric("items_not_found_total", "Items trakt could not find.", "counter")
+	operationsDeferred = newMetric("operations_deferred_total", "Operations deferred to the retry queue.", "counter")
+	lastRun            = newMetric("last_run_timestamp_seconds", "Unix time the last run finished by outcome.", "gauge")
+	runDuration        = &histogram{
+		name:    namespace + "_run_duration_seconds",
+		help:    "Duration of runs.",
+		buckets: runDurationBuckets,
+		counts:  make([]uint64, len(runDurationBuckets)),
+	}
+)
+
+func newMetric(name, help, kind string) *metric {
+	return &metric{
+		name:   namespace + "_" + name,
+		help:   help,
+		kind:   kind,
+		values: make(map[string]float64),
+	}
+}
+
+// RecordRequest counts an http request sent to a service, along with the status code of its response
+func RecordRequest(service string, statusCode int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	requests.values[labels("service", service, "status", fmt.Sprint(statusCode))]++
+}
+
+// RecordRateLimit counts a response of a service asking to slow down, which is retried when retried is true
+func RecordRateLimit(service string, retried bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	rateLimits.values[labels("service", service)]++
+	if retried {
+		retries.values[labels("service", service)]++
+	}
+}
+
+// RecordRun counts the outcome, changes and duration of a finished run
+func RecordRun(summary entities.SyncSummary, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+	runs.values[labels("outcome", outcome)]++
+	lastRun.values[labels("outcome", outcome)] = float64(summary.FinishedAt.Unix())
+	for _, operation := range summary.Operations {
+		switch operation.Action {
+		case entities.SyncActionAdd:
+			itemsAdded.values[labels("target", operation.Target)] += float64(len(operation.Items))
+		case entities.SyncActionRemove:
+			itemsRemoved.values[labels("target", operation.Target)] += float64(len(operation.Items))
+		}
+	}
+	itemsNotFound.values[""] += float64(summary.ItemsNotFound)
+	operationsDeferred.values[""] += float64(summary.OperationsDeferred)
+	runDuration.observe(summary.FinishedAt.Sub(summary.StartedAt))
+}
+
+func (h *histogram) observe(duration time.Duration) {
+	seconds := duration.Seconds()
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Write prints every metric in the prometheus text exposition format
+func Write(w io.Writer) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	var builder strings.Builder
+	for _, m := range []*metric{requests, rateLimits, retries, runs, itemsAdded, itemsRemoved, itemsNotFound, operationsDeferred, lastRun} {
+		fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		keys := make([]string, 0, len(m.values))
+		for key := range m.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&builder, "%s%s %g\n", m.name, key, m.values[key])
+		}
+	}
+	h := runDuration
+	fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, bound := range h.buckets {
+		fmt.Fprintf(&builder, "%s_bucket{le=\"%g\"} %d\n", h.name, bound, h.counts[i])
+	}
+	fmt.Fprintf(&builder, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", h.name, h.count, h.name, h.sum, h.name, h.count)
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// Handler serves the metrics to prometheus scrapes
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Write(w)
+	})
+}
+
+// labels formats label pairs as {name="value",...}
+func labels(pairs ...string) string {
+	formatted := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		formatted = append(formatted, fmt.Sprintf("%s=\"%s\"", pairs[i], value))
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
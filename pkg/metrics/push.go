@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	EnvVarKeyPushgatewayJob    = "PUSHGATEWAY_JOB"
+	EnvVarKeyPushgatewayLabels = "PUSHGATEWAY_LABELS"
+	EnvVarKeyPushgatewayUrl    = "PUSHGATEWAY_URL"
+
+	defaultPushgatewayJob = "imdb-trakt-sync"
+	pushTimeout           = 10 * time.Second
+)
+
+// PushEnabled reports whether the metrics of short-lived runs are pushed to a prometheus pushgateway
+func PushEnabled() bool {
+	return os.Getenv(EnvVarKeyPushgatewayUrl) != ""
+}
+
+// ParsePushLabels parses the grouping labels set through PUSHGATEWAY_LABELS, such as instance=nas,profile=main
+func ParsePushLabels(value string) (map[string]string, error) {
+	groupingLabels := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, labelValue, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(labelValue) == "" {
+			return nil, fmt.Errorf("failure parsing environment variable %s: label %s must be formatted as name=value", EnvVarKeyPushgatewayLabels, pair)
+		}
+		groupingLabels[strings.TrimSpace(name)] = strings.TrimSpace(labelValue)
+	}
+	return groupingLabels, nil
+}
+
+// Push replaces the metrics of the job and grouping labels on the pushgateway with the metrics of this process,
+// so the last run of a cron job stays visible to prometheus after the process exited
+func Push() error {
+	groupingLabels, err := ParsePushLabels(os.Getenv(EnvVarKeyPushgatewayLabels))
+	if err != nil {
+		return err
+	}
+	job := os.Getenv(EnvVarKeyPushgatewayJob)
+	if job == "" {
+		job = defaultPushgatewayJob
+	}
+	path := "/metrics/job/" + url.PathEscape(job)
+	names := make([]string, 0, len(groupingLabels))
+	for name := range groupingLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path += "/" + url.PathEscape(name) + "/" + url.PathEscape(groupingLabels[name])
+	}
+	var body bytes.Buffer
+	if err = Write(&body); err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(os.Getenv(EnvVarKeyPushgatewayUrl), "/") + path
+	request, err := http.NewRequest(http.MethodPut, endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failure creating pushgateway request: %w", err)
+	}
+	request.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	client := &http.Client{Timeout: pushTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failure pushing metrics to %s: %w", endpoint, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		details, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("failure pushing metrics to %s: unexpected status code %d: %s", endpoint, response.StatusCode, strings.TrimSpace(string(details)))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"fmt"
+)
+
+const (
+	EnvVarKeyAppriseNotifyOn = "APPRISE_NOTIFY_ON"
+	EnvVarKeyAppriseUrl      = "APPRISE_URL"
+	EnvVarKeyAppriseUrls     = "APPRISE_URLS"
+
+	appriseMessageLimit = 4096
+)
+
+// apprise sends the report through an apprise api server, which forwards it to any of the services supported by apprise,
+// either configured on the server under the key of the url, or passed along as apprise urls
+type apprise struct {
+	notifyUrl   string
+	serviceUrls string
+}
+
+type apprisePayload struct {
+	Urls   string `json:"urls,omitempty"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Type   string `json:"type"`
+	Format string `json:"format"`
+}
+
+func (a *apprise) name() string {
+	return "apprise"
+}
+
+func (a *apprise) triggerKey() string {
+	return EnvVarKeyAppriseNotifyOn
+}
+
+func (a *apprise) send(report Report) error {
+	var footer string
+	if report.Url != "" {
+		footer = fmt.Sprintf("\n\n[Full report](%s)", report.Url)
+	}
+	payload := apprisePayload{
+		Urls:   a.serviceUrls,
+		Title:  report.Title,
+		Body:   markdownMessage(report, appriseMessageLimit-len(footer)) + footer,
+		Type:   "success",
+		Format: "markdown",
+	}
+	if report.Failed {
+		payload.Type = "failure"
+	}
+	return postJson(a.notifyUrl, payload, nil)
+}
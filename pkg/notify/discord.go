@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	EnvVarKeyDiscordNotifyOn   = "DISCORD_NOTIFY_ON"
+	EnvVarKeyDiscordWebhookUrl = "DISCORD_WEBHOOK_URL"
+
+	discordColorFailure     = 0xe74c3c
+	discordColorSuccess     = 0x2ecc71
+	discordDescriptionLimit = 4096
+	discordUsername         = "IMDb Trakt Sync"
+)
+
+// discord posts the report as an embed to a discord channel webhook
+type discord struct {
+	webhookUrl string
+}
+
+type discordPayload struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (d *discord) name() string {
+	return "discord"
+}
+
+func (d *discord) triggerKey() string {
+	return EnvVarKeyDiscordNotifyOn
+}
+
+func (d *discord) send(report Report) error {
+	embed := discordEmbed{
+		Title:       report.Title,
+		Description: markdownDescription(report, discordDescriptionLimit),
+		Color:       discordColorSuccess,
+		Fields: []discordField{
+			{Name: "Added", Value: fmt.Sprint(report.ItemsAdded), Inline: true},
+			{Name: "Removed", Value: fmt.Sprint(report.ItemsRemoved), Inline: true},
+			{Name: "Duration", Value: report.Duration.String(), Inline: true},
+		},
+	}
+	if report.Failed {
+		embed.Color = discordColorFailure
+	}
+	if report.ItemsNotFound > 0 {
+		embed.Fields = append(embed.Fields, discordField{Name: "Not found", Value: fmt.Sprint(report.ItemsNotFound), Inline: true})
+	}
+	if report.OperationsDeferred > 0 {
+		embed.Fields = append(embed.Fields, discordField{Name: "Deferred", Value: fmt.Sprint(report.OperationsDeferred), Inline: true})
+	}
+	if len(report.FailedLists) > 0 {
+		embed.Fields = append(embed.Fields, discordField{Name: "Failed lists", Value: truncate(strings.Join(report.FailedLists, ", "), 1024)})
+	}
+	if !report.FinishedAt.IsZero() {
+		embed.Timestamp = report.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	return postJson(d.webhookUrl, discordPayload{Username: discordUsername, Embeds: []discordEmbed{embed}}, nil)
+}
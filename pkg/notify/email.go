@@ -0,0 +1,260 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EnvVarKeySmtpFrom     = "SMTP_FROM"
+	EnvVarKeySmtpHost     = "SMTP_HOST"
+	EnvVarKeySmtpNotifyOn = "SMTP_NOTIFY_ON"
+	EnvVarKeySmtpPassword = "SMTP_PASSWORD"
+	EnvVarKeySmtpPort     = "SMTP_PORT"
+	EnvVarKeySmtpTo       = "SMTP_TO"
+	EnvVarKeySmtpUsername = "SMTP_USERNAME"
+
+	defaultSmtpPort     = 587
+	smtpImplicitTlsPort = 465
+	emailItemsPerChange = 100
+)
+
+// email sends the report as an html email with a plain text alternative over smtp
+type email struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newEmail() (*email, error) {
+	port, err := smtpPort()
+	if err != nil {
+		return nil, err
+	}
+	e := &email{
+		host:     os.Getenv(EnvVarKeySmtpHost),
+		port:     port,
+		username: os.Getenv(EnvVarKeySmtpUsername),
+		password: os.Getenv(EnvVarKeySmtpPassword),
+		from:     os.Getenv(EnvVarKeySmtpFrom),
+	}
+	for _, address := range strings.Split(os.Getenv(EnvVarKeySmtpTo), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			e.to = append(e.to, address)
+		}
+	}
+	if len(e.to) == 0 {
+		return nil, fmt.Errorf("%s is required to send emails through %s", EnvVarKeySmtpTo, EnvVarKeySmtpHost)
+	}
+	if e.from == "" {
+		e.from = e.username
+	}
+	if e.from == "" {
+		return nil, fmt.Errorf("%s or %s is required to send emails through %s", EnvVarKeySmtpFrom, EnvVarKeySmtpUsername, EnvVarKeySmtpHost)
+	}
+	return e, nil
+}
+
+// smtpPort parses SMTP_PORT, which defaults to the submission port that upgrades the connection with starttls
+func smtpPort() (int, error) {
+	value := os.Getenv(EnvVarKeySmtpPort)
+	if value == "" {
+		return defaultSmtpPort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("failure parsing environment variable %s: must be a port number, such as %d", EnvVarKeySmtpPort, defaultSmtpPort)
+	}
+	return port, nil
+}
+
+func (e *email) name() string {
+	return "email"
+}
+
+func (e *email) triggerKey() string {
+	return EnvVarKeySmtpNotifyOn
+}
+
+func (e *email) send(report Report) error {
+	message, err := emailMessage(report, e.from, e.to)
+	if err != nil {
+		return err
+	}
+	address := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	tlsConfig := &tls.Config{ServerName: e.host}
+	var conn net.Conn
+	if e.port == smtpImplicitTlsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	if err = conn.SetDeadline(time.Now().Add(requestTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	// starttls is used whenever the server offers it, while plain auth is refused over unencrypted connections to remote hosts
+	if ok, _ := client.Extension("STARTTLS"); ok && e.port != smtpImplicitTlsPort {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(e.from); err != nil {
+		return err
+	}
+	for _, recipient := range e.to {
+		if err = client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailMessage builds a multipart message holding the report as plain text and html
+func emailMessage(report Report, from string, to []string) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{contentType: "text/plain; charset=utf-8", content: emailText(report)},
+		{contentType: "text/html; charset=utf-8", content: emailHtml(report)},
+	}
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failure writing email: %w", err)
+		}
+		if _, err = partWriter.Write([]byte(strings.ReplaceAll(part.content, "\n", "\r\n"))); err != nil {
+			return nil, fmt.Errorf("failure writing email: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failure writing email: %w", err)
+	}
+	var message bytes.Buffer
+	headers := [][2]string{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", report.Title)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%s", writer.Boundary())},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func emailText(report Report) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s\n%s\n", report.Title, report.Counts())
+	if report.Failed {
+		fmt.Fprintf(&builder, "\n%s\n", report.Error)
+	}
+	if len(report.FailedLists) > 0 {
+		fmt.Fprintf(&builder, "\nFailed lists: %s\n", strings.Join(report.FailedLists, ", "))
+	}
+	for _, change := range report.Changes {
+		fmt.Fprintf(&builder, "\n%s\n", change.Description)
+		for i, id := range change.ItemIds {
+			if i == emailItemsPerChange {
+				fmt.Fprintf(&builder, "- and %d more\n", len(change.ItemIds)-i)
+				break
+			}
+			fmt.Fprintf(&builder, "- %s\n", ImdbUrl(id))
+		}
+	}
+	if len(report.Changes) == 0 && !report.Failed {
+		builder.WriteString("\nTrakt was already in sync with IMDb.\n")
+	}
+	if report.Url != "" {
+		fmt.Fprintf(&builder, "\nFull report: %s\n", report.Url)
+	}
+	return builder.String()
+}
+
+func emailHtml(report Report) string {
+	var builder strings.Builder
+	builder.WriteString("<!DOCTYPE html>\n<html><body style=\"font-family: sans-serif\">\n")
+	fmt.Fprintf(&builder, "<h2>%s</h2>\n", html.EscapeString(report.Title))
+	if report.Failed {
+		fmt.Fprintf(&builder, "<pre style=\"color: #c0392b\">%s</pre>\n", html.EscapeString(report.Error))
+	}
+	builder.WriteString("<table border=\"1\" cellpadding=\"6\" style=\"border-collapse: collapse\">\n")
+	builder.WriteString("<tr><th>Duration</th><th>Items added</th><th>Items removed</th><th>Items not found</th><th>Operations deferred</th></tr>\n")
+	fmt.Fprintf(&builder, "<tr><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td></tr>\n</table>\n",
+		report.Duration, report.ItemsAdded, report.ItemsRemoved, report.ItemsNotFound, report.OperationsDeferred)
+	if len(report.FailedLists) > 0 {
+		fmt.Fprintf(&builder, "<p>Failed lists: %s</p>\n", html.EscapeString(strings.Join(report.FailedLists, ", ")))
+	}
+	for _, change := range report.Changes {
+		fmt.Fprintf(&builder, "<h3>%s</h3>\n<ul>\n", html.EscapeString(change.Description))
+		for i, id := range change.ItemIds {
+			if i == emailItemsPerChange {
+				fmt.Fprintf(&builder, "<li>and %d more</li>\n", len(change.ItemIds)-i)
+				break
+			}
+			fmt.Fprintf(&builder, "<li><a href=\"%s\">%s</a></li>\n", ImdbUrl(id), html.EscapeString(id))
+		}
+		builder.WriteString("</ul>\n")
+	}
+	if len(report.Changes) == 0 && !report.Failed {
+		builder.WriteString("<p>Trakt was already in sync with IMDb.</p>\n")
+	}
+	if report.Url != "" {
+		fmt.Fprintf(&builder, "<p><a href=\"%s\">Full report</a></p>\n", html.EscapeString(report.Url))
+	}
+	builder.WriteString("</body></html>\n")
+	return builder.String()
+}
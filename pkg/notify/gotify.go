@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"strings"
+)
+
+const (
+	EnvVarKeyGotifyNotifyOn = "GOTIFY_NOTIFY_ON"
+	EnvVarKeyGotifyToken    = "GOTIFY_TOKEN"
+	EnvVarKeyGotifyUrl      = "GOTIFY_URL"
+
+	gotifyMessageLimit    = 4096
+	gotifyPriorityFailure = 8
+	gotifyPrioritySuccess = 4
+)
+
+// gotify pushes the report as a message of an application on a gotify server
+type gotify struct {
+	serverUrl string
+	token     string
+}
+
+type gotifyPayload struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras"`
+}
+
+func (g *gotify) name() string {
+	return "gotify"
+}
+
+func (g *gotify) triggerKey() string {
+	return EnvVarKeyGotifyNotifyOn
+}
+
+func (g *gotify) send(report Report) error {
+	extras := map[string]interface{}{
+		"client::display": map[string]string{"contentType": "text/markdown"},
+	}
+	if report.Url != "" {
+		extras["client::notification"] = map[string]interface{}{"click": map[string]string{"url": report.Url}}
+	}
+	payload := gotifyPayload{
+		Title:    report.Title,
+		Message:  markdownMessage(report, gotifyMessageLimit),
+		Priority: gotifyPrioritySuccess,
+		Extras:   extras,
+	}
+	if report.Failed {
+		payload.Priority = gotifyPriorityFailure
+	}
+	return postJson(strings.TrimSuffix(g.serverUrl, "/")+"/message", payload, map[string]string{"X-Gotify-Key": g.token})
+}
@@ -0,0 +1,340 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	EnvVarKeyNotifyOn = "NOTIFY_ON"
+
+	TriggerAlways   = "always"
+	TriggerOnChange = "on-change"
+	TriggerOnError  = "on-error"
+
+	itemsPerChange = 10
+	requestTimeout = 15 * time.Second
+)
+
+// notifier delivers the report of a run to a chat or push service
+type notifier interface {
+	name() string
+	// triggerKey is the environment variable overriding NOTIFY_ON for the channel
+	triggerKey() string
+	send(report Report) error
+}
+
+// Report is the outcome of a run, shared by every notification channel
+type Report struct {
+	Title              string
+	Failed             bool
+	Error              string
+	FinishedAt         time.Time
+	Duration           time.Duration
+	ItemsAdded         int
+	ItemsRemoved       int
+	ItemsNotFound      int
+	OperationsDeferred int
+	FailedLists        []string
+	Changes            []Change
+	// Url links to the full report of the run, which is the job summary of github actions runs
+	Url     string
+	Profile string
+	Result  entities.SyncResult
+}
+
+// Change is an operation applied to trakt, along with the imdb ids of its items
+type Change struct {
+	Action      string
+	Description string
+	ItemIds     []string
+}
+
+// NewReport describes a run of the given profile, which is empty for the default settings
+func NewReport(summary entities.SyncSummary, err error, profile string) Report {
+	report := Report{
+		Title:              "IMDb to Trakt sync succeeded",
+		FinishedAt:         summary.FinishedAt,
+		Duration:           summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second),
+		ItemsAdded:         summary.ItemsAdded(),
+		ItemsRemoved:       summary.ItemsRemoved(),
+		ItemsNotFound:      summary.ItemsNotFound,
+		OperationsDeferred: summary.OperationsDeferred,
+		FailedLists:        summary.FailedLists,
+		Url:                githubRunUrl(),
+		Profile:            profile,
+		Result:             entities.NewSyncResult(summary, err),
+	}
+	if err != nil {
+		report.Title = "IMDb to Trakt sync failed"
+		report.Failed = true
+		report.Error = err.Error()
+	}
+	if profile != "" {
+		report.Title += fmt.Sprintf(" for profile %s", profile)
+	}
+	for _, operation := range summary.Operations {
+		change := Change{
+			Action:      operation.Action,
+			Description: operation.Describe(),
+		}
+		for i := range operation.Items {
+			if id, idErr := operation.Items[i].GetItemId(); idErr == nil && id != nil && *id != "" {
+				change.ItemIds = append(change.ItemIds, *id)
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	return report
+}
+
+// githubRunUrl returns the page of the github actions run, which shows the job summary of the sync
+func githubRunUrl() string {
+	server, repository, runId := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID")
+	if server == "" || repository == "" || runId == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", server, repository, runId)
+}
+
+// Counts summarizes the changes of the run in a single line
+func (r Report) Counts() string {
+	line := fmt.Sprintf("%d item(s) added, %d item(s) removed in %s", r.ItemsAdded, r.ItemsRemoved, r.Duration)
+	if r.ItemsNotFound > 0 {
+		line += fmt.Sprintf(", %d item(s) not found", r.ItemsNotFound)
+	}
+	if r.OperationsDeferred > 0 {
+		line += fmt.Sprintf(", %d operation(s) deferred to the next run", r.OperationsDeferred)
+	}
+	return line
+}
+
+// ImdbUrl returns the imdb page of a title
+func ImdbUrl(id string) string {
+	return fmt.Sprintf("https://www.imdb.com/title/%s/", id)
+}
+
+// ValidTriggers returns the values of NOTIFY_ON
+func ValidTriggers() []string {
+	return []string{TriggerAlways, TriggerOnChange, TriggerOnError}
+}
+
+// ParseTrigger validates when the notifications of a channel are sent, set through the given environment variable
+func ParseTrigger(key, value string) (string, error) {
+	if value == "" {
+		return TriggerAlways, nil
+	}
+	for _, trigger := range ValidTriggers() {
+		if value == trigger {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("failure using notification trigger %s from %s: valid triggers are %s", value, key, strings.Join(ValidTriggers(), ", "))
+}
+
+// triggerKeys returns NOTIFY_ON and the environment variables overriding it for a single channel
+func triggerKeys() []string {
+	return []string{EnvVarKeyNotifyOn, EnvVarKeyAppriseNotifyOn, EnvVarKeyDiscordNotifyOn, EnvVarKeyGotifyNotifyOn, EnvVarKeyNtfyNotifyOn, EnvVarKeySlackNotifyOn, EnvVarKeySmtpNotifyOn, EnvVarKeyTelegramNotifyOn, EnvVarKeyWebhookNotifyOn}
+}
+
+// Validate reports the invalid triggers and channel settings
+func Validate() []error {
+	var errs []error
+	for _, key := range triggerKeys() {
+		if _, err := ParseTrigger(key, os.Getenv(key)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	_, configErrs := notifiers()
+	return append(errs, configErrs...)
+}
+
+// SecretEnvVarKeys returns the environment variables holding credentials of notification channels,
+// including webhook urls, which allow anyone to post to the channel
+func SecretEnvVarKeys() []string {
+	return []string{EnvVarKeyAppriseUrl, EnvVarKeyAppriseUrls, EnvVarKeyDiscordWebhookUrl, EnvVarKeyGotifyToken, EnvVarKeyHealthcheckPingUrl, EnvVarKeyNtfyToken, EnvVarKeySlackWebhookUrl, EnvVarKeySmtpPassword, EnvVarKeyTelegramBotToken, EnvVarKeyWebhookHeaders, EnvVarKeyWebhookUrl}
+}
+
+// Enabled reports whether any notification channel is configured
+func Enabled() bool {
+	configured, configErrs := notifiers()
+	return len(configured) > 0 || len(configErrs) > 0
+}
+
+// Send delivers the report to every configured channel whose trigger matches the run,
+// returning the failures of the channels, which never stop the others from being notified
+func Send(report Report) []error {
+	configured, errs := notifiers()
+	for _, n := range configured {
+		key := n.triggerKey()
+		if os.Getenv(key) == "" {
+			key = EnvVarKeyNotifyOn
+		}
+		trigger, err := ParseTrigger(key, os.Getenv(key))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !triggerMatches(trigger, report) {
+			continue
+		}
+		if err = n.send(report); err != nil {
+			errs = append(errs, fmt.Errorf("failure sending %s notification: %w", n.name(), err))
+		}
+	}
+	return errs
+}
+
+func triggerMatches(trigger string, report Report) bool {
+	switch trigger {
+	case TriggerOnError:
+		return report.Failed
+	case TriggerOnChange:
+		return report.Failed || len(report.Changes) > 0
+	default:
+		return true
+	}
+}
+
+// notifiers returns the channels configured through environment variables, along with the settings preventing a channel from being used
+func notifiers() ([]notifier, []error) {
+	var (
+		configured []notifier
+		errs       []error
+	)
+	if webhookUrl := os.Getenv(EnvVarKeyDiscordWebhookUrl); webhookUrl != "" {
+		configured = append(configured, &discord{webhookUrl: webhookUrl})
+	}
+	if webhookUrl := os.Getenv(EnvVarKeySlackWebhookUrl); webhookUrl != "" {
+		configured = append(configured, &slack{webhookUrl: webhookUrl, channel: os.Getenv(EnvVarKeySlackChannel)})
+	}
+	if os.Getenv(EnvVarKeySmtpHost) != "" {
+		if e, err := newEmail(); err != nil {
+			errs = append(errs, err)
+		} else {
+			configured = append(configured, e)
+		}
+	}
+	if webhookUrl := os.Getenv(EnvVarKeyWebhookUrl); webhookUrl != "" {
+		if w, err := newWebhook(webhookUrl); err != nil {
+			errs = append(errs, err)
+		} else {
+			configured = append(configured, w)
+		}
+	}
+	if serverUrl, token := os.Getenv(EnvVarKeyGotifyUrl), os.Getenv(EnvVarKeyGotifyToken); serverUrl != "" && token != "" {
+		configured = append(configured, &gotify{serverUrl: serverUrl, token: token})
+	}
+	if notifyUrl := os.Getenv(EnvVarKeyAppriseUrl); notifyUrl != "" {
+		configured = append(configured, &apprise{notifyUrl: notifyUrl, serviceUrls: os.Getenv(EnvVarKeyAppriseUrls)})
+	}
+	if topicUrl := os.Getenv(EnvVarKeyNtfyUrl); topicUrl != "" {
+		configured = append(configured, &ntfy{topicUrl: topicUrl, token: os.Getenv(EnvVarKeyNtfyToken)})
+	}
+	if botToken, chatId := os.Getenv(EnvVarKeyTelegramBotToken), os.Getenv(EnvVarKeyTelegramChatId); botToken != "" && chatId != "" {
+		configured = append(configured, &telegram{botToken: botToken, chatId: chatId})
+	}
+	return configured, errs
+}
+
+// postJson sends a json payload, treating any status code other than 2xx as a failure
+func postJson(endpoint string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failure marshalling payload: %w", err)
+	}
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failure creating request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	return doRequest(request)
+}
+
+func doRequest(request *http.Request) error {
+	client := &http.Client{Timeout: requestTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// the url of a webhook is its secret, which must not end up in logs
+			return urlErr.Err
+		}
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		details, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", response.StatusCode, strings.Join(strings.Fields(string(details)), " "))
+	}
+	return nil
+}
+
+// markdownDescription lists the error and the first items of every change as markdown links, within limit characters
+func markdownDescription(report Report, limit int) string {
+	var lines []string
+	if report.Failed {
+		lines = append(lines, "> "+strings.ReplaceAll(report.Error, "\n", "\n> "), "")
+	}
+	for _, change := range report.Changes {
+		lines = append(lines, fmt.Sprintf("**%s**", change.Description))
+		links := make([]string, 0, itemsPerChange)
+		for i, id := range change.ItemIds {
+			if i == itemsPerChange {
+				links = append(links, fmt.Sprintf("and %d more", len(change.ItemIds)-i))
+				break
+			}
+			links = append(links, fmt.Sprintf("[%s](%s)", id, ImdbUrl(id)))
+		}
+		if len(links) > 0 {
+			lines = append(lines, strings.Join(links, ", "))
+		}
+	}
+	if len(report.Changes) == 0 && !report.Failed {
+		lines = append(lines, "Trakt was already in sync with IMDb.")
+	}
+	return joinLines(lines, limit)
+}
+
+// markdownMessage leads the markdown description with the counts of the run, for channels without fields of their own
+func markdownMessage(report Report, limit int) string {
+	counts := report.Counts() + "\n\n"
+	return counts + markdownDescription(report, limit-len(counts))
+}
+
+// joinLines joins as many lines as fit within limit characters, ending with an ellipsis when some are left out
+func joinLines(lines []string, limit int) string {
+	var builder strings.Builder
+	for _, line := range lines {
+		if builder.Len()+len(line)+1 > limit {
+			if builder.Len() == 0 {
+				return truncate(line, limit)
+			}
+			builder.WriteString("…")
+			break
+		}
+		builder.WriteString(line + "\n")
+	}
+	return truncate(strings.TrimRight(builder.String(), "\n"), limit)
+}
+
+// truncate shortens text to at most limit characters, ending with an ellipsis when shortened
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
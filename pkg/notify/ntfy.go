@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	EnvVarKeyNtfyNotifyOn = "NTFY_NOTIFY_ON"
+	EnvVarKeyNtfyToken    = "NTFY_TOKEN"
+	EnvVarKeyNtfyUrl      = "NTFY_URL"
+
+	ntfyMessageLimit = 4096
+)
+
+// ntfy publishes the report to a topic of ntfy.sh or a self-hosted ntfy server
+type ntfy struct {
+	topicUrl string
+	token    string
+}
+
+func (n *ntfy) name() string {
+	return "ntfy"
+}
+
+func (n *ntfy) triggerKey() string {
+	return EnvVarKeyNtfyNotifyOn
+}
+
+func (n *ntfy) send(report Report) error {
+	message := markdownMessage(report, ntfyMessageLimit)
+	request, err := http.NewRequest(http.MethodPost, n.topicUrl, strings.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("failure creating request: %w", err)
+	}
+	request.Header.Set("Title", report.Title)
+	request.Header.Set("Markdown", "yes")
+	request.Header.Set("Tags", "white_check_mark")
+	if report.Failed {
+		request.Header.Set("Tags", "x")
+		request.Header.Set("Priority", "high")
+	}
+	if report.Url != "" {
+		request.Header.Set("Click", report.Url)
+	}
+	if n.token != "" {
+		request.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return doRequest(request)
+}
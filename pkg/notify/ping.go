@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	EnvVarKeyHealthcheckPingUrl = "HEALTHCHECK_PING_URL"
+
+	pingBodyLimit = 10000
+	pingPathFail  = "/fail"
+	pingPathStart = "/start"
+)
+
+// PingEnabled reports whether runs ping a dead man's switch, such as a check of healthchecks.io
+func PingEnabled() bool {
+	return os.Getenv(EnvVarKeyHealthcheckPingUrl) != ""
+}
+
+// PingStart signals that a run started, so the dead man's switch can also alert on runs that never finish
+func PingStart() error {
+	return ping(pingPathStart, "")
+}
+
+// PingFinish signals that a run succeeded, or failed along with its error, following the ping api of healthchecks.io
+func PingFinish(err error) error {
+	if err != nil {
+		return ping(pingPathFail, err.Error())
+	}
+	return ping("", "")
+}
+
+func ping(path, body string) error {
+	endpoint := strings.TrimSuffix(os.Getenv(EnvVarKeyHealthcheckPingUrl), "/") + path
+	request, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(truncate(body, pingBodyLimit)))
+	if err != nil {
+		return fmt.Errorf("failure creating healthcheck ping: %w", err)
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if err = doRequest(request); err != nil {
+		return fmt.Errorf("failure sending healthcheck ping: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	EnvVarKeySlackChannel    = "SLACK_CHANNEL"
+	EnvVarKeySlackNotifyOn   = "SLACK_NOTIFY_ON"
+	EnvVarKeySlackWebhookUrl = "SLACK_WEBHOOK_URL"
+
+	slackChangeBlocks     = 20
+	slackSectionTextLimit = 3000
+)
+
+// slack posts the report as block kit blocks to a slack incoming webhook
+type slack struct {
+	webhookUrl string
+	channel    string
+}
+
+type slackPayload struct {
+	Channel string       `json:"channel,omitempty"`
+	Text    string       `json:"text"`
+	Blocks  []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func (s *slack) name() string {
+	return "slack"
+}
+
+func (s *slack) triggerKey() string {
+	return EnvVarKeySlackNotifyOn
+}
+
+func (s *slack) send(report Report) error {
+	return postJson(s.webhookUrl, slackMessage(report, s.channel), nil)
+}
+
+// slackMessage lays out the report as a header, the counts, the error and the first items of every change,
+// posted to the given channel instead of the default channel of the webhook when set
+func slackMessage(report Report, channel string) slackPayload {
+	icon := ":white_check_mark:"
+	if report.Failed {
+		icon = ":x:"
+	}
+	fields := []slackText{
+		slackMarkdown(fmt.Sprintf("*Added*\n%d", report.ItemsAdded)),
+		slackMarkdown(fmt.Sprintf("*Removed*\n%d", report.ItemsRemoved)),
+		slackMarkdown(fmt.Sprintf("*Duration*\n%s", report.Duration)),
+	}
+	if report.ItemsNotFound > 0 {
+		fields = append(fields, slackMarkdown(fmt.Sprintf("*Not found*\n%d", report.ItemsNotFound)))
+	}
+	if report.OperationsDeferred > 0 {
+		fields = append(fields, slackMarkdown(fmt.Sprintf("*Deferred*\n%d", report.OperationsDeferred)))
+	}
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: truncate(icon+" "+report.Title, 150)}},
+		{Type: "section", Fields: fields},
+	}
+	if report.Failed {
+		text := slackMarkdown(truncate("```"+report.Error, slackSectionTextLimit-3) + "```")
+		blocks = append(blocks, slackBlock{Type: "section", Text: &text})
+	}
+	if len(report.FailedLists) > 0 {
+		text := slackMarkdown(truncate("*Failed lists:* "+strings.Join(report.FailedLists, ", "), slackSectionTextLimit))
+		blocks = append(blocks, slackBlock{Type: "section", Text: &text})
+	}
+	for i, change := range report.Changes {
+		if i == slackChangeBlocks {
+			blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{slackMarkdown(fmt.Sprintf("and %d more change(s)", len(report.Changes)-i))}})
+			break
+		}
+		links := make([]string, 0, itemsPerChange)
+		for j, id := range change.ItemIds {
+			if j == itemsPerChange {
+				links = append(links, fmt.Sprintf("and %d more", len(change.ItemIds)-j))
+				break
+			}
+			links = append(links, fmt.Sprintf("<%s|%s>", ImdbUrl(id), id))
+		}
+		text := slackMarkdown(truncate(fmt.Sprintf("*%s*\n%s", change.Description, strings.Join(links, ", ")), slackSectionTextLimit))
+		blocks = append(blocks, slackBlock{Type: "section", Text: &text})
+	}
+	if len(report.Changes) == 0 && !report.Failed {
+		blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{slackMarkdown("Trakt was already in sync with IMDb.")}})
+	}
+	return slackPayload{
+		Channel: channel,
+		Text:    report.Title,
+		Blocks:  blocks,
+	}
+}
+
+func slackMarkdown(text string) slackText {
+	return slackText{Type: "mrkdwn", Text: text}
+}
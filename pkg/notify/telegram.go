@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+const (
+	EnvVarKeyTelegramBotToken = "TELEGRAM_BOT_TOKEN"
+	EnvVarKeyTelegramChatId   = "TELEGRAM_CHAT_ID"
+	EnvVarKeyTelegramNotifyOn = "TELEGRAM_NOTIFY_ON"
+
+	telegramApiUrl       = "https://api.telegram.org"
+	telegramErrorLimit   = 1000
+	telegramMessageLimit = 4096
+)
+
+// telegram sends the report as a message of a telegram bot to a chat, group or channel
+type telegram struct {
+	botToken string
+	chatId   string
+}
+
+type telegramPayload struct {
+	ChatId                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+func (t *telegram) name() string {
+	return "telegram"
+}
+
+func (t *telegram) triggerKey() string {
+	return EnvVarKeyTelegramNotifyOn
+}
+
+func (t *telegram) send(report Report) error {
+	payload := telegramPayload{
+		ChatId:                t.chatId,
+		Text:                  telegramMessage(report),
+		ParseMode:             "HTML",
+		DisableWebPagePreview: true,
+	}
+	return postJson(fmt.Sprintf("%s/bot%s/sendMessage", telegramApiUrl, t.botToken), payload, nil)
+}
+
+// telegramMessage formats the report as html, listing the first items of every change and linking to the full report when there is one
+func telegramMessage(report Report) string {
+	lines := []string{
+		fmt.Sprintf("<b>%s</b>", html.EscapeString(report.Title)),
+		html.EscapeString(report.Counts()),
+	}
+	if report.Failed {
+		lines = append(lines, fmt.Sprintf("<pre>%s</pre>", html.EscapeString(truncate(report.Error, telegramErrorLimit))))
+	}
+	if len(report.FailedLists) > 0 {
+		lines = append(lines, "Failed lists: "+html.EscapeString(strings.Join(report.FailedLists, ", ")))
+	}
+	for _, change := range report.Changes {
+		lines = append(lines, "", fmt.Sprintf("<b>%s</b>", html.EscapeString(change.Description)))
+		links := make([]string, 0, itemsPerChange)
+		for i, id := range change.ItemIds {
+			if i == itemsPerChange {
+				links = append(links, fmt.Sprintf("and %d more", len(change.ItemIds)-i))
+				break
+			}
+			links = append(links, fmt.Sprintf(`<a href="%s">%s</a>`, ImdbUrl(id), html.EscapeString(id)))
+		}
+		if len(links) > 0 {
+			lines = append(lines, strings.Join(links, ", "))
+		}
+	}
+	var footer string
+	if report.Url != "" {
+		footer = fmt.Sprintf("\n\n<a href=\"%s\">Full report</a>", html.EscapeString(report.Url))
+	}
+	return joinLines(lines, telegramMessageLimit-len(footer)) + footer
+}
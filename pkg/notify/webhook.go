@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"os"
+	"strings"
+)
+
+const (
+	EnvVarKeyWebhookHeaders  = "WEBHOOK_HEADERS"
+	EnvVarKeyWebhookNotifyOn = "WEBHOOK_NOTIFY_ON"
+	EnvVarKeyWebhookUrl      = "WEBHOOK_URL"
+)
+
+// webhook posts the json summary of the run to an arbitrary url, such as a home assistant or n8n webhook
+type webhook struct {
+	url     string
+	headers map[string]string
+}
+
+// webhookPayload is the json output of the sync command, along with the profile and the link to the full report
+type webhookPayload struct {
+	entities.SyncResult
+	Outcome   string `json:"outcome"`
+	Profile   string `json:"profile,omitempty"`
+	ReportUrl string `json:"report_url,omitempty"`
+}
+
+func newWebhook(url string) (*webhook, error) {
+	headers, err := parseHeaders(os.Getenv(EnvVarKeyWebhookHeaders))
+	if err != nil {
+		return nil, err
+	}
+	return &webhook{url: url, headers: headers}, nil
+}
+
+// parseHeaders parses comma separated headers formatted as Name=value
+func parseHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, headerValue, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("failure parsing environment variable %s: header %s must be formatted as Name=value", EnvVarKeyWebhookHeaders, strings.TrimSpace(name))
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(headerValue)
+	}
+	return headers, nil
+}
+
+func (w *webhook) name() string {
+	return "webhook"
+}
+
+func (w *webhook) triggerKey() string {
+	return EnvVarKeyWebhookNotifyOn
+}
+
+func (w *webhook) send(report Report) error {
+	payload := webhookPayload{
+		SyncResult: report.Result,
+		Outcome:    "success",
+		Profile:    report.Profile,
+		ReportUrl:  report.Url,
+	}
+	if report.Failed {
+		payload.Outcome = "failure"
+	}
+	return postJson(w.url, payload, w.headers)
+}
@@ -0,0 +1,144 @@
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/cecobask/imdb-trakt-sync/pkg/version"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	EnvVarKeyDsn         = "SENTRY_DSN"
+	EnvVarKeyEnvironment = "SENTRY_ENVIRONMENT"
+
+	LevelError = "error"
+	LevelFatal = "fatal"
+
+	clientName         = "imdb-trakt-sync"
+	defaultEnvironment = "production"
+	sendTimeout        = 10 * time.Second
+)
+
+// Event is an error or panic reported to sentry
+type Event struct {
+	Level string
+	// Category groups events of the same kind of failure, whatever their message
+	Category string
+	Message  string
+	Stack    string
+	Tags     map[string]string
+}
+
+type dsn struct {
+	publicKey string
+	endpoint  string
+}
+
+// Enabled reports whether errors are reported to the sentry dsn set through SENTRY_DSN
+func Enabled() bool {
+	return os.Getenv(EnvVarKeyDsn) != ""
+}
+
+// ValidateDsn reports a SENTRY_DSN that is not formatted as https://<key>@<host>/<project>
+func ValidateDsn() error {
+	if !Enabled() {
+		return nil
+	}
+	_, err := parseDsn(os.Getenv(EnvVarKeyDsn))
+	return err
+}
+
+func parseDsn(value string) (*dsn, error) {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil || parsed.User.Username() == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("failure parsing environment variable %s: expected a dsn such as https://<key>@o0.ingest.sentry.io/<project>", EnvVarKeyDsn)
+	}
+	path := strings.TrimSuffix(parsed.Path, "/")
+	i := strings.LastIndex(path, "/")
+	projectId := path[i+1:]
+	if projectId == "" {
+		return nil, fmt.Errorf("failure parsing environment variable %s: the dsn is missing the project id", EnvVarKeyDsn)
+	}
+	return &dsn{
+		publicKey: parsed.User.Username(),
+		endpoint:  fmt.Sprintf("%s://%s%s/api/%s/envelope/", parsed.Scheme, parsed.Host, path[:i], projectId),
+	}, nil
+}
+
+// Capture sends the event to sentry, replacing every secret value and credential pattern in its message and stack with a placeholder
+func Capture(event Event, secrets []string) error {
+	target, err := parseDsn(os.Getenv(EnvVarKeyDsn))
+	if err != nil {
+		return err
+	}
+	environment := os.Getenv(EnvVarKeyEnvironment)
+	if environment == "" {
+		environment = defaultEnvironment
+	}
+	eventId := randomHex(16)
+	payload := map[string]interface{}{
+		"event_id":    eventId,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"platform":    "go",
+		"level":       event.Level,
+		"logger":      clientName,
+		"release":     fmt.Sprintf("%s@%s", clientName, version.Version),
+		"environment": environment,
+		"fingerprint": []string{event.Category},
+		"tags":        event.Tags,
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{{
+				"type":  event.Category,
+				"value": logger.Scrub(event.Message, secrets),
+			}},
+		},
+		"contexts": map[string]interface{}{
+			"os":      map[string]string{"name": runtime.GOOS},
+			"runtime": map[string]string{"name": "go", "version": runtime.Version()},
+		},
+	}
+	if event.Stack != "" {
+		payload["extra"] = map[string]string{"stack": logger.Scrub(event.Stack, secrets)}
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failure marshalling sentry event: %w", err)
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "{\"event_id\":\"%s\",\"sent_at\":\"%s\"}\n{\"type\":\"event\",\"length\":%d}\n", eventId, time.Now().UTC().Format(time.RFC3339), len(encoded))
+	body.Write(encoded)
+	body.WriteString("\n")
+	request, err := http.NewRequest(http.MethodPost, target.endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failure creating sentry request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-sentry-envelope")
+	request.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s/%s, sentry_key=%s", clientName, version.Version, target.publicKey))
+	client := &http.Client{Timeout: sendTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failure sending event to sentry: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		details, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("failure sending event to sentry: unexpected status code %d: %s", response.StatusCode, strings.TrimSpace(string(details)))
+	}
+	return nil
+}
+
+func randomHex(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
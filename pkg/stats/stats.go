@@ -0,0 +1,219 @@
+package stats
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"io"
+	_ "modernc.org/sqlite"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type Run struct {
+	Version            string    `json:"version,omitempty"`
+	StartedAt          time.Time `json:"started_at"`
+	FinishedAt         time.Time `json:"finished_at"`
+	DurationSeconds    float64   `json:"duration_seconds"`
+	ItemsAdded         int       `json:"items_added"`
+	ItemsRemoved       int       `json:"items_removed"`
+	ItemsNotFound      int       `json:"items_not_found"`
+	OperationsDeferred int       `json:"operations_deferred"`
+	FailedLists        []string  `json:"failed_lists,omitempty"`
+	Error              string    `json:"error,omitempty"`
+}
+
+func NewRun(summary entities.SyncSummary, err error) Run {
+	run := Run{
+		Version:            summary.Version,
+		StartedAt:          summary.StartedAt,
+		FinishedAt:         summary.FinishedAt,
+		DurationSeconds:    summary.FinishedAt.Sub(summary.StartedAt).Seconds(),
+		ItemsAdded:         summary.ItemsAdded(),
+		ItemsRemoved:       summary.ItemsRemoved(),
+		ItemsNotFound:      summary.ItemsNotFound,
+		OperationsDeferred: summary.OperationsDeferred,
+		FailedLists:        summary.FailedLists,
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	return run
+}
+
+// Store persists the statistics of every run in a local sqlite database
+type Store struct {
+	path string
+}
+
+func NewStore(path string) *Store {
+	return &Store{
+		path: path,
+	}
+}
+
+const (
+	createRunsTable = `CREATE TABLE IF NOT EXISTS runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version TEXT NOT NULL DEFAULT '',
+		started_at TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		duration_seconds REAL NOT NULL,
+		items_added INTEGER NOT NULL,
+		items_removed INTEGER NOT NULL,
+		items_not_found INTEGER NOT NULL,
+		operations_deferred INTEGER NOT NULL,
+		failed_lists TEXT NOT NULL DEFAULT '[]',
+		error TEXT NOT NULL DEFAULT ''
+	)`
+	insertRun = `INSERT INTO runs (version, started_at, finished_at, duration_seconds, items_added, items_removed,
+		items_not_found, operations_deferred, failed_lists, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	selectRuns = `SELECT version, started_at, finished_at, duration_seconds, items_added, items_removed,
+		items_not_found, operations_deferred, failed_lists, error FROM runs ORDER BY id`
+)
+
+// open opens the database, creating its runs table when missing
+func (s *Store) open() (*sql.DB, error) {
+	db, err := sql.Open("sqlite", s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failure opening run stats database %s: %w", s.path, err)
+	}
+	if _, err = db.Exec(createRunsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failure creating run stats table in %s: %w", s.path, err)
+	}
+	return db, nil
+}
+
+func (s *Store) Append(run Run) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	failedLists, err := json.Marshal(run.FailedLists)
+	if err != nil {
+		return fmt.Errorf("failure marshalling failed lists: %w", err)
+	}
+	_, err = db.Exec(insertRun, run.Version, run.StartedAt.Format(time.RFC3339Nano), run.FinishedAt.Format(time.RFC3339Nano),
+		run.DurationSeconds, run.ItemsAdded, run.ItemsRemoved, run.ItemsNotFound, run.OperationsDeferred, string(failedLists), run.Error)
+	if err != nil {
+		return fmt.Errorf("failure writing run stats to %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Load returns the recorded runs, oldest first. A missing database means no runs were recorded yet.
+func (s *Store) Load() ([]Run, error) {
+	if _, err := os.Stat(s.path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query(selectRuns)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading run stats from %s: %w", s.path, err)
+	}
+	defer rows.Close()
+	var runs []Run
+	for rows.Next() {
+		var (
+			run                   Run
+			startedAt, finishedAt string
+			failedLists           string
+		)
+		err = rows.Scan(&run.Version, &startedAt, &finishedAt, &run.DurationSeconds, &run.ItemsAdded, &run.ItemsRemoved,
+			&run.ItemsNotFound, &run.OperationsDeferred, &failedLists, &run.Error)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading run stats from %s: %w", s.path, err)
+		}
+		if run.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt); err != nil {
+			return nil, fmt.Errorf("failure parsing run start time %s: %w", startedAt, err)
+		}
+		if run.FinishedAt, err = time.Parse(time.RFC3339Nano, finishedAt); err != nil {
+			return nil, fmt.Errorf("failure parsing run finish time %s: %w", finishedAt, err)
+		}
+		if err = json.Unmarshal([]byte(failedLists), &run.FailedLists); err != nil {
+			return nil, fmt.Errorf("failure unmarshalling failed lists: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failure reading run stats from %s: %w", s.path, err)
+	}
+	return runs, nil
+}
+
+type WeeklyTrend struct {
+	Year                   int     `json:"year"`
+	Week                   int     `json:"week"`
+	Runs                   int     `json:"runs"`
+	FailedRuns             int     `json:"failed_runs"`
+	ItemsAdded             int     `json:"items_added"`
+	ItemsRemoved           int     `json:"items_removed"`
+	AverageDurationSeconds float64 `json:"average_duration_seconds"`
+}
+
+func WeeklyTrends(runs []Run) []WeeklyTrend {
+	trendsByWeek := make(map[[2]int]*WeeklyTrend)
+	for _, run := range runs {
+		year, week := run.StartedAt.Local().ISOWeek()
+		key := [2]int{year, week}
+		trend, found := trendsByWeek[key]
+		if !found {
+			trend = &WeeklyTrend{
+				Year: year,
+				Week: week,
+			}
+			trendsByWeek[key] = trend
+		}
+		trend.AverageDurationSeconds = (trend.AverageDurationSeconds*float64(trend.Runs) + run.DurationSeconds) / float64(trend.Runs+1)
+		trend.Runs++
+		trend.ItemsAdded += run.ItemsAdded
+		trend.ItemsRemoved += run.ItemsRemoved
+		if run.Error != "" {
+			trend.FailedRuns++
+		}
+	}
+	trends := make([]WeeklyTrend, 0, len(trendsByWeek))
+	for _, trend := range trendsByWeek {
+		trends = append(trends, *trend)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Year != trends[j].Year {
+			return trends[i].Year < trends[j].Year
+		}
+		return trends[i].Week < trends[j].Week
+	})
+	return trends
+}
+
+func PrintTrends(writer io.Writer, runs []Run) error {
+	if len(runs) == 0 {
+		_, err := fmt.Fprintln(writer, "no runs recorded yet")
+		return err
+	}
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "WEEK\tRUNS\tFAILED\tADDED\tREMOVED\tAVG DURATION")
+	for _, trend := range WeeklyTrends(runs) {
+		averageDuration := time.Duration(trend.AverageDurationSeconds * float64(time.Second)).Round(time.Second)
+		fmt.Fprintf(table, "%d-W%02d\t%d\t%d\t%d\t%d\t%s\n", trend.Year, trend.Week, trend.Runs, trend.FailedRuns, trend.ItemsAdded, trend.ItemsRemoved, averageDuration)
+	}
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("failure printing run stats: %w", err)
+	}
+	last := runs[len(runs)-1]
+	status := "succeeded"
+	if last.Error != "" {
+		status = fmt.Sprintf("failed: %s", last.Error)
+	}
+	_, err := fmt.Fprintf(writer, "\nlast run on %s %s\n", last.StartedAt.Local().Format(time.RFC1123), status)
+	return err
+}
@@ -0,0 +1,231 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	stepAirtable = "airtable"
+
+	defaultAirtableTable = "Items"
+
+	airtableFieldTarget   = "target"
+	airtableFieldListId   = "list_id"
+	airtableFieldListName = "list_name"
+	airtableFieldPosition = "position"
+	airtableFieldImdbId   = "imdb_id"
+	airtableFieldType     = "type"
+	airtableFieldRating   = "rating"
+	airtableFieldRatedAt  = "rated_at"
+)
+
+// airtableFieldNames lists the fields of a record along with the airtable field they are written to by default
+var airtableFieldNames = [][2]string{
+	{airtableFieldTarget, "Target"},
+	{airtableFieldListId, "List ID"},
+	{airtableFieldListName, "List"},
+	{airtableFieldPosition, "Position"},
+	{airtableFieldImdbId, "IMDb ID"},
+	{airtableFieldType, "Type"},
+	{airtableFieldRating, "Rating"},
+	{airtableFieldRatedAt, "Rated"},
+}
+
+// airtableEnabled reports whether the watchlist, lists and ratings are written to an airtable base, which takes a token and the base id
+func airtableEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeyAirtableToken] != "" && strings.TrimSpace(os.Getenv(EnvVarKeyAirtableBaseId)) != ""
+}
+
+func airtableTable() string {
+	if table := strings.TrimSpace(os.Getenv(EnvVarKeyAirtableTable)); table != "" {
+		return table
+	}
+	return defaultAirtableTable
+}
+
+// airtableFields parses AIRTABLE_FIELDS, which maps the fields of a record to the fields of the table as comma separated
+// field=name pairs, overriding the default names. A field mapped to an empty name is left out, except for the target, list id
+// and imdb id, which tell the records apart. It returns the names keyed by field.
+func airtableFields() (map[string]string, error) {
+	fields := make(map[string]string, len(airtableFieldNames))
+	names := make([]string, 0, len(airtableFieldNames))
+	for _, field := range airtableFieldNames {
+		fields[field[0]] = field[1]
+		names = append(names, field[0])
+	}
+	value := strings.TrimSpace(os.Getenv(EnvVarKeyAirtableFields))
+	if value == "" {
+		return fields, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		field, name, found := strings.Cut(pair, "=")
+		field, name = strings.ToLower(strings.TrimSpace(field)), strings.TrimSpace(name)
+		if !found || !stringSliceContains(names, field) {
+			return nil, fmt.Errorf("failure parsing environment variable %s: %q is not a field=name pair, where the field is one of %s", EnvVarKeyAirtableFields, strings.TrimSpace(pair), strings.Join(names, ", "))
+		}
+		if name == "" {
+			delete(fields, field)
+			continue
+		}
+		fields[field] = name
+	}
+	for _, field := range []string{airtableFieldTarget, airtableFieldListId, airtableFieldImdbId} {
+		if fields[field] == "" {
+			return nil, fmt.Errorf("failure parsing environment variable %s: the %s field tells the records apart and cannot be left out", EnvVarKeyAirtableFields, field)
+		}
+	}
+	return fields, nil
+}
+
+func newAirtableClient(secrets map[string]string, logger *zap.Logger) (client.AirtableClientInterface, error) {
+	return client.NewAirtableClient(
+		client.AirtableConfig{
+			Token:    secrets[EnvVarKeyAirtableToken],
+			BaseId:   strings.TrimSpace(os.Getenv(EnvVarKeyAirtableBaseId)),
+			Table:    airtableTable(),
+			SyncMode: os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: map[string]string{
+				entities.SyncTargetList:      os.Getenv(EnvVarKeySyncModeLists),
+				entities.SyncTargetRatings:   os.Getenv(EnvVarKeySyncModeRatings),
+				entities.SyncTargetWatchlist: os.Getenv(EnvVarKeySyncModeWatchlist),
+			},
+		},
+		logger,
+	)
+}
+
+// pushAirtable keeps a record per item of the watchlist, lists and ratings in the airtable table while trakt is synced, the same
+// items as the file target. Records are told apart by their target, list id and imdb id, and those added by hand without an imdb id
+// are left alone. It returns the name of the target when it failed.
+func (s *Syncer) pushAirtable() []string {
+	if s.airtableClient == nil {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepAirtable, start)
+	if err := s.pushAirtableRecords(); err != nil {
+		s.logger.Error("failure pushing to airtable", zap.Error(err))
+		return []string{stepAirtable}
+	}
+	return nil
+}
+
+func (s *Syncer) pushAirtableRecords() error {
+	fields, err := airtableFields()
+	if err != nil {
+		return err
+	}
+	current, err := s.airtableClient.RecordsGet()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]entities.AirtableRecord, len(current))
+	var toDelete []entities.AirtableRecord
+	for _, record := range current {
+		if airtableValue(record.Fields[fields[airtableFieldImdbId]]) == "" {
+			continue
+		}
+		key := airtableRecordKey(record.Fields, fields)
+		if _, found := existing[key]; found {
+			toDelete = append(toDelete, record)
+			continue
+		}
+		existing[key] = record
+	}
+	toCreate := make(map[string][]entities.AirtableRecord)
+	toUpdate := make(map[string][]entities.AirtableRecord)
+	desired := make(map[string]bool)
+	for _, record := range s.fileTargetRecords() {
+		values := airtableRecordFields(record, fields)
+		key := airtableRecordKey(values, fields)
+		desired[key] = true
+		existingRecord, found := existing[key]
+		if !found {
+			toCreate[record.Target] = append(toCreate[record.Target], entities.AirtableRecord{Fields: values})
+			continue
+		}
+		for name, value := range values {
+			if airtableValue(existingRecord.Fields[name]) != airtableValue(value) {
+				toUpdate[record.Target] = append(toUpdate[record.Target], entities.AirtableRecord{Id: existingRecord.Id, Fields: values})
+				break
+			}
+		}
+	}
+	synced := map[string]bool{
+		entities.SyncTargetList:      s.syncLists,
+		entities.SyncTargetRatings:   s.syncRatings,
+		entities.SyncTargetWatchlist: s.syncWatchlist,
+	}
+	removed := make(map[string][]entities.AirtableRecord)
+	for key, record := range existing {
+		// the records of the targets that are not synced are left alone
+		target := airtableValue(record.Fields[fields[airtableFieldTarget]])
+		if !desired[key] && synced[target] {
+			removed[target] = append(removed[target], record)
+		}
+	}
+	for _, record := range toDelete {
+		target := airtableValue(record.Fields[fields[airtableFieldTarget]])
+		removed[target] = append(removed[target], record)
+	}
+	for _, target := range []string{entities.SyncTargetWatchlist, entities.SyncTargetList, entities.SyncTargetRatings} {
+		if err = s.airtableClient.RecordsCreate(target, toCreate[target]); err != nil {
+			return err
+		}
+		if err = s.airtableClient.RecordsUpdate(target, toUpdate[target]); err != nil {
+			return err
+		}
+		if err = s.airtableClient.RecordsDelete(target, removed[target]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// airtableRecordFields returns the values of the mapped fields of the record, leaving out the empty ones
+func airtableRecordFields(record fileTargetRecord, fields map[string]string) map[string]interface{} {
+	values := make(map[string]interface{})
+	set := func(field string, value interface{}) {
+		if name := fields[field]; name != "" && airtableValue(value) != "" {
+			values[name] = value
+		}
+	}
+	set(airtableFieldTarget, record.Target)
+	set(airtableFieldListId, record.ListId)
+	set(airtableFieldListName, record.ListName)
+	set(airtableFieldImdbId, record.ImdbId)
+	set(airtableFieldType, record.Type)
+	if record.Position > 0 {
+		set(airtableFieldPosition, record.Position)
+	}
+	if record.Rating != nil {
+		set(airtableFieldRating, *record.Rating)
+	}
+	if record.RatedAt != nil {
+		// the date is written on its own, as a date field returns it without the time
+		set(airtableFieldRatedAt, strings.SplitN(*record.RatedAt, "T", 2)[0])
+	}
+	return values
+}
+
+func airtableRecordKey(values map[string]interface{}, fields map[string]string) string {
+	return strings.Join([]string{
+		airtableValue(values[fields[airtableFieldTarget]]),
+		airtableValue(values[fields[airtableFieldListId]]),
+		airtableValue(values[fields[airtableFieldImdbId]]),
+	}, "/")
+}
+
+// airtableValue returns the value as text, so numbers read back as floats compare equal to the integers written
+func airtableValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
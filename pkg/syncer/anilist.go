@@ -0,0 +1,262 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	aniListWatchlistId = "anilist-watchlist"
+
+	stepAniList = "anilist"
+)
+
+// aniListEnabled reports whether the watchlist and ratings of anime are pushed to anilist, which takes the access token of a user
+func aniListEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeyAniListToken] != ""
+}
+
+func newAniListClient(secrets map[string]string, logger *zap.Logger) (client.AniListClientInterface, error) {
+	return client.NewAniListClient(
+		client.AniListConfig{
+			AccessToken: secrets[EnvVarKeyAniListToken],
+			SyncMode:    os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: map[string]string{
+				entities.SyncTargetRatings:   os.Getenv(EnvVarKeySyncModeRatings),
+				entities.SyncTargetWatchlist: os.Getenv(EnvVarKeySyncModeWatchlist),
+			},
+		},
+		logger,
+	)
+}
+
+// aniListSource feeds the targets from the anime list of an anilist user in place of imdb: the planned anime make up the watchlist
+// and the scored ones the ratings. Its entries are converted to imdb items through the anime mapping database, so the rest of the
+// sync is unaware of the source. Anilist has no lists of its own.
+type aniListSource struct {
+	client      client.AniListClientInterface
+	mapping     *animeMapping
+	logger      *zap.Logger
+	invalidRows []entities.ItemFailure
+}
+
+func newAniListSource(aniListClient client.AniListClientInterface, mapping *animeMapping, logger *zap.Logger) *aniListSource {
+	return &aniListSource{
+		client:  aniListClient,
+		mapping: mapping,
+		logger:  logger,
+	}
+}
+
+func (as *aniListSource) ListGet(listId string) (*entities.ImdbList, error) {
+	return nil, fmt.Errorf("failure fetching list %s: anilist has no lists", listId)
+}
+
+func (as *aniListSource) ListsGet(listIds []string) ([]entities.ImdbList, error) {
+	if len(listIds) == 0 {
+		return nil, nil
+	}
+	failed := make(map[string]error, len(listIds))
+	for _, listId := range listIds {
+		_, failed[listId] = as.ListGet(listId)
+	}
+	return nil, &client.ListsFetchError{
+		Failed: failed,
+	}
+}
+
+func (as *aniListSource) ListsGetAll() ([]entities.ImdbList, error) {
+	return nil, nil
+}
+
+func (as *aniListSource) WatchlistGet() (*entities.ImdbList, error) {
+	entries, err := as.client.EntriesGet()
+	if err != nil {
+		return nil, err
+	}
+	var planned []entities.AniListEntry
+	for _, entry := range entries {
+		if entry.Status == entities.AniListStatusPlanning {
+			planned = append(planned, entry)
+		}
+	}
+	items := as.imdbItems(planned, entities.SyncTargetWatchlist)
+	// the watchlist is not rated, as the scores of its anime are synced as ratings
+	for i := range items {
+		items[i].Rating = nil
+		items[i].RatingDate = nil
+	}
+	return &entities.ImdbList{
+		ListId:      aniListWatchlistId,
+		ListName:    "watchlist",
+		ListItems:   items,
+		IsWatchlist: true,
+	}, nil
+}
+
+func (as *aniListSource) RatingsGet() ([]entities.ImdbItem, error) {
+	entries, err := as.client.EntriesGet()
+	if err != nil {
+		return nil, err
+	}
+	var scored []entities.AniListEntry
+	for _, entry := range entries {
+		if entry.Score > 0 {
+			scored = append(scored, entry)
+		}
+	}
+	return as.imdbItems(scored, entities.SyncTargetRatings), nil
+}
+
+func (as *aniListSource) UserIdScrape() error {
+	return nil
+}
+
+func (as *aniListSource) WatchlistIdScrape() error {
+	return nil
+}
+
+// InvalidRows returns the entries left out since the source was created, as the anime mapping database does not know their imdb id
+func (as *aniListSource) InvalidRows() []entities.ItemFailure {
+	return append([]entities.ItemFailure(nil), as.invalidRows...)
+}
+
+// imdbItems converts anilist entries to imdb items through the anime mapping database, leaving out the anime it cannot match.
+// The seasons of a show share its imdb id, so only one item is kept per imdb id, the most recently updated one.
+func (as *aniListSource) imdbItems(entries []entities.AniListEntry, target string) []entities.ImdbItem {
+	byId := make(map[string]entities.ImdbItem, len(entries))
+	var ids []string
+	for _, entry := range entries {
+		mapped, found := as.mapping.byAniList[entry.MediaId]
+		if !found {
+			as.logger.Warn(fmt.Sprintf("skipping anilist anime %d, as the anime mapping database does not know its imdb id", entry.MediaId), zap.String("target", target))
+			as.invalidRows = append(as.invalidRows, entities.ItemFailure{
+				Target: target,
+				Reason: entities.ItemFailureReasonNotFound,
+				Error:  fmt.Sprintf("anilist anime %d has no imdb id", entry.MediaId),
+			})
+			continue
+		}
+		item := entry.ImdbItem(mapped)
+		existing, found := byId[item.Id]
+		if !found {
+			ids = append(ids, item.Id)
+		} else if !ratedAfter(item, existing) {
+			continue
+		}
+		byId[item.Id] = item
+	}
+	items := make([]entities.ImdbItem, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, byId[id])
+	}
+	return items
+}
+
+// pushAniList pushes the watchlist and ratings of the anime of the source to anilist while trakt is synced: the watchlist is added
+// as planned and the ratings are scored, adding the anime not listed yet as completed. Only the anime of the anime mapping database
+// imdb ids are mapped to are removed or unscored. It returns the name of the target when it failed.
+func (s *Syncer) pushAniList() []string {
+	if s.aniListClient == nil || (!s.syncWatchlist && !s.syncRatings) {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepAniList, start)
+	if err := s.pushAniListEntries(); err != nil {
+		s.logger.Error("failure pushing to anilist", zap.Error(err))
+		return []string{stepAniList}
+	}
+	return nil
+}
+
+func (s *Syncer) pushAniListEntries() error {
+	current, err := s.aniListClient.EntriesGet()
+	if err != nil {
+		return err
+	}
+	listed := make(map[int]entities.AniListEntry, len(current))
+	for _, entry := range current {
+		listed[entry.MediaId] = entry
+	}
+	if s.syncWatchlist {
+		planned := make(map[int]bool)
+		var toPlan, toDelete []entities.AniListEntry
+		for _, imdbList := range s.user.imdbLists {
+			if !imdbList.IsWatchlist {
+				continue
+			}
+			for _, item := range imdbList.ListItems {
+				mapped, found := s.animeMapping.byImdb[item.Id]
+				if !found || mapped.AniList == 0 || planned[mapped.AniList] {
+					continue
+				}
+				planned[mapped.AniList] = true
+				if listed[mapped.AniList].Status == "" {
+					toPlan = append(toPlan, entities.AniListEntry{
+						MediaId: mapped.AniList,
+						Status:  entities.AniListStatusPlanning,
+					})
+				}
+			}
+		}
+		for _, entry := range current {
+			if entry.Status == entities.AniListStatusPlanning && !planned[entry.MediaId] && s.animeMapping.mappedAniList[entry.MediaId] {
+				toDelete = append(toDelete, entry)
+			}
+		}
+		sortAniListEntries(toPlan)
+		sortAniListEntries(toDelete)
+		if err = s.aniListClient.EntriesSave(entities.SyncTargetWatchlist, toPlan); err != nil {
+			return fmt.Errorf("failure adding anilist watchlist entries: %w", err)
+		}
+		if err = s.aniListClient.EntriesDelete(entities.SyncTargetWatchlist, toDelete); err != nil {
+			return fmt.Errorf("failure removing anilist watchlist entries: %w", err)
+		}
+	}
+	if s.syncRatings {
+		desired := make(map[int]int)
+		for _, item := range s.user.imdbRatings {
+			if mapped, found := s.animeMapping.byImdb[item.Id]; found && mapped.AniList > 0 && item.Rating != nil {
+				desired[mapped.AniList] = *item.Rating
+			}
+		}
+		var toScore, toUnscore []entities.AniListEntry
+		for id, score := range desired {
+			if entry := listed[id]; entry.Score != score {
+				scored := entities.AniListEntry{
+					MediaId: id,
+					Score:   score,
+				}
+				if entry.Status == "" {
+					scored.Status = entities.AniListStatusCompleted
+				}
+				toScore = append(toScore, scored)
+			}
+		}
+		for _, entry := range current {
+			if _, found := desired[entry.MediaId]; entry.Score > 0 && !found && s.animeMapping.mappedAniList[entry.MediaId] {
+				toUnscore = append(toUnscore, entry)
+			}
+		}
+		sortAniListEntries(toScore)
+		sortAniListEntries(toUnscore)
+		if err = s.aniListClient.EntriesSave(entities.SyncTargetRatings, toScore); err != nil {
+			return fmt.Errorf("failure scoring anilist entries: %w", err)
+		}
+		if err = s.aniListClient.EntriesUnscore(toUnscore); err != nil {
+			return fmt.Errorf("failure removing anilist scores: %w", err)
+		}
+	}
+	return nil
+}
+
+func sortAniListEntries(entries []entities.AniListEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].MediaId < entries[j].MediaId
+	})
+}
@@ -0,0 +1,393 @@
+package syncer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAnimeMappingUrl  = "https://raw.githubusercontent.com/Fribb/anime-lists/master/anime-list-full.json"
+	defaultAnimeMappingPath = "anime-mapping.json"
+	defaultAnimeIdsPath     = "anime-ids.json"
+	animeMappingMaxAge      = 7 * 24 * time.Hour
+
+	stepAnime = "anime"
+	stepMal   = "mal"
+)
+
+func AnimeMappingPath() string {
+	return StatePath(defaultAnimeMappingPath)
+}
+
+func AnimeIdsPath() string {
+	return StatePath(defaultAnimeIdsPath)
+}
+
+// animeMappingEnabled reports whether the anime of the source are matched to trakt through the anime mapping database,
+// which pushing to myanimelist or anilist, and reading from anilist, need as well
+func animeMappingEnabled(secrets map[string]string) bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(EnvVarKeyAnimeMapping))
+	return enabled || malEnabled(secrets) || aniListEnabled(secrets) || SyncSource() == syncSourceAniList
+}
+
+// malEnabled reports whether the ratings of anime are pushed to myanimelist, which takes the access token of a user
+func malEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeyMalAccessToken] != ""
+}
+
+func newMalClient(secrets map[string]string, logger *zap.Logger) (client.MalClientInterface, error) {
+	return client.NewMalClient(
+		client.MalConfig{
+			AccessToken: secrets[EnvVarKeyMalAccessToken],
+			SyncMode:    os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: map[string]string{
+				entities.SyncTargetRatings: os.Getenv(EnvVarKeySyncModeRatings),
+			},
+		},
+		logger,
+	)
+}
+
+// animeMapping indexes the anime mapping database by imdb id. Shows split into an entry per season share the imdb id of the show,
+// which is mapped to the entry with the lowest myanimelist id, usually the first season.
+type animeMapping struct {
+	byImdb        map[string]entities.AnimeIds
+	byAniList     map[int]entities.AnimeIds
+	mappedMal     map[int]bool // the myanimelist ids imdb ids are mapped to, which are the only ones scored
+	mappedAniList map[int]bool // the anilist ids imdb ids are mapped to, which are the only ones updated
+}
+
+// animeMappingEntry is an entry of the anime mapping database, whose ids are sometimes written as strings
+type animeMappingEntry struct {
+	Imdb    string     `json:"imdb_id"`
+	Mal     flexibleId `json:"mal_id"`
+	AniDb   flexibleId `json:"anidb_id"`
+	AniList flexibleId `json:"anilist_id"`
+	Tmdb    flexibleId `json:"themoviedb_id"`
+	Tvdb    flexibleId `json:"thetvdb_id"`
+	Type    string     `json:"type"`
+}
+
+// flexibleId is a numeric id written either as a number or a string, which is 0 when it is unknown
+type flexibleId int
+
+func (id *flexibleId) UnmarshalJSON(data []byte) error {
+	value, err := strconv.Atoi(strings.Trim(string(data), `"`))
+	if err != nil {
+		value = 0
+	}
+	*id = flexibleId(value)
+	return nil
+}
+
+// loadAnimeMapping reads the anime mapping database from ANIME_MAPPING_URL, which is either a url or the path of a local copy.
+// A downloaded database is cached in the state directory for a week, and the cache is used when a newer one cannot be downloaded.
+func loadAnimeMapping(logger *zap.Logger) (*animeMapping, error) {
+	source := strings.TrimSpace(os.Getenv(EnvVarKeyAnimeMappingUrl))
+	if source == "" {
+		source = defaultAnimeMappingUrl
+	}
+	path := source
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		path = AnimeMappingPath()
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) > animeMappingMaxAge {
+			if downloadErr := downloadAnimeMapping(source, path); downloadErr != nil {
+				if err != nil {
+					return nil, downloadErr
+				}
+				logger.Warn("failure downloading the anime mapping database, using the cached one", zap.Error(downloadErr))
+			}
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the anime mapping database %s: %w", path, err)
+	}
+	defer file.Close()
+	var entries []animeMappingEntry
+	if err = json.NewDecoder(file).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling the anime mapping database %s: %w", path, err)
+	}
+	mapping := &animeMapping{
+		byImdb:        make(map[string]entities.AnimeIds),
+		byAniList:     make(map[int]entities.AnimeIds),
+		mappedMal:     make(map[int]bool),
+		mappedAniList: make(map[int]bool),
+	}
+	for _, entry := range entries {
+		for _, imdbId := range strings.Split(entry.Imdb, ",") {
+			imdbId = strings.TrimSpace(imdbId)
+			if !strings.HasPrefix(imdbId, "tt") {
+				continue
+			}
+			ids := entities.AnimeIds{
+				Imdb:    imdbId,
+				Mal:     int(entry.Mal),
+				AniDb:   int(entry.AniDb),
+				AniList: int(entry.AniList),
+				Tmdb:    int(entry.Tmdb),
+				Tvdb:    int(entry.Tvdb),
+				Type:    entry.Type,
+			}
+			// an anilist entry is read as the first imdb id it lists
+			if _, found := mapping.byAniList[ids.AniList]; ids.AniList > 0 && !found {
+				mapping.byAniList[ids.AniList] = ids
+			}
+			if existing, found := mapping.byImdb[imdbId]; found && (existing.Mal > 0 && (entry.Mal == 0 || existing.Mal < int(entry.Mal))) {
+				continue
+			}
+			mapping.byImdb[imdbId] = ids
+		}
+	}
+	for _, ids := range mapping.byImdb {
+		if ids.Mal > 0 {
+			mapping.mappedMal[ids.Mal] = true
+		}
+		if ids.AniList > 0 {
+			mapping.mappedAniList[ids.AniList] = true
+		}
+	}
+	return mapping, nil
+}
+
+func downloadAnimeMapping(url, path string) error {
+	response, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("failure downloading the anime mapping database: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failure downloading the anime mapping database: unexpected status code %d", response.StatusCode)
+	}
+	return writeFileAtomically(path, func(writer *bufio.Writer) error {
+		_, err := io.Copy(writer, response.Body)
+		return err
+	})
+}
+
+// animeIds caches the imdb id trakt knows every anime of the source by, as trakt has to be searched for each of them.
+// Anime trakt knows by the same imdb id, or does not know, are cached with an empty id, so they are not searched again.
+type animeIds struct {
+	path  string
+	Items map[string]string `json:"items"`
+}
+
+func loadAnimeIds(path string) (*animeIds, error) {
+	ids := &animeIds{
+		path:  path,
+		Items: make(map[string]string),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failure reading anime ids from %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, ids); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling anime ids: %w", err)
+	}
+	if ids.Items == nil {
+		ids.Items = make(map[string]string)
+	}
+	return ids, nil
+}
+
+func (i *animeIds) save() error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("failure marshalling anime ids: %w", err)
+	}
+	if err = os.WriteFile(i.path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing anime ids to %s: %w", i.path, err)
+	}
+	return nil
+}
+
+// resolveAnimeIds replaces the imdb ids of the anime of the source with the ones trakt knows them by, looking trakt up by the tvdb
+// or tmdb id of the anime mapping database. IMDb often lists the seasons of an anime as titles of their own, which trakt only knows
+// as the show, so their items are merged into that of the show.
+func (s *Syncer) resolveAnimeIds() error {
+	if s.animeMapping == nil {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseHydrate, stepAnime, start)
+	ids, err := loadAnimeIds(AnimeIdsPath())
+	if err != nil {
+		s.logger.Warn("failure loading anime ids, searching trakt for every anime", zap.Error(err))
+		ids = &animeIds{
+			path:  AnimeIdsPath(),
+			Items: make(map[string]string),
+		}
+	}
+	defer func() {
+		if err := ids.save(); err != nil {
+			s.logger.Warn("failure saving anime ids", zap.Error(err))
+		}
+	}()
+	items := make(map[string]entities.ImdbItem)
+	for _, imdbList := range s.user.imdbLists {
+		for _, item := range imdbList.ListItems {
+			items[item.Id] = item
+		}
+	}
+	for id, item := range s.user.imdbRatings {
+		items[id] = item
+	}
+	remapped := make(map[string]string)
+	for id, item := range items {
+		mapped, found := s.animeMapping.byImdb[id]
+		if !found || item.TraktItemType() == entities.TraktItemTypeEpisode {
+			continue
+		}
+		traktId, cached := ids.Items[id]
+		if !cached {
+			if traktId, err = s.searchAnime(item, mapped); err != nil {
+				return fmt.Errorf("failure searching trakt for anime %s: %w", id, err)
+			}
+			ids.Items[id] = traktId
+		}
+		if traktId != "" && traktId != id {
+			remapped[id] = traktId
+			if _, found = s.animeMapping.byImdb[traktId]; !found {
+				s.animeMapping.byImdb[traktId] = mapped
+			}
+		}
+	}
+	if len(remapped) == 0 {
+		return nil
+	}
+	for listId, imdbList := range s.user.imdbLists {
+		seen := make(map[string]bool, len(imdbList.ListItems))
+		listItems := make([]entities.ImdbItem, 0, len(imdbList.ListItems))
+		for _, item := range imdbList.ListItems {
+			if traktId, found := remapped[item.Id]; found {
+				item.Id = traktId
+			}
+			if !seen[item.Id] {
+				seen[item.Id] = true
+				listItems = append(listItems, item)
+			}
+		}
+		imdbList.ListItems = listItems
+		s.user.imdbLists[listId] = imdbList
+	}
+	ratingIds := make([]string, 0, len(s.user.imdbRatings))
+	for id := range s.user.imdbRatings {
+		ratingIds = append(ratingIds, id)
+	}
+	sort.Strings(ratingIds)
+	for _, id := range ratingIds {
+		traktId, found := remapped[id]
+		if !found {
+			continue
+		}
+		item := s.user.imdbRatings[id]
+		delete(s.user.imdbRatings, id)
+		item.Id = traktId
+		// the most recent rating of the seasons of a show wins
+		if existing, found := s.user.imdbRatings[traktId]; found && ratedAfter(existing, item) {
+			continue
+		}
+		s.user.imdbRatings[traktId] = item
+	}
+	s.logger.Info(fmt.Sprintf("matched %d anime title(s) to the imdb ids trakt knows them by", len(remapped)))
+	return nil
+}
+
+// searchAnime returns the imdb id trakt knows the anime by, searching shows by their tvdb id and movies by their tmdb id
+func (s *Syncer) searchAnime(item entities.ImdbItem, mapped entities.AnimeIds) (string, error) {
+	itemType := item.TraktItemType()
+	if mapped.Type == entities.AnimeTypeMovie {
+		itemType = entities.TraktItemTypeMovie
+	}
+	var (
+		traktIds *entities.TraktIds
+		err      error
+	)
+	switch {
+	case itemType == entities.TraktItemTypeShow && mapped.Tvdb > 0:
+		traktIds, err = s.traktClient.SearchTvdbId(itemType, mapped.Tvdb)
+	case mapped.Tmdb > 0:
+		traktIds, err = s.traktClient.SearchTmdbId(itemType, mapped.Tmdb)
+	}
+	if err != nil || traktIds == nil {
+		return "", err
+	}
+	return traktIds.Imdb, nil
+}
+
+func ratedAfter(item, other entities.ImdbItem) bool {
+	if item.RatingDate == nil || other.RatingDate == nil {
+		return item.RatingDate != nil
+	}
+	return item.RatingDate.After(*other.RatingDate)
+}
+
+// pushMal pushes the ratings of the anime of the source to myanimelist while trakt is synced, scoring the anime of the
+// anime mapping database and adding those not listed yet as completed. It returns the name of the target when it failed.
+func (s *Syncer) pushMal() []string {
+	if s.malClient == nil || !s.syncRatings {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepMal, start)
+	if err := s.pushMalScores(); err != nil {
+		s.logger.Error("failure pushing to myanimelist", zap.Error(err))
+		return []string{stepMal}
+	}
+	return nil
+}
+
+func (s *Syncer) pushMalScores() error {
+	current, err := s.malClient.ScoresGet()
+	if err != nil {
+		return err
+	}
+	desired := make(map[int]int)
+	for _, item := range s.user.imdbRatings {
+		if mapped, found := s.animeMapping.byImdb[item.Id]; found && mapped.Mal > 0 && item.Rating != nil {
+			desired[mapped.Mal] = *item.Rating
+		}
+	}
+	var toScore, toUnscore []entities.MalScore
+	for id, score := range desired {
+		if listed := current[id]; listed.Score != score {
+			toScore = append(toScore, entities.MalScore{
+				Id:     id,
+				Score:  score,
+				Status: listed.Status,
+			})
+		}
+	}
+	for id, listed := range current {
+		// only the anime an imdb id is mapped to are unscored, as the others are never part of the source
+		if _, found := desired[id]; listed.Score > 0 && !found && s.animeMapping.mappedMal[id] {
+			toUnscore = append(toUnscore, listed)
+		}
+	}
+	sort.Slice(toScore, func(i, j int) bool {
+		return toScore[i].Id < toScore[j].Id
+	})
+	sort.Slice(toUnscore, func(i, j int) bool {
+		return toUnscore[i].Id < toUnscore[j].Id
+	})
+	if err = s.malClient.ScoresSet(toScore); err != nil {
+		return err
+	}
+	return s.malClient.ScoresRemove(toUnscore)
+}
@@ -0,0 +1,121 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/stats"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultAnomalyThreshold = 10
+	defaultAnomalyMinItems  = 50
+
+	// anomalyMinRuns is the number of successful runs needed before a change set can be considered unusual
+	anomalyMinRuns = 3
+	// anomalyWindow limits the average to the most recent successful runs, so it follows the library as it grows
+	anomalyWindow = 20
+)
+
+// AnomalyError is returned when the planned changes are far larger than those of previous runs,
+// which usually means imdb returned incomplete data rather than the user emptying a list
+type AnomalyError struct {
+	action  string
+	planned int
+	average float64
+	runs    int
+}
+
+func (e *AnomalyError) Error() string {
+	return fmt.Sprintf("refusing to %s %d item(s), while the last %d run(s) averaged %.1f: review the changes and rerun with --force or --interactive to apply them",
+		e.action, e.planned, e.runs, e.average)
+}
+
+// checkAnomaly compares the items planned to be added and removed with the average of the previous successful runs,
+// stopping the run unless it is forced or the user confirms the changes
+func (s *Syncer) checkAnomaly(plan *entities.SyncPlan) error {
+	threshold, minItems := anomalyThreshold()
+	if threshold == 0 {
+		return nil
+	}
+	runs, err := s.runStats.Load()
+	if err != nil {
+		s.logger.Warn("failure loading run stats, skipping the check for unusually large changes", zap.Error(err))
+		return nil
+	}
+	added, removed, count := averageChanges(runs)
+	if count < anomalyMinRuns {
+		return nil
+	}
+	planned := entities.SyncSummary{
+		Operations: plan.Operations,
+	}
+	anomaly := unusualChange(entities.SyncActionRemove, planned.ItemsRemoved(), removed, threshold, minItems)
+	if anomaly == nil {
+		anomaly = unusualChange(entities.SyncActionAdd, planned.ItemsAdded(), added, threshold, minItems)
+	}
+	if anomaly == nil {
+		return nil
+	}
+	anomaly.runs = count
+	if s.force {
+		s.logger.Warn(fmt.Sprintf("planned to %s %d item(s), which is unusually large, applying them as the run was forced", anomaly.action, anomaly.planned))
+		return nil
+	}
+	if s.interactive {
+		message := fmt.Sprintf("planned to %s %d item(s), while the last %d run(s) averaged %.1f, apply them anyway?", anomaly.action, anomaly.planned, anomaly.runs, anomaly.average)
+		confirmed, err := promptConfirmation(message)
+		if err != nil || confirmed {
+			return err
+		}
+	}
+	return anomaly
+}
+
+func unusualChange(action string, planned int, average float64, threshold float64, minItems int) *AnomalyError {
+	baseline := average
+	if baseline < 1 {
+		baseline = 1
+	}
+	if planned < minItems || float64(planned) <= threshold*baseline {
+		return nil
+	}
+	return &AnomalyError{
+		action:  action,
+		planned: planned,
+		average: average,
+	}
+}
+
+// averageChanges returns the average items added and removed by the most recent successful runs, along with their count
+func averageChanges(runs []stats.Run) (float64, float64, int) {
+	var added, removed, count int
+	for i := len(runs) - 1; i >= 0 && count < anomalyWindow; i-- {
+		if runs[i].Error != "" {
+			continue
+		}
+		added += runs[i].ItemsAdded
+		removed += runs[i].ItemsRemoved
+		count++
+	}
+	if count == 0 {
+		return 0, 0, 0
+	}
+	return float64(added) / float64(count), float64(removed) / float64(count), count
+}
+
+// anomalyThreshold returns the multiple of the average changes considered unusual, with 0 disabling the check,
+// and the number of items a change set needs before it can be considered unusual
+func anomalyThreshold() (float64, int) {
+	threshold := float64(defaultAnomalyThreshold)
+	if value := os.Getenv(EnvVarKeyAnomalyThreshold); value != "" {
+		threshold, _ = strconv.ParseFloat(value, 64)
+	}
+	minItems := defaultAnomalyMinItems
+	if value := os.Getenv(EnvVarKeyAnomalyMinItems); value != "" {
+		minItems, _ = strconv.Atoi(value)
+	}
+	return threshold, minItems
+}
@@ -0,0 +1,116 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditLogPath = "audit-log.jsonl"
+
+	auditOutcomeApplied  = "applied"
+	auditOutcomeDeferred = "deferred"
+	auditOutcomeFailed   = "failed"
+	auditOutcomeNotFound = "not_found"
+	auditOutcomeSkipped  = "skipped"
+)
+
+func AuditLogPath() string {
+	if path := os.Getenv(EnvVarKeyAuditLogPath); path != "" {
+		return path
+	}
+	return StatePath(defaultAuditLogPath)
+}
+
+// auditEntry records a single change applied to trakt, which is never rewritten once appended
+type auditEntry struct {
+	Time         time.Time `json:"time"`
+	RunStartedAt time.Time `json:"run_started_at"`
+	Profile      string    `json:"profile,omitempty"`
+	Action       string    `json:"action"`
+	Target       string    `json:"target"`
+	List         string    `json:"list,omitempty"`
+	ImdbId       string    `json:"imdb_id,omitempty"`
+	Type         string    `json:"type,omitempty"`
+	Mode         string    `json:"mode,omitempty"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// auditLog appends every item added to or removed from trakt as json lines to a local file,
+// so the history of a title can be traced long after the run that changed it
+type auditLog struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func newAuditLog(path string) *auditLog {
+	return &auditLog{
+		path: path,
+	}
+}
+
+// record appends an entry for every item of the operation, or a single entry for operations without items,
+// such as creating a list. The items trakt could not find are recorded with their own outcome. The mode is the sync mode
+// the client applied to the operation.
+func (a *auditLog) record(runStartedAt time.Time, operation entities.SyncOperation, mode, outcome string, notFound []string, err error) error {
+	entry := auditEntry{
+		Time:         time.Now(),
+		RunStartedAt: runStartedAt,
+		Profile:      os.Getenv(EnvVarKeyProfile),
+		Action:       operation.Action,
+		Target:       operation.Target,
+		List:         operation.ListSlug,
+		Mode:         mode,
+		Outcome:      outcome,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if operation.Action == entities.SyncActionReorder || len(operation.Items) == 0 {
+		return a.append([]auditEntry{entry})
+	}
+	missing := make(map[string]bool, len(notFound))
+	for _, id := range notFound {
+		missing[id] = true
+	}
+	entries := make([]auditEntry, 0, len(operation.Items))
+	for _, item := range operation.Items {
+		itemEntry := entry
+		itemEntry.Type = item.Type
+		if id, idErr := item.GetItemId(); idErr == nil && id != nil {
+			itemEntry.ImdbId = *id
+		}
+		if missing[itemEntry.ImdbId] {
+			itemEntry.Outcome = auditOutcomeNotFound
+		}
+		entries = append(entries, itemEntry)
+	}
+	return a.append(entries)
+}
+
+func (a *auditLog) append(entries []auditEntry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failure opening audit log %s: %w", a.path, err)
+	}
+	defer file.Close()
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failure marshalling audit log entry: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if _, err = file.Write(data); err != nil {
+		return fmt.Errorf("failure writing audit log to %s: %w", a.path, err)
+	}
+	return nil
+}
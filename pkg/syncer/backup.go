@@ -0,0 +1,174 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+// Backup saves the trakt watchlist, lists and ratings to a json file
+func (s *Syncer) Backup(path string) error {
+	backup, err := s.traktBackup()
+	if err != nil {
+		s.logger.Error("failure backing up trakt data", zap.Error(err))
+		return err
+	}
+	if err = writeJson(path, backup); err != nil {
+		s.logger.Error("failure writing trakt backup", zap.Error(err))
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("saved backup of the trakt watchlist, %d list(s) and %d rating(s) to %s", len(backup.Lists), len(backup.Ratings), path))
+	return nil
+}
+
+// Restore adds the items of a backup back to trakt, recreating the lists that no longer exist.
+// Items added to trakt after the backup was taken are kept.
+func (s *Syncer) Restore(path string) error {
+	var backup entities.TraktBackup
+	if err := readJson(path, &backup); err != nil {
+		s.logger.Error("failure reading trakt backup", zap.Error(err))
+		return err
+	}
+	plan, err := s.restorePlan(&backup)
+	if err != nil {
+		s.logger.Error("failure planning trakt restore", zap.Error(err))
+		return err
+	}
+	if err = s.applyAndRecord(plan); err != nil {
+		s.logger.Error("failure restoring trakt backup", zap.Error(err))
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("successfully restored trakt backup %s", path))
+	return nil
+}
+
+func (s *Syncer) traktBackup() (*entities.TraktBackup, error) {
+	watchlist, err := s.traktClient.WatchlistGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching trakt watchlist: %w", err)
+	}
+	lists, err := s.traktClient.ListsMetadataGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching trakt lists: %w", err)
+	}
+	for i := range lists {
+		list, err := s.traktClient.ListGet(lists[i].Ids.Slug)
+		if err != nil {
+			return nil, fmt.Errorf("failure fetching trakt list %s: %w", lists[i].Ids.Slug, err)
+		}
+		lists[i].ListItems = list.ListItems
+	}
+	ratings, err := s.traktClient.RatingsGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching trakt ratings: %w", err)
+	}
+	return &entities.TraktBackup{
+		CreatedAt: time.Now(),
+		Watchlist: watchlist.ListItems,
+		Lists:     lists,
+		Ratings:   ratings,
+	}, nil
+}
+
+func (s *Syncer) restorePlan(backup *entities.TraktBackup) (*entities.SyncPlan, error) {
+	plan := &entities.SyncPlan{
+		CreatedAt: time.Now(),
+	}
+	if len(backup.Watchlist) > 0 {
+		plan.Operations = append(plan.Operations, entities.SyncOperation{
+			Action: entities.SyncActionAdd,
+			Target: entities.SyncTargetWatchlist,
+			Items:  backup.Watchlist,
+		})
+	}
+	existingLists, err := s.traktClient.ListsMetadataGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching trakt lists: %w", err)
+	}
+	existingSlugs := make(map[string]bool, len(existingLists))
+	for _, list := range existingLists {
+		existingSlugs[list.Ids.Slug] = true
+	}
+	for _, list := range backup.Lists {
+		operation := entities.SyncOperation{
+			Target:   entities.SyncTargetList,
+			ListSlug: list.Ids.Slug,
+		}
+		if !existingSlugs[list.Ids.Slug] {
+			createOperation := operation
+			createOperation.Action = entities.SyncActionCreate
+			if list.Name != nil {
+				createOperation.ListName = *list.Name
+			}
+			if list.Description != nil {
+				createOperation.Description = *list.Description
+			}
+			createOperation.SortBy = list.SortBy
+			createOperation.SortHow = list.SortHow
+			plan.Operations = append(plan.Operations, createOperation)
+		}
+		if len(list.ListItems) > 0 {
+			operation.Action = entities.SyncActionAdd
+			operation.Items = list.ListItems
+			plan.Operations = append(plan.Operations, operation)
+		}
+	}
+	if len(backup.Ratings) > 0 {
+		ratings := make(entities.TraktItems, 0, len(backup.Ratings))
+		for _, item := range backup.Ratings {
+			ratings = append(ratings, restoredRating(item))
+		}
+		plan.Operations = append(plan.Operations, entities.SyncOperation{
+			Action: entities.SyncActionAdd,
+			Target: entities.SyncTargetRatings,
+			Items:  ratings,
+		})
+	}
+	return plan, nil
+}
+
+// restoredRating moves the rating of an item fetched from trakt into its spec, where trakt expects it when adding ratings
+func restoredRating(item entities.TraktItem) entities.TraktItem {
+	rating, ratedAt := item.Rating, item.RatedAt
+	var spec *entities.TraktItemSpec
+	switch item.Type {
+	case entities.TraktItemTypeMovie:
+		spec = &item.Movie
+	case entities.TraktItemTypeShow:
+		spec = &item.Show
+	case entities.TraktItemTypeEpisode:
+		spec = &item.Episode
+	default:
+		return item
+	}
+	spec.Rating = &rating
+	if ratedAt != "" {
+		spec.RatedAt = &ratedAt
+	}
+	return item
+}
+
+func writeJson(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failure marshalling %s: %w", path, err)
+	}
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing %s: %w", path, err)
+	}
+	return nil
+}
+
+func readJson(path string, value interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failure unmarshalling %s: %w", path, err)
+	}
+	return nil
+}
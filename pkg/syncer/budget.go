@@ -0,0 +1,125 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const traktChunkSize = 100
+
+// budgetPhases maps the names used in the budget weights configuration to sync targets
+var budgetPhases = map[string]string{
+	"history":   entities.SyncTargetHistory,
+	"lists":     entities.SyncTargetList,
+	"ratings":   entities.SyncTargetRatings,
+	"watchlist": entities.SyncTargetWatchlist,
+}
+
+// parseBudgetWeights parses weights in the format `watchlist=3,ratings=2,lists=1,history=1`
+func parseBudgetWeights(value string) (map[string]int, error) {
+	weights := map[string]int{
+		entities.SyncTargetHistory:   1,
+		entities.SyncTargetList:      1,
+		entities.SyncTargetRatings:   1,
+		entities.SyncTargetWatchlist: 1,
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		pieces := strings.SplitN(pair, "=", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("failure parsing budget weight %s: expected format is phase=weight", pair)
+		}
+		phase := strings.TrimSpace(pieces[0])
+		target, found := budgetPhases[phase]
+		if !found {
+			return nil, fmt.Errorf("failure parsing budget weight %s: valid phases are history, lists, ratings, watchlist", pair)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(pieces[1]))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("failure parsing budget weight %s: weight must be a non-negative integer", pair)
+		}
+		weights[target] = weight
+	}
+	return weights, nil
+}
+
+// allocateRequestBudget splits operations into the ones that fit in the request budget and the ones that must be deferred.
+// The budget is shared between phases proportionally to their weights, while the budget left unused by a phase is
+// redistributed to the phases that still have pending operations. Phases weighted 0 only get the budget the other phases
+// leave unused, so they are never deferred forever. Every operation costs a single request.
+func allocateRequestBudget(operations []entities.SyncOperation, budget int, weights map[string]int) ([]entities.SyncOperation, []entities.SyncOperation) {
+	if budget <= 0 || len(operations) <= budget {
+		return operations, nil
+	}
+	demand := make(map[string]int)
+	for _, operation := range operations {
+		demand[operation.Target]++
+	}
+	allocation := make(map[string]int)
+	remaining := budget
+	for remaining > 0 {
+		pendingWeights := make(map[string]int)
+		for phase, requests := range demand {
+			if allocation[phase] < requests && weights[phase] > 0 {
+				pendingWeights[phase] = weights[phase]
+			}
+		}
+		if len(pendingWeights) == 0 {
+			// phases weighted 0 only share the budget left over by the other phases
+			for phase, requests := range demand {
+				if allocation[phase] < requests {
+					pendingWeights[phase] = 1
+				}
+			}
+		}
+		if len(pendingWeights) == 0 {
+			break
+		}
+		var phases []string
+		totalWeight := 0
+		for phase, weight := range pendingWeights {
+			phases = append(phases, phase)
+			totalWeight += weight
+		}
+		sort.Slice(phases, func(i, j int) bool {
+			if pendingWeights[phases[i]] != pendingWeights[phases[j]] {
+				return pendingWeights[phases[i]] > pendingWeights[phases[j]]
+			}
+			return phases[i] < phases[j]
+		})
+		distributed := 0
+		for _, phase := range phases {
+			share := remaining * pendingWeights[phase] / totalWeight
+			if share == 0 && distributed < remaining {
+				share = 1 // favour the heaviest phases when the budget is too small to be shared
+			}
+			if share > demand[phase]-allocation[phase] {
+				share = demand[phase] - allocation[phase]
+			}
+			if share > remaining-distributed {
+				share = remaining - distributed
+			}
+			allocation[phase] += share
+			distributed += share
+		}
+		if distributed == 0 {
+			break
+		}
+		remaining -= distributed
+	}
+	var scheduled, deferred []entities.SyncOperation
+	for _, operation := range operations {
+		if allocation[operation.Target] > 0 {
+			allocation[operation.Target]--
+			scheduled = append(scheduled, operation)
+			continue
+		}
+		deferred = append(deferred, operation)
+	}
+	return scheduled, deferred
+}
@@ -0,0 +1,374 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileFormatDouban reads the csv export of the marked movies and shows of a douban user, as written by the common douban export tools
+const FileFormatDouban = "douban"
+
+const (
+	defaultDoubanIdsPath = "douban-ids.json"
+
+	doubanColumnTitle   = "title"
+	doubanColumnRating  = "rating"
+	doubanColumnDate    = "date"
+	doubanColumnLink    = "link"
+	doubanColumnRelease = "release"
+	doubanColumnStatus  = "status"
+	doubanColumnImdbId  = "imdb_id"
+)
+
+// doubanCsvColumns maps the headers of the douban export tools, in chinese and english, to the fields of an entry
+var doubanCsvColumns = map[string]string{
+	"标题":     doubanColumnTitle,
+	"title":  doubanColumnTitle,
+	"个人评分":   doubanColumnRating,
+	"我的评分":   doubanColumnRating,
+	"rating": doubanColumnRating,
+	"打分日期":   doubanColumnDate,
+	"标记日期":   doubanColumnDate,
+	"date":   doubanColumnDate,
+	"条目链接":   doubanColumnLink,
+	"链接":     doubanColumnLink,
+	"link":   doubanColumnLink,
+	"url":    doubanColumnLink,
+	"上映日期":   doubanColumnRelease,
+	"year":   doubanColumnRelease,
+	"状态":     doubanColumnStatus,
+	"status": doubanColumnStatus,
+	"imdb":   doubanColumnImdbId,
+}
+
+var (
+	doubanSubjectPattern = regexp.MustCompile(`subject/(\d+)`)
+	doubanYearPattern    = regexp.MustCompile(`\d{4}`)
+)
+
+// doubanEntry is a movie or show marked by a douban user, which is watched unless its status says it is wished for or being watched
+type doubanEntry struct {
+	SubjectId string
+	Title     string
+	Year      int
+	Rating    *int // out of 10, converted from the 5 stars of douban
+	Date      string
+	Status    string
+	ImdbId    string
+	ItemType  string // the trakt type of the entry, which is known once it is matched
+}
+
+func (e *doubanEntry) watched() bool {
+	switch strings.ToLower(e.Status) {
+	case "想看", "wish", "在看", "do":
+		return false
+	default:
+		return true
+	}
+}
+
+func (e *doubanEntry) wished() bool {
+	switch strings.ToLower(e.Status) {
+	case "想看", "wish":
+		return true
+	default:
+		return false
+	}
+}
+
+// titles returns the titles to look the entry up by, as douban writes the original title after the chinese one
+func (e *doubanEntry) titles() []string {
+	parts := strings.Split(e.Title, " / ")
+	titles := make([]string, 0, len(parts))
+	for i := len(parts) - 1; i >= 0; i-- {
+		if title := strings.TrimSpace(parts[i]); title != "" {
+			titles = append(titles, title)
+		}
+	}
+	return titles
+}
+
+func DoubanIdsPath() string {
+	return StatePath(defaultDoubanIdsPath)
+}
+
+// doubanIds caches the subjects looked up on douban, so their pages are read only once
+type doubanIds struct {
+	path     string
+	Subjects map[string]entities.DoubanSubject `json:"subjects"`
+}
+
+func loadDoubanIds(path string) (*doubanIds, error) {
+	ids := &doubanIds{
+		path:     path,
+		Subjects: make(map[string]entities.DoubanSubject),
+	}
+	if err := readJson(path, ids); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if ids.Subjects == nil {
+		ids.Subjects = make(map[string]entities.DoubanSubject)
+	}
+	return ids, nil
+}
+
+func (i *doubanIds) save() error {
+	return writeJson(i.path, i)
+}
+
+// ImportDouban adds the watched movies and shows of a douban export to the trakt history, those wished for to the trakt watchlist,
+// and the stars of douban to the trakt ratings, doubled to the 10 points of trakt. Entries are matched through the imdb id
+// their douban page lists, falling back to a trakt search by their original title and year, and those still unmatched are skipped.
+func (s *Syncer) ImportDouban(path string) error {
+	entries, err := readDoubanFile(path)
+	if err != nil {
+		s.logger.Error("failure reading douban export", zap.Error(err))
+		return err
+	}
+	if err = s.resolveDoubanEntries(entries); err != nil {
+		s.logger.Error("failure matching douban entries", zap.Error(err))
+		return err
+	}
+	var history, ratings, watchlist []importRecord
+	unmatched := 0
+	for _, entry := range entries {
+		if entry.ImdbId == "" {
+			unmatched++
+			continue
+		}
+		record := importRecord{
+			ImdbId:    entry.ImdbId,
+			TitleType: entry.ItemType,
+			WatchedAt: entry.Date,
+		}
+		switch {
+		case entry.wished():
+			watchlist = append(watchlist, record)
+		case entry.watched():
+			history = append(history, record)
+		}
+		if entry.Rating != nil {
+			record.Rating = entry.Rating
+			ratings = append(ratings, record)
+		}
+	}
+	if unmatched > 0 {
+		s.logger.Warn(fmt.Sprintf("skipped %d douban entries, as neither douban nor trakt knows their imdb id", unmatched))
+	}
+	plan := &entities.SyncPlan{
+		CreatedAt: time.Now(),
+	}
+	for _, group := range []struct {
+		target  string
+		records []importRecord
+	}{
+		{target: entities.SyncTargetHistory, records: history},
+		{target: entities.SyncTargetRatings, records: ratings},
+		{target: entities.SyncTargetWatchlist, records: watchlist},
+	} {
+		if len(group.records) == 0 {
+			continue
+		}
+		items, err := importItems(group.records, group.target)
+		if err != nil {
+			s.logger.Error("failure reading douban export", zap.Error(err))
+			return err
+		}
+		plan.Operations = append(plan.Operations, entities.SyncOperation{
+			Action: entities.SyncActionAdd,
+			Target: group.target,
+			Items:  items,
+		})
+	}
+	if len(plan.Operations) > 0 {
+		if err = s.applyAndRecord(plan); err != nil {
+			s.logger.Error(fmt.Sprintf("failure importing %s", path), zap.Error(err))
+			return err
+		}
+	}
+	s.logger.Info(fmt.Sprintf("imported %d watched, %d rated and %d wished for title(s) from %s to trakt", len(history), len(ratings), len(watchlist), path))
+	return nil
+}
+
+// resolveDoubanEntries sets the imdb id and type of the entries, reading them from their douban page, or searching trakt
+// by their titles when douban lists no imdb id or cannot be reached
+func (s *Syncer) resolveDoubanEntries(entries []doubanEntry) error {
+	ids, err := loadDoubanIds(DoubanIdsPath())
+	if err != nil {
+		s.logger.Warn("failure loading douban ids, reading the page of every entry", zap.Error(err))
+		ids = &doubanIds{
+			path:     DoubanIdsPath(),
+			Subjects: make(map[string]entities.DoubanSubject),
+		}
+	}
+	defer func() {
+		if err := ids.save(); err != nil {
+			s.logger.Warn("failure saving douban ids", zap.Error(err))
+		}
+	}()
+	doubanClient := client.NewDoubanClient(client.DoubanConfig{}, s.logger)
+	doubanReachable := true
+	for i := range entries {
+		entry := &entries[i]
+		subject, cached := ids.Subjects[entry.SubjectId]
+		// the page is read even when the export has the imdb id, as only the page tells shows apart from movies
+		if !cached && entry.SubjectId != "" && doubanReachable {
+			found, err := doubanClient.SubjectGet(entry.SubjectId)
+			if err != nil {
+				// douban blocks some networks altogether, in which case every entry is searched on trakt instead
+				s.logger.Warn("failure reading douban pages, searching trakt by title instead", zap.Error(err))
+				doubanReachable = false
+			} else {
+				if found != nil {
+					subject = *found
+				}
+				subject.Id = entry.SubjectId
+				ids.Subjects[entry.SubjectId] = subject
+			}
+		}
+		entry.ItemType = entities.TraktItemTypeMovie
+		if subject.IsShow {
+			entry.ItemType = entities.TraktItemTypeShow
+		}
+		if entry.ImdbId == "" {
+			entry.ImdbId = subject.ImdbId
+		}
+		if entry.ImdbId == "" {
+			if entry.ImdbId, entry.ItemType, err = s.searchDoubanEntry(entry, subject); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// searchDoubanEntry searches trakt for the entry by its titles and year, trying shows after movies unless douban tells its type
+func (s *Syncer) searchDoubanEntry(entry *doubanEntry, subject entities.DoubanSubject) (string, string, error) {
+	itemTypes := []string{entities.TraktItemTypeMovie, entities.TraktItemTypeShow}
+	if subject.IsShow {
+		itemTypes = []string{entities.TraktItemTypeShow}
+	} else if subject.Id != "" {
+		itemTypes = []string{entities.TraktItemTypeMovie}
+	}
+	for _, title := range entry.titles() {
+		for _, itemType := range itemTypes {
+			ids, err := s.traktClient.SearchTitle(itemType, title, entry.Year)
+			if err != nil {
+				return "", "", fmt.Errorf("failure searching trakt for %s %s: %w", itemType, title, err)
+			}
+			if ids != nil && ids.Imdb != "" {
+				return ids.Imdb, itemType, nil
+			}
+		}
+	}
+	s.logger.Debug(fmt.Sprintf("skipping douban entry %s (%d), as trakt knows no movie or show of that title with an imdb id", entry.Title, entry.Year))
+	return "", "", nil
+}
+
+// readDoubanFile reads the entries of a douban csv export, whose headers are those of the douban export tools
+func readDoubanFile(path string) ([]doubanEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the header of %s: %w", path, err)
+	}
+	positions := make(map[string]int)
+	for i, name := range header {
+		if column, ok := doubanCsvColumns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))]; ok {
+			if _, duplicate := positions[column]; !duplicate {
+				positions[column] = i
+			}
+		}
+	}
+	_, hasTitle := positions[doubanColumnTitle]
+	_, hasLink := positions[doubanColumnLink]
+	if !hasTitle && !hasLink {
+		return nil, fmt.Errorf("failure reading %s: the header has no 标题 (title) or 条目链接 (link) column", path)
+	}
+	field := func(row []string, column string) string {
+		if i, ok := positions[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	var entries []doubanEntry
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure reading %s: %w", path, err)
+		}
+		entry := doubanEntry{
+			Title:  field(row, doubanColumnTitle),
+			Status: field(row, doubanColumnStatus),
+			ImdbId: field(row, doubanColumnImdbId),
+		}
+		if !strings.HasPrefix(entry.ImdbId, "tt") {
+			entry.ImdbId = ""
+		}
+		if match := doubanSubjectPattern.FindStringSubmatch(field(row, doubanColumnLink)); match != nil {
+			entry.SubjectId = match[1]
+		}
+		if year := doubanYearPattern.FindString(field(row, doubanColumnRelease)); year != "" {
+			entry.Year, _ = strconv.Atoi(year)
+		}
+		if value := field(row, doubanColumnRating); value != "" {
+			stars, err := doubanStars(value)
+			if err != nil {
+				return nil, fmt.Errorf("failure parsing the rating on line %d of %s: %w", line, path, err)
+			}
+			if stars > 0 {
+				rating := stars * 2
+				entry.Rating = &rating
+			}
+		}
+		if value := field(row, doubanColumnDate); value != "" {
+			if date, err := doubanDate(value); err == nil {
+				entry.Date = date
+			}
+		}
+		if entry.SubjectId == "" && entry.Title == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// doubanStars parses a rating of douban, written either as a number of stars from 1 to 5 or as the stars themselves
+func doubanStars(value string) (int, error) {
+	if count := strings.Count(value, "★"); count > 0 {
+		return count, nil
+	}
+	stars, err := strconv.Atoi(value)
+	if err != nil || stars < 0 || stars > 5 {
+		return 0, fmt.Errorf("expected a number of stars from 1 to 5, got %q", value)
+	}
+	return stars, nil
+}
+
+// doubanDate parses the dates of douban, which are written in the local time of the user with or without a time
+func doubanDate(value string) (string, error) {
+	if date, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return date.UTC().Format(time.RFC3339), nil
+	}
+	return parseImportDate(value)
+}
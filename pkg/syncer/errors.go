@@ -1,6 +1,25 @@
 package syncer
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"net/http"
+	"strings"
+)
+
+const (
+	ExitCodeSuccess        = 0
+	ExitCodeFailure        = 1
+	ExitCodeConfigError    = 2
+	ExitCodeAuthFailure    = 3
+	ExitCodeRateLimited    = 4
+	ExitCodePartialFailure = 5
+	ExitCodeInterrupted    = 6
+	ExitCodeListFailure    = 7
+	ExitCodeAnomaly        = 8
+)
 
 type MissingEnvironmentVariablesError struct {
 	variables []string
@@ -17,3 +36,113 @@ func (e *MissingEnvironmentVariablesError) Error() string {
 	}
 	return message
 }
+
+// ConfigProblemsError lists every problem found while validating the configuration, so they can be fixed at once
+type ConfigProblemsError struct {
+	problems []error
+}
+
+func (e *ConfigProblemsError) Error() string {
+	message := fmt.Sprintf("found %d problems", len(e.problems))
+	for _, problem := range e.problems {
+		message += fmt.Sprintf("\n  - %s", problem)
+	}
+	return message
+}
+
+// Problems returns the problems found in the configuration
+func (e *ConfigProblemsError) Problems() []error {
+	return e.problems
+}
+
+type ConfigError struct {
+	err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", e.err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.err
+}
+
+type PartialSyncError struct {
+	itemsNotFound      int
+	operationsDeferred int
+}
+
+func (e *PartialSyncError) Error() string {
+	return fmt.Sprintf("%d item(s) could not be found on trakt and %d operation(s) were deferred to the retry queue", e.itemsNotFound, e.operationsDeferred)
+}
+
+type InterruptedError struct {
+	operationsDeferred int
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("sync interrupted by a shutdown signal: %d operation(s) were deferred to the retry queue", e.operationsDeferred)
+}
+
+type ListSyncError struct {
+	lists []string
+}
+
+func (e *ListSyncError) Error() string {
+	return fmt.Sprintf("failure syncing %d list(s): %s", len(e.lists), strings.Join(e.lists, ", "))
+}
+
+func partialSyncError(summary *entities.SyncSummary) error {
+	if len(summary.FailedLists) > 0 {
+		return &ListSyncError{
+			lists: summary.FailedLists,
+		}
+	}
+	if summary.ItemsNotFound == 0 && summary.OperationsDeferred == 0 {
+		return nil
+	}
+	return &PartialSyncError{
+		itemsNotFound:      summary.ItemsNotFound,
+		operationsDeferred: summary.OperationsDeferred,
+	}
+}
+
+// ExitCode maps an error returned by the syncer to a process exit code, allowing wrapper scripts to react to each failure category
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeSuccess
+	}
+	var (
+		configError  *ConfigError
+		authError    *client.AuthError
+		apiError     *client.ApiError
+		partialError *PartialSyncError
+		interrupted  *InterruptedError
+		listError    *ListSyncError
+		anomaly      *AnomalyError
+	)
+	switch {
+	case errors.As(err, &interrupted):
+		return ExitCodeInterrupted
+	case errors.As(err, &anomaly):
+		return ExitCodeAnomaly
+	case errors.As(err, &configError):
+		return ExitCodeConfigError
+	case errors.As(err, &authError):
+		return ExitCodeAuthFailure
+	case errors.As(err, &apiError):
+		switch apiError.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ExitCodeAuthFailure
+		case http.StatusTooManyRequests, client.TraktStatusCodeEnhanceYourCalm:
+			return ExitCodeRateLimited
+		}
+		return ExitCodeFailure
+	case errors.As(err, &listError):
+		return ExitCodeListFailure
+	case errors.As(err, &partialError):
+		return ExitCodePartialFailure
+	default:
+		return ExitCodeFailure
+	}
+}
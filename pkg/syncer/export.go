@@ -0,0 +1,121 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FileFormatCsv  = "csv"
+	FileFormatJson = "json"
+)
+
+var exportCsvHeader = []string{"source", "list_id", "list_name", "position", "imdb_id", "title_type", "rating", "rated_at"}
+
+// FileFormat returns the format of an export or import file, detected from its extension when format is empty
+func FileFormat(path, format string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(path), "."+FileFormatCsv) {
+			return FileFormatCsv, nil
+		}
+		return FileFormatJson, nil
+	}
+	switch format = strings.ToLower(format); format {
+	case FileFormatCsv, FileFormatJson:
+		return format, nil
+	default:
+		return "", fmt.Errorf("file format %s is invalid, expected %s or %s", format, FileFormatCsv, FileFormatJson)
+	}
+}
+
+// Export saves the imdb watchlist, lists and ratings to a json or csv file, or to csv files to be imported on letterboxd by hand
+func (s *Syncer) Export(path, format string) error {
+	format, err := ExportFormat(path, format)
+	if err != nil {
+		return err
+	}
+	if err = s.runPhase(PhaseHydrate, s.hydrateImdb); err != nil {
+		s.logger.Error("failure hydrating imdb data", zap.Error(err))
+		return err
+	}
+	export := entities.ImdbExport{
+		CreatedAt: time.Now(),
+		Lists:     make([]entities.ImdbList, 0, len(s.user.imdbLists)),
+		Ratings:   make([]entities.ImdbItem, 0, len(s.user.imdbRatings)),
+	}
+	for _, list := range s.user.imdbLists {
+		export.Lists = append(export.Lists, list)
+	}
+	sort.Slice(export.Lists, func(i, j int) bool {
+		return export.Lists[i].ListId < export.Lists[j].ListId
+	})
+	for _, rating := range s.user.imdbRatings {
+		export.Ratings = append(export.Ratings, rating)
+	}
+	sort.Slice(export.Ratings, func(i, j int) bool {
+		return export.Ratings[i].Id < export.Ratings[j].Id
+	})
+	switch format {
+	case FileFormatLetterboxdCsv:
+		return s.exportLetterboxdCsv(path, export)
+	case FileFormatCsv:
+		err = writeExportCsv(path, export)
+	default:
+		err = writeJson(path, export)
+	}
+	if err != nil {
+		s.logger.Error("failure writing imdb export", zap.Error(err))
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("exported %d imdb list(s) and %d rating(s) to %s", len(export.Lists), len(export.Ratings), path))
+	return nil
+}
+
+// writeExportCsv writes one row per list item and rating, telling them apart by the source column
+func writeExportCsv(path string, export entities.ImdbExport) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failure creating %s: %w", path, err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	rows := [][]string{exportCsvHeader}
+	for _, list := range export.Lists {
+		source := "list"
+		if list.IsWatchlist {
+			source = "watchlist"
+		}
+		for i, item := range list.ListItems {
+			rows = append(rows, exportCsvRow(source, list.ListId, list.ListName, strconv.Itoa(i+1), item))
+		}
+	}
+	for _, rating := range export.Ratings {
+		rows = append(rows, exportCsvRow("ratings", "", "", "", rating))
+	}
+	if err = writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("failure writing %s: %w", path, err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failure writing %s: %w", path, err)
+	}
+	return nil
+}
+
+func exportCsvRow(source, listId, listName, position string, item entities.ImdbItem) []string {
+	var rating, ratedAt string
+	if item.Rating != nil {
+		rating = strconv.Itoa(*item.Rating)
+	}
+	if item.RatingDate != nil {
+		ratedAt = item.RatingDate.Local().Format("2006-01-02")
+	}
+	return []string{source, listId, listName, position, item.Id, item.TitleType, rating, ratedAt}
+}
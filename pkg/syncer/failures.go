@@ -0,0 +1,95 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+const defaultFailureReportPath = "failure-report.json"
+
+func FailureReportPath() string {
+	if path := os.Getenv(EnvVarKeyFailureReportPath); path != "" {
+		return path
+	}
+	return StatePath(defaultFailureReportPath)
+}
+
+// failureReport lists the items the last run could not sync, along with the reason of every failure
+type failureReport struct {
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+	Failures   []entities.ItemFailure `json:"failures"`
+}
+
+// operationFailures describes the items of an operation that failed, limited to the given imdb ids when there are any
+func operationFailures(operation entities.SyncOperation, reason string, ids []string, err error) []entities.ItemFailure {
+	failure := entities.ItemFailure{
+		Action: operation.Action,
+		Target: operation.Target,
+		List:   operation.ListSlug,
+		Reason: reason,
+	}
+	if err != nil {
+		failure.Error = err.Error()
+	}
+	if len(operation.Items) == 0 || operation.Action == entities.SyncActionReorder {
+		return []entities.ItemFailure{failure}
+	}
+	only := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		only[id] = true
+	}
+	failures := make([]entities.ItemFailure, 0, len(operation.Items))
+	for _, item := range operation.Items {
+		itemFailure := failure
+		itemFailure.Type = item.Type
+		if id, idErr := item.GetItemId(); idErr == nil && id != nil {
+			itemFailure.ImdbId = *id
+		}
+		if len(only) > 0 && !only[itemFailure.ImdbId] {
+			continue
+		}
+		failures = append(failures, itemFailure)
+	}
+	return failures
+}
+
+// isRejection reports whether trakt refused the items of a request, as opposed to failing because of the account or the rate limit
+func isRejection(err error) bool {
+	var apiError *client.ApiError
+	if !errors.As(err, &apiError) || apiError.StatusCode/100 != 4 {
+		return false
+	}
+	return ExitCode(err) == ExitCodeFailure
+}
+
+// writeFailureReport saves the items the run could not sync to the failure report, which is removed once a run syncs every item
+func (s *Syncer) writeFailureReport(summary entities.SyncSummary) {
+	path := FailureReportPath()
+	if len(summary.Failures) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warn(fmt.Sprintf("failure removing failure report %s", path), zap.Error(err))
+		}
+		return
+	}
+	report := failureReport{
+		StartedAt:  summary.StartedAt,
+		FinishedAt: summary.FinishedAt,
+		Failures:   summary.Failures,
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("failure writing failure report %s", path), zap.Error(err))
+		return
+	}
+	s.logger.Warn(fmt.Sprintf("%d item(s) could not be synced, see %s for the reasons", len(summary.Failures), path))
+}
@@ -0,0 +1,190 @@
+package syncer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FileFormatNdjson = "ndjson"
+
+	stepFile = "file"
+)
+
+// fileTargetDataset is the json document written to FILE_TARGET_PATH
+type fileTargetDataset struct {
+	CreatedAt time.Time          `json:"created_at"`
+	Items     []fileTargetRecord `json:"items"`
+}
+
+// fileTargetRecord is an item of the watchlist, a list or the ratings, as resolved and deduplicated to be synced to trakt
+type fileTargetRecord struct {
+	Target   string  `json:"target"`
+	ListId   string  `json:"list_id,omitempty"`
+	ListName string  `json:"list_name,omitempty"`
+	ListSlug string  `json:"list_slug,omitempty"`
+	Position int     `json:"position,omitempty"`
+	ImdbId   string  `json:"imdb_id"`
+	Type     string  `json:"type"`
+	Rating   *int    `json:"rating,omitempty"`
+	RatedAt  *string `json:"rated_at,omitempty"`
+}
+
+// fileTargetFormat returns the format of the file target, which is ndjson for the .ndjson and .jsonl extensions, and json otherwise
+func fileTargetFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		return FileFormatNdjson
+	default:
+		return FileFormatJson
+	}
+}
+
+// writeFileTarget writes the watchlist, lists and ratings of the source to FILE_TARGET_PATH while trakt is synced, once lists are merged
+// and split, and the ratings of the media servers and other sources are added. It returns the name of the target when it failed.
+func (s *Syncer) writeFileTarget() []string {
+	path := strings.TrimSpace(os.Getenv(EnvVarKeyFileTargetPath))
+	if path == "" {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepFile, start)
+	records := s.fileTargetRecords()
+	var err error
+	if fileTargetFormat(path) == FileFormatNdjson {
+		err = writeNdjson(path, records)
+	} else {
+		err = writeJsonAtomically(path, fileTargetDataset{
+			CreatedAt: time.Now(),
+			Items:     records,
+		})
+	}
+	if err != nil {
+		s.logger.Error("failure writing file target", zap.Error(err))
+		return []string{stepFile}
+	}
+	s.logger.Info(fmt.Sprintf("wrote %d item(s) to %s", len(records), path))
+	return nil
+}
+
+// fileTargetRecords returns the items of the watchlist and lists in their order, followed by the ratings sorted by imdb id,
+// keeping the first occurrence of every item in a list
+func (s *Syncer) fileTargetRecords() []fileTargetRecord {
+	imdbLists := make([]entities.ImdbList, 0, len(s.user.imdbLists))
+	for _, imdbList := range s.user.imdbLists {
+		imdbLists = append(imdbLists, imdbList)
+	}
+	sort.Slice(imdbLists, func(i, j int) bool {
+		if imdbLists[i].IsWatchlist != imdbLists[j].IsWatchlist {
+			return imdbLists[i].IsWatchlist
+		}
+		return imdbLists[i].ListName < imdbLists[j].ListName
+	})
+	var records []fileTargetRecord
+	for _, imdbList := range imdbLists {
+		record := fileTargetRecord{
+			Target: entities.SyncTargetWatchlist,
+		}
+		if !imdbList.IsWatchlist {
+			record.Target = entities.SyncTargetList
+			record.ListId = imdbList.ListId
+			record.ListName = imdbList.ListName
+			record.ListSlug = imdbList.TraktListSlug
+			if record.ListSlug == "" {
+				record.ListSlug = entities.BuildTraktListSlug(imdbList.ListName)
+			}
+		}
+		seen := make(map[string]bool, len(imdbList.ListItems))
+		for _, item := range imdbList.ListItems {
+			if seen[item.Id] {
+				continue
+			}
+			seen[item.Id] = true
+			record.Position = len(seen)
+			record.ImdbId = item.Id
+			record.Type = item.TraktItemType()
+			records = append(records, record)
+		}
+	}
+	if s.syncRatings {
+		ratings := make([]entities.ImdbItem, 0, len(s.user.imdbRatings))
+		for _, rating := range s.user.imdbRatings {
+			if rating.Rating != nil {
+				ratings = append(ratings, rating)
+			}
+		}
+		sort.Slice(ratings, func(i, j int) bool {
+			return ratings[i].Id < ratings[j].Id
+		})
+		for _, rating := range ratings {
+			record := fileTargetRecord{
+				Target: entities.SyncTargetRatings,
+				ImdbId: rating.Id,
+				Type:   rating.TraktItemType(),
+				Rating: rating.Rating,
+			}
+			if rating.RatingDate != nil {
+				ratedAt := rating.RatingDate.UTC().Format(time.RFC3339)
+				record.RatedAt = &ratedAt
+			}
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// writeJsonAtomically writes the json to a temporary file next to the path before renaming it,
+// so tools reading the file never see it half written
+func writeJsonAtomically(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failure marshalling %s: %w", path, err)
+	}
+	return writeFileAtomically(path, func(writer *bufio.Writer) error {
+		_, err := writer.Write(data)
+		return err
+	})
+}
+
+// writeNdjson writes every record as a json document on a line of its own
+func writeNdjson(path string, records []fileTargetRecord) error {
+	return writeFileAtomically(path, func(writer *bufio.Writer) error {
+		encoder := json.NewEncoder(writer)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func writeFileAtomically(path string, write func(writer *bufio.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failure creating %s: %w", path, err)
+	}
+	defer os.Remove(file.Name())
+	writer := bufio.NewWriter(file)
+	if err = write(writer); err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failure writing %s: %w", path, err)
+	}
+	if err = os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failure writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package syncer
+
+import (
+	"context"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/tracing"
+	"time"
+)
+
+const (
+	PhaseApply   = "apply"
+	PhaseHydrate = "hydrate"
+	PhasePlan    = "plan"
+)
+
+// Hooks allows embedders to observe and influence a sync run without modifying the syncer.
+// Every callback is optional and callbacks from multiple registered hooks are invoked in registration order.
+// Item and list callbacks can be invoked concurrently for different lists, unless SYNC_CONCURRENCY is set to 1.
+type Hooks struct {
+	// OnRunStart is invoked once a run acquired the lock of its profile, before contacting imdb or trakt
+	OnRunStart      func()
+	OnPhaseStart    func(phase string)
+	OnPhaseComplete func(phase string, err error)
+	// OnItemAdd is invoked for every item about to be added to trakt. The item can be enriched in place,
+	// while returning false vetoes the item and excludes it from the operation.
+	OnItemAdd     func(operation entities.SyncOperation, item *entities.TraktItem) bool
+	OnListSynced  func(target, listSlug string, err error)
+	OnRunComplete func(summary entities.SyncSummary, err error)
+}
+
+type Option func(s *Syncer)
+
+func WithHooks(hooks Hooks) Option {
+	return func(s *Syncer) {
+		s.hooks = append(s.hooks, hooks)
+	}
+}
+
+// WithContext stops the syncer from sending further requests to trakt once the context is done.
+// Operations that were not applied yet are saved to the retry queue.
+func WithContext(ctx context.Context) Option {
+	return func(s *Syncer) {
+		s.ctx = ctx
+	}
+}
+
+// WithInteractive prints the changes of every list before applying them, asking for confirmation before removing or deleting anything
+func WithInteractive() Option {
+	return func(s *Syncer) {
+		s.interactive = true
+	}
+}
+
+// WithForce applies the planned changes even when they are unusually large compared to previous runs
+func WithForce() Option {
+	return func(s *Syncer) {
+		s.force = true
+	}
+}
+
+// WithImdbOnly skips signing in to trakt, so only the imdb credentials are required.
+// Methods that contact trakt must not be called on such a syncer.
+func WithImdbOnly() Option {
+	return func(s *Syncer) {
+		s.imdbOnly = true
+	}
+}
+
+// WithTraktOnly skips signing in to imdb, so only the trakt credentials are required.
+// Methods that contact imdb must not be called on such a syncer.
+func WithTraktOnly() Option {
+	return func(s *Syncer) {
+		s.traktOnly = true
+	}
+}
+
+func (s *Syncer) runPhase(phase string, fn func() error) error {
+	for _, hooks := range s.hooks {
+		if hooks.OnPhaseStart != nil {
+			hooks.OnPhaseStart(phase)
+		}
+	}
+	s.phaseSpan = tracing.Start(nil, phase)
+	start := time.Now()
+	err := fn()
+	s.timings.record(phase, "", start)
+	s.phaseSpan.End(err)
+	for _, hooks := range s.hooks {
+		if hooks.OnPhaseComplete != nil {
+			hooks.OnPhaseComplete(phase, err)
+		}
+	}
+	return err
+}
+
+func (s *Syncer) filterItemsToAdd(operation entities.SyncOperation) entities.TraktItems {
+	items := make(entities.TraktItems, 0, len(operation.Items))
+	for i := range operation.Items {
+		item := operation.Items[i]
+		if s.itemAddAllowed(operation, &item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *Syncer) itemAddAllowed(operation entities.SyncOperation, item *entities.TraktItem) bool {
+	for _, hooks := range s.hooks {
+		if hooks.OnItemAdd != nil && !hooks.OnItemAdd(operation, item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Syncer) listSynced(target, listSlug string, err error) {
+	for _, hooks := range s.hooks {
+		if hooks.OnListSynced != nil {
+			hooks.OnListSynced(target, listSlug, err)
+		}
+	}
+}
+
+func (s *Syncer) runStart() {
+	for _, hooks := range s.hooks {
+		if hooks.OnRunStart != nil {
+			hooks.OnRunStart()
+		}
+	}
+}
+
+func (s *Syncer) runComplete(summary entities.SyncSummary, err error) {
+	for _, hooks := range s.hooks {
+		if hooks.OnRunComplete != nil {
+			hooks.OnRunComplete(summary, err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileFormatICheckMovies reads the csv export of an icheckmovies list, or of the checked movies of a user
+const FileFormatICheckMovies = "icheckmovies"
+
+const (
+	iCheckMoviesFavoritesListName = "iCheckMovies favorites"
+
+	iCheckMoviesColumnTitle     = "title"
+	iCheckMoviesColumnYear      = "year"
+	iCheckMoviesColumnImdbUrl   = "imdb"
+	iCheckMoviesColumnChecked   = "checked"
+	iCheckMoviesColumnFavorite  = "favorite"
+	iCheckMoviesColumnWatchlist = "watchlist"
+)
+
+var imdbTitlePattern = regexp.MustCompile(`tt\d+`)
+
+// iCheckMoviesCsvColumns maps the headers of the icheckmovies exports to the fields of a movie
+var iCheckMoviesCsvColumns = map[string]string{
+	"title":     iCheckMoviesColumnTitle,
+	"year":      iCheckMoviesColumnYear,
+	"imdburl":   iCheckMoviesColumnImdbUrl,
+	"imdb url":  iCheckMoviesColumnImdbUrl,
+	"imdb":      iCheckMoviesColumnImdbUrl,
+	"checked":   iCheckMoviesColumnChecked,
+	"favorite":  iCheckMoviesColumnFavorite,
+	"favorited": iCheckMoviesColumnFavorite,
+	"watchlist": iCheckMoviesColumnWatchlist,
+}
+
+// iCheckMoviesMovie is a movie of an icheckmovies export, which flags whether the user checked, favorited or watchlisted it
+type iCheckMoviesMovie struct {
+	record    importRecord
+	checked   bool
+	favorite  bool
+	watchlist bool
+}
+
+// ImportICheckMovies adds the checked movies of an icheckmovies export to the trakt history, the favorited ones to the
+// iCheckMovies favorites list and the watchlisted ones to the trakt watchlist. Every movie of the export is added to the trakt
+// list of the list name as well when one is given, so an icheckmovies list can be followed on trakt. Movies are matched by the
+// imdb id of their imdb url, falling back to a trakt search by their title and year. The export has no check dates,
+// so checked movies are added as watched at the time of the import.
+func (s *Syncer) ImportICheckMovies(path, listName string) error {
+	movies, err := readICheckMoviesFile(path)
+	if err != nil {
+		s.logger.Error("failure reading icheckmovies export", zap.Error(err))
+		return err
+	}
+	records := make([]importRecord, 0, len(movies))
+	for _, movie := range movies {
+		records = append(records, movie.record)
+	}
+	if records, err = s.resolveImportTitles(records); err != nil {
+		s.logger.Error("failure looking up icheckmovies titles on trakt", zap.Error(err))
+		return err
+	}
+	// titles that could not be resolved are left out, so the movies are matched to their records by title and year
+	resolved := make(map[string]string, len(records))
+	for _, record := range records {
+		resolved[iCheckMoviesKey(record)] = record.ImdbId
+	}
+	var all, history, favorites, watchlist []importRecord
+	for _, movie := range movies {
+		imdbId := resolved[iCheckMoviesKey(movie.record)]
+		if imdbId == "" {
+			continue
+		}
+		record := importRecord{
+			ImdbId:    imdbId,
+			TitleType: entities.TraktItemTypeMovie,
+		}
+		all = append(all, record)
+		if movie.checked {
+			history = append(history, record)
+		}
+		if movie.favorite {
+			favorites = append(favorites, record)
+		}
+		if movie.watchlist {
+			watchlist = append(watchlist, record)
+		}
+	}
+	type group struct {
+		target   string
+		listName string
+		records  []importRecord
+	}
+	groups := []group{
+		{target: entities.SyncTargetHistory, records: history},
+		{target: entities.SyncTargetList, listName: iCheckMoviesFavoritesListName, records: favorites},
+		{target: entities.SyncTargetWatchlist, records: watchlist},
+	}
+	if entities.BuildTraktListSlug(listName) != "" {
+		groups = append(groups, group{target: entities.SyncTargetList, listName: listName, records: all})
+	}
+	var listSlugs map[string]bool
+	if len(favorites) > 0 || entities.BuildTraktListSlug(listName) != "" {
+		if listSlugs, err = s.traktListSlugs(); err != nil {
+			s.logger.Error("failure fetching trakt lists", zap.Error(err))
+			return err
+		}
+	}
+	plan := &entities.SyncPlan{
+		CreatedAt: time.Now(),
+	}
+	for _, group := range groups {
+		if len(group.records) == 0 {
+			continue
+		}
+		items, err := importItems(group.records, group.target)
+		if err != nil {
+			s.logger.Error("failure reading icheckmovies export", zap.Error(err))
+			return err
+		}
+		operation := entities.SyncOperation{
+			Action: entities.SyncActionAdd,
+			Target: group.target,
+			Items:  items,
+		}
+		if group.target == entities.SyncTargetList {
+			operation.ListName = group.listName
+			operation.ListSlug = entities.BuildTraktListSlug(group.listName)
+			if !listSlugs[operation.ListSlug] {
+				createOperation := operation
+				createOperation.Action = entities.SyncActionCreate
+				createOperation.Description = fmt.Sprintf("list imported from %s by https://github.com/cecobask/imdb-trakt-sync", filepath.Base(path))
+				createOperation.Items = nil
+				plan.Operations = append(plan.Operations, createOperation)
+			}
+		}
+		plan.Operations = append(plan.Operations, operation)
+	}
+	if len(plan.Operations) > 0 {
+		if err = s.applyAndRecord(plan); err != nil {
+			s.logger.Error(fmt.Sprintf("failure importing %s", path), zap.Error(err))
+			return err
+		}
+	}
+	s.logger.Info(fmt.Sprintf("imported %d checked, %d favorited and %d watchlisted movie(s) from %s to trakt", len(history), len(favorites), len(watchlist), path))
+	return nil
+}
+
+func iCheckMoviesKey(record importRecord) string {
+	if record.ImdbId != "" && record.Title == "" {
+		return record.ImdbId
+	}
+	return fmt.Sprintf("%d/%s", record.Year, strings.ToLower(strings.TrimSpace(record.Title)))
+}
+
+// readICheckMoviesFile reads the movies of an icheckmovies csv export, whose flags are written as yes or no
+func readICheckMoviesFile(path string) ([]iCheckMoviesMovie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the header of %s: %w", path, err)
+	}
+	positions := make(map[string]int)
+	for i, name := range header {
+		if column, ok := iCheckMoviesCsvColumns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))]; ok {
+			if _, duplicate := positions[column]; !duplicate {
+				positions[column] = i
+			}
+		}
+	}
+	_, hasTitle := positions[iCheckMoviesColumnTitle]
+	_, hasImdbUrl := positions[iCheckMoviesColumnImdbUrl]
+	if !hasTitle && !hasImdbUrl {
+		return nil, fmt.Errorf("failure reading %s: the header has no title or imdburl column", path)
+	}
+	field := func(row []string, column string) string {
+		if i, ok := positions[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	var movies []iCheckMoviesMovie
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure reading %s: %w", path, err)
+		}
+		movie := iCheckMoviesMovie{
+			record: importRecord{
+				ImdbId:    imdbTitlePattern.FindString(field(row, iCheckMoviesColumnImdbUrl)),
+				Title:     field(row, iCheckMoviesColumnTitle),
+				TitleType: entities.TraktItemTypeMovie,
+			},
+			checked:   iCheckMoviesFlag(field(row, iCheckMoviesColumnChecked)),
+			favorite:  iCheckMoviesFlag(field(row, iCheckMoviesColumnFavorite)),
+			watchlist: iCheckMoviesFlag(field(row, iCheckMoviesColumnWatchlist)),
+		}
+		if value := field(row, iCheckMoviesColumnYear); value != "" {
+			year, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("failure parsing the year on line %d of %s: %w", line, path, err)
+			}
+			movie.record.Year = year
+		}
+		if movie.record.ImdbId == "" && movie.record.Title == "" {
+			continue
+		}
+		movies = append(movies, movie)
+	}
+	return movies, nil
+}
+
+func iCheckMoviesFlag(value string) bool {
+	switch strings.ToLower(value) {
+	case "yes", "y", "true", "1", "x":
+		return true
+	default:
+		return false
+	}
+}
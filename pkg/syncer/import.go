@@ -0,0 +1,415 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importCsvColumns maps the accepted csv headers to the fields of a record, including the headers of the imdb csv exports
+var importCsvColumns = map[string]string{
+	"imdb_id":     importColumnImdbId,
+	"const":       importColumnImdbId,
+	"title_type":  importColumnTitleType,
+	"title type":  importColumnTitleType,
+	"rating":      importColumnRating,
+	"your rating": importColumnRating,
+	"watched_at":  importColumnWatchedAt,
+	"rated_at":    importColumnWatchedAt,
+	"date rated":  importColumnWatchedAt,
+}
+
+const (
+	importColumnImdbId    = "imdb_id"
+	importColumnTitle     = "title"
+	importColumnYear      = "year"
+	importColumnTitleType = "title_type"
+	importColumnRating    = "rating"
+	importColumnWatchedAt = "watched_at"
+	importColumnList      = "list"
+)
+
+var importColumnNames = []string{importColumnImdbId, importColumnTitle, importColumnYear, importColumnTitleType, importColumnRating, importColumnWatchedAt, importColumnList}
+
+// importRecord is an item of an import file, identified by its imdb id, or by its title and year when the file has no imdb ids
+type importRecord struct {
+	ImdbId    string `json:"imdb_id"`
+	Title     string `json:"title,omitempty"`
+	Year      int    `json:"year,omitempty"`
+	TitleType string `json:"title_type,omitempty"`
+	Rating    *int   `json:"rating,omitempty"`
+	WatchedAt string `json:"watched_at,omitempty"`
+	List      string `json:"list,omitempty"` // the name of the trakt list the item is imported to, instead of the list name
+}
+
+// importColumns parses IMPORT_CSV_COLUMNS, which maps the fields of a record to the headers of a csv file as comma separated
+// field=header pairs, so the csv export of any service can be imported. It returns the fields keyed by their lowercase header,
+// or nil when no mapping is set and the default headers apply.
+func importColumns() (map[string]string, error) {
+	value := strings.TrimSpace(os.Getenv(EnvVarKeyImportColumns))
+	if value == "" {
+		return nil, nil
+	}
+	columns := make(map[string]string)
+	mapped := make(map[string]bool)
+	for _, pair := range strings.Split(value, ",") {
+		field, header, found := strings.Cut(pair, "=")
+		field, header = strings.ToLower(strings.TrimSpace(field)), strings.ToLower(strings.TrimSpace(header))
+		if !found || header == "" || !stringSliceContains(importColumnNames, field) {
+			return nil, fmt.Errorf("failure parsing environment variable %s: %q is not a field=header pair, where the field is one of %s", EnvVarKeyImportColumns, strings.TrimSpace(pair), strings.Join(importColumnNames, ", "))
+		}
+		columns[header] = field
+		mapped[field] = true
+	}
+	if !mapped[importColumnImdbId] && !mapped[importColumnTitle] {
+		return nil, fmt.Errorf("failure parsing environment variable %s: the %s or %s field must be mapped to a header", EnvVarKeyImportColumns, importColumnImdbId, importColumnTitle)
+	}
+	return columns, nil
+}
+
+// ImportFormat returns the format of an import file, which is either a json or csv file of imdb ids, or the export of another service,
+// whose items are imported to the targets they belong to
+func ImportFormat(path, format string) (string, error) {
+	for _, serviceFormat := range ImportServiceFormats() {
+		if strings.EqualFold(format, serviceFormat) {
+			return serviceFormat, nil
+		}
+	}
+	fileFormat, err := FileFormat(path, format)
+	if err != nil {
+		return "", fmt.Errorf("file format %s is invalid, expected %s, %s or one of %s", format, FileFormatCsv, FileFormatJson, strings.Join(ImportServiceFormats(), ", "))
+	}
+	return fileFormat, nil
+}
+
+// ImportServiceFormats returns the formats of the exports of other services, which are imported without a target
+func ImportServiceFormats() []string {
+	return []string{FileFormatDouban, FileFormatICheckMovies, FileFormatMovieLens, FileFormatNetflix, FileFormatPrimeVideo, FileFormatSerializd}
+}
+
+// ValidateImportTarget checks that items can be imported to the target, which needs a list name when it is a list,
+// unless the list of every record is read from a csv column
+func ValidateImportTarget(target, listName string) error {
+	switch target {
+	case "":
+		return fmt.Errorf("an import target is required")
+	case entities.SyncTargetHistory, entities.SyncTargetRatings, entities.SyncTargetWatchlist:
+		return nil
+	case entities.SyncTargetList:
+		columns, err := importColumns()
+		if err != nil {
+			return err
+		}
+		listColumn := false
+		for _, field := range columns {
+			listColumn = listColumn || field == importColumnList
+		}
+		if entities.BuildTraktListSlug(listName) == "" && !listColumn {
+			return fmt.Errorf("importing to a list requires a list name, or a %s column in %s", importColumnList, EnvVarKeyImportColumns)
+		}
+		return nil
+	default:
+		return fmt.Errorf("import target %s is invalid, expected one of %s, %s, %s or %s", target, entities.SyncTargetHistory, entities.SyncTargetList, entities.SyncTargetRatings, entities.SyncTargetWatchlist)
+	}
+}
+
+// Import adds the items of a json or csv file of imdb ids to the trakt watchlist, a list, ratings or history.
+// Items without an imdb id are looked up on trakt by their title and year. When importing to a list, every record
+// goes to the list it names, falling back to the list name, and lists that do not exist yet are created.
+func (s *Syncer) Import(path, format, target, listName string) error {
+	format, err := FileFormat(path, format)
+	if err != nil {
+		return err
+	}
+	if err = ValidateImportTarget(target, listName); err != nil {
+		return err
+	}
+	columns, err := importColumns()
+	if err != nil {
+		return err
+	}
+	records, err := readImportFile(path, format, columns)
+	if err != nil {
+		s.logger.Error("failure reading import file", zap.Error(err))
+		return err
+	}
+	if records, err = s.resolveImportTitles(records); err != nil {
+		s.logger.Error("failure looking up import titles on trakt", zap.Error(err))
+		return err
+	}
+	groups := map[string][]importRecord{"": records}
+	listNames := []string{""}
+	var listSlugs map[string]bool
+	if target == entities.SyncTargetList {
+		if listSlugs, err = s.traktListSlugs(); err != nil {
+			s.logger.Error("failure fetching trakt lists", zap.Error(err))
+			return err
+		}
+		groups, listNames = make(map[string][]importRecord), nil
+		for i, record := range records {
+			name := strings.TrimSpace(record.List)
+			if name == "" {
+				name = listName
+			}
+			if entities.BuildTraktListSlug(name) == "" {
+				return fmt.Errorf("record %d of %s names no list, pass a list name for the records without one", i+1, path)
+			}
+			if _, found := groups[name]; !found {
+				listNames = append(listNames, name)
+			}
+			groups[name] = append(groups[name], record)
+		}
+	}
+	plan := &entities.SyncPlan{
+		CreatedAt: time.Now(),
+	}
+	var operations []entities.SyncOperation
+	for _, name := range listNames {
+		items, err := importItems(groups[name], target)
+		if err != nil {
+			s.logger.Error("failure reading import file", zap.Error(err))
+			return err
+		}
+		operation := entities.SyncOperation{
+			Action: entities.SyncActionAdd,
+			Target: target,
+			Items:  items,
+		}
+		if target == entities.SyncTargetList {
+			operation.ListName = name
+			operation.ListSlug = entities.BuildTraktListSlug(name)
+			if !listSlugs[operation.ListSlug] {
+				createOperation := operation
+				createOperation.Action = entities.SyncActionCreate
+				createOperation.Description = fmt.Sprintf("list imported from %s by https://github.com/cecobask/imdb-trakt-sync", filepath.Base(path))
+				createOperation.Items = nil
+				plan.Operations = append(plan.Operations, createOperation)
+			}
+		}
+		plan.Operations = append(plan.Operations, operation)
+		operations = append(operations, operation)
+	}
+	if err = s.applyAndRecord(plan); err != nil {
+		s.logger.Error(fmt.Sprintf("failure importing %s", path), zap.Error(err))
+		return err
+	}
+	for _, operation := range operations {
+		s.logger.Info(fmt.Sprintf("imported %d item(s) from %s to trakt %s", len(operation.Items), path, targetLabel(operation)))
+	}
+	return nil
+}
+
+// resolveImportTitles looks up the imdb ids of the records that only have a title on trakt, leaving out those trakt knows
+// no movie or show of that exact title for. Episodes cannot be looked up by their title and are left out as well.
+func (s *Syncer) resolveImportTitles(records []importRecord) ([]importRecord, error) {
+	resolved := make([]importRecord, 0, len(records))
+	searched := make(map[string]string)
+	unmatched := 0
+	for _, record := range records {
+		if record.ImdbId != "" || strings.TrimSpace(record.Title) == "" {
+			resolved = append(resolved, record)
+			continue
+		}
+		itemType := importItemType(record.TitleType)
+		if itemType == entities.TraktItemTypeEpisode {
+			unmatched++
+			continue
+		}
+		key := fmt.Sprintf("%s/%d/%s", itemType, record.Year, strings.ToLower(strings.TrimSpace(record.Title)))
+		imdbId, found := searched[key]
+		if !found {
+			ids, err := s.traktClient.SearchTitle(itemType, strings.TrimSpace(record.Title), record.Year)
+			if err != nil {
+				return nil, fmt.Errorf("failure searching trakt for %s %s: %w", itemType, record.Title, err)
+			}
+			if ids != nil {
+				imdbId = ids.Imdb
+			}
+			searched[key] = imdbId
+		}
+		if imdbId == "" {
+			s.logger.Debug(fmt.Sprintf("skipping %s %s (%d), as trakt knows no %s of that title with an imdb id", itemType, record.Title, record.Year, itemType))
+			unmatched++
+			continue
+		}
+		record.ImdbId = imdbId
+		resolved = append(resolved, record)
+	}
+	if unmatched > 0 {
+		s.logger.Warn(fmt.Sprintf("skipped %d record(s) without an imdb id that trakt has no movie or show of the same title and year for", unmatched))
+	}
+	return resolved, nil
+}
+
+func (s *Syncer) traktListSlugs() (map[string]bool, error) {
+	lists, err := s.traktClient.ListsMetadataGet()
+	if err != nil {
+		return nil, err
+	}
+	slugs := make(map[string]bool, len(lists))
+	for _, list := range lists {
+		slugs[list.Ids.Slug] = true
+	}
+	return slugs, nil
+}
+
+// readImportFile reads the records of a json or csv file, whose headers are mapped to the fields of a record by the columns,
+// falling back to the default headers and those of the imdb csv exports
+func readImportFile(path, format string, columns map[string]string) ([]importRecord, error) {
+	if format == FileFormatJson {
+		var records []importRecord
+		if err := readJson(path, &records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the header of %s: %w", path, err)
+	}
+	if columns == nil {
+		columns = importCsvColumns
+	}
+	positions := make(map[string]int)
+	for i, name := range header {
+		if column, ok := columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))]; ok {
+			if _, duplicate := positions[column]; !duplicate {
+				positions[column] = i
+			}
+		}
+	}
+	_, hasImdbId := positions[importColumnImdbId]
+	_, hasTitle := positions[importColumnTitle]
+	if !hasImdbId && !hasTitle {
+		return nil, fmt.Errorf("failure reading %s: the header has no %s or %s column", path, importColumnImdbId, importColumnTitle)
+	}
+	field := func(row []string, column string) string {
+		if i, ok := positions[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	var records []importRecord
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure reading %s: %w", path, err)
+		}
+		record := importRecord{
+			ImdbId:    field(row, importColumnImdbId),
+			Title:     field(row, importColumnTitle),
+			TitleType: field(row, importColumnTitleType),
+			WatchedAt: field(row, importColumnWatchedAt),
+			List:      field(row, importColumnList),
+		}
+		if value := field(row, importColumnYear); value != "" {
+			year, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("failure parsing the year on line %d of %s: %w", line, path, err)
+			}
+			record.Year = year
+		}
+		if value := field(row, importColumnRating); value != "" {
+			rating, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("failure parsing the rating on line %d of %s: %w", line, path, err)
+			}
+			record.Rating = &rating
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// importItems converts the records to trakt items, keeping the last record of every imdb id
+func importItems(records []importRecord, target string) (entities.TraktItems, error) {
+	items := make(entities.TraktItems, 0, len(records))
+	positions := make(map[string]int, len(records))
+	for i, record := range records {
+		if !strings.HasPrefix(record.ImdbId, "tt") {
+			return nil, fmt.Errorf("record %d has an invalid imdb id %q", i+1, record.ImdbId)
+		}
+		spec := entities.TraktItemSpec{
+			Ids: entities.TraktIds{
+				Imdb: record.ImdbId,
+			},
+		}
+		if record.WatchedAt != "" {
+			watchedAt, err := parseImportDate(record.WatchedAt)
+			if err != nil {
+				return nil, fmt.Errorf("record %d of %s has an invalid date: %w", i+1, record.ImdbId, err)
+			}
+			spec.WatchedAt = &watchedAt
+		}
+		switch target {
+		case entities.SyncTargetRatings:
+			if record.Rating == nil || *record.Rating < 1 || *record.Rating > 10 {
+				return nil, fmt.Errorf("record %d of %s needs a rating between 1 and 10", i+1, record.ImdbId)
+			}
+			spec.Rating = record.Rating
+			spec.RatedAt, spec.WatchedAt = spec.WatchedAt, nil
+		case entities.SyncTargetList, entities.SyncTargetWatchlist:
+			spec.WatchedAt = nil
+		}
+		item := entities.TraktItem{
+			Type: importItemType(record.TitleType),
+		}
+		switch item.Type {
+		case entities.TraktItemTypeShow:
+			item.Show = spec
+		case entities.TraktItemTypeEpisode:
+			item.Episode = spec
+		default:
+			item.Movie = spec
+		}
+		if position, ok := positions[record.ImdbId]; ok {
+			items[position] = item
+			continue
+		}
+		positions[record.ImdbId] = len(items)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// importItemType returns the trakt type of a title type, which defaults to a movie
+func importItemType(titleType string) string {
+	switch strings.ToLower(strings.TrimSpace(titleType)) {
+	case "show", "tvseries", "tv series", "tvminiseries", "tv mini series":
+		return entities.TraktItemTypeShow
+	case "episode", "tvepisode", "tv episode":
+		return entities.TraktItemTypeEpisode
+	default:
+		return entities.TraktItemTypeMovie
+	}
+}
+
+// parseImportDate accepts RFC3339 timestamps and dates, which are interpreted in the local time zone
+func parseImportDate(value string) (string, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date.UTC().Format(time.RFC3339), nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("expected a date like 2006-01-02 or 2006-01-02T15:04:05Z: %w", err)
+	}
+	return date.UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,119 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileFormatLetterboxdCsv exports csv files to be imported on letterboxd by hand. Nothing is pushed to a letterboxd account,
+// as letterboxd has no public api to write to one.
+const FileFormatLetterboxdCsv = "letterboxd-csv"
+
+var letterboxdCsvHeader = []string{"imdbID", "Rating10", "WatchedDate"}
+
+// ExportFormat returns the format of an export file, which can also be letterboxd-csv, detected from its extension when format is empty
+func ExportFormat(path, format string) (string, error) {
+	if strings.EqualFold(format, FileFormatLetterboxdCsv) {
+		return FileFormatLetterboxdCsv, nil
+	}
+	if _, err := FileFormat(path, format); err != nil {
+		return "", fmt.Errorf("file format %s is invalid, expected %s, %s or %s", format, FileFormatCsv, FileFormatJson, FileFormatLetterboxdCsv)
+	}
+	return FileFormat(path, format)
+}
+
+// writeLetterboxdExport writes the rated films to path, to be imported as diary entries on letterboxd.com/import,
+// along with a file next to it for the watchlist and every list, holding the films in the order of the imdb list.
+// Letterboxd only tracks films, so shows and episodes are left out.
+func writeLetterboxdExport(path string, export entities.ImdbExport) ([]string, int, error) {
+	var (
+		paths   []string
+		skipped int
+	)
+	var ratings [][]string
+	for _, rating := range export.Ratings {
+		if rating.IsShow() || rating.Rating == nil {
+			skipped++
+			continue
+		}
+		var watchedDate string
+		if rating.RatingDate != nil {
+			watchedDate = rating.RatingDate.Local().Format("2006-01-02")
+		}
+		ratings = append(ratings, []string{rating.Id, strconv.Itoa(*rating.Rating), watchedDate})
+	}
+	if err := writeLetterboxdCsv(path, ratings); err != nil {
+		return nil, 0, err
+	}
+	paths = append(paths, path)
+	for _, list := range export.Lists {
+		var films [][]string
+		for _, item := range list.ListItems {
+			if item.IsShow() {
+				skipped++
+				continue
+			}
+			films = append(films, []string{item.Id, "", ""})
+		}
+		listPath := letterboxdListPath(path, list)
+		if err := writeLetterboxdCsv(listPath, films); err != nil {
+			return nil, 0, err
+		}
+		paths = append(paths, listPath)
+	}
+	return paths, skipped, nil
+}
+
+func (s *Syncer) exportLetterboxdCsv(path string, export entities.ImdbExport) error {
+	paths, skipped, err := writeLetterboxdExport(path, export)
+	if err != nil {
+		s.logger.Error("failure writing letterboxd export", zap.Error(err))
+		return err
+	}
+	if skipped > 0 {
+		s.logger.Info(fmt.Sprintf("left out %d show(s) and episode(s), as letterboxd only tracks films", skipped))
+	}
+	s.logger.Info(fmt.Sprintf("exported imdb ratings to %s, import them at https://letterboxd.com/import/", path))
+	for _, listPath := range paths[1:] {
+		s.logger.Info(fmt.Sprintf("exported imdb list to %s, import it into a new letterboxd list or the letterboxd watchlist", listPath))
+	}
+	return nil
+}
+
+// letterboxdListPath names the file of a list after the export file, such as letterboxd-watchlist.csv
+func letterboxdListPath(path string, list entities.ImdbList) string {
+	name := list.TraktListSlug
+	if list.IsWatchlist {
+		name = "watchlist"
+	}
+	if name == "" {
+		name = entities.BuildTraktListSlug(list.ListName)
+	}
+	if name == "" {
+		name = list.ListId
+	}
+	extension := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, extension), name, extension)
+}
+
+func writeLetterboxdCsv(path string, rows [][]string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failure creating %s: %w", path, err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	if err = writer.WriteAll(append([][]string{letterboxdCsvHeader}, rows...)); err != nil {
+		return fmt.Errorf("failure writing %s: %w", path, err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failure writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"sort"
+	"strings"
+)
+
+// parseListMerges parses mappings in the format `name:ls1,ls2;other name:ls3,ls4`
+func parseListMerges(value string) (map[string][]string, error) {
+	merges := make(map[string][]string)
+	for _, mapping := range strings.Split(value, ";") {
+		if strings.TrimSpace(mapping) == "" {
+			continue
+		}
+		pieces := strings.SplitN(mapping, ":", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("failure parsing list merge %s: expected format is name:ls1,ls2", mapping)
+		}
+		name := strings.TrimSpace(pieces[0])
+		if name == "" {
+			return nil, fmt.Errorf("failure parsing list merge %s: trakt list name is empty", mapping)
+		}
+		var listIds []string
+		for _, listId := range strings.Split(pieces[1], ",") {
+			if listId = strings.TrimSpace(listId); listId != "" {
+				listIds = append(listIds, listId)
+			}
+		}
+		if len(listIds) == 0 {
+			return nil, fmt.Errorf("failure parsing list merge %s: no imdb list ids provided", mapping)
+		}
+		merges[name] = append(merges[name], listIds...)
+	}
+	return merges, nil
+}
+
+// mergeImdbLists replaces the imdb lists that are part of a merge with a single deduplicated list per merge
+func mergeImdbLists(imdbLists []entities.ImdbList, merges map[string][]string) []entities.ImdbList {
+	if len(merges) == 0 {
+		return imdbLists
+	}
+	listsById := make(map[string]entities.ImdbList, len(imdbLists))
+	for i := range imdbLists {
+		listsById[imdbLists[i].ListId] = imdbLists[i]
+	}
+	mergedListIds := make(map[string]bool)
+	result := make([]entities.ImdbList, 0, len(imdbLists))
+	for name, listIds := range merges {
+		slug := entities.BuildTraktListSlug(name)
+		merged := entities.ImdbList{
+			ListId:        slug,
+			ListName:      name,
+			TraktListSlug: slug,
+		}
+		seen := make(map[string]bool)
+		for _, listId := range listIds {
+			mergedListIds[listId] = true
+			list, found := listsById[listId]
+			if !found {
+				continue
+			}
+			for _, item := range list.ListItems {
+				if seen[item.Id] {
+					continue
+				}
+				seen[item.Id] = true
+				merged.ListItems = append(merged.ListItems, item)
+			}
+		}
+		result = append(result, merged)
+	}
+	for i := range imdbLists {
+		if !mergedListIds[imdbLists[i].ListId] {
+			result = append(result, imdbLists[i])
+		}
+	}
+	return result
+}
+
+// withoutIncompleteMerges drops the merged lists that are missing items because one of their imdb lists failed to load,
+// returning the names of the dropped lists
+func withoutIncompleteMerges(imdbLists []entities.ImdbList, merges map[string][]string, failedListIds []string) ([]entities.ImdbList, []string) {
+	incomplete := make(map[string]bool)
+	var names []string
+	for name, listIds := range merges {
+		for _, listId := range listIds {
+			if stringSliceContains(failedListIds, listId) {
+				incomplete[entities.BuildTraktListSlug(name)] = true
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	if len(incomplete) == 0 {
+		return imdbLists, nil
+	}
+	result := make([]entities.ImdbList, 0, len(imdbLists))
+	for _, list := range imdbLists {
+		if !incomplete[list.ListId] {
+			result = append(result, list)
+		}
+	}
+	sort.Strings(names)
+	return result, names
+}
+
+// splitImdbLists replaces every imdb list with up to two lists, one containing its movies and another containing its shows
+func splitImdbLists(imdbLists []entities.ImdbList) []entities.ImdbList {
+	result := make([]entities.ImdbList, 0, len(imdbLists)*2)
+	for _, list := range imdbLists {
+		movies := entities.ImdbList{
+			ListId:   list.ListId + "-movies",
+			ListName: fmt.Sprintf("%s (movies)", list.ListName),
+			Ranked:   list.Ranked,
+		}
+		shows := entities.ImdbList{
+			ListId:   list.ListId + "-shows",
+			ListName: fmt.Sprintf("%s (shows)", list.ListName),
+			Ranked:   list.Ranked,
+		}
+		for _, item := range list.ListItems {
+			if item.IsShow() {
+				shows.ListItems = append(shows.ListItems, item)
+				continue
+			}
+			movies.ListItems = append(movies.ListItems, item)
+		}
+		for _, split := range []entities.ImdbList{movies, shows} {
+			if len(split.ListItems) == 0 {
+				continue
+			}
+			split.TraktListSlug = entities.BuildTraktListSlug(split.ListName)
+			result = append(result, split)
+		}
+	}
+	return result
+}
+
+// buildRatingsList creates a virtual imdb list containing every rated item, ordered by rating
+func buildRatingsList(name string, imdbRatings map[string]entities.ImdbItem) entities.ImdbList {
+	slug := entities.BuildTraktListSlug(name)
+	list := entities.ImdbList{
+		ListId:        slug,
+		ListName:      name,
+		TraktListSlug: slug,
+		TraktSortBy:   entities.TraktListSortByMyRating,
+		TraktSortHow:  entities.TraktListSortHowDesc,
+		ListItems:     make([]entities.ImdbItem, 0, len(imdbRatings)),
+	}
+	for _, rating := range imdbRatings {
+		list.ListItems = append(list.ListItems, rating)
+	}
+	sort.SliceStable(list.ListItems, func(i, j int) bool {
+		if *list.ListItems[i].Rating != *list.ListItems[j].Rating {
+			return *list.ListItems[i].Rating > *list.ListItems[j].Rating
+		}
+		return list.ListItems[i].Id < list.ListItems[j].Id
+	})
+	for i := range list.ListItems {
+		// list items must not carry ratings, otherwise they would be considered outdated on every run
+		list.ListItems[i].Rating = nil
+		list.ListItems[i].RatingDate = nil
+	}
+	return list
+}
+
+// reorderRank builds the rank of a trakt list matching the order of the given items.
+// Items only present in trakt keep their relative order and are moved to the end of the list.
+func reorderRank(items entities.TraktItems, traktList *entities.TraktList) []int64 {
+	listItems := make(entities.TraktItems, len(traktList.ListItems))
+	copy(listItems, traktList.ListItems)
+	sort.SliceStable(listItems, func(i, j int) bool {
+		return listItems[i].Rank < listItems[j].Rank
+	})
+	listItemIds := make(map[string]int64, len(listItems))
+	for _, item := range listItems {
+		if id, err := item.GetItemId(); err == nil && id != nil {
+			listItemIds[item.Type+*id] = item.Id
+		}
+	}
+	rank := make([]int64, 0, len(listItems))
+	ranked := make(map[int64]bool, len(listItems))
+	for _, item := range items {
+		id, err := item.GetItemId()
+		if err != nil || id == nil {
+			continue
+		}
+		if listItemId, found := listItemIds[item.Type+*id]; found && !ranked[listItemId] {
+			rank = append(rank, listItemId)
+			ranked[listItemId] = true
+		}
+	}
+	for _, item := range listItems {
+		if !ranked[item.Id] {
+			rank = append(rank, item.Id)
+		}
+	}
+	return rank
+}
@@ -0,0 +1,53 @@
+package syncer
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+const runLockFile = "sync.lock"
+
+// Jitter returns a random delay of up to SYNC_JITTER, which spreads scheduled syncs of many users away from the full hour
+func Jitter() time.Duration {
+	jitter, err := time.ParseDuration(os.Getenv(EnvVarKeySyncJitter))
+	if err != nil || jitter <= 0 {
+		return 0
+	}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return time.Duration(random.Int63n(int64(jitter)))
+}
+
+// acquireRunLock locks the lock file of the active profile, so overlapping runs do not apply the same changes twice
+// or overwrite each other's state files. It reports false when another running process holds the lock.
+// The lock is held by the operating system rather than by the existence of the file, so it is released when its process
+// exits, even after a crash, and the file is left in place, as removing it would let two runs lock different files.
+func acquireRunLock() (release func(), acquired bool, err error) {
+	path := StatePath(runLockFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, fmt.Errorf("failure opening run lock %s: %w", path, err)
+	}
+	locked, err := lockFile(file)
+	if err != nil || !locked {
+		_ = file.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("failure locking run lock %s: %w", path, err)
+		}
+		return nil, false, nil
+	}
+	// the pid only tells which process holds the lock
+	if err = file.Truncate(0); err == nil {
+		_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+	}
+	if err != nil {
+		_ = unlockFile(file)
+		_ = file.Close()
+		return nil, false, fmt.Errorf("failure writing run lock %s: %w", path, err)
+	}
+	return func() {
+		_ = unlockFile(file)
+		_ = file.Close()
+	}, true, nil
+}
@@ -0,0 +1,410 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stepEmby     = "emby"
+	stepJellyfin = "jellyfin"
+	stepKodi     = "kodi"
+	stepPlex     = "plex"
+	stepStremio  = "stremio"
+
+	defaultFavoriteRating = 8
+)
+
+// mediaServer is a media server whose watched items and ratings are reconciled with trakt,
+// and which is updated with the state of trakt when it is a target
+type mediaServer struct {
+	name   string
+	client client.MediaServerClientInterface
+	target bool
+	items  []entities.MediaServerItem
+}
+
+// plexEnabled reports whether the watched history and ratings of a plex server are synced, which takes both its url and a token
+func plexEnabled(secrets map[string]string) bool {
+	return strings.TrimSpace(os.Getenv(EnvVarKeyPlexUrl)) != "" && secrets[EnvVarKeyPlexToken] != ""
+}
+
+// jellyfinEnabled reports whether the played status and favorites of a jellyfin server are synced, which takes both its url and an api key
+func jellyfinEnabled(secrets map[string]string) bool {
+	return strings.TrimSpace(os.Getenv(EnvVarKeyJellyfinUrl)) != "" && secrets[EnvVarKeyJellyfinApiKey] != ""
+}
+
+// embyEnabled reports whether the played status and favorites of an emby server are synced, which takes both its url and an api key
+func embyEnabled(secrets map[string]string) bool {
+	return strings.TrimSpace(os.Getenv(EnvVarKeyEmbyUrl)) != "" && secrets[EnvVarKeyEmbyApiKey] != ""
+}
+
+// kodiEnabled reports whether the watched status and ratings of a kodi library are synced, which are read either through
+// the json-rpc api of its web server or from an export of the library
+func kodiEnabled() bool {
+	return strings.TrimSpace(os.Getenv(EnvVarKeyKodiUrl)) != "" || strings.TrimSpace(os.Getenv(EnvVarKeyKodiLibraryPath)) != ""
+}
+
+// stremioEnabled reports whether the library of a stremio account is synced, which takes either an auth key or an email and password
+func stremioEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeyStremioAuthKey] != "" || (strings.TrimSpace(os.Getenv(EnvVarKeyStremioEmail)) != "" && secrets[EnvVarKeyStremioPassword] != "")
+}
+
+// favoriteRating returns the rating from which an item is a jellyfin or emby favorite, where 0 leaves the favorites alone
+func favoriteRating(key string) (int, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultFavoriteRating, nil
+	}
+	rating, err := strconv.Atoi(value)
+	if err != nil || rating < 0 || rating > 10 {
+		return 0, fmt.Errorf("failure parsing environment variable %s: must be a rating between 1 and 10, or 0 to leave the favorites alone", key)
+	}
+	return rating, nil
+}
+
+// mediaServerUrlProblem reports a setting that is not the http or https url of a media server
+func mediaServerUrlProblem(key, name, example string) error {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil
+	}
+	if serverUrl, err := url.Parse(value); err != nil || (serverUrl.Scheme != "http" && serverUrl.Scheme != "https") || serverUrl.Host == "" {
+		return fmt.Errorf("failure parsing environment variable %s: must be the http or https url of a %s server, such as %s", key, name, example)
+	}
+	return nil
+}
+
+func mediaServerSyncModeOverrides() map[string]string {
+	return map[string]string{
+		entities.SyncTargetHistory: os.Getenv(EnvVarKeySyncModeHistory),
+		entities.SyncTargetRatings: os.Getenv(EnvVarKeySyncModeRatings),
+	}
+}
+
+// newMediaServers creates a client for each media server that is set up
+func newMediaServers(secrets map[string]string, logger *zap.Logger) ([]*mediaServer, error) {
+	var servers []*mediaServer
+	if plexEnabled(secrets) {
+		plexClient, err := client.NewPlexClient(
+			client.PlexConfig{
+				Url:               strings.TrimSpace(os.Getenv(EnvVarKeyPlexUrl)),
+				Token:             secrets[EnvVarKeyPlexToken],
+				SyncMode:          os.Getenv(EnvVarKeySyncMode),
+				SyncModeOverrides: mediaServerSyncModeOverrides(),
+			},
+			logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+		target, _ := strconv.ParseBool(os.Getenv(EnvVarKeyPlexTarget))
+		servers = append(servers, &mediaServer{
+			name:   stepPlex,
+			client: plexClient,
+			target: target,
+		})
+	}
+	if jellyfinEnabled(secrets) {
+		server, err := newJellyfinServer(stepJellyfin, client.NewJellyfinClient, secrets[EnvVarKeyJellyfinApiKey], EnvVarKeyJellyfinUrl, EnvVarKeyJellyfinUser, EnvVarKeyJellyfinFavorite, EnvVarKeyJellyfinTarget, logger)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	if embyEnabled(secrets) {
+		server, err := newJellyfinServer(stepEmby, client.NewEmbyClient, secrets[EnvVarKeyEmbyApiKey], EnvVarKeyEmbyUrl, EnvVarKeyEmbyUser, EnvVarKeyEmbyFavorite, EnvVarKeyEmbyTarget, logger)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	if kodiEnabled() {
+		kodiClient, err := client.NewKodiClient(
+			client.KodiConfig{
+				Url:         strings.TrimSpace(os.Getenv(EnvVarKeyKodiUrl)),
+				Username:    os.Getenv(EnvVarKeyKodiUsername),
+				Password:    secrets[EnvVarKeyKodiPassword],
+				LibraryPath: strings.TrimSpace(os.Getenv(EnvVarKeyKodiLibraryPath)),
+			},
+			logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+		// kodi is only a source, as its library export cannot be written back
+		servers = append(servers, &mediaServer{
+			name:   stepKodi,
+			client: kodiClient,
+		})
+	}
+	if stremioEnabled(secrets) {
+		stremioClient, err := client.NewStremioClient(
+			client.StremioConfig{
+				AuthKey:  secrets[EnvVarKeyStremioAuthKey],
+				Email:    strings.TrimSpace(os.Getenv(EnvVarKeyStremioEmail)),
+				Password: secrets[EnvVarKeyStremioPassword],
+			},
+			logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+		// stremio is only a source, as its library keeps its own watch progress
+		servers = append(servers, &mediaServer{
+			name:   stepStremio,
+			client: stremioClient,
+		})
+	}
+	return servers, nil
+}
+
+// newJellyfinServer creates a jellyfin or emby server, which share their api and settings besides the prefix of the latter
+func newJellyfinServer(name string, newClient func(client.JellyfinConfig, *zap.Logger) (client.MediaServerClientInterface, error), apiKey, urlKey, userKey, favoriteKey, targetKey string, logger *zap.Logger) (*mediaServer, error) {
+	rating, err := favoriteRating(favoriteKey)
+	if err != nil {
+		return nil, err
+	}
+	serverClient, err := newClient(
+		client.JellyfinConfig{
+			Url:               strings.TrimSpace(os.Getenv(urlKey)),
+			ApiKey:            apiKey,
+			User:              strings.TrimSpace(os.Getenv(userKey)),
+			FavoriteRating:    rating,
+			SyncMode:          os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: mediaServerSyncModeOverrides(),
+		},
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	target, _ := strconv.ParseBool(os.Getenv(targetKey))
+	return &mediaServer{
+		name:   name,
+		client: serverClient,
+		target: target,
+	}, nil
+}
+
+// hydrateMediaServers reads the items of the media server libraries. Ratings are added to those of the source,
+// which takes precedence when both rated an item, as does the first server to rate it, while watched items are kept
+// to reconcile the trakt history with. Planned items are added to the watchlist of the source.
+func (s *Syncer) hydrateMediaServers() error {
+	watchlistId := ""
+	for id, list := range s.user.imdbLists {
+		if list.IsWatchlist || (s.watchlistTargetList != "" && list.ListName == s.watchlistTargetList) {
+			watchlistId = id
+		}
+	}
+	for _, server := range s.mediaServers {
+		start := time.Now()
+		items, err := server.client.LibraryGet()
+		if err != nil {
+			return fmt.Errorf("failure fetching %s library: %w", server.name, err)
+		}
+		server.items = items
+		watched, rated := 0, 0
+		for i := range items {
+			item := items[i]
+			if item.Watched {
+				watched++
+			}
+			if item.Rating == nil || !s.ratingsNeeded() {
+				continue
+			}
+			if _, found := s.user.imdbRatings[item.ImdbId]; !found {
+				s.user.imdbRatings[item.ImdbId] = item.ImdbItem()
+				rated++
+			}
+		}
+		s.logger.Info(fmt.Sprintf("found %d watched item(s) and %d rating(s) missing from the source in the %s libraries", watched, rated, server.name))
+		if planned := s.addPlannedItems(watchlistId, items); planned > 0 {
+			s.logger.Info(fmt.Sprintf("found %d planned item(s) missing from the source watchlist in the %s libraries", planned, server.name))
+		}
+		s.timings.record(PhaseHydrate, server.name, start)
+	}
+	return nil
+}
+
+// addPlannedItems adds the planned items of a media server to the watchlist of the source, unless the watchlist is not synced,
+// and returns how many were missing from it
+func (s *Syncer) addPlannedItems(watchlistId string, items []entities.MediaServerItem) int {
+	watchlist, found := s.user.imdbLists[watchlistId]
+	if !found {
+		return 0
+	}
+	known := make(map[string]bool, len(watchlist.ListItems))
+	for _, item := range watchlist.ListItems {
+		known[item.Id] = true
+	}
+	added := 0
+	for i := range items {
+		if !items[i].Planned || known[items[i].ImdbId] {
+			continue
+		}
+		known[items[i].ImdbId] = true
+		watchlist.ListItems = append(watchlist.ListItems, entities.ImdbItem{
+			Id:        items[i].ImdbId,
+			TitleType: items[i].ImdbItem().TitleType,
+		})
+		added++
+	}
+	s.user.imdbLists[watchlistId] = watchlist
+	return added
+}
+
+// planMediaServerHistory adds the items watched on the media servers to the trakt history when trakt has no history for them,
+// skipping the items already planned to be added from the ratings. Media servers only report when an item was last watched,
+// if at all, so a single entry is added per item, and nothing is ever removed from the history.
+func (s *Syncer) planMediaServerHistory(planned []entities.SyncOperation) ([]entities.SyncOperation, error) {
+	libraryItems := 0
+	for _, server := range s.mediaServers {
+		libraryItems += len(server.items)
+	}
+	if s.skipHistory || libraryItems == 0 {
+		return nil, nil
+	}
+	skipped := make(map[string]bool)
+	for _, operation := range planned {
+		if operation.Target != entities.SyncTargetHistory || operation.Action != entities.SyncActionAdd {
+			continue
+		}
+		for i := range operation.Items {
+			if id, err := operation.Items[i].GetItemId(); err == nil && id != nil {
+				skipped[*id] = true
+			}
+		}
+	}
+	knownItemIds, err := s.knownHistoryItemIds()
+	if err != nil {
+		return nil, err
+	}
+	// the watched movies take a single request, saving a history lookup for each of them
+	watched, err := s.traktClient.WatchedGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching trakt watched items: %w", err)
+	}
+	for i := range watched {
+		if watched[i].Type != entities.TraktItemTypeMovie {
+			continue
+		}
+		if id, err := watched[i].GetItemId(); err == nil && id != nil {
+			skipped[*id] = true
+		}
+	}
+	var historyToAdd entities.TraktItems
+	for _, server := range s.mediaServers {
+		for _, item := range server.items {
+			if !item.Watched || skipped[item.ImdbId] || knownItemIds[item.ImdbId] || !s.ratedWithinHistoryWindow(item.ViewedAt) {
+				continue
+			}
+			skipped[item.ImdbId] = true
+			historyItem := item.HistoryItem()
+			history, err := s.traktClient.HistoryGet(historyItem.Type, item.ImdbId)
+			if err != nil {
+				return nil, fmt.Errorf("failure fetching trakt history for %s %s: %w", historyItem.Type, item.ImdbId, err)
+			}
+			if len(history) > 0 {
+				continue
+			}
+			historyToAdd = append(historyToAdd, historyItem)
+		}
+	}
+	if len(historyToAdd) == 0 {
+		return nil, nil
+	}
+	return []entities.SyncOperation{
+		{
+			Action: entities.SyncActionAdd,
+			Target: entities.SyncTargetHistory,
+			Items:  historyToAdd,
+		},
+	}, nil
+}
+
+// updateMediaServers marks the items of the target media servers watched on trakt or rated in the source as watched,
+// and sets their ratings to those of the source, so the libraries reflect the same state as trakt. Shows are never marked
+// as watched, as the servers would mark all of their episodes, and nothing is ever marked as unwatched. Servers without
+// ratings, such as jellyfin and emby, stand in favorites for them, which are removed from items rated below the favorite
+// rating when the sync mode allows removals. It returns the names of the servers that failed.
+func (s *Syncer) updateMediaServers() []string {
+	var targets []*mediaServer
+	for _, server := range s.mediaServers {
+		if server.target {
+			targets = append(targets, server)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	watchedIds := make(map[string]bool)
+	if !s.skipHistory {
+		watched, err := s.traktClient.WatchedGet()
+		if err != nil {
+			s.logger.Error("failure fetching trakt watched items to mark as watched on the media servers", zap.Error(err))
+			failed := make([]string, 0, len(targets))
+			for _, server := range targets {
+				failed = append(failed, server.name)
+			}
+			return failed
+		}
+		for i := range watched {
+			if id, err := watched[i].GetItemId(); err == nil && id != nil && watched[i].Type == entities.TraktItemTypeMovie {
+				watchedIds[*id] = true
+			}
+		}
+		// an item rated in the source counts as watched, as it does when the trakt history is synced
+		for id := range s.user.imdbRatings {
+			watchedIds[id] = true
+		}
+	}
+	var failed []string
+	for _, server := range targets {
+		if err := s.updateMediaServer(server, watchedIds); err != nil {
+			s.logger.Error(fmt.Sprintf("failure updating %s", server.name), zap.Error(err))
+			failed = append(failed, server.name)
+		}
+	}
+	return failed
+}
+
+func (s *Syncer) updateMediaServer(server *mediaServer, watchedIds map[string]bool) error {
+	start := time.Now()
+	defer s.timings.record(PhaseApply, server.name, start)
+	var toWatch, toRate []entities.MediaServerItem
+	for _, item := range server.items {
+		if !item.Watched && item.Type != entities.MediaServerItemTypeShow && watchedIds[item.ImdbId] {
+			toWatch = append(toWatch, item)
+		}
+		if !s.syncRatings {
+			continue
+		}
+		if rating, found := s.user.imdbRatings[item.ImdbId]; found && rating.Rating != nil {
+			if item.Rating == nil || int(math.Max(1, math.Round(*item.Rating))) != *rating.Rating {
+				value := float64(*rating.Rating)
+				item.Rating = &value
+				toRate = append(toRate, item)
+			}
+		}
+	}
+	if len(toWatch) > 0 {
+		if err := server.client.ItemsMarkWatched(toWatch); err != nil {
+			return fmt.Errorf("failure marking %s items as watched: %w", server.name, err)
+		}
+	}
+	if len(toRate) > 0 {
+		if err := server.client.ItemsRate(toRate); err != nil {
+			return fmt.Errorf("failure rating %s items: %w", server.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileFormatMovieLens reads the ratings of a movielens export, or of the ratings.csv of a movielens dataset along with its links.csv
+const FileFormatMovieLens = "movielens"
+
+const (
+	defaultMovieLensLinksPath = "links.csv"
+
+	movieLensColumnMovieId   = "movie_id"
+	movieLensColumnImdbId    = "imdb_id"
+	movieLensColumnTmdbId    = "tmdb_id"
+	movieLensColumnRating    = "rating"
+	movieLensColumnTimestamp = "timestamp"
+	movieLensColumnUserId    = "user_id"
+	movieLensColumnTitle     = "title"
+)
+
+// movieLensCsvColumns maps the headers of the movielens exports and datasets to the fields of a rating
+var movieLensCsvColumns = map[string]string{
+	"movie_id":  movieLensColumnMovieId,
+	"movieid":   movieLensColumnMovieId,
+	"imdb_id":   movieLensColumnImdbId,
+	"imdbid":    movieLensColumnImdbId,
+	"tmdb_id":   movieLensColumnTmdbId,
+	"tmdbid":    movieLensColumnTmdbId,
+	"rating":    movieLensColumnRating,
+	"timestamp": movieLensColumnTimestamp,
+	"userid":    movieLensColumnUserId,
+	"user_id":   movieLensColumnUserId,
+	"title":     movieLensColumnTitle,
+}
+
+// movieLensRating is a rating of a movielens movie, whose imdb and tmdb ids are set by the export or by the links file
+type movieLensRating struct {
+	MovieId string
+	ImdbId  string
+	TmdbId  int
+	Title   string
+	Rating  int // out of 10, converted from the half stars of movielens
+	RatedAt string
+}
+
+// ImportMovieLens adds the ratings of a movielens export to the trakt ratings, converting the half stars of movielens to the
+// 10 points of trakt. Exports of the movielens website carry the imdb and tmdb id of every movie, while the ratings.csv of a
+// movielens dataset identifies movies by the movielens id alone, which the links.csv of the dataset maps to their imdb and tmdb ids.
+// The links file is read from the given path, or from the directory of the ratings, and movies are looked up on trakt
+// by their tmdb id when they have no imdb id.
+func (s *Syncer) ImportMovieLens(path, linksPath string) error {
+	ratings, err := readMovieLensFile(path)
+	if err != nil {
+		s.logger.Error("failure reading movielens export", zap.Error(err))
+		return err
+	}
+	if linksPath == "" {
+		if candidate := filepath.Join(filepath.Dir(path), defaultMovieLensLinksPath); candidate != path {
+			if _, err = os.Stat(candidate); err == nil {
+				linksPath = candidate
+			}
+		}
+	}
+	if linksPath != "" {
+		if err = linkMovieLensRatings(ratings, linksPath); err != nil {
+			s.logger.Error("failure reading movielens links", zap.Error(err))
+			return err
+		}
+	}
+	records := make([]importRecord, 0, len(ratings))
+	searched := make(map[int]string)
+	unmatched := 0
+	for _, rating := range ratings {
+		imdbId := rating.ImdbId
+		if imdbId == "" && rating.TmdbId > 0 {
+			var found bool
+			if imdbId, found = searched[rating.TmdbId]; !found {
+				ids, err := s.traktClient.SearchTmdbId(entities.TraktItemTypeMovie, rating.TmdbId)
+				if err != nil {
+					s.logger.Error("failure looking up movielens movies on trakt", zap.Error(err))
+					return fmt.Errorf("failure searching trakt for tmdb movie %d: %w", rating.TmdbId, err)
+				}
+				if ids != nil {
+					imdbId = ids.Imdb
+				}
+				searched[rating.TmdbId] = imdbId
+			}
+		}
+		if imdbId == "" {
+			s.logger.Debug(fmt.Sprintf("skipping movielens movie %s %s, as it has no imdb id", rating.MovieId, rating.Title))
+			unmatched++
+			continue
+		}
+		score := rating.Rating
+		records = append(records, importRecord{
+			ImdbId:    imdbId,
+			TitleType: entities.TraktItemTypeMovie,
+			Rating:    &score,
+			WatchedAt: rating.RatedAt,
+		})
+	}
+	if unmatched > 0 {
+		s.logger.Warn(fmt.Sprintf("skipped %d movielens rating(s) of movies without an imdb or tmdb id, pass the links.csv of the dataset to match them", unmatched))
+	}
+	if len(records) == 0 {
+		s.logger.Info(fmt.Sprintf("found no movielens ratings to import in %s", path))
+		return nil
+	}
+	items, err := importItems(records, entities.SyncTargetRatings)
+	if err != nil {
+		s.logger.Error("failure reading movielens export", zap.Error(err))
+		return err
+	}
+	plan := &entities.SyncPlan{
+		CreatedAt: time.Now(),
+		Operations: []entities.SyncOperation{
+			{
+				Action: entities.SyncActionAdd,
+				Target: entities.SyncTargetRatings,
+				Items:  items,
+			},
+		},
+	}
+	if err = s.applyAndRecord(plan); err != nil {
+		s.logger.Error(fmt.Sprintf("failure importing %s", path), zap.Error(err))
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("imported %d rating(s) from %s to trakt", len(items), path))
+	return nil
+}
+
+// readMovieLensFile reads the ratings of a movielens csv file, which must belong to a single user when it is a dataset
+func readMovieLensFile(path string) ([]movieLensRating, error) {
+	rows, err := readMovieLensCsv(path, movieLensColumnMovieId, movieLensColumnImdbId, movieLensColumnTmdbId)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]bool)
+	ratings := make([]movieLensRating, 0, len(rows))
+	for i, row := range rows {
+		if user := row[movieLensColumnUserId]; user != "" {
+			users[user] = true
+		}
+		stars, err := strconv.ParseFloat(row[movieLensColumnRating], 64)
+		if err != nil || stars < 0.5 || stars > 5 {
+			return nil, fmt.Errorf("failure parsing the rating on line %d of %s: expected half stars from 0.5 to 5, got %q", i+2, path, row[movieLensColumnRating])
+		}
+		rating := movieLensRating{
+			MovieId: row[movieLensColumnMovieId],
+			ImdbId:  movieLensImdbId(row[movieLensColumnImdbId]),
+			Title:   row[movieLensColumnTitle],
+			Rating:  int(math.Round(stars * 2)),
+		}
+		rating.TmdbId, _ = strconv.Atoi(row[movieLensColumnTmdbId])
+		if seconds, err := strconv.ParseInt(row[movieLensColumnTimestamp], 10, 64); err == nil && seconds > 0 {
+			rating.RatedAt = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+		}
+		ratings = append(ratings, rating)
+	}
+	if len(users) > 1 {
+		return nil, fmt.Errorf("failure reading %s: it holds the ratings of %d users, keep only the rows of your own user id", path, len(users))
+	}
+	return ratings, nil
+}
+
+// linkMovieLensRatings sets the imdb and tmdb ids of the ratings from the links.csv of a movielens dataset
+func linkMovieLensRatings(ratings []movieLensRating, path string) error {
+	rows, err := readMovieLensCsv(path, movieLensColumnMovieId)
+	if err != nil {
+		return err
+	}
+	links := make(map[string]map[string]string, len(rows))
+	for _, row := range rows {
+		if movieId := row[movieLensColumnMovieId]; movieId != "" {
+			links[movieId] = row
+		}
+	}
+	for i := range ratings {
+		link, found := links[ratings[i].MovieId]
+		if !found {
+			continue
+		}
+		if ratings[i].ImdbId == "" {
+			ratings[i].ImdbId = movieLensImdbId(link[movieLensColumnImdbId])
+		}
+		if ratings[i].TmdbId == 0 {
+			ratings[i].TmdbId, _ = strconv.Atoi(link[movieLensColumnTmdbId])
+		}
+	}
+	return nil
+}
+
+// readMovieLensCsv reads the rows of a movielens csv file, keyed by the fields their columns are mapped to,
+// which must include one of the identifying fields
+func readMovieLensCsv(path string, identifying ...string) ([]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the header of %s: %w", path, err)
+	}
+	columns := make(map[int]string)
+	for i, name := range header {
+		if column, ok := movieLensCsvColumns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))]; ok {
+			columns[i] = column
+		}
+	}
+	identified := false
+	for _, column := range columns {
+		identified = identified || stringSliceContains(identifying, column)
+	}
+	if !identified {
+		return nil, fmt.Errorf("failure reading %s: the header has no %s column", path, strings.Join(identifying, " or "))
+	}
+	var rows []map[string]string
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure reading %s: %w", path, err)
+		}
+		fields := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(row) {
+				fields[column] = strings.TrimSpace(row[i])
+			}
+		}
+		rows = append(rows, fields)
+	}
+	return rows, nil
+}
+
+// movieLensImdbId returns the imdb id of a movielens id, which the datasets write as a number without the tt prefix
+func movieLensImdbId(value string) string {
+	if strings.HasPrefix(value, "tt") {
+		return value
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("tt%07d", number)
+}
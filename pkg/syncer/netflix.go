@@ -0,0 +1,399 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FileFormatNetflix reads the viewing history of netflix, either the ViewingActivity.csv of a personal data request
+// or the NetflixViewingHistory.csv downloaded from the viewing activity of a profile
+const FileFormatNetflix = "netflix"
+
+const (
+	netflixColumnProfile      = "profile"
+	netflixColumnStartTime    = "start_time"
+	netflixColumnDuration     = "duration"
+	netflixColumnTitle        = "title"
+	netflixColumnSupplemental = "supplemental"
+	netflixColumnDate         = "date"
+
+	// netflixMinDuration leaves out the views the viewing activity records when a title is only browsed or sampled
+	netflixMinDuration = 5 * time.Minute
+)
+
+// netflixCsvColumns maps the headers of both netflix exports to the fields of a view
+var netflixCsvColumns = map[string]string{
+	"profile name":            netflixColumnProfile,
+	"start time":              netflixColumnStartTime,
+	"duration":                netflixColumnDuration,
+	"title":                   netflixColumnTitle,
+	"supplemental video type": netflixColumnSupplemental,
+	"date":                    netflixColumnDate,
+}
+
+// netflixSeasonPattern matches the part of an episode title naming its season, which is 1 for limited series
+var netflixSeasonPattern = regexp.MustCompile(`(?i)^(?:(?:season|series|part|volume|book|chapter|collection)\s+(\d+)|limited series|miniseries|mini-series)$`)
+
+// netflixView is a title watched on netflix, parsed into the show, season and episode title of an episode
+type netflixView struct {
+	Title        string
+	WatchedAt    time.Time
+	Show         string
+	Season       int // 0 when the title names no season
+	EpisodeTitle string
+}
+
+// parseNetflixTitle splits a netflix title like "Show: Season 1: Episode" into the show, season and episode title.
+// Titles without a season part are split on their first colon as well, as they may be a movie with a subtitle
+// or the episode of a show of a single season, which is told apart when they are looked up.
+func parseNetflixTitle(view *netflixView) {
+	parts := strings.Split(view.Title, ": ")
+	if len(parts) < 2 {
+		return
+	}
+	show, seasonPart := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if match := netflixSeasonPattern.FindStringSubmatch(seasonPart); match != nil && len(parts) >= 3 {
+		view.Season = 1
+		if match[1] != "" {
+			view.Season, _ = strconv.Atoi(match[1])
+		}
+		view.Show, view.EpisodeTitle = show, strings.TrimSpace(strings.Join(parts[2:], ": "))
+		return
+	}
+	// netflix names some seasons after the show, like "Show: Show 4: Episode"
+	if number, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(seasonPart, show))); err == nil && strings.HasPrefix(seasonPart, show) && len(parts) >= 3 {
+		view.Season = number
+		view.Show, view.EpisodeTitle = show, strings.TrimSpace(strings.Join(parts[2:], ": "))
+		return
+	}
+	view.Show, view.EpisodeTitle = strings.TrimSpace(parts[0]), strings.TrimSpace(strings.Join(parts[1:], ": "))
+}
+
+// ImportNetflix adds the titles of a netflix viewing history to the trakt history, at the time they were first watched.
+// Movies are looked up on trakt by their title, and episodes by the title of their show, then matched to the episode of the same
+// title, in the season the history names when it names one. Trailers and views shorter than 5 minutes are left out, and the
+// titles trakt cannot match are reported. A viewing activity holding several profiles is read for the profile name alone.
+func (s *Syncer) ImportNetflix(path, profile string) error {
+	views, err := readNetflixFile(path, profile)
+	if err != nil {
+		s.logger.Error("failure reading netflix viewing history", zap.Error(err))
+		return err
+	}
+	matcher := newNetflixMatcher(s)
+	movies := make(map[string]string)
+	shows := make(map[string]*entities.TraktItemSpec)
+	var showIds, unresolved []string
+	for _, view := range views {
+		watchedAt := view.WatchedAt.UTC().Format(time.RFC3339)
+		match, err := matcher.match(view)
+		if err != nil {
+			s.logger.Error("failure looking up netflix titles on trakt", zap.Error(err))
+			return err
+		}
+		switch {
+		case match == nil:
+			unresolved = append(unresolved, view.Title)
+		case match.episode == nil:
+			if _, found := movies[match.imdbId]; !found {
+				movies[match.imdbId] = watchedAt
+			}
+		default:
+			show, found := shows[match.imdbId]
+			if !found {
+				show = &entities.TraktItemSpec{Ids: entities.TraktIds{Imdb: match.imdbId}}
+				shows[match.imdbId] = show
+				showIds = append(showIds, match.imdbId)
+			}
+			watchedEpisode := episode(season(show, match.episode.Season), match.episode.Number)
+			if watchedEpisode.WatchedAt == nil {
+				watchedEpisode.WatchedAt = &watchedAt
+			}
+		}
+	}
+	items := make(entities.TraktItems, 0, len(showIds)+len(movies))
+	for _, imdbId := range showIds {
+		items = append(items, entities.TraktItem{
+			Type: entities.TraktItemTypeShow,
+			Show: *shows[imdbId],
+		})
+	}
+	movieIds := make([]string, 0, len(movies))
+	for imdbId := range movies {
+		movieIds = append(movieIds, imdbId)
+	}
+	sort.Strings(movieIds)
+	for _, imdbId := range movieIds {
+		watchedAt := movies[imdbId]
+		items = append(items, entities.TraktItem{
+			Type: entities.TraktItemTypeMovie,
+			Movie: entities.TraktItemSpec{
+				Ids:       entities.TraktIds{Imdb: imdbId},
+				WatchedAt: &watchedAt,
+			},
+		})
+	}
+	if len(unresolved) > 0 {
+		sort.Strings(unresolved)
+		s.logger.Warn(fmt.Sprintf("skipped %d netflix title(s) trakt has no match for", len(unresolved)), zap.Strings("titles", unique(unresolved)))
+	}
+	if len(items) > 0 {
+		plan := &entities.SyncPlan{
+			CreatedAt: time.Now(),
+			Operations: []entities.SyncOperation{
+				{
+					Action: entities.SyncActionAdd,
+					Target: entities.SyncTargetHistory,
+					Items:  items,
+				},
+			},
+		}
+		if err = s.applyAndRecord(plan); err != nil {
+			s.logger.Error(fmt.Sprintf("failure importing %s", path), zap.Error(err))
+			return err
+		}
+	}
+	s.logger.Info(fmt.Sprintf("imported %d movie(s) and the episodes of %d show(s) from %s to trakt history", len(movieIds), len(showIds), path))
+	return nil
+}
+
+func unique(values []string) []string {
+	var result []string
+	for i, value := range values {
+		if i == 0 || values[i-1] != value {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// netflixMatch is the trakt movie or episode a netflix title is matched to, which is an episode of the show of the imdb id
+// when the episode is set
+type netflixMatch struct {
+	imdbId  string
+	episode *entities.TraktShowEpisode
+}
+
+// netflixMatcher looks netflix titles up on trakt, searching every movie, show and season only once
+type netflixMatcher struct {
+	syncer   *Syncer
+	movies   map[string]string
+	shows    map[string]string
+	episodes map[string][]entities.TraktShowEpisode
+}
+
+func newNetflixMatcher(syncer *Syncer) *netflixMatcher {
+	return &netflixMatcher{
+		syncer:   syncer,
+		movies:   make(map[string]string),
+		shows:    make(map[string]string),
+		episodes: make(map[string][]entities.TraktShowEpisode),
+	}
+}
+
+func (m *netflixMatcher) match(view netflixView) (*netflixMatch, error) {
+	// a title naming a season is an episode, while others are tried as a movie first
+	if view.Season == 0 {
+		imdbId, err := m.search(m.movies, entities.TraktItemTypeMovie, view.Title)
+		if err != nil || imdbId != "" {
+			return &netflixMatch{imdbId: imdbId}, err
+		}
+	}
+	if view.Show == "" {
+		return nil, nil
+	}
+	showId, err := m.search(m.shows, entities.TraktItemTypeShow, view.Show)
+	if err != nil || showId == "" {
+		return nil, err
+	}
+	episodes, found := m.episodes[showId]
+	if !found {
+		if episodes, err = m.syncer.traktClient.ShowEpisodesGet(showId); err != nil {
+			return nil, fmt.Errorf("failure fetching the episodes of trakt show %s: %w", showId, err)
+		}
+		m.episodes[showId] = episodes
+	}
+	// the episode title may still start with a part netflix adds, such as the name of a season, so it is shortened
+	// part by part until an episode matches
+	parts := strings.Split(view.EpisodeTitle, ": ")
+	for i := range parts {
+		if episode := netflixEpisode(episodes, strings.Join(parts[i:], ": "), view.Season); episode != nil {
+			return &netflixMatch{imdbId: showId, episode: episode}, nil
+		}
+	}
+	return nil, nil
+}
+
+// netflixEpisode returns the episode of the title, preferring the one of the season, as episodes of other seasons may share the title
+func netflixEpisode(episodes []entities.TraktShowEpisode, title string, season int) *entities.TraktShowEpisode {
+	title = normalizeTitle(title)
+	var candidate *entities.TraktShowEpisode
+	for i := range episodes {
+		if normalizeTitle(episodes[i].Title) != title {
+			continue
+		}
+		if episodes[i].Season == season {
+			return &episodes[i]
+		}
+		if candidate == nil {
+			candidate = &episodes[i]
+		}
+	}
+	return candidate
+}
+
+func (m *netflixMatcher) search(cache map[string]string, itemType, title string) (string, error) {
+	key := strings.ToLower(title)
+	if imdbId, found := cache[key]; found {
+		return imdbId, nil
+	}
+	ids, err := m.syncer.traktClient.SearchTitle(itemType, title, 0)
+	if err != nil {
+		return "", fmt.Errorf("failure searching trakt for %s %s: %w", itemType, title, err)
+	}
+	imdbId := ""
+	if ids != nil {
+		imdbId = ids.Imdb
+	}
+	cache[key] = imdbId
+	return imdbId, nil
+}
+
+// normalizeTitle lowercases a title and drops its punctuation and spaces, as services punctuate titles differently
+func normalizeTitle(title string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// readNetflixFile reads the views of a netflix viewing history, oldest first
+func readNetflixFile(path, profile string) ([]netflixView, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the header of %s: %w", path, err)
+	}
+	positions := make(map[string]int)
+	for i, name := range header {
+		if column, ok := netflixCsvColumns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))]; ok {
+			positions[column] = i
+		}
+	}
+	_, hasTitle := positions[netflixColumnTitle]
+	_, hasStartTime := positions[netflixColumnStartTime]
+	_, hasDate := positions[netflixColumnDate]
+	if !hasTitle || (!hasStartTime && !hasDate) {
+		return nil, fmt.Errorf("failure reading %s: expected the Title and Start Time columns of ViewingActivity.csv, or the Title and Date columns of NetflixViewingHistory.csv", path)
+	}
+	field := func(row []string, column string) string {
+		if i, ok := positions[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	profiles := make(map[string]bool)
+	profileFound := false
+	var views []netflixView
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure reading %s: %w", path, err)
+		}
+		if name := field(row, netflixColumnProfile); name != "" {
+			profiles[name] = true
+			if profile != "" && !strings.EqualFold(name, profile) {
+				continue
+			}
+			profileFound = true
+		}
+		if field(row, netflixColumnSupplemental) != "" {
+			continue
+		}
+		if value := field(row, netflixColumnDuration); value != "" {
+			if duration, err := parseNetflixDuration(value); err == nil && duration < netflixMinDuration {
+				continue
+			}
+		}
+		view := netflixView{
+			Title: field(row, netflixColumnTitle),
+		}
+		if hasStartTime {
+			view.WatchedAt, err = time.Parse("2006-01-02 15:04:05", field(row, netflixColumnStartTime))
+		} else {
+			view.WatchedAt, err = parseNetflixDate(field(row, netflixColumnDate))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing the date on line %d of %s: %w", line, path, err)
+		}
+		if view.Title == "" {
+			continue
+		}
+		parseNetflixTitle(&view)
+		views = append(views, view)
+	}
+	if profile == "" && len(profiles) > 1 {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("failure reading %s: it holds the views of the profiles %s, pick one of them", path, strings.Join(names, ", "))
+	}
+	if profile != "" && len(profiles) > 0 && !profileFound {
+		return nil, fmt.Errorf("failure reading %s: it has no views of the profile %s", path, profile)
+	}
+	sort.SliceStable(views, func(i, j int) bool {
+		return views[i].WatchedAt.Before(views[j].WatchedAt)
+	})
+	return views, nil
+}
+
+// parseNetflixDuration parses the duration of a view, written as hours, minutes and seconds
+func parseNetflixDuration(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("expected a duration like 01:02:03, got %q", value)
+	}
+	var total time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		amount, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("expected a duration like 01:02:03, got %q", value)
+		}
+		total += time.Duration(amount) * unit
+	}
+	return total, nil
+}
+
+// parseNetflixDate parses the date of the viewing activity of a profile, which netflix writes month first in the local time of the user
+func parseNetflixDate(value string) (time.Time, error) {
+	for _, layout := range []string{"1/2/06", "1/2/2006", "2006-01-02"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a date like 12/31/23, got %q", value)
+}
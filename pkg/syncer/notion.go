@@ -0,0 +1,150 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	stepNotion = "notion"
+)
+
+// notionEnabled reports whether the watchlist and ratings are pushed to a notion database, which takes both a token and the database id
+func notionEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeyNotionToken] != "" && secrets[EnvVarKeyNotionDatabaseId] != ""
+}
+
+func newNotionClient(secrets map[string]string, logger *zap.Logger) (client.NotionClientInterface, error) {
+	return client.NewNotionClient(
+		client.NotionConfig{
+			Token:      secrets[EnvVarKeyNotionToken],
+			DatabaseId: secrets[EnvVarKeyNotionDatabaseId],
+			SyncMode:   os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: map[string]string{
+				entities.SyncTargetRatings:   os.Getenv(EnvVarKeySyncModeRatings),
+				entities.SyncTargetWatchlist: os.Getenv(EnvVarKeySyncModeWatchlist),
+			},
+		},
+		logger,
+	)
+}
+
+// pushNotion keeps a page per item of the watchlist and ratings in the notion database while trakt is synced. Rated items have the
+// rated status, which wins over the watchlist one, and the pages of the items no longer in the source are archived.
+// It returns the name of the target when it failed.
+func (s *Syncer) pushNotion() []string {
+	if s.notionClient == nil {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepNotion, start)
+	if err := s.pushNotionPages(); err != nil {
+		s.logger.Error("failure pushing to notion", zap.Error(err))
+		return []string{stepNotion}
+	}
+	return nil
+}
+
+func (s *Syncer) pushNotionPages() error {
+	current, err := s.notionClient.PagesGet()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]entities.NotionPage, len(current))
+	for _, page := range current {
+		existing[page.ImdbId] = page
+	}
+	desired := s.notionPages()
+	imdbIds := make([]string, 0, len(desired))
+	for imdbId := range desired {
+		imdbIds = append(imdbIds, imdbId)
+	}
+	sort.Strings(imdbIds)
+	for _, imdbId := range imdbIds {
+		page := desired[imdbId]
+		target := notionPageTarget(page)
+		existingPage, found := existing[imdbId]
+		if !found {
+			metadata, err := s.traktClient.MetadataGet(imdbId)
+			if err != nil {
+				return fmt.Errorf("failure fetching trakt metadata of %s: %w", imdbId, err)
+			}
+			page.Title = imdbId
+			if metadata != nil {
+				page.Title = metadata.Title
+				page.Type = metadata.Type
+				page.Poster = metadata.Poster
+			}
+			if err = s.notionClient.PageCreate(target, page); err != nil {
+				return err
+			}
+			continue
+		}
+		if existingPage.Differs(page) {
+			page.Id = existingPage.Id
+			page.Title = existingPage.Title
+			if err = s.notionClient.PageUpdate(target, page); err != nil {
+				return err
+			}
+		}
+	}
+	for _, page := range current {
+		if _, found := desired[page.ImdbId]; found {
+			continue
+		}
+		// the pages of the targets that are not synced are left alone
+		if (page.Status == entities.NotionStatusRated && !s.syncRatings) || (page.Status == entities.NotionStatusWatchlist && !s.syncWatchlist) {
+			continue
+		}
+		if err = s.notionClient.PageArchive(notionPageTarget(page), page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notionPages returns the pages the database should have, keyed by imdb id
+func (s *Syncer) notionPages() map[string]entities.NotionPage {
+	pages := make(map[string]entities.NotionPage)
+	if s.syncWatchlist {
+		for _, imdbList := range s.user.imdbLists {
+			if !imdbList.IsWatchlist {
+				continue
+			}
+			for _, item := range imdbList.ListItems {
+				pages[item.Id] = entities.NotionPage{
+					ImdbId: item.Id,
+					Type:   item.TraktItemType(),
+					Status: entities.NotionStatusWatchlist,
+				}
+			}
+		}
+	}
+	if s.syncRatings {
+		for _, item := range s.user.imdbRatings {
+			if item.Rating == nil {
+				continue
+			}
+			pages[item.Id] = entities.NotionPage{
+				ImdbId:  item.Id,
+				Type:    item.TraktItemType(),
+				Status:  entities.NotionStatusRated,
+				Rating:  item.Rating,
+				RatedAt: item.RatingDate,
+			}
+		}
+	}
+	return pages
+}
+
+func notionPageTarget(page entities.NotionPage) string {
+	if page.Status == entities.NotionStatusRated {
+		return entities.SyncTargetRatings
+	}
+	return entities.SyncTargetWatchlist
+}
@@ -0,0 +1,229 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// mergeOperations combines operations performing the same action on the same target into a single operation,
+// so identical work coming from the retry queue and from the current plan is sent once. Operations on different lists
+// are never merged, as trakt adds and removes the items of every list separately, so the titles shared by several
+// lists are deduplicated by resolveSharedItems instead.
+func mergeOperations(operations []entities.SyncOperation) []entities.SyncOperation {
+	merged := make([]entities.SyncOperation, 0, len(operations))
+	positions := make(map[string]int)
+	seenItems := make(map[string]map[string]bool)
+	for _, operation := range operations {
+		if operation.Action != entities.SyncActionAdd && operation.Action != entities.SyncActionRemove {
+			merged = append(merged, operation)
+			continue
+		}
+		key := operation.Action + "/" + operation.Target + "/" + operation.ListSlug
+		position, found := positions[key]
+		if !found {
+			position = len(merged)
+			positions[key] = position
+			seenItems[key] = make(map[string]bool)
+			merged = append(merged, operation)
+			merged[position].Items = nil
+		}
+		for _, item := range operation.Items {
+			if id, err := item.GetItemId(); err == nil && id != nil {
+				if seenItems[key][item.Type+*id] {
+					continue
+				}
+				seenItems[key][item.Type+*id] = true
+			}
+			merged[position].Items = append(merged[position].Items, item)
+		}
+	}
+	return merged
+}
+
+// withoutPlannedItems drops the items of the queued operations that the plan also adds or removes on the same target,
+// as the plan reflects the current state of the source: a queued add of a title the plan now removes must not undo the
+// removal, and a queued rating must not override a newer one. It returns the remaining operations and the dropped items.
+func withoutPlannedItems(queued, planned []entities.SyncOperation) ([]entities.SyncOperation, int) {
+	plannedItems := make(map[string]bool)
+	for _, operation := range planned {
+		if operation.Action != entities.SyncActionAdd && operation.Action != entities.SyncActionRemove {
+			continue
+		}
+		for _, item := range operation.Items {
+			if id, err := item.GetItemId(); err == nil && id != nil {
+				plannedItems[operation.Target+"/"+operation.ListSlug+"/"+item.Type+*id] = true
+			}
+		}
+	}
+	var (
+		remaining = make([]entities.SyncOperation, 0, len(queued))
+		dropped   int
+	)
+	for _, operation := range queued {
+		if operation.Action != entities.SyncActionAdd && operation.Action != entities.SyncActionRemove {
+			remaining = append(remaining, operation)
+			continue
+		}
+		items := make(entities.TraktItems, 0, len(operation.Items))
+		for _, item := range operation.Items {
+			if id, err := item.GetItemId(); err == nil && id != nil && plannedItems[operation.Target+"/"+operation.ListSlug+"/"+item.Type+*id] {
+				continue
+			}
+			items = append(items, item)
+		}
+		dropped += len(operation.Items) - len(items)
+		if len(items) == 0 && len(operation.Items) > 0 {
+			continue
+		}
+		operation.Items = items
+		remaining = append(remaining, operation)
+	}
+	return remaining, dropped
+}
+
+// resolveSharedItems looks up once every title that several add operations would send to trakt and that trakt holds
+// in none of the synced lists or ratings yet, before any operation is applied. It returns the titles trakt does not know,
+// which every operation then leaves out, instead of each list, watchlist or ratings operation resolving them again.
+// A title whose lookup fails is left to the operations.
+func (s *Syncer) resolveSharedItems(operations []entities.SyncOperation) map[string]bool {
+	known := make(map[string]bool)
+	for _, list := range s.user.traktLists {
+		for _, item := range list.ListItems {
+			if id, err := item.GetItemId(); err == nil && id != nil {
+				known[*id] = true
+			}
+		}
+	}
+	for id := range s.user.traktRatings {
+		known[id] = true
+	}
+	occurrences := make(map[string]int)
+	for _, operation := range operations {
+		if operation.Action != entities.SyncActionAdd {
+			continue
+		}
+		for _, item := range operation.Items {
+			if id, err := item.GetItemId(); err == nil && id != nil && *id != "" && !known[*id] {
+				occurrences[*id]++
+			}
+		}
+	}
+	var (
+		unresolved = make(map[string]bool)
+		mutex      sync.Mutex
+		semaphore  = make(chan struct{}, s.concurrency)
+		waitGroup  = new(sync.WaitGroup)
+	)
+	for id, count := range occurrences {
+		if count < 2 || s.ctx.Err() != nil {
+			continue
+		}
+		semaphore <- struct{}{}
+		waitGroup.Add(1)
+		go func(id string) {
+			defer func() {
+				<-semaphore
+				waitGroup.Done()
+			}()
+			metadata, err := s.traktClient.MetadataGet(id)
+			if err != nil {
+				s.logger.Debug(fmt.Sprintf("failure resolving %s ahead of the lists containing it", id), zap.Error(err))
+				return
+			}
+			if metadata == nil {
+				mutex.Lock()
+				unresolved[id] = true
+				mutex.Unlock()
+			}
+		}(id)
+	}
+	waitGroup.Wait()
+	if len(unresolved) > 0 {
+		s.logger.Info(fmt.Sprintf("skipping %d title(s) trakt could not find in every operation containing them", len(unresolved)))
+	}
+	return unresolved
+}
+
+// withoutUnresolvedItems drops the items that trakt failed to resolve, returning the imdb ids of the dropped items
+func withoutUnresolvedItems(operation entities.SyncOperation, unresolved map[string]bool) (entities.SyncOperation, []string) {
+	if len(unresolved) == 0 {
+		return operation, nil
+	}
+	var (
+		items   = make(entities.TraktItems, 0, len(operation.Items))
+		skipped []string
+	)
+	for _, item := range operation.Items {
+		if id, err := item.GetItemId(); err == nil && id != nil && unresolved[*id] {
+			skipped = append(skipped, *id)
+			continue
+		}
+		items = append(items, item)
+	}
+	operation.Items = items
+	return operation, skipped
+}
+
+func chunkOperations(operations []entities.SyncOperation, size int) []entities.SyncOperation {
+	var chunks []entities.SyncOperation
+	for _, operation := range operations {
+		chunks = append(chunks, operation.Chunks(size)...)
+	}
+	return chunks
+}
+
+// applyState holds the progress shared by the goroutines applying a plan
+type applyState struct {
+	mutex       sync.Mutex
+	summary     *entities.SyncSummary
+	unresolved  map[string]bool
+	notFound    map[string]bool
+	interrupted int
+	err         error
+}
+
+// countNotFound counts the titles trakt could not find once, however many lists, watchlist or ratings operations contain them.
+// The caller holds the mutex.
+func (s *applyState) countNotFound(ids []string) {
+	for _, id := range ids {
+		s.unresolved[id] = true
+		if !s.notFound[id] {
+			s.notFound[id] = true
+			s.summary.ItemsNotFound++
+		}
+	}
+}
+
+func (s *applyState) fail(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *applyState) failed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err != nil
+}
+
+// groupOperationsByTarget groups operations by the watchlist, list, ratings or history they target, preserving their order.
+// Groups are independent of each other and can be applied concurrently.
+func groupOperationsByTarget(operations []entities.SyncOperation) [][]entities.SyncOperation {
+	var groups [][]entities.SyncOperation
+	positions := make(map[string]int)
+	for _, operation := range operations {
+		key := operation.Target + "/" + operation.ListSlug
+		position, found := positions[key]
+		if !found {
+			position = len(groups)
+			positions[key] = position
+			groups = append(groups, nil)
+		}
+		groups[position] = append(groups[position], operation)
+	}
+	return groups
+}
@@ -0,0 +1,471 @@
+package syncer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileFormatPrimeVideo reads the watch history of prime video, either the viewing history of an amazon data request
+// or the watch history of the prime video settings saved as csv
+const FileFormatPrimeVideo = "primevideo"
+
+const (
+	primeVideoUnresolvedFileName = "primevideo-unresolved.json"
+
+	primeVideoColumnTitle        = "title"
+	primeVideoColumnEpisodeTitle = "episode_title"
+	primeVideoColumnType         = "type"
+	primeVideoColumnDate         = "date"
+
+	// primeVideoMinSimilarity is how close a trakt title has to be to the title of amazon to be taken as a match
+	primeVideoMinSimilarity = 0.85
+)
+
+// primeVideoCsvColumns maps the headers of the prime video exports to the fields of a view
+var primeVideoCsvColumns = map[string]string{
+	"title":                          primeVideoColumnTitle,
+	"series title":                   primeVideoColumnTitle,
+	"episode title":                  primeVideoColumnEpisodeTitle,
+	"episode name":                   primeVideoColumnEpisodeTitle,
+	"type":                           primeVideoColumnType,
+	"content type":                   primeVideoColumnType,
+	"video type":                     primeVideoColumnType,
+	"date watched":                   primeVideoColumnDate,
+	"date":                           primeVideoColumnDate,
+	"playback start datetime (utc)":  primeVideoColumnDate,
+	"playback start datetime":        primeVideoColumnDate,
+	"playback start date time (utc)": primeVideoColumnDate,
+	"start time":                     primeVideoColumnDate,
+	"viewed at":                      primeVideoColumnDate,
+}
+
+var (
+	// primeVideoTagPattern matches the parts amazon adds to titles about their edition, picture or audio, like "(4K UHD)" or "[dt./OV]"
+	primeVideoTagPattern = regexp.MustCompile(`(?i)\s*[(\[][^)\]]*\b(?:4k|uhd|hd|sd|hdr|subtitled|dubbed|bonus|omu|ov|prime video|extended|director'?s cut|theatrical|unrated|uncut|edition|version|plus)\b[^)\]]*[)\]]`)
+	// primeVideoYearPattern matches the release year amazon appends to some titles
+	primeVideoYearPattern = regexp.MustCompile(`\s*[(\[]((?:19|20)\d{2})[)\]]\s*$`)
+	// primeVideoSeasonPattern matches the season amazon names in a title, in one of the forms and languages of its storefronts,
+	// which may be followed by the title of the episode
+	primeVideoSeasonPattern = regexp.MustCompile(`(?i)^(.+?)(?:\s*[-–:,]\s*|\s*\(\s*|\s+)(?:season|series|staffel|saison|temporada|stagione|seizoen|säsong|sæson|sesong|kausi|s)\s*(\d+)\s*\)?(?:\s*[-–:]\s*(.*))?$`)
+	// primeVideoEpisodePattern matches the number amazon writes before the title of some episodes, like "Ep. 3 - Title" or "3. Title"
+	primeVideoEpisodePattern = regexp.MustCompile(`(?i)^(?:s\d+\s*)?(?:e|ep\.?|episode|folge|épisode|episodio|aflevering)\s*(\d+)(?:\s*[-–:.]\s*(.*))?$|^(\d+)\.\s+(.*)$`)
+)
+
+// primeVideoView is a title watched on prime video, parsed into the show, season and episode of an episode
+type primeVideoView struct {
+	Title         string
+	EpisodeTitle  string
+	Type          string // movie or show when the export tells them apart, or empty
+	WatchedAt     time.Time
+	Name          string // the title without the tags, year and season amazon adds to it
+	Year          int
+	Season        int // 0 when the title names no season
+	EpisodeNumber int // 0 when the episode title carries no number
+	EpisodeName   string
+}
+
+// primeVideoUnresolved is a title of the watch history trakt has no match for, as written to the unresolved items report
+type primeVideoUnresolved struct {
+	Title        string `json:"title"`
+	EpisodeTitle string `json:"episode_title,omitempty"`
+	WatchedAt    string `json:"watched_at"`
+	Views        int    `json:"views"`
+	Reason       string `json:"reason"`
+}
+
+// PrimeVideoUnresolvedPath returns the path of the report of the prime video titles the last import could not match
+func PrimeVideoUnresolvedPath() string {
+	return StatePath(primeVideoUnresolvedFileName)
+}
+
+// parsePrimeVideoTitle strips a prime video title of the tags and year amazon adds to it, and splits it into the show and season
+// it names, along with the title of the episode when amazon writes it in the title
+func parsePrimeVideoTitle(view *primeVideoView) {
+	name := strings.TrimSpace(primeVideoTagPattern.ReplaceAllString(view.Title, ""))
+	if match := primeVideoYearPattern.FindStringSubmatch(name); match != nil {
+		view.Year, _ = strconv.Atoi(match[1])
+		name = strings.TrimSpace(name[:len(name)-len(match[0])])
+	}
+	view.Name = name
+	episodeName := strings.TrimSpace(primeVideoTagPattern.ReplaceAllString(view.EpisodeTitle, ""))
+	if match := primeVideoSeasonPattern.FindStringSubmatch(name); match != nil {
+		view.Name = strings.TrimSpace(match[1])
+		view.Season, _ = strconv.Atoi(match[2])
+		if episodeName == "" {
+			episodeName = strings.TrimSpace(match[3])
+		}
+	}
+	if match := primeVideoEpisodePattern.FindStringSubmatch(episodeName); match != nil {
+		if match[1] != "" {
+			view.EpisodeNumber, _ = strconv.Atoi(match[1])
+			episodeName = strings.TrimSpace(match[2])
+		} else {
+			view.EpisodeNumber, _ = strconv.Atoi(match[3])
+			episodeName = strings.TrimSpace(match[4])
+		}
+	}
+	view.EpisodeName = episodeName
+}
+
+// isEpisode reports whether the view is an episode, as the export says or as its title names a season or an episode
+func (view primeVideoView) isEpisode() bool {
+	if view.Type != "" {
+		return view.Type == entities.TraktItemTypeShow
+	}
+	return view.Season > 0 || view.EpisodeNumber > 0 || view.EpisodeName != ""
+}
+
+// ImportPrimeVideo adds the titles of a prime video watch history to the trakt history, at the time they were first watched.
+// Amazon writes titles inconsistently, adding seasons, editions and languages to them, so these are stripped before the titles are
+// searched on trakt, and the closest movie or show is taken when its title is similar enough. Episodes are matched to the episode
+// of the show by their title, or by their number in the season. The titles trakt cannot match are written to an unresolved items
+// report, which is removed once an import matches every title.
+func (s *Syncer) ImportPrimeVideo(path string) error {
+	views, err := readPrimeVideoFile(path)
+	if err != nil {
+		s.logger.Error("failure reading prime video watch history", zap.Error(err))
+		return err
+	}
+	matcher := newPrimeVideoMatcher(s)
+	movies := make(map[string]string)
+	shows := make(map[string]*entities.TraktItemSpec)
+	var showIds []string
+	unresolved := make(map[string]*primeVideoUnresolved)
+	var unresolvedKeys []string
+	for _, view := range views {
+		watchedAt := view.WatchedAt.UTC().Format(time.RFC3339)
+		match, reason, err := matcher.match(view)
+		if err != nil {
+			s.logger.Error("failure looking up prime video titles on trakt", zap.Error(err))
+			return err
+		}
+		switch {
+		case match == nil:
+			key := view.Title + "\n" + view.EpisodeTitle
+			item, found := unresolved[key]
+			if !found {
+				item = &primeVideoUnresolved{
+					Title:        view.Title,
+					EpisodeTitle: view.EpisodeTitle,
+					WatchedAt:    watchedAt,
+					Reason:       reason,
+				}
+				unresolved[key] = item
+				unresolvedKeys = append(unresolvedKeys, key)
+			}
+			item.Views++
+		case match.episode == nil:
+			if _, found := movies[match.imdbId]; !found {
+				movies[match.imdbId] = watchedAt
+			}
+		default:
+			show, found := shows[match.imdbId]
+			if !found {
+				show = &entities.TraktItemSpec{Ids: entities.TraktIds{Imdb: match.imdbId}}
+				shows[match.imdbId] = show
+				showIds = append(showIds, match.imdbId)
+			}
+			watchedEpisode := episode(season(show, match.episode.Season), match.episode.Number)
+			if watchedEpisode.WatchedAt == nil {
+				watchedEpisode.WatchedAt = &watchedAt
+			}
+		}
+	}
+	items := make(entities.TraktItems, 0, len(showIds)+len(movies))
+	for _, imdbId := range showIds {
+		items = append(items, entities.TraktItem{
+			Type: entities.TraktItemTypeShow,
+			Show: *shows[imdbId],
+		})
+	}
+	movieIds := make([]string, 0, len(movies))
+	for imdbId := range movies {
+		movieIds = append(movieIds, imdbId)
+	}
+	sort.Strings(movieIds)
+	for _, imdbId := range movieIds {
+		watchedAt := movies[imdbId]
+		items = append(items, entities.TraktItem{
+			Type: entities.TraktItemTypeMovie,
+			Movie: entities.TraktItemSpec{
+				Ids:       entities.TraktIds{Imdb: imdbId},
+				WatchedAt: &watchedAt,
+			},
+		})
+	}
+	report := make([]primeVideoUnresolved, 0, len(unresolvedKeys))
+	for _, key := range unresolvedKeys {
+		report = append(report, *unresolved[key])
+	}
+	s.writePrimeVideoUnresolved(report)
+	if len(items) > 0 {
+		plan := &entities.SyncPlan{
+			CreatedAt: time.Now(),
+			Operations: []entities.SyncOperation{
+				{
+					Action: entities.SyncActionAdd,
+					Target: entities.SyncTargetHistory,
+					Items:  items,
+				},
+			},
+		}
+		if err = s.applyAndRecord(plan); err != nil {
+			s.logger.Error(fmt.Sprintf("failure importing %s", path), zap.Error(err))
+			return err
+		}
+	}
+	s.logger.Info(fmt.Sprintf("imported %d movie(s) and the episodes of %d show(s) from %s to trakt history", len(movieIds), len(showIds), path))
+	return nil
+}
+
+// writePrimeVideoUnresolved saves the titles trakt has no match for to the unresolved items report, or removes the report
+// when every title was matched
+func (s *Syncer) writePrimeVideoUnresolved(report []primeVideoUnresolved) {
+	path := PrimeVideoUnresolvedPath()
+	if len(report) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warn(fmt.Sprintf("failure removing unresolved items report %s", path), zap.Error(err))
+		}
+		return
+	}
+	if err := writeJson(path, report); err != nil {
+		s.logger.Warn("failure writing unresolved items report", zap.Error(err))
+		return
+	}
+	s.logger.Warn(fmt.Sprintf("skipped %d prime video title(s) trakt has no match for, listed in %s", len(report), path))
+}
+
+// primeVideoMatch is the trakt movie or episode a prime video title is matched to, which is an episode of the show of the imdb id
+// when the episode is set
+type primeVideoMatch struct {
+	imdbId  string
+	episode *entities.TraktShowEpisode
+}
+
+// primeVideoMatcher looks prime video titles up on trakt, searching every movie and show and fetching every season only once
+type primeVideoMatcher struct {
+	syncer   *Syncer
+	searches map[string]*entities.TraktSearchResult
+	episodes map[string][]entities.TraktShowEpisode
+}
+
+func newPrimeVideoMatcher(syncer *Syncer) *primeVideoMatcher {
+	return &primeVideoMatcher{
+		syncer:   syncer,
+		searches: make(map[string]*entities.TraktSearchResult),
+		episodes: make(map[string][]entities.TraktShowEpisode),
+	}
+}
+
+// match returns the trakt movie or episode of the view, or the reason it has none
+func (m *primeVideoMatcher) match(view primeVideoView) (*primeVideoMatch, string, error) {
+	if !view.isEpisode() {
+		movie, err := m.search(entities.TraktItemTypeMovie, view.Name, view.Year)
+		if err != nil {
+			return nil, "", err
+		}
+		if movie != nil {
+			return &primeVideoMatch{imdbId: movie.Ids.Imdb}, "", nil
+		}
+		if view.Type == entities.TraktItemTypeMovie {
+			return nil, "no trakt movie has a similar title", nil
+		}
+		return nil, "no trakt movie has a similar title, and the title names no episode", nil
+	}
+	show, err := m.search(entities.TraktItemTypeShow, view.Name, view.Year)
+	if err != nil {
+		return nil, "", err
+	}
+	if show == nil {
+		return nil, "no trakt show has a similar title", nil
+	}
+	episodes, found := m.episodes[show.Ids.Imdb]
+	if !found {
+		if episodes, err = m.syncer.traktClient.ShowEpisodesGet(show.Ids.Imdb); err != nil {
+			return nil, "", fmt.Errorf("failure fetching the episodes of trakt show %s: %w", show.Ids.Imdb, err)
+		}
+		m.episodes[show.Ids.Imdb] = episodes
+	}
+	if episode := primeVideoEpisode(episodes, view); episode != nil {
+		return &primeVideoMatch{imdbId: show.Ids.Imdb, episode: episode}, "", nil
+	}
+	return nil, fmt.Sprintf("no episode of the trakt show %s matches the episode", show.Title), nil
+}
+
+// search returns the movie or show of the title trakt finds with the most similar title, or nil when none is similar enough
+func (m *primeVideoMatcher) search(itemType, title string, year int) (*entities.TraktSearchResult, error) {
+	if normalizeTitle(title) == "" {
+		return nil, nil
+	}
+	key := fmt.Sprintf("%s/%d/%s", itemType, year, strings.ToLower(title))
+	if result, found := m.searches[key]; found {
+		return result, nil
+	}
+	results, err := m.syncer.traktClient.SearchTitles(itemType, title, year)
+	if err != nil {
+		return nil, fmt.Errorf("failure searching trakt for %s %s: %w", itemType, title, err)
+	}
+	var best *entities.TraktSearchResult
+	bestSimilarity := primeVideoMinSimilarity
+	for i := range results {
+		if results[i].Ids.Imdb == "" {
+			continue
+		}
+		// results are ordered by relevance, so a later result only wins by being more similar
+		if similarity := titleSimilarity(title, results[i].Title); similarity > bestSimilarity || (best == nil && similarity == bestSimilarity) {
+			best, bestSimilarity = &results[i], similarity
+		}
+	}
+	m.searches[key] = best
+	return best, nil
+}
+
+// primeVideoEpisode returns the episode of the view, matched by the most similar title, preferring the season of the view,
+// or by its number in the season when its title matches no episode
+func primeVideoEpisode(episodes []entities.TraktShowEpisode, view primeVideoView) *entities.TraktShowEpisode {
+	if view.EpisodeName != "" {
+		var best *entities.TraktShowEpisode
+		bestSimilarity := primeVideoMinSimilarity
+		for i := range episodes {
+			similarity := titleSimilarity(view.EpisodeName, episodes[i].Title)
+			if similarity < primeVideoMinSimilarity {
+				continue
+			}
+			inSeason := episodes[i].Season == view.Season
+			bestInSeason := best != nil && best.Season == view.Season
+			if best == nil || (inSeason && !bestInSeason) || (inSeason == bestInSeason && similarity > bestSimilarity) {
+				best, bestSimilarity = &episodes[i], similarity
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	if view.EpisodeNumber == 0 {
+		return nil
+	}
+	seasonNumber := view.Season
+	if seasonNumber == 0 {
+		seasonNumber = 1
+	}
+	for i := range episodes {
+		if episodes[i].Season == seasonNumber && episodes[i].Number == view.EpisodeNumber {
+			return &episodes[i]
+		}
+	}
+	return nil
+}
+
+// titleSimilarity returns how similar two titles are, from 0 to 1, by the edit distance of their normalized forms
+func titleSimilarity(a, b string) float64 {
+	first, second := normalizeTitle(a), normalizeTitle(b)
+	longest := len(first)
+	if len(second) > longest {
+		longest = len(second)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(editDistance(first, second))/float64(longest)
+}
+
+// readPrimeVideoFile reads the views of a prime video watch history, oldest first
+func readPrimeVideoFile(path string) ([]primeVideoView, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %s: %w", path, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the header of %s: %w", path, err)
+	}
+	positions := make(map[string]int)
+	for i, name := range header {
+		if column, ok := primeVideoCsvColumns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))]; ok {
+			if _, duplicate := positions[column]; !duplicate {
+				positions[column] = i
+			}
+		}
+	}
+	_, hasTitle := positions[primeVideoColumnTitle]
+	_, hasDate := positions[primeVideoColumnDate]
+	if !hasTitle || !hasDate {
+		return nil, fmt.Errorf("failure reading %s: expected a Title column and a Date Watched or Playback Start Datetime column", path)
+	}
+	field := func(row []string, column string) string {
+		if i, ok := positions[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	var views []primeVideoView
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure reading %s: %w", path, err)
+		}
+		view := primeVideoView{
+			Title:        field(row, primeVideoColumnTitle),
+			EpisodeTitle: field(row, primeVideoColumnEpisodeTitle),
+			Type:         primeVideoType(field(row, primeVideoColumnType)),
+		}
+		if view.Title == "" {
+			continue
+		}
+		if view.WatchedAt, err = parsePrimeVideoDate(field(row, primeVideoColumnDate)); err != nil {
+			return nil, fmt.Errorf("failure parsing the date on line %d of %s: %w", line, path, err)
+		}
+		parsePrimeVideoTitle(&view)
+		views = append(views, view)
+	}
+	sort.SliceStable(views, func(i, j int) bool {
+		return views[i].WatchedAt.Before(views[j].WatchedAt)
+	})
+	return views, nil
+}
+
+// primeVideoType returns the trakt item type of the content type of prime video, or an empty type when it is not known
+func primeVideoType(value string) string {
+	value = strings.ToLower(value)
+	switch {
+	case strings.Contains(value, "movie"), strings.Contains(value, "film"):
+		return entities.TraktItemTypeMovie
+	case strings.Contains(value, "tv"), strings.Contains(value, "episode"), strings.Contains(value, "series"), strings.Contains(value, "season"):
+		return entities.TraktItemTypeShow
+	default:
+		return ""
+	}
+}
+
+// parsePrimeVideoDate parses the date a title was watched, which the data request writes in UTC and the watch history of the
+// settings writes as a day in the local time of the user
+func parsePrimeVideoDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(strings.TrimSuffix(value, " UTC"))
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05.000", "2006-01-02 15:04:05", "2006-01-02T15:04:05.000", "2006-01-02T15:04:05"} {
+		if date, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return date, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02", "1/2/2006", "1/2/06", "January 2, 2006", "2 January 2006", "Jan 2, 2006"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a date like 2023-12-31 or 2023-12-31 23:59:59, got %q", value)
+}
@@ -0,0 +1,362 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/config"
+	"github.com/cecobask/imdb-trakt-sync/pkg/events"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"github.com/cecobask/imdb-trakt-sync/pkg/notify"
+	"github.com/cecobask/imdb-trakt-sync/pkg/sentry"
+	"github.com/cecobask/imdb-trakt-sync/pkg/tracing"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var imdbListIdPattern = regexp.MustCompile(`ls\d+`)
+
+// phaseSettings lists the settings that only apply while the data type toggled by the key is synced
+var phaseSettings = map[string][]string{
+	EnvVarKeySyncHistory:   {EnvVarKeyHistorySince, EnvVarKeySkipHistoryKnown, EnvVarKeySyncModeHistory},
+	EnvVarKeySyncLists:     {EnvVarKeyCleanupLists, EnvVarKeyListMerges, EnvVarKeyRankedListIds, EnvVarKeyRatingsListName, EnvVarKeySplitListsByType, EnvVarKeySyncModeLists},
+	EnvVarKeySyncRatings:   {EnvVarKeyRatingsConflict, EnvVarKeySyncModeRatings},
+	EnvVarKeySyncWatchlist: {EnvVarKeySyncModeWatchlist, EnvVarKeyWatchlistTarget},
+}
+
+// knownSettingKeys returns every setting accepted in the config file
+func knownSettingKeys() []string {
+	keys := []string{
+		EnvVarKeyAirtableBaseId,
+		EnvVarKeyAirtableFields,
+		EnvVarKeyAirtableTable,
+		EnvVarKeyAirtableToken,
+		EnvVarKeyAniListToken,
+		EnvVarKeyAnimeMapping,
+		EnvVarKeyAnimeMappingUrl,
+		EnvVarKeyAnomalyMinItems,
+		EnvVarKeyAnomalyThreshold,
+		notify.EnvVarKeyAppriseNotifyOn,
+		notify.EnvVarKeyAppriseUrl,
+		notify.EnvVarKeyAppriseUrls,
+		EnvVarKeyAuditLogPath,
+		config.EnvVarKeyAgeKey,
+		config.EnvVarKeyAgeKeyFile,
+		config.EnvVarKeyAuthHeader,
+		config.EnvVarKeyConfigPath,
+		EnvVarKeyCleanupLists,
+		events.EnvVarKeyHttpUrl,
+		events.EnvVarKeyNatsSubject,
+		events.EnvVarKeyNatsUrl,
+		EnvVarKeyCredentialStore,
+		EnvVarKeyEmbyApiKey,
+		EnvVarKeyEmbyFavorite,
+		EnvVarKeyEmbyTarget,
+		EnvVarKeyEmbyUrl,
+		EnvVarKeyEmbyUser,
+		EnvVarKeyFailureReportPath,
+		EnvVarKeyFileTargetPath,
+		EnvVarKeyGoogleSheetsCreds,
+		EnvVarKeyGoogleSheetsId,
+		EnvVarKeyCookieAtMain,
+		EnvVarKeyCookieUbidMain,
+		EnvVarKeyListIds,
+		EnvVarKeyListMerges,
+		EnvVarKeyRankedListIds,
+		EnvVarKeyImportColumns,
+		EnvVarKeyJellyfinApiKey,
+		EnvVarKeyJellyfinFavorite,
+		EnvVarKeyJellyfinTarget,
+		EnvVarKeyJellyfinUrl,
+		EnvVarKeyJellyfinUser,
+		EnvVarKeyKodiLibraryPath,
+		EnvVarKeyKodiPassword,
+		EnvVarKeyKodiUrl,
+		EnvVarKeyKodiUsername,
+		EnvVarKeyListItemNotes,
+		EnvVarKeyMalAccessToken,
+		EnvVarKeyNotionDatabaseId,
+		EnvVarKeyNotionToken,
+		EnvVarKeyPlexTarget,
+		EnvVarKeyPlexToken,
+		EnvVarKeyPlexUrl,
+		logger.EnvVarKeyLogFile,
+		logger.EnvVarKeyLogFileMaxAge,
+		logger.EnvVarKeyLogFileMaxBackups,
+		logger.EnvVarKeyLogFileMaxSize,
+		logger.EnvVarKeyLogFormat,
+		logger.EnvVarKeyLogLevel,
+		metrics.EnvVarKeyMetricsAddr,
+		metrics.EnvVarKeyPushgatewayJob,
+		metrics.EnvVarKeyPushgatewayLabels,
+		metrics.EnvVarKeyPushgatewayUrl,
+		notify.EnvVarKeyDiscordNotifyOn,
+		notify.EnvVarKeyDiscordWebhookUrl,
+		notify.EnvVarKeyGotifyNotifyOn,
+		notify.EnvVarKeyGotifyToken,
+		notify.EnvVarKeyGotifyUrl,
+		notify.EnvVarKeyHealthcheckPingUrl,
+		notify.EnvVarKeyNotifyOn,
+		notify.EnvVarKeyNtfyNotifyOn,
+		notify.EnvVarKeyNtfyToken,
+		notify.EnvVarKeyNtfyUrl,
+		notify.EnvVarKeySlackChannel,
+		notify.EnvVarKeySlackNotifyOn,
+		notify.EnvVarKeySlackWebhookUrl,
+		notify.EnvVarKeySmtpFrom,
+		notify.EnvVarKeySmtpHost,
+		notify.EnvVarKeySmtpNotifyOn,
+		notify.EnvVarKeySmtpPassword,
+		notify.EnvVarKeySmtpPort,
+		notify.EnvVarKeySmtpTo,
+		notify.EnvVarKeySmtpUsername,
+		notify.EnvVarKeyTelegramBotToken,
+		notify.EnvVarKeyTelegramChatId,
+		notify.EnvVarKeyTelegramNotifyOn,
+		tracing.EnvVarKeyOtlpEndpoint,
+		tracing.EnvVarKeyOtlpHeaders,
+		tracing.EnvVarKeyOtlpTracesEndpoint,
+		tracing.EnvVarKeyServiceName,
+		EnvVarKeyRatingsConflict,
+		EnvVarKeyRatingsListName,
+		EnvVarKeyRemovalGrace,
+		EnvVarKeyRetryQueuePath,
+		EnvVarKeyRunHistoryDir,
+		EnvVarKeyRunHistoryLimit,
+		EnvVarKeyRunStatsPath,
+		sentry.EnvVarKeyDsn,
+		sentry.EnvVarKeyEnvironment,
+		EnvVarKeySimklAccessToken,
+		EnvVarKeySimklClientId,
+		EnvVarKeySkipHistory,
+		EnvVarKeySkipHistoryKnown,
+		EnvVarKeySplitListsByType,
+		EnvVarKeyStateDir,
+		EnvVarKeyStremioAuthKey,
+		EnvVarKeyStremioEmail,
+		EnvVarKeyStremioPassword,
+		EnvVarKeyConcurrency,
+		EnvVarKeySyncHistory,
+		EnvVarKeyHistorySince,
+		EnvVarKeySyncInterval,
+		EnvVarKeySyncJitter,
+		EnvVarKeySyncLists,
+		EnvVarKeyProfile,
+		EnvVarKeySyncMode,
+		EnvVarKeySyncModeHistory,
+		EnvVarKeySyncModeLists,
+		EnvVarKeySyncModeRatings,
+		EnvVarKeySyncModeWatchlist,
+		EnvVarKeySyncRatings,
+		EnvVarKeySyncSource,
+		EnvVarKeySyncWatchlist,
+		EnvVarKeyTmdbApiKey,
+		EnvVarKeyTmdbFavorites,
+		EnvVarKeyTmdbSessionId,
+		EnvVarKeyTraktBudgetWeight,
+		EnvVarKeyTraktClientId,
+		EnvVarKeyTraktClientSecret,
+		EnvVarKeyTraktEmail,
+		EnvVarKeyTraktPassword,
+		EnvVarKeyRateLimitWarn,
+		EnvVarKeyTraktBudget,
+		EnvVarKeyTraktTokensPath,
+		EnvVarKeyTimezone,
+		EnvVarKeyWatchlistTarget,
+		notify.EnvVarKeyWebhookHeaders,
+		notify.EnvVarKeyWebhookNotifyOn,
+		notify.EnvVarKeyWebhookUrl,
+	}
+	for _, key := range secretEnvVarKeys {
+		keys = append(keys, key+secretFileSuffix)
+	}
+	return keys
+}
+
+// configFileProblems reports the unknown keys of the config file and its profiles, suggesting the closest known setting
+func configFileProblems() []error {
+	file, err := config.LoadDefault()
+	if err != nil {
+		// the config file is loaded before the syncer, which already reported the error
+		return nil
+	}
+	sections := map[string]map[string]string{
+		"": file.Settings,
+	}
+	names := []string{""}
+	for _, name := range file.ProfileNames() {
+		sections[name] = file.Profiles[name]
+		names = append(names, name)
+	}
+	known := knownSettingKeys()
+	var problems []error
+	for _, name := range names {
+		for _, key := range sortedSettingKeys(sections[name]) {
+			if stringSliceContains(known, key) {
+				continue
+			}
+			location := "the config file"
+			if name != "" {
+				location = fmt.Sprintf("profile %s of the config file", name)
+			}
+			problem := fmt.Sprintf("unknown setting %s in %s", key, location)
+			if suggestion := closestKey(key, known); suggestion != "" {
+				problem += fmt.Sprintf(", did you mean %s?", suggestion)
+			}
+			problems = append(problems, errors.New(problem))
+		}
+	}
+	return problems
+}
+
+// listIdProblems reports the imdb list ids that are not formatted like ls123456789, such as urls or list names
+func listIdProblems() []error {
+	if source := SyncSource(); source == syncSourceTmdb || source == syncSourceAniList {
+		// the lists of tmdb have ids of their own, which are checked once they are fetched, and anilist has no lists
+		return nil
+	}
+	var problems []error
+	check := func(key, listId string) {
+		if listId == "" || imdbListIdPattern.FindString(listId) == listId {
+			return
+		}
+		problem := fmt.Sprintf("%s contains the malformed imdb list id %s, expected an id like ls123456789 from the url of the list", key, listId)
+		if id := imdbListIdPattern.FindString(listId); id != "" {
+			problem += fmt.Sprintf(", did you mean %s?", id)
+		}
+		problems = append(problems, errors.New(problem))
+	}
+	if listIds := os.Getenv(EnvVarKeyListIds); listIds != "all" {
+		for _, listId := range strings.Split(listIds, ",") {
+			check(EnvVarKeyListIds, strings.TrimSpace(listId))
+		}
+	}
+	for _, listId := range strings.Split(os.Getenv(EnvVarKeyRankedListIds), ",") {
+		check(EnvVarKeyRankedListIds, strings.TrimSpace(listId))
+	}
+	merges, _ := parseListMerges(os.Getenv(EnvVarKeyListMerges))
+	for _, name := range sortedListKeys(merges) {
+		for _, listId := range merges[name] {
+			check(EnvVarKeyListMerges, listId)
+		}
+	}
+	return problems
+}
+
+// combinationProblems reports settings that contradict each other or have no effect with the rest of the configuration
+func combinationProblems() []error {
+	var problems []error
+	skipHistory, _ := strconv.ParseBool(os.Getenv(EnvVarKeySkipHistory))
+	if syncHistory, err := strconv.ParseBool(os.Getenv(EnvVarKeySyncHistory)); err == nil && syncHistory && skipHistory {
+		problems = append(problems, fmt.Errorf("%s=true contradicts %s=true, remove %s", EnvVarKeySkipHistory, EnvVarKeySyncHistory, EnvVarKeySkipHistory))
+	}
+	disabled := 0
+	for _, phase := range sortedListKeys(phaseSettings) {
+		enabled := phaseEnabled(phase)
+		if phase == EnvVarKeySyncHistory {
+			enabled = enabled && !skipHistory
+		}
+		if enabled {
+			continue
+		}
+		disabled++
+		for _, key := range phaseSettings[phase] {
+			if value := os.Getenv(key); value != "" && value != "false" {
+				problems = append(problems, fmt.Errorf("%s has no effect while %s is disabled, remove it or enable %s", key, phase, phase))
+			}
+		}
+	}
+	if disabled == len(phaseSettings) {
+		problems = append(problems, fmt.Errorf("%s, %s, %s and %s are all disabled, so there is nothing to sync", EnvVarKeySyncHistory, EnvVarKeySyncLists, EnvVarKeySyncRatings, EnvVarKeySyncWatchlist))
+	}
+	if listIds := os.Getenv(EnvVarKeyListIds); listIds != "" && listIds != "all" {
+		synced := strings.Split(strings.ReplaceAll(listIds, " ", ""), ",")
+		merges, _ := parseListMerges(os.Getenv(EnvVarKeyListMerges))
+		for _, merged := range merges {
+			synced = append(synced, merged...)
+		}
+		for _, listId := range strings.Split(os.Getenv(EnvVarKeyRankedListIds), ",") {
+			if listId = strings.TrimSpace(listId); listId != "" && !stringSliceContains(synced, listId) {
+				problems = append(problems, fmt.Errorf("ranked list %s is not synced, add it to %s", listId, EnvVarKeyListIds))
+			}
+		}
+	}
+	if plexTarget, _ := strconv.ParseBool(os.Getenv(EnvVarKeyPlexTarget)); plexTarget && os.Getenv(EnvVarKeyPlexUrl) == "" {
+		problems = append(problems, fmt.Errorf("%s has no effect without %s, set it along with %s", EnvVarKeyPlexTarget, EnvVarKeyPlexUrl, EnvVarKeyPlexToken))
+	}
+	if embyTarget, _ := strconv.ParseBool(os.Getenv(EnvVarKeyEmbyTarget)); embyTarget && os.Getenv(EnvVarKeyEmbyUrl) == "" {
+		problems = append(problems, fmt.Errorf("%s has no effect without %s, set it along with %s", EnvVarKeyEmbyTarget, EnvVarKeyEmbyUrl, EnvVarKeyEmbyApiKey))
+	}
+	if jellyfinTarget, _ := strconv.ParseBool(os.Getenv(EnvVarKeyJellyfinTarget)); jellyfinTarget && os.Getenv(EnvVarKeyJellyfinUrl) == "" {
+		problems = append(problems, fmt.Errorf("%s has no effect without %s, set it along with %s", EnvVarKeyJellyfinTarget, EnvVarKeyJellyfinUrl, EnvVarKeyJellyfinApiKey))
+	}
+	if os.Getenv(EnvVarKeyTmdbFavorites) != "" && SyncSource() == syncSourceTmdb {
+		problems = append(problems, fmt.Errorf("%s has no effect while %s is %s, as tmdb is not mirrored into, remove it", EnvVarKeyTmdbFavorites, EnvVarKeySyncSource, syncSourceTmdb))
+	}
+	return problems
+}
+
+// closestKey returns the known key closest to an unknown one, or nothing when none is close enough to be a typo
+func closestKey(key string, known []string) string {
+	var (
+		closest  string
+		distance = len(key)/3 + 1
+	)
+	for _, candidate := range known {
+		if d := editDistance(key, candidate); d < distance {
+			closest, distance = candidate, d
+		}
+	}
+	return closest
+}
+
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+func sortedSettingKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedListKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
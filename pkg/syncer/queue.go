@@ -0,0 +1,68 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"os"
+)
+
+const defaultRetryQueuePath = "retry-queue.json"
+
+func RetryQueuePath() string {
+	if path := os.Getenv(EnvVarKeyRetryQueuePath); path != "" {
+		return path
+	}
+	return StatePath(defaultRetryQueuePath)
+}
+
+// retryQueue persists the operations that failed due to transient errors, so that they can be retried on the next run
+type retryQueue struct {
+	path       string
+	Operations []entities.SyncOperation `json:"operations"`
+}
+
+func loadRetryQueue(path string) (*retryQueue, error) {
+	queue := &retryQueue{
+		path: path,
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return queue, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failure reading retry queue from %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, queue); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling retry queue: %w", err)
+	}
+	return queue, nil
+}
+
+func (q *retryQueue) push(operation entities.SyncOperation) {
+	q.Operations = append(q.Operations, operation)
+}
+
+func (q *retryQueue) drain() []entities.SyncOperation {
+	operations := q.Operations
+	q.Operations = nil
+	return operations
+}
+
+func (q *retryQueue) save() error {
+	if len(q.Operations) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failure removing retry queue %s: %w", q.path, err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failure marshalling retry queue: %w", err)
+	}
+	if err = os.WriteFile(q.path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing retry queue to %s: %w", q.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/config"
+	"github.com/cecobask/imdb-trakt-sync/pkg/events"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/cecobask/imdb-trakt-sync/pkg/notify"
+	"github.com/cecobask/imdb-trakt-sync/pkg/sentry"
+	"github.com/cecobask/imdb-trakt-sync/pkg/tracing"
+	"github.com/zalando/go-keyring"
+	"os"
+	"strings"
+)
+
+const (
+	secretFileSuffix = "_FILE"
+
+	credentialStoreEnv     = "env"
+	credentialStoreKeyring = "keyring"
+
+	keyringService = "imdb-trakt-sync"
+)
+
+// secretEnvVarKeys lists the credentials that can be read from a file, such as a docker or kubernetes secret,
+// by setting the environment variable suffixed with _FILE to its path
+var secretEnvVarKeys = []string{
+	EnvVarKeyAirtableToken,
+	EnvVarKeyAniListToken,
+	EnvVarKeyCookieAtMain,
+	EnvVarKeyCookieUbidMain,
+	EnvVarKeyEmbyApiKey,
+	EnvVarKeyGoogleSheetsCreds,
+	EnvVarKeyGoogleSheetsId,
+	EnvVarKeyJellyfinApiKey,
+	EnvVarKeyKodiPassword,
+	EnvVarKeyMalAccessToken,
+	EnvVarKeyNotionDatabaseId,
+	EnvVarKeyNotionToken,
+	EnvVarKeyPlexToken,
+	EnvVarKeySimklAccessToken,
+	EnvVarKeySimklClientId,
+	EnvVarKeyStremioAuthKey,
+	EnvVarKeyStremioPassword,
+	EnvVarKeyTmdbApiKey,
+	EnvVarKeyTmdbSessionId,
+	EnvVarKeyTraktClientId,
+	EnvVarKeyTraktClientSecret,
+	EnvVarKeyTraktEmail,
+	EnvVarKeyTraktPassword,
+}
+
+// CredentialEnvVarKeys returns the environment variables holding credentials
+func CredentialEnvVarKeys() []string {
+	keys := make([]string, len(secretEnvVarKeys))
+	copy(keys, secretEnvVarKeys)
+	return keys
+}
+
+// SecretValues returns the value of every environment variable holding a credential, including the urls and headers
+// of integrations, which are scrubbed from logs and reported errors
+func SecretValues() []string {
+	var keys []string
+	keys = append(keys, CredentialEnvVarKeys()...)
+	keys = append(keys, config.SecretEnvVarKeys()...)
+	keys = append(keys, notify.SecretEnvVarKeys()...)
+	keys = append(keys, events.SecretEnvVarKeys()...)
+	keys = append(keys, sentry.EnvVarKeyDsn, tracing.EnvVarKeyOtlpHeaders)
+	var values []string
+	for _, key := range keys {
+		if value := os.Getenv(key); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// readSecrets returns the value of every credential, reading it from a file when its _FILE variant is set,
+// or from the platform keyring when it is the configured credential store and the credential is not set otherwise
+func readSecrets() (map[string]string, error) {
+	secrets := make(map[string]string, len(secretEnvVarKeys))
+	for _, key := range secretEnvVarKeys {
+		value, err := readSecret(key)
+		if err != nil {
+			return nil, err
+		}
+		secrets[key] = value
+		// credentials read from a file or the keyring are not part of the environment, yet must never be logged
+		logger.AddSecrets(value)
+	}
+	logger.AddSecrets(SecretValues()...)
+	return secrets, nil
+}
+
+func readSecret(key string) (string, error) {
+	fileKey := key + secretFileSuffix
+	path := os.Getenv(fileKey)
+	if path == "" {
+		if value := os.Getenv(key); value != "" || os.Getenv(EnvVarKeyCredentialStore) != credentialStoreKeyring {
+			return value, nil
+		}
+		return readKeyringSecret(key)
+	}
+	if os.Getenv(key) != "" {
+		return "", fmt.Errorf("environment variables %s and %s cannot both be set", key, fileKey)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failure reading environment variable %s from file: %w", fileKey, err)
+	}
+	// editors and secret managers commonly append a trailing newline, which is never part of the secret
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func readKeyringSecret(key string) (string, error) {
+	value, err := keyring.Get(keyringServiceName(), key)
+	if err != nil {
+		if errors.Is(err, keyring.ErrNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failure reading %s from the keyring: %w", key, err)
+	}
+	return value, nil
+}
+
+// StoreSecrets moves the credentials among the settings into the platform keyring, leaving only the other settings behind
+func StoreSecrets(settings map[string]string) error {
+	for _, key := range secretEnvVarKeys {
+		value, ok := settings[key]
+		if !ok {
+			continue
+		}
+		if err := keyring.Set(keyringServiceName(), key, value); err != nil {
+			return fmt.Errorf("failure storing %s in the keyring: %w", key, err)
+		}
+		delete(settings, key)
+	}
+	settings[EnvVarKeyCredentialStore] = credentialStoreKeyring
+	return nil
+}
+
+// keyringServiceName scopes the keyring entries to the active profile, so every profile keeps its own credentials
+func keyringServiceName() string {
+	if profile := os.Getenv(EnvVarKeyProfile); profile != "" {
+		return fmt.Sprintf("%s/%s", keyringService, profile)
+	}
+	return keyringService
+}
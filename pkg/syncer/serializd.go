@@ -0,0 +1,336 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileFormatSerializd reads the data export of serializd, a tracker of shows which identifies shows and seasons by their tmdb ids
+const FileFormatSerializd = "serializd"
+
+const (
+	defaultSerializdCommentsPath = "serializd-comments.json"
+
+	traktCommentMinWords = 5
+)
+
+type serializdExport struct {
+	Reviews        []serializdEntry `json:"reviews"`
+	Watched        []serializdEntry `json:"watched"`
+	WatchedSeasons []serializdEntry `json:"watchedSeasons"`
+}
+
+// serializdEntry is a review or a watched show, season or episode of the export. An entry without a season number
+// is about the whole show, and one without an episode number about the whole season.
+type serializdEntry struct {
+	Id              int    `json:"id"`
+	ShowId          int    `json:"showId"`
+	ShowName        string `json:"showName"`
+	SeasonId        int    `json:"seasonId"`
+	SeasonNumber    *int   `json:"seasonNumber"`
+	EpisodeNumber   *int   `json:"episodeNumber"`
+	Rating          int    `json:"rating"` // out of 10, where 0 is unrated
+	ReviewText      string `json:"reviewText"`
+	ContainsSpoiler bool   `json:"containsSpoiler"`
+	DateAdded       string `json:"dateAdded"`
+	Backdate        string `json:"backdate"`
+}
+
+// date returns when the entry was watched, which serializd records as a backdate when it was logged later
+func (e *serializdEntry) date() *string {
+	value := e.Backdate
+	if value == "" {
+		value = e.DateAdded
+	}
+	if date, err := parseImportDate(value); err == nil {
+		return &date
+	}
+	return nil
+}
+
+// commentKey identifies a review, so it is commented on trakt only once
+func (e *serializdEntry) commentKey() string {
+	if e.Id != 0 {
+		return fmt.Sprint(e.Id)
+	}
+	return fmt.Sprintf("%d/%d/%d/%s", e.ShowId, intValue(e.SeasonNumber), intValue(e.EpisodeNumber), e.DateAdded)
+}
+
+func intValue(value *int) int {
+	if value == nil {
+		return -1
+	}
+	return *value
+}
+
+// serializdComments records the reviews already commented on trakt, as importing the same export again would duplicate them
+type serializdComments struct {
+	path   string
+	Posted map[string]bool `json:"posted"`
+}
+
+func SerializdCommentsPath() string {
+	return StatePath(defaultSerializdCommentsPath)
+}
+
+func loadSerializdComments(path string) (*serializdComments, error) {
+	comments := &serializdComments{
+		path:   path,
+		Posted: make(map[string]bool),
+	}
+	if err := readJson(path, comments); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if comments.Posted == nil {
+		comments.Posted = make(map[string]bool)
+	}
+	return comments, nil
+}
+
+func (c *serializdComments) save() error {
+	return writeJson(c.path, c)
+}
+
+// ImportSerializd adds the watched shows, seasons and episodes of a serializd export to the trakt history, its ratings
+// to the trakt ratings, and its reviews as trakt comments. Shows are looked up on trakt by their tmdb id, and those trakt
+// does not know are skipped. Reviews shorter than trakt allows and reviews of episodes are not commented.
+func (s *Syncer) ImportSerializd(path string) error {
+	export := serializdExport{}
+	if err := readJson(path, &export); err != nil {
+		s.logger.Error("failure reading serializd export", zap.Error(err))
+		return err
+	}
+	watched := append(export.Watched, export.WatchedSeasons...)
+	// the latest review of an item wins, as reviews of rewatches come after the first ones
+	sort.SliceStable(export.Reviews, func(i, j int) bool {
+		return strings.Compare(stringValue(export.Reviews[i].date()), stringValue(export.Reviews[j].date())) < 0
+	})
+	showIds, err := s.serializdShowIds(append(watched, export.Reviews...))
+	if err != nil {
+		s.logger.Error("failure looking up serializd shows on trakt", zap.Error(err))
+		return err
+	}
+	history := newSerializdShows()
+	ratings := newSerializdShows()
+	for i := range watched {
+		entry := &watched[i]
+		if ids, found := showIds[entry.ShowId]; found {
+			history.watch(ids, entry)
+		}
+	}
+	for i := range export.Reviews {
+		entry := &export.Reviews[i]
+		ids, found := showIds[entry.ShowId]
+		if !found {
+			continue
+		}
+		if entry.Rating >= 1 && entry.Rating <= 10 {
+			ratings.rate(ids, entry)
+		}
+		// a review of a season or an episode tells it was watched, unlike a review of a whole show
+		if entry.SeasonNumber != nil {
+			history.watch(ids, entry)
+		}
+	}
+	plan := &entities.SyncPlan{
+		CreatedAt: time.Now(),
+	}
+	for _, operation := range []entities.SyncOperation{
+		{Action: entities.SyncActionAdd, Target: entities.SyncTargetHistory, Items: history.items()},
+		{Action: entities.SyncActionAdd, Target: entities.SyncTargetRatings, Items: ratings.items()},
+	} {
+		if len(operation.Items) > 0 {
+			plan.Operations = append(plan.Operations, operation)
+		}
+	}
+	if len(plan.Operations) > 0 {
+		if err = s.applyAndRecord(plan); err != nil {
+			s.logger.Error(fmt.Sprintf("failure importing %s", path), zap.Error(err))
+			return err
+		}
+	}
+	commented, err := s.commentSerializdReviews(export.Reviews, showIds)
+	if err != nil {
+		s.logger.Error("failure commenting serializd reviews on trakt", zap.Error(err))
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("imported %d watched show(s), %d rated show(s) and %d review(s) from %s to trakt", len(history.items()), len(ratings.items()), commented, path))
+	return nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// serializdShowIds looks up the trakt ids of the shows of the entries by their tmdb ids, leaving out those trakt does not know
+func (s *Syncer) serializdShowIds(entries []serializdEntry) (map[int]entities.TraktIds, error) {
+	showIds := make(map[int]entities.TraktIds)
+	searched := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.ShowId == 0 || searched[entry.ShowId] {
+			continue
+		}
+		searched[entry.ShowId] = true
+		ids, err := s.traktClient.SearchTmdbId(entities.TraktItemTypeShow, entry.ShowId)
+		if err != nil {
+			return nil, fmt.Errorf("failure searching trakt for show %s: %w", entry.ShowName, err)
+		}
+		if ids == nil || ids.Imdb == "" {
+			s.logger.Warn(fmt.Sprintf("skipping show %s, as trakt does not know its tmdb id %d or has no imdb id for it", entry.ShowName, entry.ShowId))
+			continue
+		}
+		showIds[entry.ShowId] = entities.TraktIds{Imdb: ids.Imdb}
+	}
+	return showIds, nil
+}
+
+// serializdShows gathers the seasons and episodes of every show, so each show is synced once
+type serializdShows struct {
+	order []string
+	shows map[string]*entities.TraktItemSpec
+}
+
+func newSerializdShows() *serializdShows {
+	return &serializdShows{
+		shows: make(map[string]*entities.TraktItemSpec),
+	}
+}
+
+func (s *serializdShows) show(ids entities.TraktIds) *entities.TraktItemSpec {
+	show, found := s.shows[ids.Imdb]
+	if !found {
+		show = &entities.TraktItemSpec{Ids: ids}
+		s.shows[ids.Imdb] = show
+		s.order = append(s.order, ids.Imdb)
+	}
+	return show
+}
+
+func season(show *entities.TraktItemSpec, number int) *entities.TraktSeason {
+	for i := range show.Seasons {
+		if show.Seasons[i].Number == number {
+			return &show.Seasons[i]
+		}
+	}
+	show.Seasons = append(show.Seasons, entities.TraktSeason{Number: number})
+	return &show.Seasons[len(show.Seasons)-1]
+}
+
+func episode(season *entities.TraktSeason, number int) *entities.TraktEpisode {
+	for i := range season.Episodes {
+		if season.Episodes[i].Number == number {
+			return &season.Episodes[i]
+		}
+	}
+	season.Episodes = append(season.Episodes, entities.TraktEpisode{Number: number})
+	return &season.Episodes[len(season.Episodes)-1]
+}
+
+// watch adds the entry to the history of its show. Trakt only adds the seasons of a show, or the episodes of a season,
+// when they are given, so a watched show or season drops its seasons or episodes, and those of an already watched one are left out.
+func (s *serializdShows) watch(ids entities.TraktIds, entry *serializdEntry) {
+	show := s.show(ids)
+	if entry.SeasonNumber == nil {
+		show.WatchedAt, show.Seasons = entry.date(), nil
+		return
+	}
+	if show.WatchedAt != nil && len(show.Seasons) == 0 {
+		return
+	}
+	watchedSeason := season(show, *entry.SeasonNumber)
+	if entry.EpisodeNumber == nil {
+		watchedSeason.WatchedAt, watchedSeason.Episodes = entry.date(), nil
+		return
+	}
+	if watchedSeason.WatchedAt != nil && len(watchedSeason.Episodes) == 0 {
+		return
+	}
+	episode(watchedSeason, *entry.EpisodeNumber).WatchedAt = entry.date()
+}
+
+func (s *serializdShows) rate(ids entities.TraktIds, entry *serializdEntry) {
+	show := s.show(ids)
+	rating := entry.Rating
+	switch {
+	case entry.SeasonNumber == nil:
+		show.Rating, show.RatedAt = &rating, entry.date()
+	case entry.EpisodeNumber == nil:
+		ratedSeason := season(show, *entry.SeasonNumber)
+		ratedSeason.Rating, ratedSeason.RatedAt = &rating, entry.date()
+	default:
+		ratedEpisode := episode(season(show, *entry.SeasonNumber), *entry.EpisodeNumber)
+		ratedEpisode.Rating, ratedEpisode.RatedAt = &rating, entry.date()
+	}
+}
+
+func (s *serializdShows) items() entities.TraktItems {
+	items := make(entities.TraktItems, 0, len(s.order))
+	for _, id := range s.order {
+		items = append(items, entities.TraktItem{
+			Type: entities.TraktItemTypeShow,
+			Show: *s.shows[id],
+		})
+	}
+	return items
+}
+
+// commentSerializdReviews comments the reviews of shows and seasons on trakt, skipping those commented by an earlier import,
+// and returns how many it commented
+func (s *Syncer) commentSerializdReviews(reviews []serializdEntry, showIds map[int]entities.TraktIds) (int, error) {
+	comments, err := loadSerializdComments(SerializdCommentsPath())
+	if err != nil {
+		return 0, err
+	}
+	commented, skipped := 0, 0
+	for i := range reviews {
+		review := &reviews[i]
+		ids, found := showIds[review.ShowId]
+		text := strings.TrimSpace(review.ReviewText)
+		if !found || text == "" || comments.Posted[review.commentKey()] {
+			continue
+		}
+		if review.EpisodeNumber != nil || (review.SeasonNumber != nil && review.SeasonId == 0) || len(strings.Fields(text)) < traktCommentMinWords {
+			skipped++
+			continue
+		}
+		comment := entities.TraktComment{
+			Comment: text,
+			Spoiler: review.ContainsSpoiler,
+		}
+		if review.SeasonNumber == nil {
+			comment.Show = &entities.TraktItemSpec{Ids: ids}
+		} else {
+			comment.Season = &entities.TraktItemSpec{Ids: entities.TraktIds{Tmdb: review.SeasonId}}
+		}
+		posted, err := s.traktClient.CommentAdd(comment)
+		if isRejection(err) {
+			// the review is not recorded, so the next import comments it again
+			s.logger.Warn(fmt.Sprintf("trakt rejected the comment of the review of %s", review.ShowName), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return commented, fmt.Errorf("failure commenting the review of %s: %w", review.ShowName, err)
+		}
+		if !posted {
+			continue
+		}
+		comments.Posted[review.commentKey()] = true
+		if err = comments.save(); err != nil {
+			return commented, err
+		}
+		commented++
+	}
+	if skipped > 0 {
+		s.logger.Warn(fmt.Sprintf("skipped %d review(s) of episodes or shorter than the %d words trakt requires", skipped, traktCommentMinWords))
+	}
+	return commented, nil
+}
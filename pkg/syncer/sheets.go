@@ -0,0 +1,123 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	stepSheets = "sheets"
+
+	sheetTitleRatings   = "Ratings"
+	sheetTitleWatchlist = "Watchlist"
+	sheetTitleMaxLength = 100
+)
+
+var (
+	sheetHeaderList    = []interface{}{"Position", "IMDb ID", "Type"}
+	sheetHeaderRatings = []interface{}{"IMDb ID", "Type", "Rating", "Rated"}
+)
+
+// googleSheetsEnabled reports whether the synced data is written to a google sheet, which takes both a service account key and the spreadsheet id
+func googleSheetsEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeyGoogleSheetsCreds] != "" && secrets[EnvVarKeyGoogleSheetsId] != ""
+}
+
+func newGoogleSheetsClient(secrets map[string]string, logger *zap.Logger) (client.GoogleSheetsClientInterface, error) {
+	return client.NewGoogleSheetsClient(
+		client.GoogleSheetsConfig{
+			Credentials:   secrets[EnvVarKeyGoogleSheetsCreds],
+			SpreadsheetId: secrets[EnvVarKeyGoogleSheetsId],
+		},
+		logger,
+	)
+}
+
+// sheet is a worksheet along with its rows, the first of which is the header
+type sheet struct {
+	title string
+	rows  [][]interface{}
+}
+
+// writeGoogleSheets writes the same items as the file target to the spreadsheet while trakt is synced, with a worksheet for the watchlist,
+// every list and the ratings. The worksheets of the lists no longer synced are left alone. It returns the name of the target when it failed.
+func (s *Syncer) writeGoogleSheets() []string {
+	if s.googleSheetsClient == nil {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepSheets, start)
+	sheets := googleSheets(s.fileTargetRecords(), s.syncWatchlist, s.syncRatings)
+	for _, sheet := range sheets {
+		if err := s.googleSheetsClient.SheetWrite(sheet.title, sheet.rows); err != nil {
+			s.logger.Error("failure writing google sheets", zap.Error(err))
+			return []string{stepSheets}
+		}
+	}
+	s.logger.Info(fmt.Sprintf("wrote %d worksheet(s) to google sheets", len(sheets)))
+	return nil
+}
+
+// googleSheets groups the records by worksheet, in the order of the records. The watchlist and ratings worksheets are written even
+// when empty while they are synced, so removed items do not linger in them. Lists sharing a title, or taking that of the watchlist
+// or ratings, are told apart by their id.
+func googleSheets(records []fileTargetRecord, watchlist, ratings bool) []sheet {
+	var sheets []sheet
+	indexes := make(map[string]int) // the index of the worksheet of every target and list id
+	titles := map[string]bool{
+		strings.ToLower(sheetTitleRatings):   true,
+		strings.ToLower(sheetTitleWatchlist): true,
+	}
+	if watchlist {
+		sheets = append(sheets, sheet{title: sheetTitleWatchlist, rows: [][]interface{}{sheetHeaderList}})
+		indexes[entities.SyncTargetWatchlist] = 0
+	}
+	for _, record := range records {
+		key := record.Target + record.ListId
+		index, found := indexes[key]
+		if !found {
+			index = len(sheets)
+			indexes[key] = index
+			newSheet := sheet{title: sheetTitleWatchlist, rows: [][]interface{}{sheetHeaderList}}
+			switch record.Target {
+			case entities.SyncTargetRatings:
+				newSheet = sheet{title: sheetTitleRatings, rows: [][]interface{}{sheetHeaderRatings}}
+			case entities.SyncTargetList:
+				newSheet.title = sheetTitle(record.ListName, record.ListId, titles)
+			}
+			sheets = append(sheets, newSheet)
+		}
+		var row []interface{}
+		if record.Target == entities.SyncTargetRatings {
+			row = []interface{}{record.ImdbId, record.Type, *record.Rating, ""}
+			if record.RatedAt != nil {
+				row[3] = *record.RatedAt
+			}
+		} else {
+			row = []interface{}{record.Position, record.ImdbId, record.Type}
+		}
+		sheets[index].rows = append(sheets[index].rows, row)
+	}
+	if _, found := indexes[entities.SyncTargetRatings]; ratings && !found {
+		sheets = append(sheets, sheet{title: sheetTitleRatings, rows: [][]interface{}{sheetHeaderRatings}})
+	}
+	return sheets
+}
+
+// sheetTitle returns the title of the worksheet of a list, suffixed with the list id when another worksheet has the title already,
+// as google compares titles regardless of case
+func sheetTitle(listName, listId string, titles map[string]bool) string {
+	title := strings.TrimSpace(listName)
+	if title == "" || titles[strings.ToLower(title)] {
+		title = strings.TrimSpace(fmt.Sprintf("%s %s", title, listId))
+	}
+	if runes := []rune(title); len(runes) > sheetTitleMaxLength {
+		title = string(runes[:sheetTitleMaxLength])
+	}
+	titles[strings.ToLower(title)] = true
+	return title
+}
@@ -0,0 +1,188 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/zalando/go-keyring"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSimklTokenPath = "simkl-token"
+	keyringSimklToken     = "SIMKL_TOKEN"
+	stepSimkl             = "simkl"
+)
+
+func SimklTokenPath() string {
+	return StatePath(defaultSimklTokenPath)
+}
+
+// simklEnabled reports whether the watchlist, ratings and history are pushed to simkl, which takes the client id of a simkl application
+func simklEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeySimklClientId] != ""
+}
+
+// AuthorizeSimkl runs the simkl pin flow once and stores the access token, which never expires
+func AuthorizeSimkl(prompt func(codes *entities.SimklAuthCodesResponse)) error {
+	secrets, err := readSecrets()
+	if err != nil {
+		return &ConfigError{err: err}
+	}
+	if secrets[EnvVarKeySimklClientId] == "" {
+		return &ConfigError{err: &MissingEnvironmentVariablesError{variables: []string{EnvVarKeySimklClientId}}}
+	}
+	token, err := client.AuthorizeSimkl(
+		client.SimklConfig{
+			ClientId: secrets[EnvVarKeySimklClientId],
+		},
+		logger.NewLogger(),
+		prompt,
+	)
+	if err != nil {
+		return err
+	}
+	return saveSimklToken(token)
+}
+
+// simklAccessToken returns the access token set through SIMKL_ACCESS_TOKEN, falling back to the one stored by the auth command
+func simklAccessToken(secrets map[string]string) (string, error) {
+	if token := secrets[EnvVarKeySimklAccessToken]; token != "" {
+		return token, nil
+	}
+	var token string
+	if os.Getenv(EnvVarKeyCredentialStore) == credentialStoreKeyring {
+		value, err := keyring.Get(keyringServiceName(), keyringSimklToken)
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return "", fmt.Errorf("failure reading simkl access token from the keyring: %w", err)
+		}
+		token = value
+	} else {
+		path := SimklTokenPath()
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failure reading simkl access token from %s: %w", path, err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return "", fmt.Errorf("simkl is not authorized, run the auth command with --simkl or set %s", EnvVarKeySimklAccessToken)
+	}
+	logger.AddSecrets(token)
+	return token, nil
+}
+
+func saveSimklToken(token string) error {
+	if os.Getenv(EnvVarKeyCredentialStore) == credentialStoreKeyring {
+		if err := keyring.Set(keyringServiceName(), keyringSimklToken, token); err != nil {
+			return fmt.Errorf("failure storing simkl access token in the keyring: %w", err)
+		}
+		return nil
+	}
+	path := SimklTokenPath()
+	if err := os.WriteFile(path, []byte(token), 0600); err != nil {
+		return fmt.Errorf("failure writing simkl access token to %s: %w", path, err)
+	}
+	return nil
+}
+
+func newSimklClient(secrets map[string]string, logger *zap.Logger) (client.SimklClientInterface, error) {
+	token, err := simklAccessToken(secrets)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewSimklClient(
+		client.SimklConfig{
+			ClientId:    secrets[EnvVarKeySimklClientId],
+			AccessToken: token,
+			SyncMode:    os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: map[string]string{
+				entities.SyncTargetHistory:   os.Getenv(EnvVarKeySyncModeHistory),
+				entities.SyncTargetRatings:   os.Getenv(EnvVarKeySyncModeRatings),
+				entities.SyncTargetWatchlist: os.Getenv(EnvVarKeySyncModeWatchlist),
+			},
+		},
+		logger,
+	)
+}
+
+// pushSimkl pushes the source to simkl alongside trakt: the watchlist is added to the plan to watch list, leaving alone the items
+// simkl already tracks, the ratings replace those of simkl, and the rated movies are marked as watched when the history is synced.
+// Rated shows are not marked as watched, as simkl would mark every episode, and neither are episodes, which simkl cannot look up by imdb id.
+// It returns the name of the target when it failed.
+func (s *Syncer) pushSimkl() []string {
+	if s.simklClient == nil {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepSimkl, start)
+	if err := s.pushSimklItems(); err != nil {
+		s.logger.Error("failure pushing to simkl", zap.Error(err))
+		return []string{stepSimkl}
+	}
+	return nil
+}
+
+func (s *Syncer) pushSimklItems() error {
+	current, err := s.simklClient.ItemsGet()
+	if err != nil {
+		return err
+	}
+	tracked := make(map[string]entities.SimklItem, len(current))
+	for _, item := range current {
+		tracked[item.ImdbId] = item
+	}
+	if s.syncWatchlist {
+		var toAdd []entities.SimklItem
+		for _, imdbList := range s.user.imdbLists {
+			if !imdbList.IsWatchlist {
+				continue
+			}
+			for _, imdbItem := range imdbList.ListItems {
+				if item, ok := entities.NewSimklItem(imdbItem); ok && tracked[item.ImdbId].Status == "" {
+					toAdd = append(toAdd, item)
+				}
+			}
+		}
+		if err = s.simklClient.WatchlistAdd(toAdd); err != nil {
+			return fmt.Errorf("failure adding simkl watchlist items: %w", err)
+		}
+	}
+	var toRate, toUnrate, toWatch []entities.SimklItem
+	for _, imdbItem := range s.user.imdbRatings {
+		item, ok := entities.NewSimklItem(imdbItem)
+		if !ok || item.Rating == nil {
+			continue
+		}
+		simklItem := tracked[item.ImdbId]
+		if s.syncRatings && (simklItem.Rating == nil || *simklItem.Rating != *item.Rating) {
+			toRate = append(toRate, item)
+		}
+		// an item rated in the source counts as watched, as it does when the trakt history is synced
+		if !s.skipHistory && item.Type == entities.SimklItemTypeMovie && simklItem.Status != entities.SimklStatusCompleted {
+			toWatch = append(toWatch, item)
+		}
+	}
+	if s.syncRatings {
+		for _, item := range current {
+			if _, found := s.user.imdbRatings[item.ImdbId]; item.Rating != nil && !found {
+				toUnrate = append(toUnrate, item)
+			}
+		}
+	}
+	if err = s.simklClient.RatingsAdd(toRate); err != nil {
+		return fmt.Errorf("failure rating simkl items: %w", err)
+	}
+	if err = s.simklClient.RatingsRemove(toUnrate); err != nil {
+		return fmt.Errorf("failure removing simkl ratings: %w", err)
+	}
+	if err = s.simklClient.HistoryAdd(toWatch); err != nil {
+		return fmt.Errorf("failure adding simkl history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package syncer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const stateDirName = "imdb-trakt-sync"
+
+// StateDir returns the directory holding the persistent state, such as tokens, the retry queue, run stats and backups.
+// It is set through STATE_DIR, falling back to $XDG_STATE_HOME/imdb-trakt-sync or ~/.local/state/imdb-trakt-sync.
+func StateDir() string {
+	if dir := os.Getenv(EnvVarKeyStateDir); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, stateDirName)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(home, ".local", "state", stateDirName)
+}
+
+// StatePath returns the path of a state file in the state directory, creating the directory when it is missing.
+// The file name is suffixed with the active profile, so profiles never share state. A file left in the working directory
+// by an earlier version keeps being used, unless STATE_DIR is set.
+func StatePath(name string) string {
+	name = profileFileName(name)
+	if os.Getenv(EnvVarKeyStateDir) == "" {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	dir := StateDir()
+	// a failure surfaces once the state file is written, with the path in the error
+	_ = os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, name)
+}
+
+func profileFileName(name string) string {
+	profile := os.Getenv(EnvVarKeyProfile)
+	if profile == "" {
+		return name
+	}
+	extension := filepath.Ext(name)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, extension), profile, extension)
+}
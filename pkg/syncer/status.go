@@ -0,0 +1,77 @@
+package syncer
+
+import (
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/stats"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Status describes the state left behind by previous runs, read from the state directory
+type Status struct {
+	LastRun             *stats.Run  `json:"last_run,omitempty"`
+	LastSuccessfulRun   *stats.Run  `json:"last_successful_run,omitempty"`
+	PendingOperations   int         `json:"pending_operations"`
+	TraktTokensExpireAt *time.Time  `json:"trakt_tokens_expire_at,omitempty"`
+	PendingChanges      *PlanTotals `json:"pending_changes,omitempty"`
+}
+
+// PlanTotals counts the changes a sync would make
+type PlanTotals struct {
+	Operations   int `json:"operations"`
+	ItemsAdded   int `json:"items_added"`
+	ItemsRemoved int `json:"items_removed"`
+}
+
+// ReadStatus reads the run statistics, retry queue and stored trakt tokens without contacting imdb or trakt
+func ReadStatus() (*Status, error) {
+	status := &Status{}
+	runs, err := stats.NewStore(RunStatsPath()).Load()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if status.LastRun == nil {
+			status.LastRun = &runs[i]
+		}
+		if runs[i].Error == "" {
+			status.LastSuccessfulRun = &runs[i]
+			break
+		}
+	}
+	queue, err := loadRetryQueue(RetryQueuePath())
+	if err != nil {
+		return nil, err
+	}
+	status.PendingOperations = len(queue.Operations)
+	tokens, err := loadTraktTokens()
+	if err != nil {
+		return nil, err
+	}
+	if tokens != nil {
+		expiresAt := tokens.ExpiresAt()
+		status.TraktTokensExpireAt = &expiresAt
+	}
+	return status, nil
+}
+
+// PlanTotals computes the changes a sync would make without applying them
+func (s *Syncer) PlanTotals() (*PlanTotals, error) {
+	if err := s.runPhase(PhaseHydrate, s.hydrate); err != nil {
+		s.logger.Error("failure hydrating", zap.Error(err))
+		return nil, err
+	}
+	plan, err := s.buildPlan()
+	if err != nil {
+		s.logger.Error("failure building sync plan", zap.Error(err))
+		return nil, err
+	}
+	summary := entities.SyncSummary{
+		Operations: plan.Operations,
+	}
+	return &PlanTotals{
+		Operations:   len(plan.Operations),
+		ItemsAdded:   summary.ItemsAdded(),
+		ItemsRemoved: summary.ItemsRemoved(),
+	}, nil
+}
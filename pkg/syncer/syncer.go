@@ -1,35 +1,183 @@
 package syncer
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/console"
 	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/events"
+	"github.com/cecobask/imdb-trakt-sync/pkg/history"
 	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/cecobask/imdb-trakt-sync/pkg/metrics"
+	"github.com/cecobask/imdb-trakt-sync/pkg/notify"
+	"github.com/cecobask/imdb-trakt-sync/pkg/sentry"
+	"github.com/cecobask/imdb-trakt-sync/pkg/stats"
+	"github.com/cecobask/imdb-trakt-sync/pkg/tracing"
+	"github.com/cecobask/imdb-trakt-sync/pkg/version"
 	"go.uber.org/zap"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
+	EnvVarKeyAirtableBaseId    = "AIRTABLE_BASE_ID"
+	EnvVarKeyAirtableFields    = "AIRTABLE_FIELDS"
+	EnvVarKeyAirtableTable     = "AIRTABLE_TABLE"
+	EnvVarKeyAirtableToken     = "AIRTABLE_TOKEN"
+	EnvVarKeyAniListToken      = "ANILIST_ACCESS_TOKEN"
+	EnvVarKeyAnimeMapping      = "ANIME_MAPPING"
+	EnvVarKeyAnimeMappingUrl   = "ANIME_MAPPING_URL"
+	EnvVarKeyAnomalyMinItems   = "ANOMALY_MIN_ITEMS"
+	EnvVarKeyAnomalyThreshold  = "ANOMALY_THRESHOLD"
+	EnvVarKeyCleanupLists      = "CLEANUP_ORPHANED_LISTS"
+	EnvVarKeyAuditLogPath      = "AUDIT_LOG_PATH"
+	EnvVarKeyCredentialStore   = "CREDENTIAL_STORE"
+	EnvVarKeyEmbyApiKey        = "EMBY_API_KEY"
+	EnvVarKeyEmbyFavorite      = "EMBY_FAVORITE_RATING"
+	EnvVarKeyEmbyTarget        = "EMBY_TARGET"
+	EnvVarKeyEmbyUrl           = "EMBY_URL"
+	EnvVarKeyEmbyUser          = "EMBY_USER"
+	EnvVarKeyFailureReportPath = "FAILURE_REPORT_PATH"
+	EnvVarKeyFileTargetPath    = "FILE_TARGET_PATH"
+	EnvVarKeyGoogleSheetsCreds = "GOOGLE_SHEETS_CREDENTIALS"
+	EnvVarKeyGoogleSheetsId    = "GOOGLE_SHEETS_ID"
 	EnvVarKeyCookieAtMain      = "IMDB_COOKIE_AT_MAIN"
 	EnvVarKeyCookieUbidMain    = "IMDB_COOKIE_UBID_MAIN"
 	EnvVarKeyListIds           = "IMDB_LIST_IDS"
+	EnvVarKeyListMerges        = "IMDB_LIST_MERGES"
+	EnvVarKeyRankedListIds     = "IMDB_RANKED_LIST_IDS"
+	EnvVarKeyImportColumns     = "IMPORT_CSV_COLUMNS"
+	EnvVarKeyJellyfinApiKey    = "JELLYFIN_API_KEY"
+	EnvVarKeyJellyfinFavorite  = "JELLYFIN_FAVORITE_RATING"
+	EnvVarKeyJellyfinTarget    = "JELLYFIN_TARGET"
+	EnvVarKeyJellyfinUrl       = "JELLYFIN_URL"
+	EnvVarKeyJellyfinUser      = "JELLYFIN_USER"
+	EnvVarKeyKodiLibraryPath   = "KODI_LIBRARY_PATH"
+	EnvVarKeyKodiPassword      = "KODI_PASSWORD"
+	EnvVarKeyKodiUrl           = "KODI_URL"
+	EnvVarKeyKodiUsername      = "KODI_USERNAME"
+	EnvVarKeyListItemNotes     = "LIST_ITEM_NOTES"
+	EnvVarKeyMalAccessToken    = "MAL_ACCESS_TOKEN"
+	EnvVarKeyNotionDatabaseId  = "NOTION_DATABASE_ID"
+	EnvVarKeyNotionToken       = "NOTION_TOKEN"
+	EnvVarKeyPlexTarget        = "PLEX_TARGET"
+	EnvVarKeyPlexToken         = "PLEX_TOKEN"
+	EnvVarKeyPlexUrl           = "PLEX_URL"
+	EnvVarKeyRatingsConflict   = "RATINGS_CONFLICT_POLICY"
+	EnvVarKeyRatingsListName   = "RATINGS_LIST_NAME"
+	EnvVarKeyRemovalGrace      = "REMOVAL_GRACE_PERIOD"
+	EnvVarKeyRetryQueuePath    = "RETRY_QUEUE_PATH"
+	EnvVarKeyRunHistoryDir     = "RUN_HISTORY_DIR"
+	EnvVarKeyRunHistoryLimit   = "RUN_HISTORY_LIMIT"
+	EnvVarKeyRunStatsPath      = "RUN_STATS_PATH"
+	EnvVarKeySimklAccessToken  = "SIMKL_ACCESS_TOKEN"
+	EnvVarKeySimklClientId     = "SIMKL_CLIENT_ID"
 	EnvVarKeySkipHistory       = "SKIP_HISTORY"
+	EnvVarKeySkipHistoryKnown  = "SKIP_HISTORY_FOR_COLLECTED_OR_WATCHED"
+	EnvVarKeySplitListsByType  = "SPLIT_LISTS_BY_TYPE"
+	EnvVarKeyStateDir          = "STATE_DIR"
+	EnvVarKeyStremioAuthKey    = "STREMIO_AUTH_KEY"
+	EnvVarKeyStremioEmail      = "STREMIO_EMAIL"
+	EnvVarKeyStremioPassword   = "STREMIO_PASSWORD"
+	EnvVarKeyConcurrency       = "SYNC_CONCURRENCY"
+	EnvVarKeySyncHistory       = "SYNC_HISTORY"
+	EnvVarKeyHistorySince      = "SYNC_HISTORY_SINCE"
+	EnvVarKeySyncInterval      = "SYNC_INTERVAL"
+	EnvVarKeySyncJitter        = "SYNC_JITTER"
+	EnvVarKeySyncLists         = "SYNC_LISTS"
+	EnvVarKeyProfile           = "SYNC_PROFILE"
 	EnvVarKeySyncMode          = "SYNC_MODE"
+	EnvVarKeySyncModeHistory   = "SYNC_MODE_HISTORY"
+	EnvVarKeySyncModeLists     = "SYNC_MODE_LISTS"
+	EnvVarKeySyncModeRatings   = "SYNC_MODE_RATINGS"
+	EnvVarKeySyncModeWatchlist = "SYNC_MODE_WATCHLIST"
+	EnvVarKeySyncRatings       = "SYNC_RATINGS"
+	EnvVarKeySyncSource        = "SYNC_SOURCE"
+	EnvVarKeySyncWatchlist     = "SYNC_WATCHLIST"
+	EnvVarKeyTmdbApiKey        = "TMDB_API_KEY"
+	EnvVarKeyTmdbFavorites     = "TMDB_FAVORITES_LIST_ID"
+	EnvVarKeyTmdbSessionId     = "TMDB_SESSION_ID"
+	EnvVarKeyTraktBudgetWeight = "TRAKT_BUDGET_WEIGHTS"
 	EnvVarKeyTraktClientId     = "TRAKT_CLIENT_ID"
 	EnvVarKeyTraktClientSecret = "TRAKT_CLIENT_SECRET"
 	EnvVarKeyTraktEmail        = "TRAKT_EMAIL"
 	EnvVarKeyTraktPassword     = "TRAKT_PASSWORD"
+	EnvVarKeyRateLimitWarn     = "TRAKT_RATE_LIMIT_WARN_PERCENT"
+	EnvVarKeyTraktTokensPath   = "TRAKT_TOKENS_PATH"
+	EnvVarKeyTimezone          = "TZ"
+	EnvVarKeyTraktBudget       = "TRAKT_REQUEST_BUDGET"
+	EnvVarKeyWatchlistTarget   = "WATCHLIST_TARGET_LIST"
+
+	defaultConcurrency     = 4
+	defaultSyncInterval    = 6 * time.Hour
+	defaultRunStatsPath    = "run-stats.db"
+	defaultRunHistory      = "run-history"
+	defaultRunHistoryLimit = 100
+
+	ratingsConflictPolicyHigher = "higher"
+	ratingsConflictPolicyImdb   = "imdb"
+	ratingsConflictPolicyNewer  = "newer"
+	ratingsConflictPolicyPrompt = "prompt"
+	ratingsConflictPolicyTrakt  = "trakt"
 )
 
+var stdin = bufio.NewReader(os.Stdin)
+
 type Syncer struct {
-	logger      *zap.Logger
-	imdbClient  client.ImdbClientInterface
-	traktClient client.TraktClientInterface
-	user        *user
-	skipHistory bool
+	ctx                   context.Context
+	logger                *zap.Logger
+	imdbClient            client.ImdbClientInterface
+	traktClient           client.TraktClientInterface
+	tmdbClient            client.TmdbClientInterface
+	simklClient           client.SimklClientInterface
+	notionClient          client.NotionClientInterface
+	googleSheetsClient    client.GoogleSheetsClientInterface
+	airtableClient        client.AirtableClientInterface
+	malClient             client.MalClientInterface
+	aniListClient         client.AniListClientInterface
+	animeMapping          *animeMapping
+	tmdbFavoritesListId   string
+	mediaServers          []*mediaServer
+	user                  *user
+	syncWatchlist         bool
+	syncLists             bool
+	syncRatings           bool
+	skipHistory           bool
+	skipHistoryKnown      bool
+	historySince          *time.Time
+	splitListsByType      bool
+	cleanupOrphanedLists  bool
+	ratingsConflictPolicy string
+	watchlistTargetList   string
+	ratingsListName       string
+	listMerges            map[string][]string
+	retryQueuePath        string
+	retryQueue            *retryQueue
+	requestBudget         int
+	budgetWeights         map[string]int
+	runStats              *stats.Store
+	runHistory            *history.Store
+	auditLog              *auditLog
+	hooks                 []Hooks
+	failedLists           []string
+	concurrency           int
+	interactive           bool
+	force                 bool
+	listItemNotes         bool
+	rankedListIds         []string
+	removalGraceCutoff    *time.Time
+	imdbOnly              bool
+	traktOnly             bool
+	phaseSpan             *tracing.Span
+	timings               *runTimings
 }
 
 type user struct {
@@ -39,9 +187,11 @@ type user struct {
 	traktRatings map[string]entities.TraktItem
 }
 
-func NewSyncer() *Syncer {
+func NewSyncer(opts ...Option) (*Syncer, error) {
 	syncer := &Syncer{
-		logger: logger.NewLogger(),
+		ctx:     context.Background(),
+		logger:  logger.NewLogger(),
+		timings: &runTimings{},
 		user: &user{
 			imdbLists:    make(map[string]entities.ImdbList),
 			imdbRatings:  make(map[string]entities.ImdbItem),
@@ -49,82 +199,608 @@ func NewSyncer() *Syncer {
 			traktRatings: make(map[string]entities.TraktItem),
 		},
 	}
-	if err := validateEnvVars(); err != nil {
-		syncer.logger.Fatal("failure validating environment variables", zap.Error(err))
+	for _, opt := range opts {
+		opt(syncer)
+	}
+	if err := validateEnvVars(syncer.imdbOnly, syncer.traktOnly); err != nil {
+		syncer.logger.Error("failure validating environment variables", zap.Error(err))
+		return nil, &ConfigError{err: err}
 	}
+	secrets, _ := readSecrets()
+	applyDefaultTraktApp(secrets)
+	traktTokens, _ := loadTraktTokens()
+	syncer.syncWatchlist = phaseEnabled(EnvVarKeySyncWatchlist)
+	syncer.syncLists = phaseEnabled(EnvVarKeySyncLists)
+	syncer.syncRatings = phaseEnabled(EnvVarKeySyncRatings)
 	syncer.skipHistory, _ = strconv.ParseBool(os.Getenv(EnvVarKeySkipHistory))
-	imdbClient, err := client.NewImdbClient(
-		client.ImdbConfig{
-			CookieAtMain:   os.Getenv(EnvVarKeyCookieAtMain),
-			CookieUbidMain: os.Getenv(EnvVarKeyCookieUbidMain),
-		},
-		syncer.logger,
-	)
-	if err != nil {
-		syncer.logger.Fatal("failure initialising imdb client", zap.Error(err))
+	syncer.skipHistory = syncer.skipHistory || !phaseEnabled(EnvVarKeySyncHistory)
+	syncer.skipHistoryKnown, _ = strconv.ParseBool(os.Getenv(EnvVarKeySkipHistoryKnown))
+	if value := os.Getenv(EnvVarKeyHistorySince); value != "" {
+		since, _ := parseSince(value, time.Now())
+		syncer.historySince = &since
+	}
+	if value := os.Getenv(EnvVarKeyRemovalGrace); value != "" {
+		cutoff, _ := parseSince(value, time.Now())
+		syncer.removalGraceCutoff = &cutoff
+	}
+	syncer.splitListsByType, _ = strconv.ParseBool(os.Getenv(EnvVarKeySplitListsByType))
+	syncer.cleanupOrphanedLists, _ = strconv.ParseBool(os.Getenv(EnvVarKeyCleanupLists))
+	syncer.listItemNotes, _ = strconv.ParseBool(os.Getenv(EnvVarKeyListItemNotes))
+	syncer.ratingsConflictPolicy = ratingsConflictPolicyImdb
+	if policy := os.Getenv(EnvVarKeyRatingsConflict); policy != "" {
+		syncer.ratingsConflictPolicy = policy
+	}
+	syncer.watchlistTargetList = strings.TrimSpace(os.Getenv(EnvVarKeyWatchlistTarget))
+	syncer.ratingsListName = strings.TrimSpace(os.Getenv(EnvVarKeyRatingsListName))
+	syncer.listMerges, _ = parseListMerges(os.Getenv(EnvVarKeyListMerges))
+	for _, listId := range strings.Split(os.Getenv(EnvVarKeyRankedListIds), ",") {
+		if listId = strings.TrimSpace(listId); listId != "" {
+			syncer.rankedListIds = append(syncer.rankedListIds, listId)
+		}
+	}
+	syncer.runStats = stats.NewStore(RunStatsPath())
+	syncer.runHistory = NewRunHistory()
+	syncer.auditLog = newAuditLog(AuditLogPath())
+	syncer.retryQueuePath = RetryQueuePath()
+	syncer.concurrency = defaultConcurrency
+	if value := os.Getenv(EnvVarKeyConcurrency); value != "" {
+		syncer.concurrency, _ = strconv.Atoi(value)
+	}
+	syncer.requestBudget, _ = strconv.Atoi(os.Getenv(EnvVarKeyTraktBudget))
+	syncer.budgetWeights, _ = parseBudgetWeights(os.Getenv(EnvVarKeyTraktBudgetWeight))
+	if imdbListIdsString := os.Getenv(EnvVarKeyListIds); imdbListIdsString != "" && imdbListIdsString != "all" {
+		imdbListIds := strings.Split(imdbListIdsString, ",")
+		for i := range imdbListIds {
+			listId := strings.ReplaceAll(imdbListIds[i], " ", "")
+			syncer.user.imdbLists[listId] = entities.ImdbList{ListId: listId}
+		}
+		for _, listIds := range syncer.listMerges {
+			for _, listId := range listIds {
+				syncer.user.imdbLists[listId] = entities.ImdbList{ListId: listId}
+			}
+		}
+	}
+	if !syncer.traktOnly && SyncSource() == syncSourceTmdb {
+		tmdbClient, err := newTmdbClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising tmdb client", zap.Error(err))
+			return nil, err
+		}
+		syncer.imdbClient = newTmdbSource(tmdbClient, syncer.logger)
+	} else if !syncer.traktOnly && SyncSource() == syncSourceAniList {
+		aniListClient, err := newAniListClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising anilist client", zap.Error(err))
+			return nil, err
+		}
+		// the source reads its anime through the anime mapping database
+		animeMapping, err := loadAnimeMapping(syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure loading anime mapping database", zap.Error(err))
+			return nil, err
+		}
+		syncer.animeMapping = animeMapping
+		syncer.imdbClient = newAniListSource(aniListClient, animeMapping, syncer.logger)
+	} else if !syncer.traktOnly {
+		imdbClient, err := client.NewImdbClient(
+			client.ImdbConfig{
+				CookieAtMain:   secrets[EnvVarKeyCookieAtMain],
+				CookieUbidMain: secrets[EnvVarKeyCookieUbidMain],
+				Concurrency:    syncer.concurrency,
+			},
+			syncer.logger,
+		)
+		if err != nil {
+			syncer.logger.Error("failure initialising imdb client", zap.Error(err))
+			return nil, err
+		}
+		syncer.imdbClient = imdbClient
+	}
+	if syncer.imdbOnly {
+		return syncer, nil
 	}
-	syncer.imdbClient = imdbClient
 	traktClient, err := client.NewTraktClient(
 		client.TraktConfig{
-			ClientId:     os.Getenv(EnvVarKeyTraktClientId),
-			ClientSecret: os.Getenv(EnvVarKeyTraktClientSecret),
-			Email:        os.Getenv(EnvVarKeyTraktEmail),
-			Password:     os.Getenv(EnvVarKeyTraktPassword),
+			ClientId:     secrets[EnvVarKeyTraktClientId],
+			ClientSecret: secrets[EnvVarKeyTraktClientSecret],
+			Email:        secrets[EnvVarKeyTraktEmail],
+			Password:     secrets[EnvVarKeyTraktPassword],
 			SyncMode:     os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: map[string]string{
+				entities.SyncTargetHistory:   os.Getenv(EnvVarKeySyncModeHistory),
+				entities.SyncTargetList:      os.Getenv(EnvVarKeySyncModeLists),
+				entities.SyncTargetRatings:   os.Getenv(EnvVarKeySyncModeRatings),
+				entities.SyncTargetWatchlist: os.Getenv(EnvVarKeySyncModeWatchlist),
+			},
+			Concurrency:          syncer.concurrency,
+			RateLimitWarnPercent: rateLimitWarnPercent(),
+			Tokens:               traktTokens,
+			OnTokensRefresh:      saveTraktTokens,
 		},
 		syncer.logger,
 	)
 	if err != nil {
-		syncer.logger.Fatal("failure initialising trakt client", zap.Error(err))
+		syncer.logger.Error("failure initialising trakt client", zap.Error(err))
+		return nil, err
 	}
 	syncer.traktClient = traktClient
-	if imdbListIdsString := os.Getenv(EnvVarKeyListIds); imdbListIdsString != "" && imdbListIdsString != "all" {
-		imdbListIds := strings.Split(imdbListIdsString, ",")
-		for i := range imdbListIds {
-			listId := strings.ReplaceAll(imdbListIds[i], " ", "")
-			syncer.user.imdbLists[listId] = entities.ImdbList{ListId: listId}
+	mediaServers, err := newMediaServers(secrets, syncer.logger)
+	if err != nil {
+		syncer.logger.Error("failure initialising media server clients", zap.Error(err))
+		return nil, err
+	}
+	syncer.mediaServers = mediaServers
+	// tmdb is only mirrored into when it is not the source of the sync
+	if tmdbEnabled(secrets) && SyncSource() != syncSourceTmdb {
+		tmdbClient, err := newTmdbClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising tmdb client", zap.Error(err))
+			return nil, err
+		}
+		syncer.tmdbClient = tmdbClient
+		syncer.tmdbFavoritesListId = strings.TrimSpace(os.Getenv(EnvVarKeyTmdbFavorites))
+	}
+	if simklEnabled(secrets) {
+		simklClient, err := newSimklClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising simkl client", zap.Error(err))
+			return nil, err
+		}
+		syncer.simklClient = simklClient
+	}
+	if notionEnabled(secrets) {
+		notionClient, err := newNotionClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising notion client", zap.Error(err))
+			return nil, err
+		}
+		syncer.notionClient = notionClient
+	}
+	if googleSheetsEnabled(secrets) {
+		googleSheetsClient, err := newGoogleSheetsClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising google sheets client", zap.Error(err))
+			return nil, err
+		}
+		syncer.googleSheetsClient = googleSheetsClient
+	}
+	if airtableEnabled(secrets) {
+		airtableClient, err := newAirtableClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising airtable client", zap.Error(err))
+			return nil, err
+		}
+		syncer.airtableClient = airtableClient
+	}
+	if animeMappingEnabled(secrets) && syncer.animeMapping == nil {
+		animeMapping, err := loadAnimeMapping(syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure loading anime mapping database", zap.Error(err))
+			return nil, err
+		}
+		syncer.animeMapping = animeMapping
+	}
+	if malEnabled(secrets) {
+		malClient, err := newMalClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising myanimelist client", zap.Error(err))
+			return nil, err
 		}
+		syncer.malClient = malClient
+	}
+	// anilist is only pushed to when it is not the source of the sync
+	if aniListEnabled(secrets) && SyncSource() != syncSourceAniList {
+		aniListClient, err := newAniListClient(secrets, syncer.logger)
+		if err != nil {
+			syncer.logger.Error("failure initialising anilist client", zap.Error(err))
+			return nil, err
+		}
+		syncer.aniListClient = aniListClient
+	}
+	return syncer, nil
+}
+
+func (s *Syncer) Run() error {
+	release, acquired, err := acquireRunLock()
+	if err != nil {
+		s.logger.Error("failure running the syncer", zap.Error(err))
+		return err
+	}
+	if !acquired {
+		s.logger.Warn("skipping the sync, as another sync of the same profile is still running")
+		return nil
+	}
+	defer release()
+	summary := entities.SyncSummary{
+		Version:   version.Version,
+		StartedAt: time.Now(),
+	}
+	s.runStart()
+	client.ResetTelemetry()
+	s.timings.reset()
+	span := tracing.StartRun("sync", runAttributes()...)
+	err = s.run(&summary)
+	summary.FinishedAt = time.Now()
+	s.recordTelemetry(&summary)
+	s.recordTimings(&summary)
+	span.End(err)
+	s.flushTraces()
+	s.writeFailureReport(summary)
+	s.runComplete(summary, err)
+	s.recordRun(summary, err)
+	if err != nil {
+		s.logger.Error("failure running the syncer", zap.String("version", summary.Version), zap.Error(err))
+		return err
+	}
+	s.logger.Info("successfully ran the syncer", zap.String("version", summary.Version))
+	return nil
+}
+
+// runAttributes annotates the root span of a run with the profile and sync mode
+func runAttributes() []tracing.Attribute {
+	return []tracing.Attribute{
+		tracing.String("sync.profile", os.Getenv(EnvVarKeyProfile)),
+		tracing.String("sync.mode", os.Getenv(EnvVarKeySyncMode)),
+	}
+}
+
+// recordTelemetry attaches the http requests sent during the run to its summary, which helps tuning SYNC_CONCURRENCY
+// and noticing when the rate limits of trakt are the bottleneck
+func (s *Syncer) recordTelemetry(summary *entities.SyncSummary) {
+	summary.Http = client.Telemetry()
+	s.logger.Info(
+		"http requests sent during the run",
+		zap.Int("requests", summary.Http.Requests),
+		zap.Int("retries", summary.Http.Retries),
+		zap.Duration("rate_limit_wait", time.Duration(summary.Http.RateLimitWaitSeconds*float64(time.Second))),
+		zap.Int64("p95_latency_ms", summary.Http.P95LatencyMs),
+	)
+}
+
+func (s *Syncer) flushTraces() {
+	if err := tracing.Flush(); err != nil {
+		s.logger.Warn("failure flushing traces", zap.Error(err))
+	}
+}
+
+// rateLimitWarnPercent returns the percentage of a trakt rate limit left when a warning is logged
+func rateLimitWarnPercent() int {
+	value := os.Getenv(EnvVarKeyRateLimitWarn)
+	if value == "" {
+		return client.DefaultRateLimitWarnPercent
+	}
+	percent, _ := strconv.Atoi(value)
+	return percent
+}
+
+// recordRun appends the outcome of the run to the run stats and saves its summary to the run history
+func (s *Syncer) recordRun(summary entities.SyncSummary, err error) {
+	if statsErr := s.runStats.Append(stats.NewRun(summary, err)); statsErr != nil {
+		s.logger.Warn("failure recording run stats", zap.Error(statsErr))
+	}
+	if historyErr := s.runHistory.Save(history.NewRun(summary, err)); historyErr != nil {
+		s.logger.Warn("failure recording run history", zap.Error(historyErr))
 	}
-	return syncer
 }
 
-func (s *Syncer) Run() {
-	if err := s.hydrate(); err != nil {
-		s.logger.Fatal("failure hydrating imdb client", zap.Error(err))
+// NewRunHistory opens the run history set through RUN_HISTORY_DIR, which defaults to a directory of the state directory
+func NewRunHistory() *history.Store {
+	limit := defaultRunHistoryLimit
+	if value := os.Getenv(EnvVarKeyRunHistoryLimit); value != "" {
+		limit, _ = strconv.Atoi(value)
 	}
-	if err := s.syncLists(); err != nil {
-		s.logger.Fatal("failure syncing lists", zap.Error(err))
+	return history.NewStore(RunHistoryDir(), limit)
+}
+
+func RunHistoryDir() string {
+	if dir := os.Getenv(EnvVarKeyRunHistoryDir); dir != "" {
+		return dir
+	}
+	return StatePath(defaultRunHistory)
+}
+
+func RunStatsPath() string {
+	if path := os.Getenv(EnvVarKeyRunStatsPath); path != "" {
+		return path
 	}
-	if err := s.syncRatings(); err != nil {
-		s.logger.Fatal("failure syncing ratings", zap.Error(err))
+	return StatePath(defaultRunStatsPath)
+}
+
+// ApplyTimezone makes TZ the local time zone of the process, even when it was set through the .env or config file
+// after the go runtime started. Dates written to trakt and printed in reports then follow the time zone of the user.
+func ApplyTimezone() error {
+	location, err := loadTimezone()
+	if err != nil {
+		return err
 	}
-	if err := s.syncHistory(); err != nil {
-		s.logger.Fatal("failure syncing history", zap.Error(err))
+	if location != nil {
+		time.Local = location
 	}
-	s.logger.Info("successfully ran the syncer")
+	return nil
 }
 
-func (s *Syncer) hydrate() (err error) {
+func loadTimezone() (*time.Location, error) {
+	name := os.Getenv(EnvVarKeyTimezone)
+	if name == "" {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(strings.TrimPrefix(name, ":"))
+	if err != nil {
+		return nil, fmt.Errorf("failure loading time zone %s from %s: expected a name like Europe/London: %w", name, EnvVarKeyTimezone, err)
+	}
+	return location, nil
+}
+
+// SyncInterval returns the time between scheduled syncs, falling back to the default when it is not set or invalid
+func SyncInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv(EnvVarKeySyncInterval)); err == nil && interval >= time.Minute {
+		return interval
+	}
+	return defaultSyncInterval
+}
+
+func (s *Syncer) run(summary *entities.SyncSummary) error {
+	err := s.runPhase(PhaseHydrate, s.hydrate)
+	if s.imdbClient != nil {
+		// the invalid rows fail their fetch, so they are reported even when hydrating fails
+		summary.Failures = append(summary.Failures, s.imdbClient.InvalidRows()...)
+	}
+	if err != nil {
+		return fmt.Errorf("failure hydrating: %w", err)
+	}
+	summary.FailedLists = append(summary.FailedLists, s.failedLists...)
+	var plan *entities.SyncPlan
+	err = s.runPhase(PhasePlan, func() (err error) {
+		plan, err = s.buildPlan()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failure building sync plan: %w", err)
+	}
+	if s.ctx.Err() != nil {
+		return &InterruptedError{}
+	}
+	if err = s.checkAnomaly(plan); err != nil {
+		return err
+	}
+	if s.interactive {
+		if plan, err = s.confirmPlan(plan); err != nil {
+			return fmt.Errorf("failure confirming sync plan: %w", err)
+		}
+	}
+	err = s.runPhase(PhaseApply, func() error {
+		// tmdb, simkl, myanimelist, notion, google sheets, airtable and the file target are written while the plan is applied to trakt, as none of them depends on the others
+		mirrored := make(chan []string, 1)
+		go func() {
+			var failed []string
+			for _, mirror := range []func() []string{s.mirrorTmdb, s.pushSimkl, s.pushMal, s.pushAniList, s.pushNotion, s.writeGoogleSheets, s.pushAirtable, s.writeFileTarget} {
+				failed = append(failed, mirror()...)
+			}
+			mirrored <- failed
+		}()
+		err := s.applyPlanWithRetryQueue(plan, summary)
+		summary.FailedLists = append(summary.FailedLists, <-mirrored...)
+		if err == nil {
+			summary.FailedLists = append(summary.FailedLists, s.updateMediaServers()...)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failure applying sync plan: %w", err)
+	}
+	return partialSyncError(summary)
+}
+
+func (s *Syncer) Plan(path string) error {
+	if err := s.runPhase(PhaseHydrate, s.hydrate); err != nil {
+		s.logger.Error("failure hydrating", zap.Error(err))
+		return err
+	}
+	var plan *entities.SyncPlan
+	err := s.runPhase(PhasePlan, func() (err error) {
+		plan, err = s.buildPlan()
+		return err
+	})
+	if err != nil {
+		s.logger.Error("failure building sync plan", zap.Error(err))
+		return err
+	}
+	if err = writePlan(path, plan); err != nil {
+		s.logger.Error("failure writing sync plan", zap.Error(err))
+		return err
+	}
+	for _, operation := range plan.Operations {
+		s.logger.Info(fmt.Sprintf("planned to %s", describeOperation(operation)), zap.Array("items", operation.Items))
+	}
+	s.logger.Info(fmt.Sprintf("saved sync plan with %d operation(s) to %s", len(plan.Operations), path))
+	return nil
+}
+
+func (s *Syncer) Apply(path string) error {
+	plan, err := readPlan(path)
+	if err != nil {
+		s.logger.Error("failure reading sync plan", zap.Error(err))
+		return err
+	}
+	if err = s.applyAndRecord(plan); err != nil {
+		s.logger.Error("failure applying sync plan", zap.Error(err))
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("successfully applied sync plan %s", path))
+	return nil
+}
+
+// applyAndRecord applies a plan outside a full run, reporting it to the hooks and the run stats like a full run
+func (s *Syncer) applyAndRecord(plan *entities.SyncPlan) (err error) {
+	release, acquired, err := acquireRunLock()
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		s.logger.Warn("skipping the changes, as a sync of the same profile is still running")
+		return nil
+	}
+	defer release()
+	if s.interactive {
+		if plan, err = s.confirmPlan(plan); err != nil {
+			return fmt.Errorf("failure confirming sync plan: %w", err)
+		}
+	}
+	summary := entities.SyncSummary{
+		Version:   version.Version,
+		StartedAt: time.Now(),
+	}
+	s.runStart()
+	client.ResetTelemetry()
+	s.timings.reset()
+	span := tracing.StartRun("apply", runAttributes()...)
+	err = s.runPhase(PhaseApply, func() error {
+		return s.applyPlanWithRetryQueue(plan, &summary)
+	})
+	if err == nil {
+		err = partialSyncError(&summary)
+	}
+	summary.FinishedAt = time.Now()
+	s.recordTelemetry(&summary)
+	s.recordTimings(&summary)
+	span.End(err)
+	s.flushTraces()
+	s.writeFailureReport(summary)
+	s.runComplete(summary, err)
+	s.recordRun(summary, err)
+	return err
+}
+
+// isolateListFailures records the imdb lists that failed to load, so the remaining lists can still be synced
+func (s *Syncer) isolateListFailures(err error) error {
+	var fetchError *client.ListsFetchError
+	if !errors.As(err, &fetchError) {
+		return err
+	}
+	for listId, listErr := range fetchError.Failed {
+		s.logger.Error(fmt.Sprintf("failure fetching imdb list %s, continuing with the remaining lists", listId), zap.Error(listErr))
+		s.failedLists = append(s.failedLists, listId)
+	}
+	sort.Strings(s.failedLists)
+	return nil
+}
+
+func (s *Syncer) hydrate() error {
+	start := time.Now()
+	if err := s.hydrateImdb(); err != nil {
+		return err
+	}
+	s.timings.record(PhaseHydrate, stepImdb, start)
+	if err := s.resolveAnimeIds(); err != nil {
+		return err
+	}
+	if err := s.hydrateMediaServers(); err != nil {
+		return err
+	}
+	start = time.Now()
+	if err := s.hydrateTrakt(); err != nil {
+		return err
+	}
+	s.timings.record(PhaseHydrate, stepTrakt, start)
+	return nil
+}
+
+func (s *Syncer) hydrateImdb() (err error) {
 	var imdbLists []entities.ImdbList
+	if s.syncLists {
+		if imdbLists, err = s.fetchImdbLists(); err != nil {
+			return err
+		}
+	} else {
+		s.user.imdbLists = make(map[string]entities.ImdbList)
+	}
+	if s.syncWatchlist {
+		imdbWatchlist, err := s.imdbClient.WatchlistGet()
+		if err != nil {
+			return fmt.Errorf("failure fetching imdb watchlist: %w", err)
+		}
+		if s.watchlistTargetList != "" {
+			// mirror the watchlist into a custom trakt list, treating it like any other imdb list
+			imdbWatchlist.IsWatchlist = false
+			imdbWatchlist.ListName = s.watchlistTargetList
+			imdbWatchlist.TraktListSlug = entities.BuildTraktListSlug(s.watchlistTargetList)
+			imdbLists = append(imdbLists, *imdbWatchlist)
+		} else {
+			s.user.imdbLists[imdbWatchlist.ListId] = *imdbWatchlist
+		}
+	}
+	if s.ratingsNeeded() {
+		imdbRatings, err := s.imdbClient.RatingsGet()
+		if err != nil {
+			return fmt.Errorf("failure fetching imdb ratings: %w", err)
+		}
+		for i := range imdbRatings {
+			imdbRating := imdbRatings[i]
+			s.user.imdbRatings[imdbRating.Id] = imdbRating
+		}
+	}
+	if s.syncLists && s.ratingsListName != "" {
+		imdbLists = append(imdbLists, buildRatingsList(s.ratingsListName, s.user.imdbRatings))
+	}
+	for i := range imdbLists {
+		s.user.imdbLists[imdbLists[i].ListId] = imdbLists[i]
+	}
+	return nil
+}
+
+// fetchImdbLists fetches the configured imdb lists, applying merges and splits
+func (s *Syncer) fetchImdbLists() (imdbLists []entities.ImdbList, err error) {
 	if len(s.user.imdbLists) != 0 {
 		listIds := make([]string, 0, len(s.user.imdbLists))
 		for id := range s.user.imdbLists {
 			listIds = append(listIds, id)
 		}
 		imdbLists, err = s.imdbClient.ListsGet(listIds)
-		if err != nil {
-			return fmt.Errorf("failure hydrating imdb lists: %w", err)
+		if err = s.isolateListFailures(err); err != nil {
+			return nil, fmt.Errorf("failure hydrating imdb lists: %w", err)
 		}
+		s.user.imdbLists = make(map[string]entities.ImdbList)
 	} else {
 		imdbLists, err = s.imdbClient.ListsGetAll()
-		if err != nil {
-			return fmt.Errorf("failure fetching all imdb lists: %w", err)
+		if err = s.isolateListFailures(err); err != nil {
+			return nil, fmt.Errorf("failure fetching all imdb lists: %w", err)
 		}
 	}
-	traktIds := make([]entities.TraktIds, 0, len(imdbLists))
 	for i := range imdbLists {
-		imdbList := imdbLists[i]
-		s.user.imdbLists[imdbList.ListId] = imdbList
+		imdbLists[i].Ranked = stringSliceContains(s.rankedListIds, imdbLists[i].ListId)
+	}
+	imdbLists = mergeImdbLists(imdbLists, s.listMerges)
+	imdbLists, incompleteMerges := withoutIncompleteMerges(imdbLists, s.listMerges, s.failedLists)
+	for _, name := range incompleteMerges {
+		s.logger.Warn(fmt.Sprintf("skipping merged list %s because some of its imdb lists failed to load", name))
+	}
+	if s.splitListsByType {
+		imdbLists = splitImdbLists(imdbLists)
+	}
+	return imdbLists, nil
+}
+
+// ratingsNeeded reports whether the ratings have to be fetched, as the history and ratings list are derived from them
+func (s *Syncer) ratingsNeeded() bool {
+	return s.syncRatings || !s.skipHistory || (s.syncLists && s.ratingsListName != "")
+}
+
+// phaseEnabled reports whether the phase toggled by the environment variable runs, which it does unless disabled explicitly
+func phaseEnabled(key string) bool {
+	enabled, err := strconv.ParseBool(os.Getenv(key))
+	return err != nil || enabled
+}
+
+func (s *Syncer) hydrateTrakt() error {
+	var (
+		traktIds        = make([]entities.TraktIds, 0, len(s.user.imdbLists))
+		imdbWatchlistId string
+	)
+	for _, imdbList := range s.user.imdbLists {
+		if imdbList.IsWatchlist {
+			imdbWatchlistId = imdbList.ListId
+			continue
+		}
 		traktIds = append(traktIds, entities.TraktIds{
 			Imdb: imdbList.ListId,
 			Slug: imdbList.TraktListSlug,
@@ -138,23 +814,15 @@ func (s *Syncer) hydrate() (err error) {
 		traktList := traktLists[i]
 		s.user.traktLists[traktList.Ids.Imdb] = traktList
 	}
-	imdbWatchlist, err := s.imdbClient.WatchlistGet()
-	if err != nil {
-		return fmt.Errorf("failure fetching imdb watchlist: %w", err)
-	}
-	s.user.imdbLists[imdbWatchlist.ListId] = *imdbWatchlist
-	traktWatchlist, err := s.traktClient.WatchlistGet()
-	if err != nil {
-		return fmt.Errorf("failure fetching trakt watchlist: %w", err)
-	}
-	s.user.traktLists[imdbWatchlist.ListId] = *traktWatchlist
-	imdbRatings, err := s.imdbClient.RatingsGet()
-	if err != nil {
-		return fmt.Errorf("failure fetching imdb ratings: %w", err)
+	if imdbWatchlistId != "" {
+		traktWatchlist, err := s.traktClient.WatchlistGet()
+		if err != nil {
+			return fmt.Errorf("failure fetching trakt watchlist: %w", err)
+		}
+		s.user.traktLists[imdbWatchlistId] = *traktWatchlist
 	}
-	for i := range imdbRatings {
-		imdbRating := imdbRatings[i]
-		s.user.imdbRatings[imdbRating.Id] = imdbRating
+	if !s.ratingsNeeded() {
+		return nil
 	}
 	traktRatings, err := s.traktClient.RatingsGet()
 	if err != nil {
@@ -173,82 +841,244 @@ func (s *Syncer) hydrate() (err error) {
 	return nil
 }
 
-func (s *Syncer) syncLists() error {
+func (s *Syncer) buildPlan() (*entities.SyncPlan, error) {
+	start := time.Now()
+	listOperations, err := s.planLists()
+	if err != nil {
+		return nil, fmt.Errorf("failure planning lists: %w", err)
+	}
+	s.timings.record(PhasePlan, stepLists, start)
+	start = time.Now()
+	ratingsOperations, err := s.planRatings()
+	if err != nil {
+		return nil, fmt.Errorf("failure planning ratings: %w", err)
+	}
+	s.timings.record(PhasePlan, stepRatings, start)
+	start = time.Now()
+	historyOperations, err := s.planHistory()
+	if err != nil {
+		return nil, fmt.Errorf("failure planning history: %w", err)
+	}
+	mediaServerOperations, err := s.planMediaServerHistory(historyOperations)
+	if err != nil {
+		return nil, fmt.Errorf("failure planning media server history: %w", err)
+	}
+	historyOperations = append(historyOperations, mediaServerOperations...)
+	s.timings.record(PhasePlan, stepHistory, start)
+	plan := &entities.SyncPlan{
+		CreatedAt: time.Now(),
+	}
+	plan.Operations = append(plan.Operations, listOperations...)
+	plan.Operations = append(plan.Operations, ratingsOperations...)
+	plan.Operations = append(plan.Operations, historyOperations...)
+	return plan, nil
+}
+
+func (s *Syncer) planLists() ([]entities.SyncOperation, error) {
+	var operations []entities.SyncOperation
 	for _, list := range s.user.imdbLists {
-		diff := entities.ListDifference(list, s.user.traktLists[list.ListId])
+		traktList, found := s.user.traktLists[list.ListId]
+		diff := entities.ListDifference(list, traktList)
+		operation := entities.SyncOperation{
+			Target:   entities.SyncTargetList,
+			ListName: list.ListName,
+			ListSlug: list.TraktListSlug,
+		}
+		if !found && !list.IsWatchlist {
+			createOperation := operation
+			createOperation.Action = entities.SyncActionCreate
+			createOperation.SortBy = list.TraktSortBy
+			createOperation.SortHow = list.TraktSortHow
+			operations = append(operations, createOperation)
+		}
 		if list.IsWatchlist {
-			if len(diff["add"]) > 0 {
-				if err := s.traktClient.WatchlistItemsAdd(diff["add"]); err != nil {
-					return fmt.Errorf("failure adding items to trakt watchlist: %w", err)
-				}
-			}
-			if len(diff["remove"]) > 0 {
-				if err := s.traktClient.WatchlistItemsRemove(diff["remove"]); err != nil {
-					return fmt.Errorf("failure removing items from trakt watchlist: %w", err)
-				}
+			operation = entities.SyncOperation{
+				Target: entities.SyncTargetWatchlist,
 			}
-			continue
 		}
 		if len(diff["add"]) > 0 {
-			if err := s.traktClient.ListItemsAdd(list.TraktListSlug, diff["add"]); err != nil {
-				return fmt.Errorf("failure adding items to trakt list %s: %w", list.TraktListSlug, err)
+			if s.listItemNotes && !list.IsWatchlist {
+				notes := fmt.Sprintf("imdb-sync: from %s on %s", list.ListId, time.Now().Format("2006-01-02"))
+				for i := range diff["add"] {
+					diff["add"][i].SetNotes(notes)
+				}
 			}
+			operation.Action = entities.SyncActionAdd
+			operation.Items = diff["add"]
+			operations = append(operations, operation)
+		}
+		if held := s.holdRecentlyListedItems(diff, operation); held > 0 {
+			s.logger.Info(fmt.Sprintf("holding off removal of %d item(s) of trakt %s listed within the grace period", held, targetLabel(operation)))
 		}
 		if len(diff["remove"]) > 0 {
-			if err := s.traktClient.ListItemsRemove(list.TraktListSlug, diff["remove"]); err != nil {
-				return fmt.Errorf("failure removing items from trakt list %s: %w", list.TraktListSlug, err)
-			}
+			operation.Action = entities.SyncActionRemove
+			operation.Items = diff["remove"]
+			operations = append(operations, operation)
+		}
+		membershipChanged := len(diff["add"]) > 0 || len(diff["remove"]) > 0
+		if list.Ranked && !list.IsWatchlist && (membershipChanged || entities.ListOrderDiffers(list, traktList)) {
+			operation.Action = entities.SyncActionReorder
+			operation.Items = list.TraktItems()
+			operations = append(operations, operation)
 		}
 	}
-	// remove lists that only exist in Trakt
+	if !s.cleanupOrphanedLists || !s.syncLists {
+		return operations, nil
+	}
+	if len(s.failedLists) > 0 {
+		s.logger.Warn("skipping cleanup of orphaned lists because some imdb lists failed to load")
+		return operations, nil
+	}
+	// remove auto imported lists that only exist in Trakt
 	traktLists, err := s.traktClient.ListsMetadataGet()
 	if err != nil {
-		return fmt.Errorf("failure fetching trakt lists: %w", err)
+		return nil, fmt.Errorf("failure fetching trakt lists: %w", err)
 	}
 	for i := range traktLists {
-		if traktListIsStray(s.user.imdbLists, *traktLists[i].Name) {
-			if err = s.traktClient.ListRemove(traktLists[i].Ids.Slug); err != nil {
-				return fmt.Errorf("failure removing trakt list %s: %w", *traktLists[i].Name, err)
-			}
+		if traktLists[i].IsAutoImported() && traktListIsStray(s.user.imdbLists, *traktLists[i].Name) {
+			operations = append(operations, entities.SyncOperation{
+				Action:   entities.SyncActionDelete,
+				Target:   entities.SyncTargetList,
+				ListName: *traktLists[i].Name,
+				ListSlug: traktLists[i].Ids.Slug,
+			})
 		}
 	}
-	return nil
+	return operations, nil
+}
+
+// holdRecentlyListedItems keeps the items listed on trakt after the grace period cutoff out of the removals,
+// protecting them against imdb temporarily failing to return them
+func (s *Syncer) holdRecentlyListedItems(diff map[string]entities.TraktItems, operation entities.SyncOperation) int {
+	if s.removalGraceCutoff == nil || len(diff["remove"]) == 0 {
+		return 0
+	}
+	var (
+		removals = make(entities.TraktItems, 0, len(diff["remove"]))
+		held     int
+	)
+	for _, item := range diff["remove"] {
+		listedAt, err := time.Parse(time.RFC3339, item.ListedAt)
+		if err == nil && listedAt.After(*s.removalGraceCutoff) {
+			held++
+			continue
+		}
+		removals = append(removals, item)
+	}
+	diff["remove"] = removals
+	return held
 }
 
-func (s *Syncer) syncRatings() error {
+func (s *Syncer) planRatings() ([]entities.SyncOperation, error) {
+	if !s.syncRatings {
+		s.logger.Info("skipping ratings sync")
+		return nil, nil
+	}
+	var operations []entities.SyncOperation
 	diff := entities.ItemsDifference(s.user.imdbRatings, s.user.traktRatings)
 	if len(diff["add"]) > 0 {
-		if err := s.traktClient.RatingsAdd(diff["add"]); err != nil {
-			return fmt.Errorf("failure adding trakt ratings: %w", err)
+		ratingsToAdd, err := s.resolveRatingsConflicts(diff["add"])
+		if err != nil {
+			return nil, fmt.Errorf("failure resolving trakt ratings conflicts: %w", err)
+		}
+		if len(ratingsToAdd) > 0 {
+			operations = append(operations, entities.SyncOperation{
+				Action: entities.SyncActionAdd,
+				Target: entities.SyncTargetRatings,
+				Items:  ratingsToAdd,
+			})
 		}
 	}
 	if len(diff["remove"]) > 0 {
-		if err := s.traktClient.RatingsRemove(diff["remove"]); err != nil {
-			return fmt.Errorf("failure removing trakt ratings: %w", err)
+		operations = append(operations, entities.SyncOperation{
+			Action: entities.SyncActionRemove,
+			Target: entities.SyncTargetRatings,
+			Items:  diff["remove"],
+		})
+	}
+	return operations, nil
+}
+
+// resolveRatingsConflicts filters out the items that are rated differently on both sides,
+// unless the configured conflict policy decides the imdb rating should take precedence
+func (s *Syncer) resolveRatingsConflicts(items entities.TraktItems) (entities.TraktItems, error) {
+	var resolved entities.TraktItems
+	for i := range items {
+		id, err := items[i].GetItemId()
+		if err != nil {
+			return nil, fmt.Errorf("failure fetching trakt item id: %w", err)
+		}
+		traktRating, found := s.user.traktRatings[*id]
+		if !found {
+			resolved = append(resolved, items[i])
+			continue
+		}
+		imdbRating := s.user.imdbRatings[*id]
+		keepImdb, err := s.keepImdbRating(imdbRating, traktRating)
+		if err != nil {
+			return nil, err
 		}
+		if !keepImdb {
+			s.logger.Debug(fmt.Sprintf("keeping trakt rating %d over imdb rating %d for %s due to conflict policy %s", traktRating.Rating, *imdbRating.Rating, *id, s.ratingsConflictPolicy))
+			continue
+		}
+		resolved = append(resolved, items[i])
 	}
-	return nil
+	return resolved, nil
 }
 
-func (s *Syncer) syncHistory() error {
+func (s *Syncer) keepImdbRating(imdbRating entities.ImdbItem, traktRating entities.TraktItem) (bool, error) {
+	switch s.ratingsConflictPolicy {
+	case ratingsConflictPolicyHigher:
+		return *imdbRating.Rating > traktRating.Rating, nil
+	case ratingsConflictPolicyNewer:
+		traktRatedAt, err := time.Parse(time.RFC3339, traktRating.RatedAt)
+		if err != nil {
+			return false, fmt.Errorf("failure parsing trakt rating date %s: %w", traktRating.RatedAt, err)
+		}
+		// a rating without a date counts as older, as it does when the ratings of several sources are merged
+		return imdbRating.RatingDate != nil && imdbRating.RatingDate.After(traktRatedAt), nil
+	case ratingsConflictPolicyTrakt:
+		return false, nil
+	case ratingsConflictPolicyPrompt:
+		if !s.interactive {
+			s.logger.Warn(fmt.Sprintf("keeping the imdb rating of %s, as the %s conflict policy only prompts in interactive mode", imdbRating.Id, ratingsConflictPolicyPrompt))
+			return true, nil
+		}
+		message := fmt.Sprintf("%s is rated %d on imdb and %d on trakt, overwrite the trakt rating?", imdbRating.Id, *imdbRating.Rating, traktRating.Rating)
+		return promptConfirmation(message)
+	default:
+		return true, nil
+	}
+}
+
+func (s *Syncer) planHistory() ([]entities.SyncOperation, error) {
 	if s.skipHistory {
 		s.logger.Info("skipping history sync")
-		return nil
+		return nil, nil
 	}
 	// imdb doesn't offer functionality similar to trakt history, hence why there can't be a direct mapping between them
 	// the syncer will assume a user to have watched an item if they've submitted a rating for it
 	// if the above is satisfied and the user's history for this item is empty, a new history entry is added!
+	var operations []entities.SyncOperation
 	diff := entities.ItemsDifference(s.user.imdbRatings, s.user.traktRatings)
 	if len(diff["add"]) > 0 {
+		knownItemIds, err := s.knownHistoryItemIds()
+		if err != nil {
+			return nil, err
+		}
 		var historyToAdd entities.TraktItems
 		for i := range diff["add"] {
 			traktItemId, err := diff["add"][i].GetItemId()
 			if err != nil {
-				return fmt.Errorf("failure fetching trakt item id: %w", err)
+				return nil, fmt.Errorf("failure fetching trakt item id: %w", err)
+			}
+			if knownItemIds[*traktItemId] || !s.ratedWithinHistoryWindow(s.user.imdbRatings[*traktItemId].RatingDate) {
+				continue
 			}
 			history, err := s.traktClient.HistoryGet(diff["add"][i].Type, *traktItemId)
 			if err != nil {
-				return fmt.Errorf("failure fetching trakt history for %s %s: %w", diff["add"][i].Type, *traktItemId, err)
+				return nil, fmt.Errorf("failure fetching trakt history for %s %s: %w", diff["add"][i].Type, *traktItemId, err)
 			}
 			if len(history) > 0 {
 				continue
@@ -256,9 +1086,11 @@ func (s *Syncer) syncHistory() error {
 			historyToAdd = append(historyToAdd, diff["add"][i])
 		}
 		if len(historyToAdd) > 0 {
-			if err := s.traktClient.HistoryAdd(historyToAdd); err != nil {
-				return fmt.Errorf("failure adding trakt history: %w", err)
-			}
+			operations = append(operations, entities.SyncOperation{
+				Action: entities.SyncActionAdd,
+				Target: entities.SyncTargetHistory,
+				Items:  historyToAdd,
+			})
 		}
 	}
 	if len(diff["remove"]) > 0 {
@@ -266,11 +1098,17 @@ func (s *Syncer) syncHistory() error {
 		for i := range diff["remove"] {
 			traktItemId, err := diff["remove"][i].GetItemId()
 			if err != nil {
-				return fmt.Errorf("failure fetching trakt item id: %w", err)
+				return nil, fmt.Errorf("failure fetching trakt item id: %w", err)
+			}
+			if s.historySince != nil {
+				ratedAt, err := time.Parse(time.RFC3339, diff["remove"][i].RatedAt)
+				if err == nil && !s.ratedWithinHistoryWindow(&ratedAt) {
+					continue
+				}
 			}
 			history, err := s.traktClient.HistoryGet(diff["remove"][i].Type, *traktItemId)
 			if err != nil {
-				return fmt.Errorf("failure fetching trakt history for %s %s: %w", diff["remove"][i].Type, *traktItemId, err)
+				return nil, fmt.Errorf("failure fetching trakt history for %s %s: %w", diff["remove"][i].Type, *traktItemId, err)
 			}
 			if len(history) == 0 {
 				continue
@@ -278,43 +1116,540 @@ func (s *Syncer) syncHistory() error {
 			historyToRemove = append(historyToRemove, diff["remove"][i])
 		}
 		if len(historyToRemove) > 0 {
-			if err := s.traktClient.HistoryRemove(historyToRemove); err != nil {
+			operations = append(operations, entities.SyncOperation{
+				Action: entities.SyncActionRemove,
+				Target: entities.SyncTargetHistory,
+				Items:  historyToRemove,
+			})
+		}
+	}
+	return operations, nil
+}
+
+// knownHistoryItemIds returns the ids of items that are collected or watched on trakt, which are considered as already
+// handled when adding history, saving a history lookup per item. It is empty unless SKIP_HISTORY_FOR_COLLECTED_OR_WATCHED is set.
+func (s *Syncer) knownHistoryItemIds() (map[string]bool, error) {
+	ids := make(map[string]bool)
+	if !s.skipHistoryKnown {
+		return ids, nil
+	}
+	collection, err := s.traktClient.CollectionGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching trakt collection: %w", err)
+	}
+	watched, err := s.traktClient.WatchedGet()
+	if err != nil {
+		return nil, fmt.Errorf("failure fetching trakt watched items: %w", err)
+	}
+	for _, item := range append(collection, watched...) {
+		id, err := item.GetItemId()
+		if err != nil {
+			return nil, fmt.Errorf("failure fetching trakt item id: %w", err)
+		}
+		if id != nil && *id != "" {
+			ids[*id] = true
+		}
+	}
+	return ids, nil
+}
+
+// ratedWithinHistoryWindow reports whether an item rated at the time falls within SYNC_HISTORY_SINCE, counting undated items as within it
+func (s *Syncer) ratedWithinHistoryWindow(ratedAt *time.Time) bool {
+	if s.historySince == nil || ratedAt == nil {
+		return true
+	}
+	return !ratedAt.Before(*s.historySince)
+}
+
+// applyPlanWithRetryQueue drains the operations left over from previous runs before applying the plan,
+// deferring operations that fail due to transient errors to the next run. Queued items the plan also changes are dropped.
+func (s *Syncer) applyPlanWithRetryQueue(plan *entities.SyncPlan, summary *entities.SyncSummary) error {
+	queue, err := loadRetryQueue(s.retryQueuePath)
+	if err != nil {
+		return err
+	}
+	s.retryQueue = queue
+	queuedOperations, superseded := withoutPlannedItems(queue.drain(), plan.Operations)
+	if superseded > 0 {
+		s.logger.Info(fmt.Sprintf("dropping %d queued item(s) superseded by the current plan", superseded))
+	}
+	if len(queuedOperations) > 0 {
+		s.logger.Info(fmt.Sprintf("retrying %d operation(s) from the retry queue", len(queuedOperations)))
+	}
+	operations := chunkOperations(mergeOperations(append(queuedOperations, plan.Operations...)), traktChunkSize)
+	operations, deferred := allocateRequestBudget(operations, s.requestBudget, s.budgetWeights)
+	if len(deferred) > 0 {
+		s.logger.Info(fmt.Sprintf("deferring %d operation(s) exceeding the request budget to the retry queue", len(deferred)))
+		for _, operation := range deferred {
+			queue.push(operation)
+			summary.OperationsDeferred++
+		}
+	}
+	err = s.applyPlan(&entities.SyncPlan{CreatedAt: plan.CreatedAt, Operations: operations}, summary)
+	if saveErr := queue.save(); saveErr != nil {
+		if err != nil {
+			s.logger.Error("failure saving retry queue", zap.Error(saveErr))
+			return err
+		}
+		return saveErr
+	}
+	return err
+}
+
+func (s *Syncer) applyPlan(plan *entities.SyncPlan, summary *entities.SyncSummary) error {
+	var (
+		state = &applyState{
+			summary:    summary,
+			unresolved: s.resolveSharedItems(plan.Operations),
+			notFound:   make(map[string]bool),
+		}
+		semaphore = make(chan struct{}, s.concurrency)
+		waitGroup = new(sync.WaitGroup)
+		groups    = groupOperationsByTarget(plan.Operations)
+	)
+	for i, group := range groups {
+		semaphore <- struct{}{}
+		if state.failed() {
+			<-semaphore
+			break
+		}
+		if s.ctx.Err() != nil {
+			<-semaphore
+			var remaining []entities.SyncOperation
+			for _, group := range groups[i:] {
+				remaining = append(remaining, group...)
+			}
+			s.deferRemainingOperations(remaining, state)
+			break
+		}
+		waitGroup.Add(1)
+		go func(group []entities.SyncOperation) {
+			defer func() {
+				<-semaphore
+				waitGroup.Done()
+			}()
+			if err := s.applyOperationGroup(group, state); err != nil {
+				state.fail(err)
+			}
+		}(group)
+	}
+	waitGroup.Wait()
+	if state.err != nil {
+		return state.err
+	}
+	if state.interrupted > 0 {
+		return &InterruptedError{
+			operationsDeferred: state.interrupted,
+		}
+	}
+	return nil
+}
+
+// applyOperationGroup applies the operations of a single target in order, stopping at the first failure
+func (s *Syncer) applyOperationGroup(operations []entities.SyncOperation, state *applyState) error {
+	groupSpan := tracing.Start(s.phaseSpan, groupSpanName(operations[0]), tracing.String("sync.target", operations[0].Target))
+	if operations[0].ListSlug != "" {
+		groupSpan.SetAttributes(tracing.String("sync.list", operations[0].ListSlug))
+	}
+	var err error
+	start := time.Now()
+	defer func() {
+		groupSpan.End(err)
+		s.timings.record(PhaseApply, groupSpanName(operations[0]), start)
+	}()
+	for i, operation := range operations {
+		if s.ctx.Err() != nil {
+			s.deferRemainingOperations(operations[i:], state)
+			return nil
+		}
+		if operation.Action == entities.SyncActionAdd {
+			operation.Items = s.filterItemsToAdd(operation)
+			unfiltered := operation
+			var skipped []string
+			state.mutex.Lock()
+			operation, skipped = withoutUnresolvedItems(operation, state.unresolved)
+			if len(skipped) > 0 {
+				state.countNotFound(skipped)
+				state.summary.Failures = append(state.summary.Failures, operationFailures(unfiltered, entities.ItemFailureReasonNotFound, skipped, nil)...)
+			}
+			state.mutex.Unlock()
+			if len(skipped) > 0 {
+				s.logger.Debug(fmt.Sprintf("skipping %d item(s) trakt could not find while syncing %s", len(skipped), describeOperation(operation)))
+			}
+		}
+		operationSpan := tracing.Start(groupSpan, operation.Describe(), tracing.String("sync.action", operation.Action), tracing.Int("sync.items", len(operation.Items)))
+		err = s.applyOperation(operation)
+		operationSpan.End(err)
+		auditOutcome, auditErr := auditOutcomeApplied, err
+		var notFound []string
+		state.mutex.Lock()
+		var notFoundError *client.ItemsNotFoundError
+		if errors.As(err, &notFoundError) {
+			s.logger.Warn("failure syncing some items", zap.Error(err), zap.Object("not_found", &notFoundError.NotFound))
+			notFound = notFoundError.NotFound.ImdbIds()
+			// items without an imdb id cannot be told apart, so they are counted every time
+			state.summary.ItemsNotFound += notFoundError.NotFound.Count() - len(notFound)
+			state.countNotFound(notFound)
+			state.summary.Failures = append(state.summary.Failures, operationFailures(operation, entities.ItemFailureReasonNotFound, notFound, nil)...)
+			auditErr = nil
+			err = nil
+		}
+		// changes the sync mode forbids are audited as skipped, and left out of the summary as they never reached trakt
+		auditMode := s.traktClient.SyncMode(operation.Target)
+		var skippedErr *client.SyncModeSkippedError
+		skipped := errors.As(err, &skippedErr)
+		if skipped {
+			auditMode, auditOutcome, auditErr, err = skippedErr.Mode, auditOutcomeSkipped, nil, nil
+		}
+		deferred := client.IsTransientError(err) && s.retryQueue != nil
+		if deferred {
+			s.logger.Warn(fmt.Sprintf("deferring operation to %s to the retry queue", describeOperation(operation)), zap.Error(err))
+			s.retryQueue.push(operation)
+			state.summary.OperationsDeferred++
+			auditOutcome = auditOutcomeDeferred
+			err = nil
+		} else if err != nil {
+			auditOutcome = auditOutcomeFailed
+			if isRejection(err) {
+				state.summary.Failures = append(state.summary.Failures, operationFailures(operation, entities.ItemFailureReasonRejected, nil, err)...)
+			}
+		}
+		if err == nil && !deferred && !skipped {
+			state.summary.Operations = append(state.summary.Operations, operation)
+		}
+		listFailed := err != nil && isListTarget(operation) && ExitCode(err) != ExitCodeAuthFailure
+		if listFailed {
+			state.summary.FailedLists = append(state.summary.FailedLists, listLabel(operation))
+		}
+		state.mutex.Unlock()
+		if !(operation.Action == entities.SyncActionAdd && len(operation.Items) == 0) {
+			if recordErr := s.auditLog.record(state.summary.StartedAt, operation, auditMode, auditOutcome, notFound, auditErr); recordErr != nil {
+				s.logger.Warn("failure recording changes in the audit log", zap.Error(recordErr))
+			}
+		}
+		if isListTarget(operation) && (i == len(operations)-1 || err != nil) {
+			s.listSynced(operation.Target, operation.ListSlug, err)
+		}
+		if listFailed {
+			s.logger.Error(fmt.Sprintf("failure trying to %s, continuing with the remaining lists", describeOperation(operation)), zap.Error(err))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupSpanName names the span of the operations applied to a target, such as "list movies" or "watchlist"
+func groupSpanName(operation entities.SyncOperation) string {
+	if operation.ListSlug != "" {
+		return fmt.Sprintf("%s %s", operation.Target, operation.ListSlug)
+	}
+	return operation.Target
+}
+
+// deferRemainingOperations saves the operations left unapplied by a shutdown to the retry queue
+func (s *Syncer) deferRemainingOperations(operations []entities.SyncOperation, state *applyState) {
+	s.logger.Warn(fmt.Sprintf("shutting down, deferring %d remaining operation(s) to the retry queue", len(operations)))
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	for _, operation := range operations {
+		s.retryQueue.push(operation)
+		state.summary.OperationsDeferred++
+	}
+	state.interrupted += len(operations)
+}
+
+func (s *Syncer) applyOperation(operation entities.SyncOperation) error {
+	if operation.Action == entities.SyncActionAdd && len(operation.Items) == 0 {
+		return nil
+	}
+	switch operation.Target {
+	case entities.SyncTargetWatchlist:
+		switch operation.Action {
+		case entities.SyncActionAdd:
+			if err := s.traktClient.WatchlistItemsAdd(operation.Items); err != nil {
+				return fmt.Errorf("failure adding items to trakt watchlist: %w", err)
+			}
+			return nil
+		case entities.SyncActionRemove:
+			if err := s.traktClient.WatchlistItemsRemove(operation.Items); err != nil {
+				return fmt.Errorf("failure removing items from trakt watchlist: %w", err)
+			}
+			return nil
+		}
+	case entities.SyncTargetList:
+		switch operation.Action {
+		case entities.SyncActionAdd:
+			if err := s.traktClient.ListItemsAdd(operation.ListSlug, operation.Items); err != nil {
+				return fmt.Errorf("failure adding items to trakt list %s: %w", operation.ListSlug, err)
+			}
+			return nil
+		case entities.SyncActionRemove:
+			if err := s.traktClient.ListItemsRemove(operation.ListSlug, operation.Items); err != nil {
+				return fmt.Errorf("failure removing items from trakt list %s: %w", operation.ListSlug, err)
+			}
+			return nil
+		case entities.SyncActionCreate:
+			if err := s.traktClient.ListAdd(operation.ListSlug, operation.ListName, operation.Description, operation.SortBy, operation.SortHow); err != nil {
+				return fmt.Errorf("failure creating trakt list %s: %w", operation.ListName, err)
+			}
+			return nil
+		case entities.SyncActionReorder:
+			// the list is fetched again, since the trakt ids of the items added earlier in the run are unknown
+			traktList, err := s.traktClient.ListGet(operation.ListSlug)
+			if err != nil {
+				return fmt.Errorf("failure fetching trakt list %s: %w", operation.ListSlug, err)
+			}
+			if err = s.traktClient.ListItemsReorder(operation.ListSlug, reorderRank(operation.Items, traktList)); err != nil {
+				return fmt.Errorf("failure reordering trakt list %s: %w", operation.ListSlug, err)
+			}
+			return nil
+		case entities.SyncActionDelete:
+			if err := s.traktClient.ListRemove(operation.ListSlug); err != nil {
+				return fmt.Errorf("failure removing trakt list %s: %w", operation.ListName, err)
+			}
+			return nil
+		}
+	case entities.SyncTargetRatings:
+		switch operation.Action {
+		case entities.SyncActionAdd:
+			if err := s.traktClient.RatingsAdd(operation.Items); err != nil {
+				return fmt.Errorf("failure adding trakt ratings: %w", err)
+			}
+			return nil
+		case entities.SyncActionRemove:
+			if err := s.traktClient.RatingsRemove(operation.Items); err != nil {
+				return fmt.Errorf("failure removing trakt ratings: %w", err)
+			}
+			return nil
+		}
+	case entities.SyncTargetHistory:
+		switch operation.Action {
+		case entities.SyncActionAdd:
+			if err := s.traktClient.HistoryAdd(operation.Items); err != nil {
+				return fmt.Errorf("failure adding trakt history: %w", err)
+			}
+			return nil
+		case entities.SyncActionRemove:
+			if err := s.traktClient.HistoryRemove(operation.Items); err != nil {
 				return fmt.Errorf("failure removing trakt history: %w", err)
 			}
+			return nil
 		}
 	}
+	return fmt.Errorf("unsupported sync operation %s %s", operation.Action, operation.Target)
+}
+
+// ValidateConfig validates the settings of the environment without contacting imdb or trakt
+func ValidateConfig() error {
+	if err := validateEnvVars(false, false); err != nil {
+		return &ConfigError{err: err}
+	}
 	return nil
 }
 
-func validateEnvVars() error {
-	requiredEnvVarKeys := []string{
-		EnvVarKeyCookieAtMain,
-		EnvVarKeyCookieUbidMain,
-		EnvVarKeyListIds,
-		EnvVarKeySyncMode,
-		EnvVarKeyTraktClientId,
-		EnvVarKeyTraktClientSecret,
-		EnvVarKeyTraktEmail,
-		EnvVarKeyTraktPassword,
+// validateEnvVars collects every problem of the configuration, rather than stopping at the first one
+func validateEnvVars(imdbOnly, traktOnly bool) error {
+	var problems []error
+	report := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if store := os.Getenv(EnvVarKeyCredentialStore); store != "" && store != credentialStoreEnv && store != credentialStoreKeyring {
+		report(fmt.Errorf("failure using credential store %s: valid stores are %s, %s", store, credentialStoreEnv, credentialStoreKeyring))
+	}
+	secrets, err := readSecrets()
+	report(err)
+	var requiredEnvVarKeys []string
+	if source := SyncSource(); !stringSliceContains(validSyncSources(), source) {
+		report(fmt.Errorf("failure using sync source %s from %s: valid sources are %s", source, EnvVarKeySyncSource, strings.Join(validSyncSources(), ", ")))
+	} else if !traktOnly && source == syncSourceTmdb {
+		requiredEnvVarKeys = append(requiredEnvVarKeys, EnvVarKeyTmdbApiKey, EnvVarKeyTmdbSessionId)
+	} else if !traktOnly && source == syncSourceAniList {
+		requiredEnvVarKeys = append(requiredEnvVarKeys, EnvVarKeyAniListToken)
+	} else if !traktOnly {
+		requiredEnvVarKeys = append(requiredEnvVarKeys, EnvVarKeyCookieAtMain, EnvVarKeyCookieUbidMain, EnvVarKeyListIds)
+	}
+	if !imdbOnly {
+		requiredEnvVarKeys = append(requiredEnvVarKeys, EnvVarKeySyncMode, EnvVarKeyTraktClientId, EnvVarKeyTraktClientSecret)
+		defaultTraktApp := secrets != nil && applyDefaultTraktApp(secrets)
+		// the trakt email and password are only needed to sign in when the auth command did not store tokens
+		if tokens, err := loadTraktTokens(); err != nil {
+			report(err)
+		} else if tokens == nil && defaultTraktApp {
+			report(fmt.Errorf("the built-in trakt application can only sign in with the auth command, run it once or set %s and %s of your own application", EnvVarKeyTraktClientId, EnvVarKeyTraktClientSecret))
+		} else if tokens == nil {
+			requiredEnvVarKeys = append(requiredEnvVarKeys, EnvVarKeyTraktEmail, EnvVarKeyTraktPassword)
+		}
 	}
 	var missingEnvVars []string
 	for i := range requiredEnvVarKeys {
-		if value, ok := os.LookupEnv(requiredEnvVarKeys[i]); !ok || value == "" {
+		value, ok := secrets[requiredEnvVarKeys[i]]
+		if !ok {
+			value = os.Getenv(requiredEnvVarKeys[i])
+		}
+		if value == "" {
 			missingEnvVars = append(missingEnvVars, requiredEnvVarKeys[i])
 		}
 	}
 	if len(missingEnvVars) > 0 {
-		return &MissingEnvironmentVariablesError{
+		report(&MissingEnvironmentVariablesError{
 			variables: missingEnvVars,
+		})
+	}
+	for _, key := range []string{EnvVarKeyAnimeMapping, EnvVarKeyCleanupLists, EnvVarKeyEmbyTarget, EnvVarKeyJellyfinTarget, EnvVarKeyListItemNotes, EnvVarKeyPlexTarget, EnvVarKeySkipHistory, EnvVarKeySkipHistoryKnown, EnvVarKeySplitListsByType, EnvVarKeySyncHistory, EnvVarKeySyncLists, EnvVarKeySyncRatings, EnvVarKeySyncWatchlist} {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			_, err := strconv.ParseBool(value)
+			if err != nil {
+				report(fmt.Errorf("failure parsing environment variable %s as boolean: %w", key, err))
+			}
 		}
 	}
-	if value, ok := os.LookupEnv(EnvVarKeySkipHistory); ok && value != "" {
-		_, err := strconv.ParseBool(value)
-		if err != nil {
-			return err
+	for _, key := range []string{EnvVarKeyHistorySince, EnvVarKeyRemovalGrace} {
+		if value := os.Getenv(key); value != "" {
+			_, err := parseSince(value, time.Now())
+			report(err)
+		}
+	}
+	syncModeKeys := []string{EnvVarKeySyncMode, EnvVarKeySyncModeHistory, EnvVarKeySyncModeLists, EnvVarKeySyncModeRatings, EnvVarKeySyncModeWatchlist}
+	for _, key := range syncModeKeys {
+		if value := os.Getenv(key); value != "" && !stringSliceContains(client.ValidSyncModes(), value) {
+			report(fmt.Errorf("failure using sync mode %s from %s: valid modes are %s", value, key, strings.Join(client.ValidSyncModes(), ", ")))
+		}
+	}
+	_, err = parseListMerges(os.Getenv(EnvVarKeyListMerges))
+	report(err)
+	if value := os.Getenv(EnvVarKeyConcurrency); value != "" {
+		if concurrency, err := strconv.Atoi(value); err != nil || concurrency < 1 {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a positive integer", EnvVarKeyConcurrency))
+		}
+	}
+	if value := os.Getenv(EnvVarKeySyncInterval); value != "" {
+		if interval, err := time.ParseDuration(value); err != nil || interval < time.Minute {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a duration of at least 1m, such as 6h", EnvVarKeySyncInterval))
+		}
+	}
+	if value := os.Getenv(EnvVarKeySyncJitter); value != "" {
+		if jitter, err := time.ParseDuration(value); err != nil || jitter < 0 {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a non-negative duration, such as 10m", EnvVarKeySyncJitter))
+		}
+	}
+	if value := os.Getenv(EnvVarKeyAnomalyThreshold); value != "" {
+		if threshold, err := strconv.ParseFloat(value, 64); err != nil || threshold < 0 {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a non-negative number, with 0 disabling the check", EnvVarKeyAnomalyThreshold))
+		}
+	}
+	if value := os.Getenv(EnvVarKeyAnomalyMinItems); value != "" {
+		if minItems, err := strconv.Atoi(value); err != nil || minItems < 0 {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a non-negative integer", EnvVarKeyAnomalyMinItems))
+		}
+	}
+	if value := os.Getenv(EnvVarKeyRunHistoryLimit); value != "" {
+		if limit, err := strconv.Atoi(value); err != nil || limit < 0 {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a non-negative integer, with 0 keeping every run", EnvVarKeyRunHistoryLimit))
+		}
+	}
+	if value := os.Getenv(EnvVarKeyRateLimitWarn); value != "" {
+		if percent, err := strconv.Atoi(value); err != nil || percent < 0 || percent > 100 {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a percentage between 0 and 100, with 0 never warning", EnvVarKeyRateLimitWarn))
+		}
+	}
+	if value := os.Getenv(EnvVarKeyTraktBudget); value != "" {
+		if budget, err := strconv.Atoi(value); err != nil || budget < 0 {
+			report(fmt.Errorf("failure parsing environment variable %s: must be a non-negative integer", EnvVarKeyTraktBudget))
+		}
+	}
+	_, err = parseBudgetWeights(os.Getenv(EnvVarKeyTraktBudgetWeight))
+	report(err)
+	_, err = loadTimezone()
+	report(err)
+	_, err = logger.ParseLevel(os.Getenv(logger.EnvVarKeyLogLevel))
+	report(err)
+	_, err = logger.ParseFormat(os.Getenv(logger.EnvVarKeyLogFormat))
+	report(err)
+	_, err = logger.NewFileWriter()
+	report(err)
+	_, err = metrics.ParsePushLabels(os.Getenv(metrics.EnvVarKeyPushgatewayLabels))
+	report(err)
+	for _, notifyErr := range notify.Validate() {
+		report(notifyErr)
+	}
+	if secrets != nil && (secrets[EnvVarKeyTmdbApiKey] == "") != (secrets[EnvVarKeyTmdbSessionId] == "") {
+		report(fmt.Errorf("mirroring the imdb lists into tmdb takes both %s and %s", EnvVarKeyTmdbApiKey, EnvVarKeyTmdbSessionId))
+	}
+	report(mediaServerUrlProblem(EnvVarKeyPlexUrl, "plex", "http://localhost:32400"))
+	if secrets != nil && (strings.TrimSpace(os.Getenv(EnvVarKeyPlexUrl)) == "") != (secrets[EnvVarKeyPlexToken] == "") {
+		report(fmt.Errorf("syncing the history and ratings of plex takes both %s and %s", EnvVarKeyPlexUrl, EnvVarKeyPlexToken))
+	}
+	report(mediaServerUrlProblem(EnvVarKeyJellyfinUrl, "jellyfin", "http://localhost:8096"))
+	if secrets != nil && (strings.TrimSpace(os.Getenv(EnvVarKeyJellyfinUrl)) == "") != (secrets[EnvVarKeyJellyfinApiKey] == "") {
+		report(fmt.Errorf("syncing the played status and favorites of jellyfin takes both %s and %s", EnvVarKeyJellyfinUrl, EnvVarKeyJellyfinApiKey))
+	}
+	_, err = favoriteRating(EnvVarKeyJellyfinFavorite)
+	report(err)
+	report(mediaServerUrlProblem(EnvVarKeyEmbyUrl, "emby", "http://localhost:8096/emby"))
+	if secrets != nil && (strings.TrimSpace(os.Getenv(EnvVarKeyEmbyUrl)) == "") != (secrets[EnvVarKeyEmbyApiKey] == "") {
+		report(fmt.Errorf("syncing the played status and favorites of emby takes both %s and %s", EnvVarKeyEmbyUrl, EnvVarKeyEmbyApiKey))
+	}
+	_, err = favoriteRating(EnvVarKeyEmbyFavorite)
+	report(err)
+	_, err = importColumns()
+	report(err)
+	report(mediaServerUrlProblem(EnvVarKeyKodiUrl, "kodi", "http://localhost:8080"))
+	if strings.TrimSpace(os.Getenv(EnvVarKeyKodiUrl)) != "" && strings.TrimSpace(os.Getenv(EnvVarKeyKodiLibraryPath)) != "" {
+		report(fmt.Errorf("kodi is read either through %s or from %s, set only one of them", EnvVarKeyKodiUrl, EnvVarKeyKodiLibraryPath))
+	}
+	if secrets != nil && (strings.TrimSpace(os.Getenv(EnvVarKeyStremioEmail)) == "") != (secrets[EnvVarKeyStremioPassword] == "") {
+		report(fmt.Errorf("signing in to stremio takes both %s and %s", EnvVarKeyStremioEmail, EnvVarKeyStremioPassword))
+	}
+	if secrets != nil && secrets[EnvVarKeyStremioAuthKey] != "" && strings.TrimSpace(os.Getenv(EnvVarKeyStremioEmail)) != "" {
+		report(fmt.Errorf("stremio is signed in either with %s or with %s, set only one of them", EnvVarKeyStremioAuthKey, EnvVarKeyStremioEmail))
+	}
+	if os.Getenv(EnvVarKeyAnimeMappingUrl) != "" && !animeMappingEnabled(secrets) {
+		report(fmt.Errorf("%s only applies when %s is true, %s or %s is set, or %s is %s", EnvVarKeyAnimeMappingUrl, EnvVarKeyAnimeMapping, EnvVarKeyMalAccessToken, EnvVarKeyAniListToken, EnvVarKeySyncSource, syncSourceAniList))
+	}
+	if secrets != nil && (secrets[EnvVarKeyAirtableToken] == "") != (strings.TrimSpace(os.Getenv(EnvVarKeyAirtableBaseId)) == "") {
+		report(fmt.Errorf("pushing to airtable takes both %s and %s", EnvVarKeyAirtableToken, EnvVarKeyAirtableBaseId))
+	}
+	_, err = airtableFields()
+	report(err)
+	if secrets != nil && (secrets[EnvVarKeyGoogleSheetsCreds] == "") != (secrets[EnvVarKeyGoogleSheetsId] == "") {
+		report(fmt.Errorf("writing to google sheets takes both %s and %s", EnvVarKeyGoogleSheetsCreds, EnvVarKeyGoogleSheetsId))
+	}
+	if secrets != nil && (secrets[EnvVarKeyNotionToken] == "") != (secrets[EnvVarKeyNotionDatabaseId] == "") {
+		report(fmt.Errorf("pushing to notion takes both %s and %s", EnvVarKeyNotionToken, EnvVarKeyNotionDatabaseId))
+	}
+	if secrets != nil && secrets[EnvVarKeySimklAccessToken] != "" && !simklEnabled(secrets) {
+		report(fmt.Errorf("%s only applies along with %s", EnvVarKeySimklAccessToken, EnvVarKeySimklClientId))
+	}
+	if os.Getenv(EnvVarKeyTmdbFavorites) != "" && secrets != nil && !tmdbEnabled(secrets) {
+		report(fmt.Errorf("%s only applies when %s and %s are set", EnvVarKeyTmdbFavorites, EnvVarKeyTmdbApiKey, EnvVarKeyTmdbSessionId))
+	}
+	for _, eventsErr := range events.Validate() {
+		report(eventsErr)
+	}
+	report(sentry.ValidateDsn())
+	if value, ok := os.LookupEnv(EnvVarKeyRatingsConflict); ok && value != "" {
+		if !stringSliceContains(validRatingsConflictPolicies(), value) {
+			report(fmt.Errorf("failure using ratings conflict policy %s: valid policies are %s", value, strings.Join(validRatingsConflictPolicies(), ", ")))
+		}
+	}
+	problems = append(problems, listIdProblems()...)
+	problems = append(problems, combinationProblems()...)
+	problems = append(problems, configFileProblems()...)
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return problems[0]
+	default:
+		return &ConfigProblemsError{
+			problems: problems,
 		}
 	}
-	return nil
 }
 
 func traktListIsStray(imdbLists map[string]entities.ImdbList, traktListName string) bool {
@@ -325,3 +1660,161 @@ func traktListIsStray(imdbLists map[string]entities.ImdbList, traktListName stri
 	}
 	return true
 }
+
+// confirmPlan prints the changes planned for every target, dropping the removals and deletions the user does not confirm
+func (s *Syncer) confirmPlan(plan *entities.SyncPlan) (*entities.SyncPlan, error) {
+	confirmed := &entities.SyncPlan{
+		CreatedAt: plan.CreatedAt,
+	}
+	for _, group := range groupOperationsByTarget(plan.Operations) {
+		var destructive []entities.SyncOperation
+		for _, operation := range group {
+			fmt.Printf("%s\n", console.Colorize(os.Stdout, console.Bold, describeOperation(operation)))
+			color := operationColor(operation)
+			for i, item := range operation.Items {
+				if id, err := item.GetItemId(); err == nil && id != nil {
+					fmt.Printf("  %s\n", console.Colorize(os.Stdout, color, fmt.Sprintf("%s %s %s", operationSymbol(operation, i), item.Type, *id)))
+				}
+			}
+			if operation.Action == entities.SyncActionRemove || operation.Action == entities.SyncActionDelete {
+				destructive = append(destructive, operation)
+			}
+		}
+		approved := true
+		if len(destructive) > 0 {
+			var err error
+			approved, err = promptConfirmation(fmt.Sprintf("apply the removals from trakt %s?", targetLabel(destructive[0])))
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, operation := range group {
+			if !approved && (operation.Action == entities.SyncActionRemove || operation.Action == entities.SyncActionDelete) {
+				s.logger.Info(fmt.Sprintf("skipping operation to %s as it was not confirmed", describeOperation(operation)))
+				continue
+			}
+			confirmed.Operations = append(confirmed.Operations, operation)
+		}
+	}
+	return confirmed, nil
+}
+
+func operationSymbol(operation entities.SyncOperation, index int) string {
+	switch operation.Action {
+	case entities.SyncActionAdd:
+		return "+"
+	case entities.SyncActionReorder:
+		return fmt.Sprintf("%d.", index+1)
+	default:
+		return "-"
+	}
+}
+
+// operationColor highlights additions in green and removals in red when the changes are printed to a terminal
+func operationColor(operation entities.SyncOperation) string {
+	switch operation.Action {
+	case entities.SyncActionAdd, entities.SyncActionCreate:
+		return console.Green
+	case entities.SyncActionRemove, entities.SyncActionDelete:
+		return console.Red
+	default:
+		return console.Yellow
+	}
+}
+
+func promptConfirmation(message string) (bool, error) {
+	fmt.Printf("%s [y/N]: ", message)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failure reading confirmation from stdin: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func stringSliceContains(slice []string, element string) bool {
+	for i := range slice {
+		if slice[i] == element {
+			return true
+		}
+	}
+	return false
+}
+
+func validRatingsConflictPolicies() []string {
+	return []string{
+		ratingsConflictPolicyImdb,
+		ratingsConflictPolicyHigher,
+		ratingsConflictPolicyNewer,
+		ratingsConflictPolicyTrakt,
+		ratingsConflictPolicyPrompt,
+	}
+}
+
+func describeOperation(operation entities.SyncOperation) string {
+	switch operation.Action {
+	case entities.SyncActionCreate, entities.SyncActionDelete:
+		return fmt.Sprintf("%s trakt list %s", operation.Action, operation.ListSlug)
+	}
+	if operation.Target == entities.SyncTargetList {
+		return fmt.Sprintf("%s %d item(s) of trakt list %s", operation.Action, len(operation.Items), operation.ListSlug)
+	}
+	return fmt.Sprintf("%s %d item(s) of trakt %s", operation.Action, len(operation.Items), operation.Target)
+}
+
+func writePlan(path string, plan *entities.SyncPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failure marshalling sync plan: %w", err)
+	}
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing sync plan to %s: %w", path, err)
+	}
+	return nil
+}
+
+func readPlan(path string) (*entities.SyncPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading sync plan from %s: %w", path, err)
+	}
+	var plan entities.SyncPlan
+	if err = json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling sync plan: %w", err)
+	}
+	return &plan, nil
+}
+
+func isListTarget(operation entities.SyncOperation) bool {
+	return operation.Target == entities.SyncTargetList || operation.Target == entities.SyncTargetWatchlist
+}
+
+func targetLabel(operation entities.SyncOperation) string {
+	if operation.Target == entities.SyncTargetList {
+		return fmt.Sprintf("list %s", operation.ListSlug)
+	}
+	return operation.Target
+}
+
+func listLabel(operation entities.SyncOperation) string {
+	if operation.Target == entities.SyncTargetWatchlist {
+		return entities.SyncTargetWatchlist
+	}
+	return operation.ListSlug
+}
+
+// parseSince parses a point in time given either as a date (2006-01-02), a number of days (90d) or a duration (72h)
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		return now.Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("failure parsing %s as a point in time: expected a date like 2006-01-02, a number of days like 90d or a duration like 72h", value)
+}
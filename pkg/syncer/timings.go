@@ -0,0 +1,80 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	stepImdb    = "imdb"
+	stepTrakt   = "trakt"
+	stepRatings = "ratings"
+	stepHistory = "history"
+	stepLists   = "lists"
+)
+
+var phaseOrder = map[string]int{
+	PhaseHydrate: 0,
+	PhasePlan:    1,
+	PhaseApply:   2,
+}
+
+// runTimings collects the time spent on every phase of a run and on the steps within it,
+// such as fetching the imdb data or applying the changes of a single list
+type runTimings struct {
+	mutex   sync.Mutex
+	entries []entities.Timing
+}
+
+func (t *runTimings) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.entries = nil
+}
+
+// record adds the time elapsed since start to a step of the phase, or to the phase as a whole when the step is empty
+func (t *runTimings) record(phase, step string, start time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.entries = append(t.entries, entities.Timing{
+		Phase:   phase,
+		Step:    step,
+		Seconds: time.Since(start).Seconds(),
+	})
+}
+
+// list returns the timings in the order of the phases, each phase followed by its slowest steps
+func (t *runTimings) list() []entities.Timing {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	timings := append([]entities.Timing(nil), t.entries...)
+	sort.SliceStable(timings, func(i, j int) bool {
+		if timings[i].Phase != timings[j].Phase {
+			return phaseOrder[timings[i].Phase] < phaseOrder[timings[j].Phase]
+		}
+		if (timings[i].Step == "") != (timings[j].Step == "") {
+			return timings[i].Step == ""
+		}
+		return timings[i].Seconds > timings[j].Seconds
+	})
+	return timings
+}
+
+// recordTimings attaches the time spent on every phase and list to the summary,
+// showing whether fetching from imdb or writing to trakt dominates a slow run
+func (s *Syncer) recordTimings(summary *entities.SyncSummary) {
+	summary.Timings = s.timings.list()
+	fields := make([]zap.Field, 0, len(phaseOrder))
+	for _, timing := range summary.Timings {
+		if timing.Step == "" {
+			fields = append(fields, zap.Duration(timing.Phase, timing.Duration()))
+			continue
+		}
+		s.logger.Debug(fmt.Sprintf("time spent on %s during %s", timing.Step, timing.Phase), zap.Duration("duration", timing.Duration()))
+	}
+	s.logger.Info("time spent per phase", fields...)
+}
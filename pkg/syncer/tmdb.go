@@ -0,0 +1,247 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTmdbIdsPath = "tmdb-ids.json"
+
+	stepTmdb = "tmdb"
+)
+
+// tmdbIds caches the tmdb ids of imdb ids across runs, as tmdb has to be searched for each of them.
+// Ids unknown to tmdb are cached as nil, so they are not searched again.
+type tmdbIds struct {
+	path  string
+	Items map[string]*entities.TmdbItem `json:"items"`
+}
+
+func TmdbIdsPath() string {
+	return StatePath(defaultTmdbIdsPath)
+}
+
+func newTmdbClient(secrets map[string]string, logger *zap.Logger) (client.TmdbClientInterface, error) {
+	return client.NewTmdbClient(
+		client.TmdbConfig{
+			ApiKey:    secrets[EnvVarKeyTmdbApiKey],
+			SessionId: secrets[EnvVarKeyTmdbSessionId],
+			SyncMode:  os.Getenv(EnvVarKeySyncMode),
+			SyncModeOverrides: map[string]string{
+				entities.SyncTargetList:      os.Getenv(EnvVarKeySyncModeLists),
+				entities.SyncTargetWatchlist: os.Getenv(EnvVarKeySyncModeWatchlist),
+			},
+		},
+		logger,
+	)
+}
+
+// tmdbEnabled reports whether the imdb lists are mirrored into tmdb, which takes both an api key and a session
+func tmdbEnabled(secrets map[string]string) bool {
+	return secrets[EnvVarKeyTmdbApiKey] != "" && secrets[EnvVarKeyTmdbSessionId] != ""
+}
+
+func loadTmdbIds(path string) (*tmdbIds, error) {
+	ids := &tmdbIds{
+		path:  path,
+		Items: make(map[string]*entities.TmdbItem),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failure reading tmdb ids from %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, ids); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling tmdb ids: %w", err)
+	}
+	if ids.Items == nil {
+		ids.Items = make(map[string]*entities.TmdbItem)
+	}
+	return ids, nil
+}
+
+func (i *tmdbIds) save() error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("failure marshalling tmdb ids: %w", err)
+	}
+	if err = os.WriteFile(i.path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing tmdb ids to %s: %w", i.path, err)
+	}
+	return nil
+}
+
+// mirrorTmdb mirrors the imdb lists into tmdb alongside trakt: the watchlist into the tmdb watchlist,
+// the list set through TMDB_FAVORITES_LIST_ID into the favorites, and every other list into a tmdb list of the same name,
+// which is created when missing. It returns the names of the lists that failed to mirror.
+func (s *Syncer) mirrorTmdb() []string {
+	if s.tmdbClient == nil {
+		return nil
+	}
+	start := time.Now()
+	defer s.timings.record(PhaseApply, stepTmdb, start)
+	ids, err := loadTmdbIds(TmdbIdsPath())
+	if err != nil {
+		s.logger.Warn("failure loading tmdb ids, searching tmdb for every item", zap.Error(err))
+		ids = &tmdbIds{
+			path:  TmdbIdsPath(),
+			Items: make(map[string]*entities.TmdbItem),
+		}
+	}
+	defer func() {
+		if err := ids.save(); err != nil {
+			s.logger.Warn("failure saving tmdb ids", zap.Error(err))
+		}
+	}()
+	imdbLists := make([]entities.ImdbList, 0, len(s.user.imdbLists))
+	for _, imdbList := range s.user.imdbLists {
+		imdbLists = append(imdbLists, imdbList)
+	}
+	sort.Slice(imdbLists, func(i, j int) bool {
+		return imdbLists[i].ListName < imdbLists[j].ListName
+	})
+	var (
+		failed       []string
+		tmdbLists    []entities.TmdbList
+		listsErr     error
+		listsFetched bool
+	)
+	for _, imdbList := range imdbLists {
+		if s.ctx.Err() != nil {
+			return failed
+		}
+		items, err := s.resolveTmdbItems(ids, imdbList.ListItems)
+		if err == nil {
+			switch {
+			case imdbList.IsWatchlist:
+				err = s.mirrorTmdbAccountList(entities.TmdbAccountListWatchlist, items)
+			case imdbList.ListId == s.tmdbFavoritesListId:
+				err = s.mirrorTmdbAccountList(entities.TmdbAccountListFavorite, items)
+			default:
+				if !listsFetched {
+					tmdbLists, listsErr = s.tmdbClient.ListsGet()
+					listsFetched = true
+				}
+				if err = listsErr; err == nil {
+					err = s.mirrorTmdbList(tmdbLists, imdbList, items)
+				}
+			}
+		}
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("failure mirroring imdb list %s into tmdb", imdbList.ListName), zap.Error(err))
+			failed = append(failed, fmt.Sprintf("tmdb %s", imdbList.ListName))
+		}
+	}
+	return failed
+}
+
+// resolveTmdbItems looks up the tmdb ids of the items, leaving out those tmdb does not know, such as episodes
+func (s *Syncer) resolveTmdbItems(ids *tmdbIds, imdbItems []entities.ImdbItem) ([]entities.TmdbItem, error) {
+	items := make([]entities.TmdbItem, 0, len(imdbItems))
+	for _, imdbItem := range imdbItems {
+		item, ok := ids.Items[imdbItem.Id]
+		if !ok {
+			var err error
+			if item, err = s.tmdbClient.FindByImdbId(imdbItem.Id); err != nil {
+				return nil, fmt.Errorf("failure finding tmdb id of %s: %w", imdbItem.Id, err)
+			}
+			ids.Items[imdbItem.Id] = item
+		}
+		if item != nil {
+			items = append(items, *item)
+		}
+	}
+	return items, nil
+}
+
+func (s *Syncer) mirrorTmdbAccountList(accountList string, items []entities.TmdbItem) error {
+	current, err := s.tmdbClient.AccountListGet(accountList)
+	if err != nil {
+		return err
+	}
+	add, remove := tmdbDifference(items, current)
+	if len(add) > 0 {
+		if err = s.tmdbClient.AccountListItemsAdd(accountList, add); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		if err = s.tmdbClient.AccountListItemsRemove(accountList, remove); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorTmdbList mirrors the movies of an imdb list, as the lists of version 3 of the tmdb api cannot hold shows
+func (s *Syncer) mirrorTmdbList(tmdbLists []entities.TmdbList, imdbList entities.ImdbList, items []entities.TmdbItem) error {
+	var movies []entities.TmdbItem
+	for _, item := range items {
+		if item.MediaType == entities.TmdbMediaTypeMovie {
+			movies = append(movies, item)
+		}
+	}
+	var tmdbList *entities.TmdbList
+	for i := range tmdbLists {
+		if strings.EqualFold(tmdbLists[i].Name, imdbList.ListName) {
+			var err error
+			if tmdbList, err = s.tmdbClient.ListGet(tmdbLists[i].Id); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if tmdbList == nil {
+		created, err := s.tmdbClient.ListAdd(imdbList.ListName, fmt.Sprintf("Synced from imdb list %s", imdbList.ListId))
+		if err != nil || created == nil {
+			return err
+		}
+		tmdbList = created
+	}
+	add, remove := tmdbDifference(movies, tmdbList.Items)
+	if len(add) > 0 {
+		if err := s.tmdbClient.ListItemsAdd(tmdbList.Id, add); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		if err := s.tmdbClient.ListItemsRemove(tmdbList.Id, remove); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tmdbDifference returns the items missing from current, followed by the items of current that are not wanted
+func tmdbDifference(wanted, current []entities.TmdbItem) (add, remove []entities.TmdbItem) {
+	currentKeys := make(map[string]bool, len(current))
+	for _, item := range current {
+		currentKeys[tmdbItemKey(item)] = true
+	}
+	wantedKeys := make(map[string]bool, len(wanted))
+	for _, item := range wanted {
+		if k := tmdbItemKey(item); !wantedKeys[k] {
+			wantedKeys[k] = true
+			if !currentKeys[k] {
+				add = append(add, item)
+			}
+		}
+	}
+	for _, item := range current {
+		if !wantedKeys[tmdbItemKey(item)] {
+			remove = append(remove, item)
+		}
+	}
+	return add, remove
+}
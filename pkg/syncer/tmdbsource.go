@@ -0,0 +1,194 @@
+package syncer
+
+import (
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+)
+
+const (
+	syncSourceAniList = "anilist"
+	syncSourceImdb    = "imdb"
+	syncSourceTmdb    = "tmdb"
+
+	tmdbWatchlistId = "tmdb-watchlist"
+)
+
+func validSyncSources() []string {
+	return []string{syncSourceImdb, syncSourceTmdb, syncSourceAniList}
+}
+
+// SyncSource returns the account the targets are fed from, which is imdb unless SYNC_SOURCE says otherwise
+func SyncSource() string {
+	if source := strings.ToLower(strings.TrimSpace(os.Getenv(EnvVarKeySyncSource))); source != "" {
+		return source
+	}
+	return syncSourceImdb
+}
+
+// tmdbSource feeds the targets from the watchlist, ratings and lists of a tmdb account in place of imdb.
+// Its items are converted to imdb items through their imdb ids, so the rest of the sync is unaware of the source.
+type tmdbSource struct {
+	client      client.TmdbClientInterface
+	ids         *tmdbIds
+	imdbIds     map[string]string
+	logger      *zap.Logger
+	invalidRows []entities.ItemFailure
+}
+
+func newTmdbSource(tmdbClient client.TmdbClientInterface, logger *zap.Logger) *tmdbSource {
+	ids, err := loadTmdbIds(TmdbIdsPath())
+	if err != nil {
+		logger.Warn("failure loading tmdb ids, looking up the imdb id of every item", zap.Error(err))
+		ids = &tmdbIds{
+			path:  TmdbIdsPath(),
+			Items: make(map[string]*entities.TmdbItem),
+		}
+	}
+	source := &tmdbSource{
+		client:  tmdbClient,
+		ids:     ids,
+		imdbIds: make(map[string]string, len(ids.Items)),
+		logger:  logger,
+	}
+	for imdbId, item := range ids.Items {
+		if item != nil {
+			source.imdbIds[tmdbItemKey(*item)] = imdbId
+		}
+	}
+	return source
+}
+
+func tmdbItemKey(item entities.TmdbItem) string {
+	return fmt.Sprintf("%s/%d", item.MediaType, item.Id)
+}
+
+func (ts *tmdbSource) ListGet(listId string) (*entities.ImdbList, error) {
+	tmdbList, err := ts.client.ListGet(listId)
+	if err != nil {
+		return nil, err
+	}
+	items, err := ts.imdbItems(tmdbList.Items, entities.SyncTargetList, tmdbList.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &entities.ImdbList{
+		ListId:        tmdbList.Id,
+		ListName:      tmdbList.Name,
+		ListItems:     items,
+		TraktListSlug: entities.BuildTraktListSlug(tmdbList.Name),
+	}, nil
+}
+
+// ListsGet fetches the lists one by one, returning the lists that could be fetched along with the failures of the rest
+func (ts *tmdbSource) ListsGet(listIds []string) ([]entities.ImdbList, error) {
+	var (
+		lists  []entities.ImdbList
+		failed = make(map[string]error)
+	)
+	for _, listId := range listIds {
+		list, err := ts.ListGet(listId)
+		if err != nil {
+			failed[listId] = err
+			continue
+		}
+		lists = append(lists, *list)
+	}
+	if len(failed) > 0 {
+		return lists, &client.ListsFetchError{
+			Failed: failed,
+		}
+	}
+	return lists, nil
+}
+
+func (ts *tmdbSource) ListsGetAll() ([]entities.ImdbList, error) {
+	tmdbLists, err := ts.client.ListsGet()
+	if err != nil {
+		return nil, err
+	}
+	listIds := make([]string, 0, len(tmdbLists))
+	for _, tmdbList := range tmdbLists {
+		listIds = append(listIds, tmdbList.Id)
+	}
+	return ts.ListsGet(listIds)
+}
+
+func (ts *tmdbSource) WatchlistGet() (*entities.ImdbList, error) {
+	tmdbItems, err := ts.client.AccountListGet(entities.TmdbAccountListWatchlist)
+	if err != nil {
+		return nil, err
+	}
+	items, err := ts.imdbItems(tmdbItems, entities.SyncTargetWatchlist, "")
+	if err != nil {
+		return nil, err
+	}
+	return &entities.ImdbList{
+		ListId:      tmdbWatchlistId,
+		ListName:    "watchlist",
+		ListItems:   items,
+		IsWatchlist: true,
+	}, nil
+}
+
+func (ts *tmdbSource) RatingsGet() ([]entities.ImdbItem, error) {
+	tmdbItems, err := ts.client.AccountListGet(entities.TmdbAccountListRated)
+	if err != nil {
+		return nil, err
+	}
+	return ts.imdbItems(tmdbItems, entities.SyncTargetRatings, "")
+}
+
+func (ts *tmdbSource) UserIdScrape() error {
+	return nil
+}
+
+func (ts *tmdbSource) WatchlistIdScrape() error {
+	return nil
+}
+
+// InvalidRows returns the items left out since the source was created, as tmdb does not know their imdb id
+func (ts *tmdbSource) InvalidRows() []entities.ItemFailure {
+	return append([]entities.ItemFailure(nil), ts.invalidRows...)
+}
+
+// imdbItems converts tmdb items to imdb items, looking up the imdb ids missing from the cache and saving them for the next run
+func (ts *tmdbSource) imdbItems(tmdbItems []entities.TmdbItem, target, listName string) ([]entities.ImdbItem, error) {
+	items := make([]entities.ImdbItem, 0, len(tmdbItems))
+	lookedUp := false
+	for _, tmdbItem := range tmdbItems {
+		imdbId, ok := ts.imdbIds[tmdbItemKey(tmdbItem)]
+		if !ok {
+			var err error
+			if imdbId, err = ts.client.ImdbIdGet(tmdbItem); err != nil {
+				return nil, err
+			}
+			if imdbId != "" {
+				cached := entities.TmdbItem{Id: tmdbItem.Id, MediaType: tmdbItem.MediaType}
+				ts.ids.Items[imdbId] = &cached
+				ts.imdbIds[tmdbItemKey(tmdbItem)] = imdbId
+				lookedUp = true
+			}
+		}
+		if imdbId == "" {
+			ts.logger.Warn(fmt.Sprintf("skipping tmdb %s %d, as tmdb does not know its imdb id", tmdbItem.MediaType, tmdbItem.Id), zap.String("target", target))
+			ts.invalidRows = append(ts.invalidRows, entities.ItemFailure{
+				Target: target,
+				List:   listName,
+				Reason: entities.ItemFailureReasonNotFound,
+				Error:  fmt.Sprintf("tmdb %s %d has no imdb id", tmdbItem.MediaType, tmdbItem.Id),
+			})
+			continue
+		}
+		items = append(items, tmdbItem.ImdbItem(imdbId))
+	}
+	if lookedUp {
+		if err := ts.ids.save(); err != nil {
+			ts.logger.Warn("failure saving tmdb ids", zap.Error(err))
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,129 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"github.com/cecobask/imdb-trakt-sync/pkg/entities"
+	"github.com/cecobask/imdb-trakt-sync/pkg/logger"
+	"github.com/zalando/go-keyring"
+	"os"
+)
+
+const (
+	defaultTraktTokensPath = "trakt-tokens.json"
+	keyringTraktTokens     = "TRAKT_TOKENS"
+)
+
+// DefaultTraktClientId and DefaultTraktClientSecret identify the trakt application of published builds, which are set at build time, e.g.
+// go build -ldflags "-X github.com/cecobask/imdb-trakt-sync/pkg/syncer.DefaultTraktClientId=<id> -X github.com/cecobask/imdb-trakt-sync/pkg/syncer.DefaultTraktClientSecret=<secret>" ./cmd/syncer
+// The built-in application is used when TRAKT_CLIENT_ID and TRAKT_CLIENT_SECRET are both unset, and only with the tokens
+// of the auth command, since signing in with the trakt email and password requires an application of your own.
+var (
+	DefaultTraktClientId     = ""
+	DefaultTraktClientSecret = ""
+)
+
+// HasDefaultTraktApp reports whether the build embeds a trakt application, which spares creating one of your own
+func HasDefaultTraktApp() bool {
+	return DefaultTraktClientId != "" && DefaultTraktClientSecret != ""
+}
+
+// applyDefaultTraktApp fills in the built-in trakt application when no application of your own is configured, reporting whether it did
+func applyDefaultTraktApp(secrets map[string]string) bool {
+	if !HasDefaultTraktApp() {
+		return false
+	}
+	if secrets[EnvVarKeyTraktClientId] != "" || secrets[EnvVarKeyTraktClientSecret] != "" {
+		return false
+	}
+	secrets[EnvVarKeyTraktClientId] = DefaultTraktClientId
+	secrets[EnvVarKeyTraktClientSecret] = DefaultTraktClientSecret
+	return true
+}
+
+func TraktTokensPath() string {
+	if path := os.Getenv(EnvVarKeyTraktTokensPath); path != "" {
+		return path
+	}
+	return StatePath(defaultTraktTokensPath)
+}
+
+// AuthorizeTrakt runs the trakt device flow once and stores the tokens, so that unattended syncs never need the trakt password
+func AuthorizeTrakt(prompt func(codes *entities.TraktAuthCodesResponse)) error {
+	secrets, err := readSecrets()
+	if err != nil {
+		return &ConfigError{err: err}
+	}
+	applyDefaultTraktApp(secrets)
+	var missing []string
+	for _, key := range []string{EnvVarKeyTraktClientId, EnvVarKeyTraktClientSecret} {
+		if secrets[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return &ConfigError{err: &MissingEnvironmentVariablesError{variables: missing}}
+	}
+	tokens, err := client.AuthorizeDevice(
+		client.TraktConfig{
+			ClientId:     secrets[EnvVarKeyTraktClientId],
+			ClientSecret: secrets[EnvVarKeyTraktClientSecret],
+		},
+		logger.NewLogger(),
+		prompt,
+	)
+	if err != nil {
+		return err
+	}
+	return saveTraktTokens(tokens)
+}
+
+// loadTraktTokens returns the stored trakt tokens, or nil when the auth command was never run
+func loadTraktTokens() (*entities.TraktAuthTokensResponse, error) {
+	var data []byte
+	if os.Getenv(EnvVarKeyCredentialStore) == credentialStoreKeyring {
+		value, err := keyring.Get(keyringServiceName(), keyringTraktTokens)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure reading trakt tokens from the keyring: %w", err)
+		}
+		data = []byte(value)
+	} else {
+		path := TraktTokensPath()
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failure reading trakt tokens from %s: %w", path, err)
+		}
+	}
+	tokens := &entities.TraktAuthTokensResponse{}
+	if err := json.Unmarshal(data, tokens); err != nil {
+		return nil, fmt.Errorf("failure unmarshalling trakt tokens: %w", err)
+	}
+	logger.AddSecrets(tokens.AccessToken, tokens.RefreshToken)
+	return tokens, nil
+}
+
+func saveTraktTokens(tokens *entities.TraktAuthTokensResponse) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("failure marshalling trakt tokens: %w", err)
+	}
+	if os.Getenv(EnvVarKeyCredentialStore) == credentialStoreKeyring {
+		if err = keyring.Set(keyringServiceName(), keyringTraktTokens, string(data)); err != nil {
+			return fmt.Errorf("failure storing trakt tokens in the keyring: %w", err)
+		}
+		return nil
+	}
+	path := TraktTokensPath()
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failure writing trakt tokens to %s: %w", path, err)
+	}
+	return nil
+}
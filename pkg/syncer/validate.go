@@ -0,0 +1,141 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/client"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Check is the outcome of a single preflight check, with a hint on how to fix it when it failed
+type Check struct {
+	Name string
+	Err  error
+	Hint string
+}
+
+// Validate checks that trakt and imdb can be reached with the configured credentials and that every configured list is accessible,
+// without changing anything
+func (s *Syncer) Validate() []Check {
+	_, traktErr := s.traktClient.ListsMetadataGet()
+	_, watchlistErr := s.imdbClient.WatchlistGet()
+	_, ratingsErr := s.imdbClient.RatingsGet()
+	source, sourceHint := SyncSource(), fmt.Sprintf("refresh %s and %s by signing in to imdb again", EnvVarKeyCookieAtMain, EnvVarKeyCookieUbidMain)
+	switch source {
+	case syncSourceTmdb:
+		sourceHint = fmt.Sprintf("check that %s and %s belong to the tmdb account", EnvVarKeyTmdbApiKey, EnvVarKeyTmdbSessionId)
+	case syncSourceAniList:
+		sourceHint = fmt.Sprintf("create a new %s, as anilist access tokens expire after a year", EnvVarKeyAniListToken)
+	}
+	checks := []Check{
+		{
+			Name: "trakt api access",
+			Err:  traktErr,
+			Hint: fmt.Sprintf("check that %s and %s belong to an existing trakt api application", EnvVarKeyTraktClientId, EnvVarKeyTraktClientSecret),
+		},
+		{
+			Name: fmt.Sprintf("%s watchlist access", source),
+			Err:  watchlistErr,
+			Hint: sourceHint,
+		},
+		{
+			Name: fmt.Sprintf("%s ratings access", source),
+			Err:  ratingsErr,
+			Hint: sourceHint,
+		},
+	}
+	return append(checks, s.validateLists()...)
+}
+
+func (s *Syncer) validateLists() []Check {
+	if len(s.user.imdbLists) == 0 {
+		_, err := s.imdbClient.ListsGetAll()
+		return []Check{
+			{
+				Name: fmt.Sprintf("%s lists access", SyncSource()),
+				Err:  err,
+				Hint: "make sure every imdb list can be exported from the imdb website",
+			},
+		}
+	}
+	listIds := make([]string, 0, len(s.user.imdbLists))
+	for listId := range s.user.imdbLists {
+		listIds = append(listIds, listId)
+	}
+	sort.Strings(listIds)
+	checks := make([]Check, 0, len(listIds))
+	for _, listId := range listIds {
+		_, err := s.imdbClient.ListGet(listId)
+		var apiError *client.ApiError
+		hint := "make sure the list can be exported from the imdb website"
+		if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
+			hint = fmt.Sprintf("remove the list from %s or %s, or make it public", EnvVarKeyListIds, EnvVarKeyListMerges)
+		}
+		checks = append(checks, Check{
+			Name: fmt.Sprintf("%s list %s access", SyncSource(), listId),
+			Err:  err,
+			Hint: hint,
+		})
+	}
+	return checks
+}
+
+// CheckStateFiles checks that the retry queue, run statistics, run history, audit log, failure report and file target can be written, without contacting imdb or trakt
+func CheckStateFiles() []Check {
+	states := []struct {
+		name string
+		path string
+		key  string
+	}{
+		{name: "retry queue", path: RetryQueuePath(), key: EnvVarKeyRetryQueuePath},
+		{name: "run stats", path: RunStatsPath(), key: EnvVarKeyRunStatsPath},
+		{name: "run history", path: RunHistoryDir(), key: EnvVarKeyRunHistoryDir},
+		{name: "audit log", path: AuditLogPath(), key: EnvVarKeyAuditLogPath},
+		{name: "failure report", path: FailureReportPath(), key: EnvVarKeyFailureReportPath},
+		{name: "tmdb ids", path: TmdbIdsPath(), key: EnvVarKeyStateDir},
+		{name: "anime ids", path: AnimeIdsPath(), key: EnvVarKeyStateDir},
+		{name: "file target", path: os.Getenv(EnvVarKeyFileTargetPath), key: EnvVarKeyFileTargetPath},
+	}
+	checks := make([]Check, 0, len(states))
+	for _, state := range states {
+		if state.path == "" {
+			continue
+		}
+		checks = append(checks, Check{
+			Name: fmt.Sprintf("%s directory writable", state.name),
+			Err:  checkWritableDir(filepath.Dir(state.path)),
+			Hint: fmt.Sprintf("make sure the directory exists and is writable, or point %s elsewhere", state.key),
+		})
+	}
+	return checks
+}
+
+func checkWritableDir(dir string) error {
+	file, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return fmt.Errorf("failure writing to directory %s: %w", dir, err)
+	}
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
+
+// AuthHint returns a hint on how to fix an authentication failure returned when creating a syncer
+func AuthHint(err error) string {
+	var authError *client.AuthError
+	if !errors.As(err, &authError) {
+		return ""
+	}
+	switch authError.ClientName() {
+	case "imdb":
+		return fmt.Sprintf("refresh %s and %s by signing in to imdb again", EnvVarKeyCookieAtMain, EnvVarKeyCookieUbidMain)
+	case "anilist":
+		return fmt.Sprintf("create a new %s, as anilist access tokens expire after a year", EnvVarKeyAniListToken)
+	case "stremio":
+		return fmt.Sprintf("check %s and %s, or set %s from a signed in session", EnvVarKeyStremioEmail, EnvVarKeyStremioPassword, EnvVarKeyStremioAuthKey)
+	default:
+		return fmt.Sprintf("check %s, %s, %s and %s, or run the auth command again", EnvVarKeyTraktClientId, EnvVarKeyTraktClientSecret, EnvVarKeyTraktEmail, EnvVarKeyTraktPassword)
+	}
+}
@@ -0,0 +1,274 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cecobask/imdb-trakt-sync/pkg/version"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EnvVarKeyOtlpEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	EnvVarKeyOtlpHeaders        = "OTEL_EXPORTER_OTLP_HEADERS"
+	EnvVarKeyOtlpTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	EnvVarKeyServiceName        = "OTEL_SERVICE_NAME"
+
+	defaultServiceName  = "imdb-trakt-sync"
+	exportBatchSize     = 1000
+	exportTimeout       = 30 * time.Second
+	instrumentationName = "github.com/cecobask/imdb-trakt-sync"
+	tracesPath          = "/v1/traces"
+
+	spanKindInternal = 1
+	spanKindClient   = 3
+	statusCodeError  = 2
+)
+
+// Span is a timed operation of a run, which is a no-op when tracing is disabled
+type Span struct {
+	traceId    string
+	spanId     string
+	parentId   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes []Attribute
+	err        error
+}
+
+// Attribute annotates a span with a string or integer value
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+var (
+	mutex    sync.Mutex
+	root     *Span
+	finished []*Span
+)
+
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Enabled reports whether spans are exported to an otlp endpoint, set through the standard opentelemetry variables
+func Enabled() bool {
+	return tracesEndpoint() != ""
+}
+
+// StartRun starts the root span of a new trace, which parents the spans started without a parent until it ends
+func StartRun(name string, attributes ...Attribute) *Span {
+	if !Enabled() {
+		return nil
+	}
+	span := &Span{
+		traceId:    randomHex(16),
+		spanId:     randomHex(8),
+		name:       name,
+		kind:       spanKindInternal,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	root = span
+	return span
+}
+
+// Start starts a child span of parent, or of the root span of the run when parent is nil
+func Start(parent *Span, name string, attributes ...Attribute) *Span {
+	if parent == nil {
+		mutex.Lock()
+		parent = root
+		mutex.Unlock()
+	}
+	if parent == nil {
+		return nil
+	}
+	return &Span{
+		traceId:    parent.traceId,
+		spanId:     randomHex(8),
+		parentId:   parent.spanId,
+		name:       name,
+		kind:       spanKindInternal,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+}
+
+// RecordRequest records an http request that already completed as a client span of the run
+func RecordRequest(service, method, url string, statusCode int, start time.Time) {
+	span := Start(nil, fmt.Sprintf("%s %s", service, method),
+		String("peer.service", service),
+		String("http.request.method", method),
+		String("url.full", url),
+		Int("http.response.status_code", statusCode),
+	)
+	if span == nil {
+		return
+	}
+	span.kind = spanKindClient
+	span.start = start
+	var err error
+	if statusCode >= http.StatusBadRequest {
+		err = fmt.Errorf("unexpected status code %d", statusCode)
+	}
+	span.End(err)
+}
+
+// SetAttributes adds attributes known once the span started
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// End finishes the span, marking it as failed when err is not nil
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	mutex.Lock()
+	defer mutex.Unlock()
+	finished = append(finished, s)
+	if s == root {
+		root = nil
+	}
+}
+
+// Flush exports the finished spans to the otlp endpoint as json
+func Flush() error {
+	mutex.Lock()
+	spans := finished
+	finished = nil
+	mutex.Unlock()
+	for start := 0; start < len(spans); start += exportBatchSize {
+		end := start + exportBatchSize
+		if end > len(spans) {
+			end = len(spans)
+		}
+		if err := export(spans[start:end]); err != nil {
+			return fmt.Errorf("failure exporting traces to %s: %w", tracesEndpoint(), err)
+		}
+	}
+	return nil
+}
+
+// tracesEndpoint returns the url traces are posted to, following the opentelemetry conventions for otlp over http
+func tracesEndpoint() string {
+	if endpoint := os.Getenv(EnvVarKeyOtlpTracesEndpoint); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv(EnvVarKeyOtlpEndpoint); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + tracesPath
+	}
+	return ""
+}
+
+func export(spans []*Span) error {
+	serviceName := os.Getenv(EnvVarKeyServiceName)
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, span.encode())
+	}
+	payload := map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": encodeAttributes([]Attribute{
+					String("service.name", serviceName),
+					String("service.version", version.Version),
+				}),
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": instrumentationName, "version": version.Version},
+				"spans": encoded,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, tracesEndpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for _, pair := range strings.Split(os.Getenv(EnvVarKeyOtlpHeaders), ",") {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			request.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	client := &http.Client{Timeout: exportTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		details, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", response.StatusCode, strings.Join(strings.Fields(string(details)), " "))
+	}
+	return nil
+}
+
+// encode formats the span as in the json encoding of the otlp protocol
+func (s *Span) encode() map[string]interface{} {
+	encoded := map[string]interface{}{
+		"traceId":           s.traceId,
+		"spanId":            s.spanId,
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": fmt.Sprint(s.start.UnixNano()),
+		"endTimeUnixNano":   fmt.Sprint(s.end.UnixNano()),
+		"attributes":        encodeAttributes(s.attributes),
+	}
+	if s.parentId != "" {
+		encoded["parentSpanId"] = s.parentId
+	}
+	if s.err != nil {
+		encoded["status"] = map[string]interface{}{"code": statusCodeError, "message": s.err.Error()}
+	}
+	return encoded
+}
+
+func encodeAttributes(attributes []Attribute) []map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(attributes))
+	for _, attribute := range attributes {
+		var value map[string]interface{}
+		switch v := attribute.Value.(type) {
+		case int:
+			value = map[string]interface{}{"intValue": fmt.Sprint(v)}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": attribute.Key, "value": value})
+	}
+	return encoded
+}
+
+func randomHex(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
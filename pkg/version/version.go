@@ -0,0 +1,48 @@
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Version, Commit and Date are set at build time, e.g.
+// go build -ldflags "-X github.com/cecobask/imdb-trakt-sync/pkg/version.Version=v1.2.3 -X github.com/cecobask/imdb-trakt-sync/pkg/version.Commit=$(git rev-parse HEAD) -X github.com/cecobask/imdb-trakt-sync/pkg/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/syncer
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// Get describes the build, falling back to the commit embedded by the go toolchain when no ldflags were set
+func Get() Info {
+	info := Info{
+		Version: Version,
+		Commit:  Commit,
+		Date:    Date,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+func String() string {
+	info := Get()
+	return fmt.Sprintf("%s (commit %s, built %s)", info.Version, info.Commit, info.Date)
+}